@@ -0,0 +1,281 @@
+// Package admin is the support-facing API for looking at and clearing
+// idempotency keys. It answers "what did we return for key X?" and lets
+// an engineer free a key a customer legitimately needs to reuse, or copy
+// every key to another gateway with a snapshot.
+package admin
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/GordenArcher/Idempotency-Gateway/config"
+	"github.com/GordenArcher/Idempotency-Gateway/models"
+	"github.com/GordenArcher/Idempotency-Gateway/snapshot"
+	"github.com/GordenArcher/Idempotency-Gateway/store"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 500
+)
+
+type Handler struct {
+	store store.Store
+	cfg   *config.Config
+	mux   *http.ServeMux
+}
+
+// NewHandler builds the /admin/keys and /admin/snapshot API on top of s.
+// Every route requires "Authorization: Bearer <cfg.AdminToken>".
+func NewHandler(s store.Store, cfg *config.Config) *Handler {
+	h := &Handler{store: s, cfg: cfg, mux: http.NewServeMux()}
+
+	h.mux.HandleFunc("GET /admin/keys", h.listKeys)
+	h.mux.HandleFunc("POST /admin/keys/purge", h.purgeKeys)
+	// {key...} so keys containing slashes still resolve.
+	h.mux.HandleFunc("GET /admin/keys/{key...}", h.getKey)
+	h.mux.HandleFunc("DELETE /admin/keys/{key...}", h.deleteKey)
+	h.mux.HandleFunc("GET /admin/snapshot", h.exportSnapshot)
+	h.mux.HandleFunc("POST /admin/snapshot", h.importSnapshot)
+
+	return h
+}
+
+// Handle adds another route behind the admin token, for operator views that
+// live outside this package, like the ledger.
+func (h *Handler) Handle(pattern string, handler http.Handler) {
+	h.mux.Handle(pattern, handler)
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !h.authorized(r) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+		writeError(w, http.StatusUnauthorized, "missing or invalid admin token")
+		return
+	}
+	h.mux.ServeHTTP(w, r)
+}
+
+// authorized compares hashes of the tokens in constant time so the
+// response time doesn't leak how much of the token was right.
+func (h *Handler) authorized(r *http.Request) bool {
+	if h.cfg.AdminToken == "" {
+		return false
+	}
+	got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return false
+	}
+	want := sha256.Sum256([]byte(h.cfg.AdminToken))
+	have := sha256.Sum256([]byte(got))
+	return subtle.ConstantTimeCompare(want[:], have[:]) == 1
+}
+
+// keyView is how an entry is shown to support engineers.
+type keyView struct {
+	Key          string          `json:"key"`
+	State        models.KeyState `json:"state"`
+	Fingerprint  string          `json:"fingerprint"`
+	StatusCode   int             `json:"status_code,omitempty"`
+	ResponseBody any             `json:"response_body,omitempty"`
+	CreatedAt    time.Time       `json:"created_at"`
+	ExpiresAt    time.Time       `json:"expires_at"`
+}
+
+// view builds the JSON shape for an entry. The cached body is only
+// included on the single-key endpoint, listing thousands of full
+// payment responses isn't useful and is a lot of PII to hand out.
+func (h *Handler) view(key string, entry *models.CachedEntry, withBody bool) keyView {
+	created := time.Unix(entry.CreatedAt, 0).UTC()
+	v := keyView{
+		Key:         key,
+		State:       entry.State,
+		Fingerprint: entry.BodyHash,
+		StatusCode:  entry.StatusCode,
+		CreatedAt:   created,
+		ExpiresAt:   created.Add(h.cfg.KeyTTL),
+	}
+	if withBody && len(entry.ResponseBody) > 0 {
+		// Show JSON bodies as JSON, anything else as a plain string.
+		if json.Valid(entry.ResponseBody) {
+			v.ResponseBody = json.RawMessage(entry.ResponseBody)
+		} else {
+			v.ResponseBody = string(entry.ResponseBody)
+		}
+	}
+	return v
+}
+
+// getKey handles GET /admin/keys/{key}.
+func (h *Handler) getKey(w http.ResponseWriter, r *http.Request) {
+	key := r.PathValue("key")
+	entry := h.store.Get(key)
+	if entry == nil {
+		writeError(w, http.StatusNotFound, "idempotency key not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, h.view(key, entry, true))
+}
+
+// listKeys handles GET /admin/keys?state=&prefix=&limit=&cursor=.
+func (h *Handler) listKeys(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	state := models.KeyState(strings.ToUpper(q.Get("state")))
+	if state != "" && state != models.StateProcessing && state != models.StateComplete {
+		writeError(w, http.StatusBadRequest, "state must be PROCESSING or COMPLETE")
+		return
+	}
+
+	limit := defaultPageSize
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxPageSize {
+			writeError(w, http.StatusBadRequest, "limit must be between 1 and "+strconv.Itoa(maxPageSize))
+			return
+		}
+		limit = n
+	}
+
+	page := h.store.List(store.ListOptions{
+		Prefix: q.Get("prefix"),
+		State:  state,
+		After:  q.Get("cursor"),
+		Limit:  limit,
+	})
+
+	keys := make([]keyView, len(page.Entries))
+	for i, e := range page.Entries {
+		keys[i] = h.view(e.Key, e.Entry, false)
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"keys":        keys,
+		"next_cursor": page.NextCursor,
+	})
+}
+
+// deleteKey handles DELETE /admin/keys/{key}.
+// A PROCESSING key is refused unless ?force=true: its request is still
+// running, and freeing the key means a retry would run a second time.
+func (h *Handler) deleteKey(w http.ResponseWriter, r *http.Request) {
+	key := r.PathValue("key")
+	entry := h.store.Get(key)
+	if entry == nil {
+		writeError(w, http.StatusNotFound, "idempotency key not found")
+		return
+	}
+
+	if r.URL.Query().Get("force") == "true" {
+		h.store.Delete(key)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if entry.State == models.StateProcessing {
+		writeError(w, http.StatusConflict, "key is still PROCESSING, pass force=true to delete it anyway")
+		return
+	}
+
+	// Only the COMPLETE entry looked at above, not one that has been
+	// retried or rewritten since.
+	if !h.store.DeleteIf(key, store.DeleteCondition{State: models.StateComplete, CreatedBefore: entry.CreatedAt + 1}) {
+		writeError(w, http.StatusConflict, "key changed while it was being deleted, look at it again")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type purgeRequest struct {
+	Prefix    string `json:"prefix"`
+	OlderThan string `json:"older_than"` // Go duration, e.g. "2h"
+}
+
+// purgeKeys handles POST /admin/keys/purge.
+// At least one of prefix or older_than is required, so an empty body
+// can't wipe the whole store by accident. PROCESSING keys are never purged.
+func (h *Handler) purgeKeys(w http.ResponseWriter, r *http.Request) {
+	var req purgeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body, expected {prefix, older_than}")
+		return
+	}
+	if req.Prefix == "" && req.OlderThan == "" {
+		writeError(w, http.StatusBadRequest, "prefix or older_than is required")
+		return
+	}
+
+	var cutoff int64
+	if req.OlderThan != "" {
+		age, err := time.ParseDuration(req.OlderThan)
+		if err != nil || age <= 0 {
+			writeError(w, http.StatusBadRequest, "older_than must be a positive duration like \"2h\"")
+			return
+		}
+		cutoff = time.Now().Add(-age).Unix()
+	}
+
+	// The condition is checked again as each key is deleted, so one that
+	// went back to PROCESSING or was written again since the page was
+	// read is left alone.
+	cond := store.DeleteCondition{State: models.StateComplete, CreatedBefore: cutoff}
+	opts := store.ListOptions{Prefix: req.Prefix, State: models.StateComplete, Limit: maxPageSize}
+	purged := 0
+	for {
+		page := h.store.List(opts)
+		for _, e := range page.Entries {
+			if h.store.DeleteIf(e.Key, cond) {
+				purged++
+			}
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		opts.After = page.NextCursor
+	}
+
+	writeJSON(w, http.StatusOK, map[string]int{"purged": purged})
+}
+
+// exportSnapshot handles GET /admin/snapshot, streaming every key as a
+// snapshot file.
+func (h *Handler) exportSnapshot(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Content-Disposition", `attachment; filename="idempotency-snapshot.jsonl"`)
+
+	n, err := snapshot.Export(w, h.store, h.cfg.KeyTTL)
+	if err != nil {
+		// The status has gone out already. The file is cut short, and
+		// Import refuses anything that doesn't parse to the end.
+		slog.Error("snapshot export failed", "error", err, "exported", n)
+		return
+	}
+	slog.Info("snapshot exported", "keys", n)
+}
+
+// importSnapshot handles POST /admin/snapshot with a snapshot file as the body.
+func (h *Handler) importSnapshot(w http.ResponseWriter, r *http.Request) {
+	result, err := snapshot.Import(r.Body, h.store)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	slog.Info("snapshot imported", "imported", result.Imported, "skipped_expired", result.Expired,
+		"skipped_processing", result.Processing, "skipped_newer", result.Newer)
+	writeJSON(w, http.StatusOK, result)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
@@ -0,0 +1,323 @@
+package admin
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GordenArcher/Idempotency-Gateway/config"
+	"github.com/GordenArcher/Idempotency-Gateway/models"
+	"github.com/GordenArcher/Idempotency-Gateway/store"
+)
+
+const testToken = "s3cret-admin-token"
+
+func testHandler() (*store.MemoryStore, *Handler) {
+	cfg := &config.Config{KeyTTL: 24 * time.Hour, AdminToken: testToken}
+	s := store.NewMemoryStore(cfg.KeyTTL)
+	return s, NewHandler(s, cfg)
+}
+
+func completeEntry(createdAt time.Time) *models.CachedEntry {
+	return &models.CachedEntry{
+		State:        models.StateComplete,
+		BodyHash:     "fingerprint-abc",
+		StatusCode:   http.StatusCreated,
+		ResponseBody: []byte(`{"status":"success"}`),
+		CreatedAt:    createdAt.Unix(),
+	}
+}
+
+func do(h http.Handler, method, target, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+testToken)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w
+}
+
+func TestAdmin_RejectsMissingOrWrongToken(t *testing.T) {
+	_, h := testHandler()
+
+	for _, auth := range []string{"", "Bearer wrong", testToken} {
+		req := httptest.NewRequest(http.MethodGet, "/admin/keys", nil)
+		if auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("Authorization %q: expected 401, got %d", auth, w.Code)
+		}
+	}
+}
+
+func TestAdmin_HandledRoutesNeedTheToken(t *testing.T) {
+	_, h := testHandler()
+	h.Handle("GET /admin/ledger/balances", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/ledger/balances", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 without the token, got %d", w.Code)
+	}
+
+	if w := do(h, http.MethodGet, "/admin/ledger/balances", ""); w.Code != http.StatusOK {
+		t.Errorf("expected 200 with the token, got %d", w.Code)
+	}
+}
+
+func TestAdmin_EmptyTokenConfigDeniesEverything(t *testing.T) {
+	// An unset token must not mean "no auth".
+	h := NewHandler(store.NewMemoryStore(time.Hour), &config.Config{})
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/keys", nil)
+	req.Header.Set("Authorization", "Bearer ")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 with no configured token, got %d", w.Code)
+	}
+}
+
+func TestAdmin_GetKey_ReturnsStateFingerprintAndBody(t *testing.T) {
+	s, h := testHandler()
+	s.Set("order/123", completeEntry(time.Now()))
+
+	w := do(h, http.MethodGet, "/admin/keys/order/123", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d — %s", w.Code, w.Body.String())
+	}
+
+	var resp struct {
+		Key          string          `json:"key"`
+		State        string          `json:"state"`
+		Fingerprint  string          `json:"fingerprint"`
+		StatusCode   int             `json:"status_code"`
+		ResponseBody json.RawMessage `json:"response_body"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+
+	if resp.Key != "order/123" || resp.State != "COMPLETE" || resp.Fingerprint != "fingerprint-abc" {
+		t.Errorf("unexpected key view: %+v", resp)
+	}
+	if resp.StatusCode != http.StatusCreated {
+		t.Errorf("expected cached status 201, got %d", resp.StatusCode)
+	}
+	if string(resp.ResponseBody) != `{"status":"success"}` {
+		t.Errorf("expected cached body as JSON, got %s", resp.ResponseBody)
+	}
+}
+
+func TestAdmin_GetKey_UnknownReturns404(t *testing.T) {
+	_, h := testHandler()
+
+	if w := do(h, http.MethodGet, "/admin/keys/nope", ""); w.Code != http.StatusNotFound {
+		t.Errorf("expected 404, got %d", w.Code)
+	}
+}
+
+func TestAdmin_ListKeys_PaginatesAndFiltersByState(t *testing.T) {
+	s, h := testHandler()
+	s.Set("a", completeEntry(time.Now()))
+	s.Set("b", completeEntry(time.Now()))
+	s.Set("c", &models.CachedEntry{State: models.StateProcessing, CreatedAt: time.Now().Unix()})
+
+	var page struct {
+		Keys []struct {
+			Key string `json:"key"`
+		} `json:"keys"`
+		NextCursor string `json:"next_cursor"`
+	}
+
+	w := do(h, http.MethodGet, "/admin/keys?state=complete&limit=1", "")
+	json.Unmarshal(w.Body.Bytes(), &page)
+	if len(page.Keys) != 1 || page.Keys[0].Key != "a" || page.NextCursor != "a" {
+		t.Fatalf("unexpected first page: %s", w.Body.String())
+	}
+
+	w = do(h, http.MethodGet, "/admin/keys?state=complete&limit=1&cursor="+page.NextCursor, "")
+	page.NextCursor = ""
+	json.Unmarshal(w.Body.Bytes(), &page)
+	if len(page.Keys) != 1 || page.Keys[0].Key != "b" || page.NextCursor != "" {
+		t.Fatalf("unexpected second page: %s", w.Body.String())
+	}
+}
+
+func TestAdmin_ListKeys_RejectsBadParams(t *testing.T) {
+	_, h := testHandler()
+
+	for _, q := range []string{"?state=DONE", "?limit=0", "?limit=abc", "?limit=100000"} {
+		if w := do(h, http.MethodGet, "/admin/keys"+q, ""); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", q, w.Code)
+		}
+	}
+}
+
+func TestAdmin_DeleteKey(t *testing.T) {
+	s, h := testHandler()
+	s.Set("reuse-me", completeEntry(time.Now()))
+
+	if w := do(h, http.MethodDelete, "/admin/keys/reuse-me", ""); w.Code != http.StatusNoContent {
+		t.Fatalf("expected 204, got %d", w.Code)
+	}
+	if s.Get("reuse-me") != nil {
+		t.Error("expected key to be deleted")
+	}
+}
+
+func TestAdmin_DeleteKey_ProcessingNeedsForce(t *testing.T) {
+	// Deleting an in-flight key lets a retry run a second time,
+	// so it has to be asked for explicitly.
+	s, h := testHandler()
+	s.Set("in-flight", &models.CachedEntry{State: models.StateProcessing, CreatedAt: time.Now().Unix()})
+
+	if w := do(h, http.MethodDelete, "/admin/keys/in-flight", ""); w.Code != http.StatusConflict {
+		t.Errorf("expected 409 without force, got %d", w.Code)
+	}
+	if w := do(h, http.MethodDelete, "/admin/keys/in-flight?force=true", ""); w.Code != http.StatusNoContent {
+		t.Errorf("expected 204 with force, got %d", w.Code)
+	}
+}
+
+func TestAdmin_PurgeByPrefix(t *testing.T) {
+	s, h := testHandler()
+	s.Set("tenant-a:1", completeEntry(time.Now()))
+	s.Set("tenant-a:2", completeEntry(time.Now()))
+	s.Set("tenant-b:1", completeEntry(time.Now()))
+
+	w := do(h, http.MethodPost, "/admin/keys/purge", `{"prefix": "tenant-a:"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d — %s", w.Code, w.Body.String())
+	}
+	if !strings.Contains(w.Body.String(), `"purged":2`) {
+		t.Errorf("expected 2 purged, got %s", w.Body.String())
+	}
+	if s.Get("tenant-b:1") == nil {
+		t.Error("purge removed a key outside the prefix")
+	}
+}
+
+func TestAdmin_PurgeByAge_SkipsProcessing(t *testing.T) {
+	s, h := testHandler()
+	s.Set("old", completeEntry(time.Now().Add(-3*time.Hour)))
+	s.Set("new", completeEntry(time.Now()))
+	s.Set("old-inflight", &models.CachedEntry{State: models.StateProcessing, CreatedAt: time.Now().Add(-3 * time.Hour).Unix()})
+
+	w := do(h, http.MethodPost, "/admin/keys/purge", `{"older_than": "1h"}`)
+	if !strings.Contains(w.Body.String(), `"purged":1`) {
+		t.Errorf("expected 1 purged, got %s", w.Body.String())
+	}
+	if s.Get("old") != nil {
+		t.Error("expected old key to be purged")
+	}
+	if s.Get("new") == nil || s.Get("old-inflight") == nil {
+		t.Error("purge removed a fresh or PROCESSING key")
+	}
+}
+
+// racingStore moves key back to PROCESSING right after the handler has
+// read it, as a retry arriving at that moment would.
+type racingStore struct {
+	*store.MemoryStore
+	key string
+}
+
+func (rs *racingStore) reserve() {
+	rs.MemoryStore.Set(rs.key, &models.CachedEntry{State: models.StateProcessing, CreatedAt: time.Now().Unix()})
+}
+
+func (rs *racingStore) Get(key string) *models.CachedEntry {
+	entry := rs.MemoryStore.Get(key)
+	if key == rs.key {
+		rs.reserve()
+	}
+	return entry
+}
+
+func (rs *racingStore) List(opts store.ListOptions) store.ListResult {
+	page := rs.MemoryStore.List(opts)
+	rs.reserve()
+	return page
+}
+
+func TestAdmin_DeleteAndPurge_KeepKeysThatWentBackToProcessing(t *testing.T) {
+	cfg := &config.Config{KeyTTL: 24 * time.Hour, AdminToken: testToken}
+	rs := &racingStore{MemoryStore: store.NewMemoryStore(cfg.KeyTTL), key: "retried"}
+	h := NewHandler(rs, cfg)
+
+	rs.MemoryStore.Set("retried", completeEntry(time.Now().Add(-3*time.Hour)))
+	if w := do(h, http.MethodDelete, "/admin/keys/retried", ""); w.Code != http.StatusConflict {
+		t.Errorf("expected 409, got %d", w.Code)
+	}
+	if rs.MemoryStore.Get("retried").State != models.StateProcessing {
+		t.Fatal("delete removed a key that was PROCESSING by the time it ran")
+	}
+
+	rs.MemoryStore.Set("retried", completeEntry(time.Now().Add(-3*time.Hour)))
+	rs.MemoryStore.Set("other", completeEntry(time.Now().Add(-3*time.Hour)))
+	w := do(h, http.MethodPost, "/admin/keys/purge", `{"older_than": "1h"}`)
+	if !strings.Contains(w.Body.String(), `"purged":1`) {
+		t.Errorf("expected 1 purged, got %s", w.Body.String())
+	}
+	if rs.MemoryStore.Get("retried") == nil || rs.MemoryStore.Get("other") != nil {
+		t.Error("purge removed a PROCESSING key or missed a COMPLETE one")
+	}
+}
+
+func TestAdmin_PurgePagesThroughEveryKey(t *testing.T) {
+	s, h := testHandler()
+	for i := 0; i < maxPageSize*2+7; i++ {
+		s.Set(fmt.Sprintf("bulk:%04d", i), completeEntry(time.Now()))
+	}
+
+	w := do(h, http.MethodPost, "/admin/keys/purge", `{"prefix": "bulk:"}`)
+	if want := fmt.Sprintf(`"purged":%d`, maxPageSize*2+7); !strings.Contains(w.Body.String(), want) {
+		t.Errorf("expected %s, got %s", want, w.Body.String())
+	}
+	if s.Stats().Keys != 0 {
+		t.Errorf("expected every key purged, %d left", s.Stats().Keys)
+	}
+}
+
+func TestAdmin_PurgeRequiresAFilter(t *testing.T) {
+	_, h := testHandler()
+
+	for _, body := range []string{`{}`, `{"older_than": "soon"}`, `not json`} {
+		if w := do(h, http.MethodPost, "/admin/keys/purge", body); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", body, w.Code)
+		}
+	}
+}
+
+func TestAdmin_SnapshotExportThenImport(t *testing.T) {
+	src, from := testHandler()
+	src.Set("key-1", completeEntry(time.Now()))
+	src.Set("key-2", completeEntry(time.Now()))
+
+	exported := do(from, http.MethodGet, "/admin/snapshot", "")
+	if exported.Code != http.StatusOK || exported.Header().Get("Content-Type") != "application/x-ndjson" {
+		t.Fatalf("expected a snapshot, got %d — %s", exported.Code, exported.Body.String())
+	}
+
+	dst, to := testHandler()
+	w := do(to, http.MethodPost, "/admin/snapshot", exported.Body.String())
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"imported":2`) {
+		t.Fatalf("expected 2 imported, got %d — %s", w.Code, w.Body.String())
+	}
+	if got := dst.Get("key-1"); got == nil || string(got.ResponseBody) != `{"status":"success"}` {
+		t.Errorf("unexpected imported entry %+v", got)
+	}
+
+	if w := do(to, http.MethodPost, "/admin/snapshot", `{"format": "nope"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for a bad file, got %d", w.Code)
+	}
+}
@@ -0,0 +1,110 @@
+// Package audit keeps an append-only record of every idempotency decision,
+// so that in a payment dispute we can show which request actually ran
+// and which ones were replays or rejections.
+//
+// Records are hash-chained: each one carries the hash of the record before it,
+// and its own hash covers that link. Editing, dropping or reordering any line
+// breaks the chain from that point on, which Verify reports.
+package audit
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// GenesisHash is the PrevHash of the very first record in a chain.
+var GenesisHash = strings.Repeat("0", sha256.Size*2)
+
+// Record is one idempotency decision.
+// The raw idempotency key is never stored, only its hash.
+type Record struct {
+	Seq             uint64    `json:"seq"`
+	Time            time.Time `json:"time"`
+	Scope           string    `json:"scope,omitempty"`
+	KeyHash         string    `json:"key_hash,omitempty"`
+	BodyFingerprint string    `json:"body_fingerprint,omitempty"`
+	Outcome         string    `json:"outcome"`
+	Status          int       `json:"status"`
+	LatencyMicros   int64     `json:"latency_us"`
+	PrevHash        string    `json:"prev_hash"`
+	Hash            string    `json:"hash,omitempty"`
+}
+
+// Sink receives every decision. Implementations fill in Seq, PrevHash
+// and Hash themselves, callers only describe what happened.
+type Sink interface {
+	Write(rec Record) error
+}
+
+// computeHash hashes the record's JSON with the Hash field left out.
+// Field order is fixed by the struct, so the encoding is deterministic.
+func computeHash(rec Record) string {
+	rec.Hash = ""
+	payload, _ := json.Marshal(rec)
+	sum := sha256.Sum256(payload)
+	return hex.EncodeToString(sum[:])
+}
+
+// seal links rec onto the chain after prevHash and sets its hash.
+func seal(rec Record, seq uint64, prevHash string) Record {
+	rec.Seq = seq
+	rec.PrevHash = prevHash
+	rec.Time = rec.Time.UTC()
+	rec.Hash = computeHash(rec)
+	return rec
+}
+
+// Verify walks a JSON-lines audit file and checks every link in the chain.
+// prevHash is the hash the first record is expected to point at:
+// GenesisHash for the first file, or the last hash of the previous file
+// when checking rotated files in order. It returns the last hash seen so
+// the next file can be checked against it.
+func Verify(r io.Reader, prevHash string) (lastHash string, records int, err error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	lastHash = prevHash
+	var lastSeq uint64
+
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+
+		var rec Record
+		if err := json.Unmarshal(line, &rec); err != nil {
+			return lastHash, records, fmt.Errorf("record %d: invalid JSON: %w", records+1, err)
+		}
+		if rec.PrevHash != lastHash {
+			return lastHash, records, fmt.Errorf("record seq %d: chain broken, prev_hash does not match the previous record", rec.Seq)
+		}
+		if records > 0 && rec.Seq != lastSeq+1 {
+			return lastHash, records, fmt.Errorf("record seq %d: expected seq %d", rec.Seq, lastSeq+1)
+		}
+		if computeHash(rec) != rec.Hash {
+			return lastHash, records, fmt.Errorf("record seq %d: hash mismatch, record was modified", rec.Seq)
+		}
+
+		lastHash = rec.Hash
+		lastSeq = rec.Seq
+		records++
+	}
+
+	return lastHash, records, scanner.Err()
+}
+
+// jsonLine encodes a record as a single newline-terminated line.
+func jsonLine(rec Record) ([]byte, error) {
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return nil, err
+	}
+	return append(line, '\n'), nil
+}
@@ -0,0 +1,172 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// FileSink appends records as JSON lines and rotates the file once it
+// passes maxBytes. Rotated files are renamed to "<path>.<UTC timestamp>"
+// and the chain carries straight on into the new file, so the full
+// history verifies as long as the files are checked in order.
+type FileSink struct {
+	path     string
+	maxBytes int64
+
+	mu       sync.Mutex
+	file     *os.File
+	size     int64
+	seq      uint64
+	lastHash string
+}
+
+// NewFileSink opens (or creates) the audit file at path. If there is
+// already a chain on disk, new records continue it rather than starting
+// a fresh one. maxBytes <= 0 disables rotation.
+func NewFileSink(path string, maxBytes int64) (*FileSink, error) {
+	fs := &FileSink{path: path, maxBytes: maxBytes, lastHash: GenesisHash}
+
+	if err := fs.recoverChain(); err != nil {
+		return nil, err
+	}
+	if err := fs.open(); err != nil {
+		return nil, err
+	}
+	return fs, nil
+}
+
+// Write seals rec onto the chain and appends it. The chain only advances
+// once the line is on disk, a failed write doesn't leave a gap.
+func (fs *FileSink) Write(rec Record) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if fs.maxBytes > 0 && fs.size >= fs.maxBytes {
+		if err := fs.rotate(); err != nil {
+			return err
+		}
+	}
+
+	sealed := seal(rec, fs.seq+1, fs.lastHash)
+	line, err := jsonLine(sealed)
+	if err != nil {
+		return err
+	}
+
+	n, err := fs.file.Write(line)
+	fs.size += int64(n)
+	if err != nil {
+		return err
+	}
+
+	fs.seq = sealed.Seq
+	fs.lastHash = sealed.Hash
+	return nil
+}
+
+// Close flushes the file to disk and closes it.
+func (fs *FileSink) Close() error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if err := fs.file.Sync(); err != nil {
+		fs.file.Close()
+		return err
+	}
+	return fs.file.Close()
+}
+
+func (fs *FileSink) open() error {
+	f, err := os.OpenFile(fs.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	fs.file = f
+	fs.size = info.Size()
+	return nil
+}
+
+func (fs *FileSink) rotate() error {
+	if err := fs.file.Sync(); err != nil {
+		return err
+	}
+	if err := fs.file.Close(); err != nil {
+		return err
+	}
+
+	rotated := fs.path + "." + time.Now().UTC().Format("20060102T150405.000000000")
+	if err := os.Rename(fs.path, rotated); err != nil {
+		return err
+	}
+	return fs.open()
+}
+
+// recoverChain finds the last record written, in the current file or,
+// if that's empty because we'd just rotated, in the newest rotated one.
+func (fs *FileSink) recoverChain() error {
+	candidates := []string{fs.path}
+
+	rotated, err := filepath.Glob(fs.path + ".*")
+	if err != nil {
+		return err
+	}
+	// Timestamps sort lexically, newest last, so walk them backwards.
+	sort.Sort(sort.Reverse(sort.StringSlice(rotated)))
+	candidates = append(candidates, rotated...)
+
+	for _, path := range candidates {
+		last, ok, err := lastRecord(path)
+		if err != nil {
+			return err
+		}
+		if ok {
+			fs.seq = last.Seq
+			fs.lastHash = last.Hash
+			return nil
+		}
+	}
+	return nil
+}
+
+// lastRecord returns the final record in a file, if it has any.
+func lastRecord(path string) (Record, bool, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return Record{}, false, nil
+	}
+	if err != nil {
+		return Record{}, false, err
+	}
+	defer f.Close()
+
+	var last []byte
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) > 0 {
+			last = append(last[:0], scanner.Bytes()...)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return Record{}, false, err
+	}
+	if last == nil {
+		return Record{}, false, nil
+	}
+
+	var rec Record
+	if err := json.Unmarshal(last, &rec); err != nil {
+		return Record{}, false, err
+	}
+	return rec, true, nil
+}
@@ -0,0 +1,194 @@
+// Package auth works out which merchant a request comes from by its API key.
+// Keys are only ever stored as SHA-256 hashes, a leaked keys file doesn't
+// let anyone charge payments. A merchant can hold several keys at once,
+// each with its own validity window, which is how keys are rotated without
+// a moment where neither the old nor the new one works.
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const hashPrefix = "sha256:"
+
+var (
+	// ErrUnknownKey means no key in the keyring matches.
+	ErrUnknownKey = errors.New("unknown API key")
+
+	// ErrKeyNotYetValid means the key exists but its NotBefore hasn't come yet.
+	ErrKeyNotYetValid = errors.New("API key is not valid yet")
+
+	// ErrKeyExpired means the key exists but its ExpiresAt has passed.
+	ErrKeyExpired = errors.New("API key has expired")
+)
+
+// Key is an API key as written in the keys file. Zero times leave that end
+// of the window open.
+type Key struct {
+	ID        string    `json:"id"`
+	Merchant  string    `json:"merchant"`
+	Hash      string    `json:"hash"` // "sha256:" + hex of the secret key
+	NotBefore time.Time `json:"not_before"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// activeAt reports why the key can't be used at now, or nil if it can.
+func (k Key) activeAt(now time.Time) error {
+	if !k.NotBefore.IsZero() && now.Before(k.NotBefore) {
+		return ErrKeyNotYetValid
+	}
+	if !k.ExpiresAt.IsZero() && !now.Before(k.ExpiresAt) {
+		return ErrKeyExpired
+	}
+	return nil
+}
+
+// Hash is what goes in a Key's Hash for the secret key a merchant is given.
+func Hash(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hashPrefix + hex.EncodeToString(sum[:])
+}
+
+// Keyring holds the keys requests are checked against.
+// Replace swaps them all at once, so the file can be reloaded while serving.
+type Keyring struct {
+	now func() time.Time
+
+	mu     sync.RWMutex
+	byHash map[string]Key
+}
+
+func NewKeyring(keys []Key) (*Keyring, error) {
+	k := &Keyring{now: time.Now}
+	if err := k.Replace(keys); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// Replace validates keys and swaps them in. On error the old keys stay.
+func (k *Keyring) Replace(keys []Key) error {
+	byHash, err := index(keys)
+	if err != nil {
+		return err
+	}
+
+	k.mu.Lock()
+	k.byHash = byHash
+	k.mu.Unlock()
+	return nil
+}
+
+// Authenticate returns the key secret belongs to, if it's usable right now.
+// The lookup is by hash, so how long it takes says nothing about how close
+// a wrong guess was to a real key.
+func (k *Keyring) Authenticate(secret string) (Key, error) {
+	k.mu.RLock()
+	key, ok := k.byHash[Hash(secret)]
+	k.mu.RUnlock()
+
+	if !ok {
+		return Key{}, ErrUnknownKey
+	}
+	if err := key.activeAt(k.now()); err != nil {
+		return Key{}, fmt.Errorf("%w: %s", err, key.ID)
+	}
+	return key, nil
+}
+
+// Len is how many keys are loaded, for the startup log.
+func (k *Keyring) Len() int {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return len(k.byHash)
+}
+
+func index(keys []Key) (map[string]Key, error) {
+	byHash := make(map[string]Key, len(keys))
+	ids := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		if key.ID == "" {
+			return nil, errors.New("key with no id")
+		}
+		if ids[key.ID] {
+			return nil, fmt.Errorf("key %s listed twice", key.ID)
+		}
+		ids[key.ID] = true
+
+		if key.Merchant == "" {
+			return nil, fmt.Errorf("key %s: merchant must not be empty", key.ID)
+		}
+		digest, ok := strings.CutPrefix(key.Hash, hashPrefix)
+		if b, err := hex.DecodeString(digest); !ok || err != nil || len(b) != sha256.Size {
+			return nil, fmt.Errorf("key %s: hash must be %q followed by 64 hex characters", key.ID, hashPrefix)
+		}
+		key.Hash = strings.ToLower(key.Hash)
+		if other, ok := byHash[key.Hash]; ok {
+			return nil, fmt.Errorf("key %s: same secret as key %s", key.ID, other.ID)
+		}
+		if !key.NotBefore.IsZero() && !key.ExpiresAt.IsZero() && !key.ExpiresAt.After(key.NotBefore) {
+			return nil, fmt.Errorf("key %s: expires_at must be after not_before", key.ID)
+		}
+		byHash[key.Hash] = key
+	}
+	return byHash, nil
+}
+
+// Load reads keys from a JSON array. An empty path means no keys file,
+// and authentication is off.
+func Load(path string) ([]Key, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []Key
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&keys); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if _, err := index(keys); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return keys, nil
+}
+
+// Identity is who a request was authenticated as.
+type Identity struct {
+	Merchant string
+	KeyID    string
+}
+
+type identityKey struct{}
+
+// WithIdentity returns ctx carrying id.
+func WithIdentity(ctx context.Context, id Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, id)
+}
+
+// FromContext returns the identity the request was authenticated as.
+func FromContext(ctx context.Context) (Identity, bool) {
+	id, ok := ctx.Value(identityKey{}).(Identity)
+	return id, ok
+}
+
+// Merchant is the merchant behind ctx, or "" when authentication is off.
+func Merchant(ctx context.Context) string {
+	id, _ := FromContext(ctx)
+	return id.Merchant
+}
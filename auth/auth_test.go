@@ -0,0 +1,132 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var now = time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+
+func keyring(t *testing.T, keys ...Key) *Keyring {
+	t.Helper()
+	k, err := NewKeyring(keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	k.now = func() time.Time { return now }
+	return k
+}
+
+func TestHash(t *testing.T) {
+	got := Hash("sk_test_123")
+	if !strings.HasPrefix(got, "sha256:") || len(got) != len("sha256:")+64 {
+		t.Errorf("unexpected hash %q", got)
+	}
+	if Hash("sk_test_123") != got || Hash("sk_test_124") == got {
+		t.Error("expected the hash to depend only on the secret")
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	k := keyring(t, Key{ID: "key_1", Merchant: "acme", Hash: Hash("sk_acme")})
+
+	key, err := k.Authenticate("sk_acme")
+	if err != nil || key.Merchant != "acme" || key.ID != "key_1" {
+		t.Errorf("expected acme's key, got %+v, %v", key, err)
+	}
+	if _, err := k.Authenticate("sk_wrong"); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("expected ErrUnknownKey, got %v", err)
+	}
+}
+
+// Rotating means adding the new key, then giving the old one an expiry.
+// Until it passes both work.
+func TestAuthenticate_RotationOverlap(t *testing.T) {
+	k := keyring(t,
+		Key{ID: "key_old", Merchant: "acme", Hash: Hash("sk_old"), ExpiresAt: now.Add(time.Hour)},
+		Key{ID: "key_new", Merchant: "acme", Hash: Hash("sk_new"), NotBefore: now.Add(-time.Hour)},
+		Key{ID: "key_next", Merchant: "acme", Hash: Hash("sk_next"), NotBefore: now.Add(time.Hour)},
+		Key{ID: "key_gone", Merchant: "acme", Hash: Hash("sk_gone"), ExpiresAt: now},
+	)
+
+	for _, secret := range []string{"sk_old", "sk_new"} {
+		if key, err := k.Authenticate(secret); err != nil || key.Merchant != "acme" {
+			t.Errorf("%s: expected it to work during the overlap, got %v", secret, err)
+		}
+	}
+	if _, err := k.Authenticate("sk_next"); !errors.Is(err, ErrKeyNotYetValid) {
+		t.Errorf("expected ErrKeyNotYetValid, got %v", err)
+	}
+	if _, err := k.Authenticate("sk_gone"); !errors.Is(err, ErrKeyExpired) {
+		t.Errorf("expected ErrKeyExpired at exactly expires_at, got %v", err)
+	}
+}
+
+func TestReplace_KeepsOldKeysOnError(t *testing.T) {
+	k := keyring(t, Key{ID: "key_1", Merchant: "acme", Hash: Hash("sk_acme")})
+
+	if err := k.Replace([]Key{{ID: "key_2", Hash: Hash("sk_globex")}}); err == nil {
+		t.Fatal("expected an error for a key with no merchant")
+	}
+	if _, err := k.Authenticate("sk_acme"); err != nil {
+		t.Errorf("expected the old keys to survive a bad reload, got %v", err)
+	}
+
+	if err := k.Replace([]Key{{ID: "key_2", Merchant: "globex", Hash: Hash("sk_globex")}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := k.Authenticate("sk_acme"); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("expected the removed key to stop working, got %v", err)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	write := func(t *testing.T, content string) string {
+		path := filepath.Join(t.TempDir(), "keys.json")
+		os.WriteFile(path, []byte(content), 0o600)
+		return path
+	}
+
+	keys, err := Load(write(t, `[{"id": "key_1", "merchant": "acme", "hash": "`+Hash("sk_acme")+`", "expires_at": "2027-01-01T00:00:00Z"}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 || keys[0].Merchant != "acme" || keys[0].ExpiresAt.Year() != 2027 {
+		t.Errorf("unexpected keys %+v", keys)
+	}
+
+	if keys, err := Load(""); keys != nil || err != nil {
+		t.Errorf("expected no keys and no error for an empty path, got %v, %v", keys, err)
+	}
+
+	bad := map[string]string{
+		"no id":          `[{"merchant": "acme", "hash": "` + Hash("a") + `"}]`,
+		"duplicate id":   `[{"id": "k", "merchant": "acme", "hash": "` + Hash("a") + `"}, {"id": "k", "merchant": "acme", "hash": "` + Hash("b") + `"}]`,
+		"same secret":    `[{"id": "k1", "merchant": "acme", "hash": "` + Hash("a") + `"}, {"id": "k2", "merchant": "globex", "hash": "` + Hash("a") + `"}]`,
+		"plaintext":      `[{"id": "k", "merchant": "acme", "hash": "sk_acme"}]`,
+		"short hash":     `[{"id": "k", "merchant": "acme", "hash": "sha256:abcd"}]`,
+		"empty window":   `[{"id": "k", "merchant": "acme", "hash": "` + Hash("a") + `", "not_before": "2027-01-01T00:00:00Z", "expires_at": "2026-01-01T00:00:00Z"}]`,
+		"unknown field":  `[{"id": "k", "merchant": "acme", "secret": "sk_acme"}]`,
+		"not json array": `{"id": "k"}`,
+	}
+	for name, content := range bad {
+		if _, err := Load(write(t, content)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestContext(t *testing.T) {
+	if Merchant(context.Background()) != "" {
+		t.Error("expected no merchant on a bare context")
+	}
+	ctx := WithIdentity(context.Background(), Identity{Merchant: "acme", KeyID: "key_1"})
+	if id, ok := FromContext(ctx); !ok || id.KeyID != "key_1" || Merchant(ctx) != "acme" {
+		t.Errorf("expected acme/key_1, got %+v", id)
+	}
+}
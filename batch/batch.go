@@ -0,0 +1,219 @@
+// Package batch serves POST /payment-batches: many payments in one request,
+// each with its own key. Every item is sent through the same idempotent
+// handler a single payment would go through, so an item is charged once
+// however many times its batch is retried.
+package batch
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+
+	"github.com/GordenArcher/Idempotency-Gateway/middleware"
+)
+
+// Item outcomes, as reported per item in the response.
+const (
+	OutcomeSucceeded  = "succeeded"  // 2xx, the payment went through
+	OutcomeFailed     = "failed"     // 4xx, a final answer such as a decline, retrying won't change it
+	OutcomeIncomplete = "incomplete" // 5xx, didn't finish, retrying the batch runs it again
+)
+
+// Config sizes the batch endpoint.
+type Config struct {
+	ItemPath string // path the items are sent to, e.g. /process-payment
+	Workers  int    // items processed at once within one batch
+	MaxItems int    // largest batch accepted
+}
+
+// Item is one payment in a batch. Amount is kept raw so it reaches the
+// payment handler exactly as the client wrote it, string or number.
+type Item struct {
+	Key      string          `json:"key"`
+	Amount   json.RawMessage `json:"amount"`
+	Currency string          `json:"currency"`
+
+	// Passed through for the risk rules, same as on a single payment.
+	CustomerID string `json:"customer_id,omitempty"`
+	Card       string `json:"card,omitempty"`
+	Country    string `json:"country,omitempty"`
+}
+
+type request struct {
+	Items []Item `json:"items"`
+}
+
+// Result is what happened to one item.
+type Result struct {
+	Key        string          `json:"key"`
+	Outcome    string          `json:"outcome"`
+	StatusCode int             `json:"status_code"`
+	Replayed   bool            `json:"replayed"` // the item had already run in an earlier attempt of this batch
+	Response   json.RawMessage `json:"response,omitempty"`
+}
+
+// Handler processes batches by calling items once per item. items is
+// expected to be wrapped in the idempotency middleware with
+// WithRetryServerErrors, that's what makes a retried batch skip the items
+// that already completed.
+type Handler struct {
+	cfg   Config
+	items http.Handler
+}
+
+func NewHandler(items http.Handler, cfg Config) *Handler {
+	if cfg.Workers < 1 {
+		cfg.Workers = 1
+	}
+	return &Handler{cfg: cfg, items: items}
+}
+
+// ServeHTTP handles POST /payment-batches.
+// By the time a batch gets here the idempotency middleware has checked its
+// key and body, so this only has to fan the items out. The status is 200
+// once every item has a final outcome, and 502 while any are incomplete,
+// which is also what makes the middleware run a retry instead of replaying it.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req request
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body, expected {items: [{key, amount, currency}]}")
+		return
+	}
+	if err := h.validate(req.Items); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	batchKey := r.Header.Get("Idempotency-Key")
+	results := make([]Result, len(req.Items))
+
+	// A fixed number of workers pull item indexes, results land in the
+	// same order as the items came in.
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < min(h.cfg.Workers, len(req.Items)); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				results[i] = h.process(r, batchKey, req.Items[i])
+			}
+		}()
+	}
+	for i := range req.Items {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+
+	summary := map[string]int{"total": len(results), OutcomeSucceeded: 0, OutcomeFailed: 0, OutcomeIncomplete: 0}
+	for _, res := range results {
+		summary[res.Outcome]++
+	}
+
+	status := http.StatusOK
+	if summary[OutcomeIncomplete] > 0 {
+		status = http.StatusBadGateway
+	}
+	writeJSON(w, status, map[string]any{
+		"summary": summary,
+		"items":   results,
+	})
+}
+
+func (h *Handler) validate(items []Item) error {
+	if len(items) == 0 {
+		return errors.New("batch has no items")
+	}
+	if h.cfg.MaxItems > 0 && len(items) > h.cfg.MaxItems {
+		return fmt.Errorf("batch has %d items, the most allowed is %d", len(items), h.cfg.MaxItems)
+	}
+	seen := make(map[string]bool, len(items))
+	for i, item := range items {
+		if item.Key == "" {
+			return fmt.Errorf("item %d has no key", i)
+		}
+		if seen[item.Key] {
+			return fmt.Errorf("item key %q is used more than once", item.Key)
+		}
+		seen[item.Key] = true
+	}
+	return nil
+}
+
+// process runs one item through the item handler as its own request,
+// carrying the batch request's context and headers so it's logged, traced
+// and scoped the same way. Items run at the same time, so each gets its own
+// request log and span rather than writing to the batch's.
+func (h *Handler) process(r *http.Request, batchKey string, item Item) Result {
+	payment := map[string]any{"amount": item.Amount, "currency": item.Currency}
+	for name, v := range map[string]string{"customer_id": item.CustomerID, "card": item.Card, "country": item.Country} {
+		if v != "" {
+			payment[name] = v
+		}
+	}
+	body, _ := json.Marshal(payment)
+
+	itemReq := r.Clone(middleware.SubrequestContext(r.Context()))
+	itemReq.Method = http.MethodPost
+	itemReq.URL = &url.URL{Path: h.cfg.ItemPath}
+	itemReq.RequestURI = h.cfg.ItemPath
+	itemReq.Body = io.NopCloser(bytes.NewReader(body))
+	itemReq.ContentLength = int64(len(body))
+	itemReq.Header.Set("Content-Type", "application/json")
+	itemReq.Header.Set("Idempotency-Key", ItemKey(batchKey, item.Key))
+	// Items always run inline, the batch itself is what a client would make async.
+	itemReq.Header.Del("Prefer")
+
+	rec := &recorder{header: http.Header{}, status: http.StatusOK}
+	h.items.ServeHTTP(rec, itemReq)
+
+	result := Result{
+		Key:        item.Key,
+		StatusCode: rec.status,
+		Replayed:   rec.header.Get("X-Cache-Hit") == "true",
+		Outcome:    OutcomeSucceeded,
+	}
+	switch {
+	case rec.status >= 500:
+		result.Outcome = OutcomeIncomplete
+	case rec.status >= 400:
+		result.Outcome = OutcomeFailed
+	}
+	if json.Valid(rec.body.Bytes()) {
+		result.Response = rec.body.Bytes()
+	}
+	return result
+}
+
+// ItemKey is the idempotency key an item runs under. Both parts are escaped
+// so a ':' in either can't make two different pairs collide.
+func ItemKey(batchKey, itemKey string) string {
+	return "batch:" + url.QueryEscape(batchKey) + ":" + url.QueryEscape(itemKey)
+}
+
+// recorder is the ResponseWriter each item writes to.
+type recorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (rec *recorder) Header() http.Header         { return rec.header }
+func (rec *recorder) Write(b []byte) (int, error) { return rec.body.Write(b) }
+func (rec *recorder) WriteHeader(code int)        { rec.status = code }
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
+}
@@ -0,0 +1,274 @@
+package batch
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/GordenArcher/Idempotency-Gateway/middleware"
+	"github.com/GordenArcher/Idempotency-Gateway/store"
+)
+
+// fakePayments stands in for the payment handler. An amount of "402" is
+// declined, "502" fails the first time and succeeds after, anything else
+// succeeds. It counts how many times each item key actually ran.
+type fakePayments struct {
+	mu    sync.Mutex
+	calls map[string]int
+}
+
+func (f *fakePayments) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Amount   json.RawMessage `json:"amount"`
+		Currency string          `json:"currency"`
+	}
+	json.NewDecoder(r.Body).Decode(&body)
+
+	key := r.Header.Get("Idempotency-Key")
+	f.mu.Lock()
+	f.calls[key]++
+	n := f.calls[key]
+	f.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	switch {
+	case string(body.Amount) == `"402"`:
+		w.WriteHeader(http.StatusPaymentRequired)
+		fmt.Fprint(w, `{"status":"declined"}`)
+	case string(body.Amount) == `"502"` && n == 1:
+		w.WriteHeader(http.StatusBadGateway)
+		fmt.Fprint(w, `{"error":"processor unavailable"}`)
+	default:
+		w.WriteHeader(http.StatusCreated)
+		fmt.Fprintf(w, `{"status":"success","amount":%s}`, body.Amount)
+	}
+}
+
+func (f *fakePayments) count(batchKey, itemKey string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls[ItemKey(batchKey, itemKey)]
+}
+
+// testBatch wires a batch handler the way main.go does: the batch and its
+// items each behind the idempotency middleware, both re-running 5xx.
+func testBatch(workers int) (http.Handler, *fakePayments) {
+	s := store.NewMemoryStore(time.Hour)
+	payments := &fakePayments{calls: map[string]int{}}
+	items := middleware.Idempotency(s, payments, middleware.WithRetryServerErrors())
+	h := NewHandler(items, Config{ItemPath: "/process-payment", Workers: workers, MaxItems: 50})
+	return middleware.Idempotency(s, h, middleware.WithRetryServerErrors()), payments
+}
+
+type response struct {
+	Summary map[string]int `json:"summary"`
+	Items   []Result       `json:"items"`
+}
+
+func postBatch(t *testing.T, h http.Handler, key, body string) (int, response) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/payment-batches", strings.NewReader(body))
+	req.Header.Set("Idempotency-Key", key)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+
+	var resp response
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	return w.Code, resp
+}
+
+func TestBatch_ReportsPerItemOutcome(t *testing.T) {
+	h, _ := testBatch(4)
+
+	status, resp := postBatch(t, h, "batch-1", `{"items": [
+		{"key": "emp-1", "amount": "100.00", "currency": "GHS"},
+		{"key": "emp-2", "amount": "402", "currency": "GHS"},
+		{"key": "emp-3", "amount": 25.5, "currency": "GHS"}
+	]}`)
+
+	if status != http.StatusOK {
+		t.Fatalf("expected 200, got %d", status)
+	}
+	if resp.Summary["total"] != 3 || resp.Summary[OutcomeSucceeded] != 2 || resp.Summary[OutcomeFailed] != 1 {
+		t.Errorf("unexpected summary %v", resp.Summary)
+	}
+
+	// Items come back in the order they were sent.
+	want := []string{OutcomeSucceeded, OutcomeFailed, OutcomeSucceeded}
+	for i, item := range resp.Items {
+		if item.Outcome != want[i] {
+			t.Errorf("item %s: expected %s, got %s", item.Key, want[i], item.Outcome)
+		}
+	}
+	if string(resp.Items[2].Response) != `{"status":"success","amount":25.5}` {
+		t.Errorf("expected the amount passed through as written, got %s", resp.Items[2].Response)
+	}
+}
+
+func TestBatch_RetryOnlyReprocessesIncompleteItems(t *testing.T) {
+	h, payments := testBatch(4)
+	body := `{"items": [
+		{"key": "emp-1", "amount": "100.00", "currency": "GHS"},
+		{"key": "emp-2", "amount": "402", "currency": "GHS"},
+		{"key": "emp-3", "amount": "502", "currency": "GHS"}
+	]}`
+
+	status, resp := postBatch(t, h, "batch-2", body)
+	if status != http.StatusBadGateway {
+		t.Fatalf("expected 502 while an item is incomplete, got %d", status)
+	}
+	if resp.Summary[OutcomeIncomplete] != 1 || resp.Items[2].Outcome != OutcomeIncomplete {
+		t.Fatalf("expected emp-3 incomplete, got %v", resp.Items)
+	}
+
+	status, resp = postBatch(t, h, "batch-2", body)
+	if status != http.StatusOK {
+		t.Fatalf("expected 200 once every item is final, got %d", status)
+	}
+	for _, item := range resp.Items[:2] {
+		if !item.Replayed {
+			t.Errorf("expected %s to be replayed from the first attempt", item.Key)
+		}
+	}
+	if resp.Items[2].Outcome != OutcomeSucceeded || resp.Items[2].Replayed {
+		t.Errorf("expected emp-3 to run again and succeed, got %+v", resp.Items[2])
+	}
+
+	for key, want := range map[string]int{"emp-1": 1, "emp-2": 1, "emp-3": 2} {
+		if got := payments.count("batch-2", key); got != want {
+			t.Errorf("%s: expected to run %d times, ran %d", key, want, got)
+		}
+	}
+
+	// Once complete, the batch itself is a plain replay.
+	status, _ = postBatch(t, h, "batch-2", body)
+	if status != http.StatusOK || payments.count("batch-2", "emp-3") != 2 {
+		t.Errorf("expected a replay without running anything, got %d", status)
+	}
+}
+
+func TestBatch_SameKeyDifferentItems_Returns409(t *testing.T) {
+	h, _ := testBatch(1)
+
+	postBatch(t, h, "batch-3", `{"items": [{"key": "emp-1", "amount": "1.00", "currency": "GHS"}]}`)
+	status, _ := postBatch(t, h, "batch-3", `{"items": [{"key": "emp-1", "amount": "2.00", "currency": "GHS"}]}`)
+
+	if status != http.StatusConflict {
+		t.Errorf("expected 409, got %d", status)
+	}
+}
+
+func TestBatch_ItemKeysAreScopedToTheBatch(t *testing.T) {
+	h, payments := testBatch(1)
+	body := `{"items": [{"key": "emp-1", "amount": "1.00", "currency": "GHS"}]}`
+
+	postBatch(t, h, "batch-4", body)
+	postBatch(t, h, "batch-5", body)
+
+	if payments.count("batch-4", "emp-1") != 1 || payments.count("batch-5", "emp-1") != 1 {
+		t.Error("expected the same item key in two batches to be two payments")
+	}
+}
+
+func TestBatch_Validation(t *testing.T) {
+	h, _ := testBatch(1)
+
+	many := make([]string, 51)
+	for i := range many {
+		many[i] = fmt.Sprintf(`{"key": "k%d", "amount": "1", "currency": "GHS"}`, i)
+	}
+
+	for name, body := range map[string]string{
+		"not json":      `items`,
+		"no items":      `{"items": []}`,
+		"missing key":   `{"items": [{"amount": "1", "currency": "GHS"}]}`,
+		"duplicate key": `{"items": [{"key": "a", "amount": "1", "currency": "GHS"}, {"key": "a", "amount": "2", "currency": "GHS"}]}`,
+		"too many":      `{"items": [` + strings.Join(many, ",") + `]}`,
+	} {
+		if status, _ := postBatch(t, h, "batch-invalid-"+name, body); status != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %d", name, status)
+		}
+	}
+}
+
+func TestBatch_WorkersBoundConcurrency(t *testing.T) {
+	var running, peak atomic.Int32
+	slow := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		n := running.Add(1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		running.Add(-1)
+		w.WriteHeader(http.StatusCreated)
+	})
+	h := NewHandler(slow, Config{ItemPath: "/process-payment", Workers: 3})
+
+	items := make([]string, 12)
+	for i := range items {
+		items[i] = fmt.Sprintf(`{"key": "k%d", "amount": "1", "currency": "GHS"}`, i)
+	}
+	status, resp := postBatch(t, h, "batch-6", `{"items": [`+strings.Join(items, ",")+`]}`)
+
+	if status != http.StatusOK || resp.Summary[OutcomeSucceeded] != 12 {
+		t.Fatalf("expected 12 successes, got %d %v", status, resp.Summary)
+	}
+	if p := peak.Load(); p > 3 || p < 2 {
+		t.Errorf("expected up to 3 items at once, peak was %d", p)
+	}
+}
+
+func TestItemKey_EscapesSeparator(t *testing.T) {
+	if ItemKey("a:b", "c") == ItemKey("a", "b:c") {
+		t.Error("expected different batch/item pairs to get different keys")
+	}
+}
+
+func TestBatch_ItemsDontWriteToTheBatchesLogLine(t *testing.T) {
+	// Items run at once behind the same RequestLogger as their batch. Run
+	// with -race: each item records its own idempotency decision, none of
+	// them on the batch's log line.
+	var buf bytes.Buffer
+	h, _ := testBatch(8)
+	h = middleware.RequestLogger(slog.New(slog.NewJSONHandler(&buf, nil)), h)
+
+	var items []string
+	for i := 0; i < 20; i++ {
+		items = append(items, fmt.Sprintf(`{"key": "emp-%d", "amount": "10.00", "currency": "GHS"}`, i))
+	}
+	status, _ := postBatch(t, h, "batch-logged", `{"items": [`+strings.Join(items, ",")+`]}`)
+	if status != http.StatusOK {
+		t.Fatalf("expected 200, got %d", status)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("expected one log line for the batch, got %d", len(lines))
+	}
+	var record map[string]any
+	if err := json.Unmarshal([]byte(lines[0]), &record); err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256([]byte("batch-logged"))
+	if record["idempotency_key_hash"] != hex.EncodeToString(sum[:]) {
+		t.Errorf("expected the batch's own key hash on its log line, got %v", record["idempotency_key_hash"])
+	}
+	if record["idempotency_outcome"] != string(middleware.OutcomeNew) {
+		t.Errorf("expected the batch's outcome, got %v", record["idempotency_outcome"])
+	}
+}
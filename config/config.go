@@ -1,6 +1,12 @@
 package config
 
-import "time"
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"time"
+)
 
 // Config holds all the tuneable values for the gateway.
 // Centralizing these here means I'm not hunting through the codebase
@@ -13,6 +19,80 @@ type Config struct {
 	// The spec asks for a 2-second delay — this is where that lives.
 	ProcessingDelay time.Duration
 
+	// ProcessingJitter spreads the simulated delay uniformly over
+	// ProcessingDelay ± ProcessingJitter, 0 keeps it fixed.
+	ProcessingJitter time.Duration
+
+	// ProcessorTimeout is how long we wait on the processor before giving
+	// up with a 504. 0 means no limit.
+	ProcessorTimeout time.Duration
+
+	// The simulated processor's failure rates, each a probability 0-1.
+	// All zero by default so the demo behaves, turn them up to see how
+	// the idempotency layer copes with a flaky upstream.
+	ProcessorDeclineRate float64
+	ProcessorTimeoutRate float64
+	ProcessorErrorRate   float64
+
+	// AuthorizationTTL is how long an authorization can wait to be captured
+	// before it expires. Card networks typically hold funds for about a week.
+	// 0 means authorizations never expire.
+	AuthorizationTTL time.Duration
+
+	// FeeBasisPoints is the fee taken on every capture, in hundredths of
+	// a percent (150 is 1.5%). Posted to the ledger's fee_revenue account.
+	FeeBasisPoints int64
+
+	// CurrenciesFile is a JSON file listing the currencies payments can be
+	// made in, with their exponents and limits. Empty uses the built-in list.
+	CurrenciesFile string
+
+	// RateLimitPerMinute is how many new payments a client can start per
+	// minute. Replays of a key don't count. 0 turns rate limiting off.
+	RateLimitPerMinute int64
+
+	// RateLimitBurst is how many new payments a client can start at once
+	// before the per-minute rate kicks in.
+	RateLimitBurst int64
+
+	// TrustClientID rate limits unauthenticated callers by their X-Client-ID
+	// header instead of their IP. Only for a proxy in front that sets the
+	// header and drops the client's own.
+	TrustClientID bool
+
+	// RiskRulesFile is a JSON file of fraud and risk rules every new payment
+	// is checked against before it reaches the processor. Empty allows everything.
+	RiskRulesFile string
+
+	// AsyncWorkers is how many requests sent with Prefer: respond-async are
+	// processed at once in the background.
+	AsyncWorkers int64
+
+	// AsyncQueueSize is how many async requests can wait for a worker
+	// before new ones are turned away with a 503.
+	AsyncQueueSize int64
+
+	// BatchWorkers is how many items of one batch are processed at once.
+	BatchWorkers int64
+
+	// BatchMaxItems is the most items a single batch may contain.
+	BatchMaxItems int64
+
+	// WebhooksFile is a JSON file listing the endpoints payment and refund
+	// events are sent to, with their signing secrets. Empty turns webhooks off.
+	WebhooksFile string
+
+	// WebhookMaxAttempts is how many times a delivery is tried before it's
+	// marked failed.
+	WebhookMaxAttempts int64
+
+	// WebhookBackoff is the wait before the first retry of a delivery,
+	// doubled after every failed attempt up to an hour.
+	WebhookBackoff time.Duration
+
+	// WebhookTimeout bounds each delivery attempt.
+	WebhookTimeout time.Duration
+
 	// KeyTTL is how long an idempotency key lives in the store before expiry.
 	// Keeping it configurable so I can set it low during testing.
 	KeyTTL time.Duration
@@ -21,15 +101,320 @@ type Config struct {
 	// expired keys from memory. No point sweeping every millisecond,
 	// but we don't want stale keys hanging around too long either.
 	SweepInterval time.Duration
+
+	// ShutdownTimeout is how long we give in-flight requests to finish
+	// once a SIGTERM/SIGINT arrives. A payment that's halfway through
+	// processing should get the chance to complete and land in the store,
+	// otherwise the client's retry finds nothing and charges again.
+	ShutdownTimeout time.Duration
+
+	// DrainRetryAfter is the Retry-After hint sent with the 503 we return
+	// to new requests while the server is draining.
+	DrainRetryAfter time.Duration
+
+	// DrainDelay is how long the server keeps answering after a shutdown
+	// signal before it stops accepting connections. /readyz is failing and
+	// new requests get the 503 the whole time, long enough for a load
+	// balancer to notice and move traffic elsewhere.
+	DrainDelay time.Duration
+
+	// LogLevel is the minimum level written to the JSON request log.
+	// Debug is noisy, Info gives one line per request.
+	LogLevel slog.Level
+
+	// TraceOutput is where finished spans are written as OTLP-JSON lines:
+	// "" turns tracing off, "stdout" prints them, anything else is a file path.
+	TraceOutput string
+
+	// TLSCertFile and TLSKeyFile turn on HTTPS. Both or neither.
+	// The files are watched and re-read when they change.
+	TLSCertFile string
+	TLSKeyFile  string
+
+	// TLSMinVersion is the oldest TLS version accepted, "1.2" or "1.3".
+	TLSMinVersion string
+
+	// TLSCipherSuites is a comma-separated list of TLS 1.2 cipher suites to
+	// allow. Empty uses Go's defaults, which are fine for most deployments.
+	TLSCipherSuites string
+
+	// TLSClientCAFile turns on mutual TLS: clients must present a
+	// certificate signed by one of the CAs in this file.
+	TLSClientCAFile string
+
+	// TLSClientCertScope makes the client certificate's subject the caller's
+	// identity, so idempotency keys are scoped per certificate.
+	TLSClientCertScope bool
+
+	// TLSReloadInterval is how often the certificate files are checked for changes.
+	TLSReloadInterval time.Duration
+
+	// APIKeysFile is a JSON file of hashed API keys and the merchant each
+	// belongs to. Every payment endpoint then needs a key, and each merchant's
+	// idempotency keys are kept apart. Empty leaves the API open.
+	APIKeysFile string
+
+	// SigningSecretsFile is a JSON file of HMAC secrets for merchants that
+	// sign their requests. Their unsigned requests are then rejected.
+	// Empty means nobody has to sign.
+	SigningSecretsFile string
+
+	// SignatureTolerance is how far a signed request's timestamp may be from
+	// our clock, either way, before it's rejected as stale.
+	SignatureTolerance time.Duration
+
+	// EncryptionKeysFile is a JSON key ring for encrypting cached response
+	// bodies. The first key encrypts, the rest only decrypt, for rotation.
+	// Empty stores bodies in plaintext.
+	EncryptionKeysFile string
+
+	// StoreCompression is the codec large cached response bodies are
+	// compressed with, "gzip", "deflate" or "off".
+	StoreCompression string
+
+	// StoreCompressionMinBytes is the smallest body that gets compressed.
+	StoreCompressionMinBytes int64
+
+	// AdminToken protects the /admin API. Left empty, the admin API
+	// isn't mounted at all, there's no "open by default" mode.
+	AdminToken string
+
+	// AuditLogPath is the JSON-lines file every idempotency decision is
+	// appended to. Empty disables the audit log.
+	AuditLogPath string
+
+	// AuditMaxBytes rotates the audit file once it grows past this size.
+	AuditMaxBytes int64
 }
 
 // Default returns a Config with sane defaults that satisfy the spec out of the box.
 // main.go will call this
 func Default() *Config {
 	return &Config{
-		Port:            ":8080",
-		ProcessingDelay: 2 * time.Second,
-		KeyTTL:          24 * time.Hour,
-		SweepInterval:   10 * time.Minute,
+		Port:               ":8080",
+		ProcessingDelay:    2 * time.Second,
+		ProcessorTimeout:   10 * time.Second,
+		AuthorizationTTL:   7 * 24 * time.Hour,
+		AsyncWorkers:       8,
+		AsyncQueueSize:     100,
+		RateLimitPerMinute: 300,
+		RateLimitBurst:     50,
+		BatchWorkers:       10,
+		BatchMaxItems:      500,
+		WebhookMaxAttempts: 8,
+		WebhookBackoff:     time.Second,
+		WebhookTimeout:     10 * time.Second,
+		KeyTTL:             24 * time.Hour,
+		SweepInterval:      10 * time.Minute,
+		ShutdownTimeout:    30 * time.Second,
+		DrainRetryAfter:    5 * time.Second,
+		DrainDelay:         5 * time.Second,
+		SignatureTolerance: 5 * time.Minute,
+		TLSMinVersion:      "1.2",
+		TLSReloadInterval:  10 * time.Second,
+		StoreCompression:   "gzip",
+		LogLevel:           slog.LevelInfo,
+		AuditMaxBytes:      100 << 20, // 100 MiB
+
+		StoreCompressionMinBytes: 1024,
+	}
+}
+
+// Load returns Default() with any GATEWAY_* environment variables applied on top.
+// Nothing has to be set, the defaults still run the gateway out of the box,
+// but deployments can tune timeouts without rebuilding.
+func Load() (*Config, error) {
+	cfg := Default()
+
+	env := &envLoader{}
+	env.string("GATEWAY_PORT", &cfg.Port)
+	env.duration("GATEWAY_PROCESSING_DELAY", &cfg.ProcessingDelay)
+	env.duration("GATEWAY_PROCESSING_JITTER", &cfg.ProcessingJitter)
+	env.duration("GATEWAY_PROCESSOR_TIMEOUT", &cfg.ProcessorTimeout)
+	env.rate("GATEWAY_PROCESSOR_DECLINE_RATE", &cfg.ProcessorDeclineRate)
+	env.rate("GATEWAY_PROCESSOR_TIMEOUT_RATE", &cfg.ProcessorTimeoutRate)
+	env.rate("GATEWAY_PROCESSOR_ERROR_RATE", &cfg.ProcessorErrorRate)
+	env.duration("GATEWAY_AUTHORIZATION_TTL", &cfg.AuthorizationTTL)
+	env.int64("GATEWAY_FEE_BPS", &cfg.FeeBasisPoints)
+	env.string("GATEWAY_CURRENCIES_FILE", &cfg.CurrenciesFile)
+	env.int64("GATEWAY_RATE_LIMIT", &cfg.RateLimitPerMinute)
+	env.int64("GATEWAY_RATE_LIMIT_BURST", &cfg.RateLimitBurst)
+	env.bool("GATEWAY_TRUST_CLIENT_ID", &cfg.TrustClientID)
+	env.string("GATEWAY_RISK_RULES_FILE", &cfg.RiskRulesFile)
+	env.int64("GATEWAY_ASYNC_WORKERS", &cfg.AsyncWorkers)
+	env.int64("GATEWAY_ASYNC_QUEUE_SIZE", &cfg.AsyncQueueSize)
+	env.int64("GATEWAY_BATCH_WORKERS", &cfg.BatchWorkers)
+	env.int64("GATEWAY_BATCH_MAX_ITEMS", &cfg.BatchMaxItems)
+	env.string("GATEWAY_WEBHOOKS_FILE", &cfg.WebhooksFile)
+	env.int64("GATEWAY_WEBHOOK_MAX_ATTEMPTS", &cfg.WebhookMaxAttempts)
+	env.duration("GATEWAY_WEBHOOK_BACKOFF", &cfg.WebhookBackoff)
+	env.duration("GATEWAY_WEBHOOK_TIMEOUT", &cfg.WebhookTimeout)
+	env.duration("GATEWAY_KEY_TTL", &cfg.KeyTTL)
+	env.duration("GATEWAY_SWEEP_INTERVAL", &cfg.SweepInterval)
+	env.duration("GATEWAY_SHUTDOWN_TIMEOUT", &cfg.ShutdownTimeout)
+	env.duration("GATEWAY_DRAIN_RETRY_AFTER", &cfg.DrainRetryAfter)
+	env.duration("GATEWAY_DRAIN_DELAY", &cfg.DrainDelay)
+	env.level("GATEWAY_LOG_LEVEL", &cfg.LogLevel)
+	env.string("GATEWAY_TRACE_OUTPUT", &cfg.TraceOutput)
+	env.string("GATEWAY_ADMIN_TOKEN", &cfg.AdminToken)
+	env.string("GATEWAY_TLS_CERT_FILE", &cfg.TLSCertFile)
+	env.string("GATEWAY_TLS_KEY_FILE", &cfg.TLSKeyFile)
+	env.string("GATEWAY_TLS_MIN_VERSION", &cfg.TLSMinVersion)
+	env.string("GATEWAY_TLS_CIPHER_SUITES", &cfg.TLSCipherSuites)
+	env.string("GATEWAY_TLS_CLIENT_CA_FILE", &cfg.TLSClientCAFile)
+	env.bool("GATEWAY_TLS_CLIENT_CERT_SCOPE", &cfg.TLSClientCertScope)
+	env.duration("GATEWAY_TLS_RELOAD_INTERVAL", &cfg.TLSReloadInterval)
+	env.string("GATEWAY_API_KEYS_FILE", &cfg.APIKeysFile)
+	env.string("GATEWAY_SIGNING_SECRETS_FILE", &cfg.SigningSecretsFile)
+	env.duration("GATEWAY_SIGNATURE_TOLERANCE", &cfg.SignatureTolerance)
+	env.string("GATEWAY_ENCRYPTION_KEYS_FILE", &cfg.EncryptionKeysFile)
+	env.string("GATEWAY_STORE_COMPRESSION", &cfg.StoreCompression)
+	env.int64("GATEWAY_STORE_COMPRESSION_MIN_BYTES", &cfg.StoreCompressionMinBytes)
+	env.string("GATEWAY_AUDIT_LOG", &cfg.AuditLogPath)
+	env.int64("GATEWAY_AUDIT_MAX_BYTES", &cfg.AuditMaxBytes)
+
+	if env.err != nil {
+		return nil, env.err
+	}
+	if cfg.FeeBasisPoints < 0 || cfg.FeeBasisPoints > 10000 {
+		return nil, fmt.Errorf("GATEWAY_FEE_BPS: must be between 0 and 10000, got %d", cfg.FeeBasisPoints)
+	}
+	if cfg.AsyncWorkers < 1 {
+		return nil, fmt.Errorf("GATEWAY_ASYNC_WORKERS: must be at least 1, got %d", cfg.AsyncWorkers)
+	}
+	if cfg.RateLimitPerMinute < 0 {
+		return nil, fmt.Errorf("GATEWAY_RATE_LIMIT: must not be negative, got %d", cfg.RateLimitPerMinute)
+	}
+	if cfg.RateLimitBurst < 1 {
+		return nil, fmt.Errorf("GATEWAY_RATE_LIMIT_BURST: must be at least 1, got %d", cfg.RateLimitBurst)
+	}
+	if cfg.BatchWorkers < 1 {
+		return nil, fmt.Errorf("GATEWAY_BATCH_WORKERS: must be at least 1, got %d", cfg.BatchWorkers)
+	}
+	if cfg.BatchMaxItems < 1 {
+		return nil, fmt.Errorf("GATEWAY_BATCH_MAX_ITEMS: must be at least 1, got %d", cfg.BatchMaxItems)
+	}
+	if cfg.WebhookMaxAttempts < 1 {
+		return nil, fmt.Errorf("GATEWAY_WEBHOOK_MAX_ATTEMPTS: must be at least 1, got %d", cfg.WebhookMaxAttempts)
+	}
+	if cfg.DrainDelay < 0 {
+		return nil, fmt.Errorf("GATEWAY_DRAIN_DELAY: must not be negative, got %s", cfg.DrainDelay)
+	}
+	if cfg.AsyncQueueSize < 0 {
+		return nil, fmt.Errorf("GATEWAY_ASYNC_QUEUE_SIZE: must not be negative, got %d", cfg.AsyncQueueSize)
+	}
+	if (cfg.TLSCertFile == "") != (cfg.TLSKeyFile == "") {
+		return nil, fmt.Errorf("GATEWAY_TLS_CERT_FILE and GATEWAY_TLS_KEY_FILE: set both or neither")
+	}
+	if cfg.TLSClientCAFile != "" && cfg.TLSCertFile == "" {
+		return nil, fmt.Errorf("GATEWAY_TLS_CLIENT_CA_FILE: needs GATEWAY_TLS_CERT_FILE, mutual TLS is still TLS")
+	}
+	if cfg.TLSClientCertScope && cfg.TLSClientCAFile == "" {
+		return nil, fmt.Errorf("GATEWAY_TLS_CLIENT_CERT_SCOPE: needs GATEWAY_TLS_CLIENT_CA_FILE, only verified certificates can be trusted")
+	}
+	if cfg.TLSReloadInterval <= 0 {
+		return nil, fmt.Errorf("GATEWAY_TLS_RELOAD_INTERVAL: must be positive, got %s", cfg.TLSReloadInterval)
+	}
+	if cfg.SweepInterval <= 0 {
+		return nil, fmt.Errorf("GATEWAY_SWEEP_INTERVAL: must be positive, got %s", cfg.SweepInterval)
+	}
+	if cfg.StoreCompressionMinBytes < 0 {
+		return nil, fmt.Errorf("GATEWAY_STORE_COMPRESSION_MIN_BYTES: must not be negative, got %d", cfg.StoreCompressionMinBytes)
+	}
+	if cfg.SignatureTolerance <= 0 {
+		return nil, fmt.Errorf("GATEWAY_SIGNATURE_TOLERANCE: must be positive, got %s", cfg.SignatureTolerance)
+	}
+	return cfg, nil
+}
+
+// envLoader reads environment variables into config fields.
+// It keeps the first error it hits so Load can stay a flat list of fields
+// instead of an if-err block per variable.
+type envLoader struct {
+	err error
+}
+
+func (l *envLoader) lookup(name string) (string, bool) {
+	if l.err != nil {
+		return "", false
+	}
+	v, ok := os.LookupEnv(name)
+	if !ok || v == "" {
+		return "", false
+	}
+	return v, true
+}
+
+func (l *envLoader) string(name string, dst *string) {
+	if v, ok := l.lookup(name); ok {
+		*dst = v
+	}
+}
+
+func (l *envLoader) duration(name string, dst *time.Duration) {
+	v, ok := l.lookup(name)
+	if !ok {
+		return
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		l.err = fmt.Errorf("%s: %w", name, err)
+		return
+	}
+	*dst = d
+}
+
+func (l *envLoader) int64(name string, dst *int64) {
+	v, ok := l.lookup(name)
+	if !ok {
+		return
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		l.err = fmt.Errorf("%s: %w", name, err)
+		return
+	}
+	*dst = n
+}
+
+func (l *envLoader) bool(name string, dst *bool) {
+	v, ok := l.lookup(name)
+	if !ok {
+		return
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		l.err = fmt.Errorf("%s: %w", name, err)
+		return
+	}
+	*dst = b
+}
+
+// rate reads a probability, anything outside 0-1 is a config mistake.
+func (l *envLoader) rate(name string, dst *float64) {
+	v, ok := l.lookup(name)
+	if !ok {
+		return
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		l.err = fmt.Errorf("%s: %w", name, err)
+		return
+	}
+	if f < 0 || f > 1 {
+		l.err = fmt.Errorf("%s: must be between 0 and 1, got %v", name, f)
+		return
+	}
+	*dst = f
+}
+
+// level accepts the names slog understands: debug, info, warn, error.
+func (l *envLoader) level(name string, dst *slog.Level) {
+	v, ok := l.lookup(name)
+	if !ok {
+		return
+	}
+	if err := dst.UnmarshalText([]byte(v)); err != nil {
+		l.err = fmt.Errorf("%s: %w", name, err)
 	}
 }
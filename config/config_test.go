@@ -0,0 +1,182 @@
+package config
+
+import (
+	"log/slog"
+	"testing"
+	"time"
+)
+
+func TestLoad_NoEnvironment_ReturnsDefaults(t *testing.T) {
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if *cfg != *Default() {
+		t.Errorf("expected defaults, got %+v", cfg)
+	}
+}
+
+func TestLoad_EnvironmentOverridesDefaults(t *testing.T) {
+	t.Setenv("GATEWAY_PORT", ":9090")
+	t.Setenv("GATEWAY_SHUTDOWN_TIMEOUT", "5s")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if cfg.Port != ":9090" {
+		t.Errorf("expected port :9090, got %s", cfg.Port)
+	}
+	if cfg.ShutdownTimeout != 5*time.Second {
+		t.Errorf("expected shutdown timeout 5s, got %s", cfg.ShutdownTimeout)
+	}
+}
+
+func TestLoad_InvalidDuration_ReturnsError(t *testing.T) {
+	// A typo in a timeout should stop the gateway from starting,
+	// not silently fall back to a default nobody asked for.
+	t.Setenv("GATEWAY_KEY_TTL", "24 hours")
+
+	if _, err := Load(); err == nil {
+		t.Error("expected an error for an unparseable duration")
+	}
+}
+
+func TestLoad_LogLevel(t *testing.T) {
+	t.Setenv("GATEWAY_LOG_LEVEL", "debug")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.LogLevel != slog.LevelDebug {
+		t.Errorf("expected debug level, got %s", cfg.LogLevel)
+	}
+
+	t.Setenv("GATEWAY_LOG_LEVEL", "chatty")
+	if _, err := Load(); err == nil {
+		t.Error("expected an error for an unknown log level")
+	}
+}
+
+func TestLoad_FeeBasisPoints(t *testing.T) {
+	t.Setenv("GATEWAY_FEE_BPS", "150")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.FeeBasisPoints != 150 {
+		t.Errorf("expected 150, got %d", cfg.FeeBasisPoints)
+	}
+
+	t.Setenv("GATEWAY_FEE_BPS", "10001")
+	if _, err := Load(); err == nil {
+		t.Error("expected an error for a fee over 100%")
+	}
+}
+
+func TestLoad_AsyncWorkers(t *testing.T) {
+	t.Setenv("GATEWAY_ASYNC_WORKERS", "0")
+	if _, err := Load(); err == nil {
+		t.Error("expected an error for zero async workers")
+	}
+}
+
+func TestLoad_BatchMaxItems(t *testing.T) {
+	for _, v := range []string{"0", "-1"} {
+		t.Setenv("GATEWAY_BATCH_MAX_ITEMS", v)
+		if _, err := Load(); err == nil {
+			t.Errorf("GATEWAY_BATCH_MAX_ITEMS=%s: expected an error, a batch needs a cap", v)
+		}
+	}
+}
+
+func TestLoad_RateLimit(t *testing.T) {
+	t.Setenv("GATEWAY_RATE_LIMIT", "0")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("expected 0 to turn rate limiting off, got %v", err)
+	}
+	if cfg.RateLimitPerMinute != 0 {
+		t.Errorf("expected 0, got %d", cfg.RateLimitPerMinute)
+	}
+
+	t.Setenv("GATEWAY_RATE_LIMIT_BURST", "0")
+	if _, err := Load(); err == nil {
+		t.Error("expected an error for a zero burst")
+	}
+}
+
+func TestLoad_SignatureTolerance(t *testing.T) {
+	t.Setenv("GATEWAY_SIGNATURE_TOLERANCE", "0s")
+	if _, err := Load(); err == nil {
+		t.Error("expected an error for a zero tolerance")
+	}
+}
+
+func TestLoad_SweepInterval(t *testing.T) {
+	t.Setenv("GATEWAY_SWEEP_INTERVAL", "30s")
+	cfg, err := Load()
+	if err != nil || cfg.SweepInterval != 30*time.Second {
+		t.Errorf("expected 30s, got %v, %v", cfg, err)
+	}
+
+	t.Setenv("GATEWAY_SWEEP_INTERVAL", "0s")
+	if _, err := Load(); err == nil {
+		t.Error("expected an error for a zero sweep interval")
+	}
+}
+
+func TestLoad_DrainDelay(t *testing.T) {
+	t.Setenv("GATEWAY_DRAIN_DELAY", "0s")
+	cfg, err := Load()
+	if err != nil || cfg.DrainDelay != 0 {
+		t.Errorf("expected 0 to shut down straight away, got %v, %v", cfg, err)
+	}
+
+	t.Setenv("GATEWAY_DRAIN_DELAY", "-1s")
+	if _, err := Load(); err == nil {
+		t.Error("expected an error for a negative drain delay")
+	}
+}
+
+func TestLoad_StoreCompression(t *testing.T) {
+	t.Setenv("GATEWAY_STORE_COMPRESSION_MIN_BYTES", "0")
+	if _, err := Load(); err != nil {
+		t.Errorf("expected 0 to compress every body, got %v", err)
+	}
+
+	t.Setenv("GATEWAY_STORE_COMPRESSION_MIN_BYTES", "-1")
+	if _, err := Load(); err == nil {
+		t.Error("expected an error for a negative threshold")
+	}
+}
+
+func TestLoad_TLS(t *testing.T) {
+	t.Setenv("GATEWAY_TLS_CERT_FILE", "cert.pem")
+	if _, err := Load(); err == nil {
+		t.Error("expected an error for a certificate without a key")
+	}
+
+	t.Setenv("GATEWAY_TLS_KEY_FILE", "key.pem")
+	t.Setenv("GATEWAY_TLS_CLIENT_CERT_SCOPE", "true")
+	if _, err := Load(); err == nil {
+		t.Error("expected an error for a client cert scope without client CAs")
+	}
+
+	t.Setenv("GATEWAY_TLS_CLIENT_CA_FILE", "ca.pem")
+	cfg, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cfg.TLSClientCertScope || cfg.TLSMinVersion != "1.2" {
+		t.Errorf("unexpected TLS config %+v", cfg)
+	}
+
+	t.Setenv("GATEWAY_TLS_CLIENT_CERT_SCOPE", "sometimes")
+	if _, err := Load(); err == nil {
+		t.Error("expected an error for a value that isn't a bool")
+	}
+}
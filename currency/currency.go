@@ -0,0 +1,213 @@
+// Package currency is the list of currencies the gateway will charge in,
+// how many decimal places each has, and how much a single payment may be.
+// Validation and formatting both go through it, so adding a market is a
+// config change rather than a code change.
+package currency
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/GordenArcher/Idempotency-Gateway/money"
+)
+
+var (
+	// ErrUnsupported is a currency code the registry has never heard of.
+	ErrUnsupported = errors.New("unsupported currency")
+
+	// ErrDisabled is a known currency that's switched off, e.g. a market
+	// we haven't launched in yet.
+	ErrDisabled = errors.New("currency not enabled")
+
+	// ErrOutOfLimits is an amount below the currency's minimum or above its maximum.
+	ErrOutOfLimits = errors.New("amount outside the allowed range")
+)
+
+// Currency describes one ISO 4217 currency. Min and Max are in minor units.
+type Currency struct {
+	Code     string
+	Name     string
+	Exponent int
+	Min      int64
+	Max      int64
+	Enabled  bool
+}
+
+// Registry looks currencies up by code. It's read-only once built,
+// so it's safe to share between requests.
+type Registry struct {
+	currencies map[string]Currency
+}
+
+// NewRegistry checks every currency and builds a registry from them.
+func NewRegistry(currencies []Currency) (*Registry, error) {
+	r := &Registry{currencies: make(map[string]Currency, len(currencies))}
+	for _, c := range currencies {
+		if err := c.validate(); err != nil {
+			return nil, err
+		}
+		if _, dup := r.currencies[c.Code]; dup {
+			return nil, fmt.Errorf("currency %s: listed twice", c.Code)
+		}
+		r.currencies[c.Code] = c
+	}
+	return r, nil
+}
+
+func (c Currency) validate() error {
+	if len(c.Code) != 3 || strings.ToUpper(c.Code) != c.Code || strings.Trim(c.Code, "ABCDEFGHIJKLMNOPQRSTUVWXYZ") != "" {
+		return fmt.Errorf("currency %q: code must be three upper-case letters", c.Code)
+	}
+	// ISO 4217 tops out at 4 decimal places (CLF, UYW).
+	if c.Exponent < 0 || c.Exponent > 4 {
+		return fmt.Errorf("currency %s: exponent must be between 0 and 4, got %d", c.Code, c.Exponent)
+	}
+	if c.Min < 1 {
+		return fmt.Errorf("currency %s: min must be at least one minor unit", c.Code)
+	}
+	if c.Max < c.Min {
+		return fmt.Errorf("currency %s: max is below min", c.Code)
+	}
+	return nil
+}
+
+// Lookup returns the currency for code, enabled or not.
+func (r *Registry) Lookup(code string) (Currency, bool) {
+	c, ok := r.currencies[code]
+	return c, ok
+}
+
+// Enabled lists the codes payments can currently be made in, sorted.
+func (r *Registry) Enabled() []string {
+	var codes []string
+	for code, c := range r.currencies {
+		if c.Enabled {
+			codes = append(codes, code)
+		}
+	}
+	sort.Strings(codes)
+	return codes
+}
+
+// Parse turns the amount and currency from a request into Money, or
+// explains, in terms of that currency, why it can't be charged.
+func (r *Registry) Parse(amount money.Decimal, code string) (money.Money, error) {
+	c, ok := r.currencies[code]
+	if !ok {
+		return money.Money{}, fmt.Errorf("%w %q, supported currencies are %s", ErrUnsupported, code, strings.Join(r.Enabled(), ", "))
+	}
+	if !c.Enabled {
+		return money.Money{}, fmt.Errorf("%w: %s payments are not enabled", ErrDisabled, c.Code)
+	}
+
+	m, err := money.New(amount, c.Code, c.Exponent)
+	if errors.Is(err, money.ErrPrecision) {
+		if c.Exponent == 0 {
+			return money.Money{}, fmt.Errorf("%w: %s amounts must be whole numbers", money.ErrPrecision, c.Code)
+		}
+		return money.Money{}, fmt.Errorf("%w: %s amounts have at most %d decimal places", money.ErrPrecision, c.Code, c.Exponent)
+	}
+	if err != nil {
+		return money.Money{}, err
+	}
+
+	if m.Minor < c.Min {
+		return money.Money{}, fmt.Errorf("%w: the minimum %s payment is %s", ErrOutOfLimits, c.Code, c.money(c.Min))
+	}
+	if m.Minor > c.Max {
+		return money.Money{}, fmt.Errorf("%w: the maximum %s payment is %s", ErrOutOfLimits, c.Code, c.money(c.Max))
+	}
+	return m, nil
+}
+
+// Format formats minor units of code for humans, e.g. "100.50 GHS".
+// Codes the registry doesn't know are printed as raw minor units.
+func (r *Registry) Format(minor int64, code string) string {
+	c, ok := r.currencies[code]
+	if !ok {
+		return fmt.Sprintf("%d %s", minor, code)
+	}
+	return c.money(minor).String()
+}
+
+func (c Currency) money(minor int64) money.Money {
+	return money.Money{Minor: minor, Currency: c.Code, Exponent: c.Exponent}
+}
+
+// Default is the registry used when no file is configured: the West African
+// currencies we know about, with only GHS switched on, which is what the
+// gateway has always accepted.
+func Default() *Registry {
+	r, err := NewRegistry([]Currency{
+		{Code: "GHS", Name: "Ghanaian cedi", Exponent: 2, Min: 1, Max: 1_000_000_00, Enabled: true},
+		{Code: "NGN", Name: "Nigerian naira", Exponent: 2, Min: 1, Max: 100_000_000_00},
+		{Code: "XOF", Name: "West African CFA franc", Exponent: 0, Min: 1, Max: 500_000_000},
+		{Code: "GMD", Name: "Gambian dalasi", Exponent: 2, Min: 1, Max: 10_000_000_00},
+		{Code: "SLE", Name: "Sierra Leonean leone", Exponent: 2, Min: 1, Max: 10_000_000_00},
+		{Code: "LRD", Name: "Liberian dollar", Exponent: 2, Min: 1, Max: 100_000_000_00},
+		{Code: "GNF", Name: "Guinean franc", Exponent: 0, Min: 1, Max: 10_000_000_000},
+		{Code: "CVE", Name: "Cape Verdean escudo", Exponent: 2, Min: 1, Max: 100_000_000_00},
+	})
+	if err != nil {
+		panic(err) // the list above is wrong, not something to handle at runtime
+	}
+	return r
+}
+
+// fileCurrency is one entry in the registry file. Limits are written as
+// decimals in the currency's own units, so operators don't have to
+// count zeros.
+type fileCurrency struct {
+	Code     string        `json:"code"`
+	Name     string        `json:"name"`
+	Exponent int           `json:"exponent"`
+	Min      money.Decimal `json:"min"`
+	Max      money.Decimal `json:"max"`
+	Enabled  bool          `json:"enabled"`
+}
+
+// Load reads a registry from a JSON file holding an array of currencies:
+//
+//	[{"code": "GHS", "name": "Ghanaian cedi", "exponent": 2, "min": "1.00", "max": "50000.00", "enabled": true}]
+//
+// The file replaces the defaults entirely. An empty path returns Default().
+func Load(path string) (*Registry, error) {
+	if path == "" {
+		return Default(), nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []fileCurrency
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&entries); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	currencies := make([]Currency, 0, len(entries))
+	for _, e := range entries {
+		c := Currency{Code: e.Code, Name: e.Name, Exponent: e.Exponent, Enabled: e.Enabled}
+		if c.Min, err = e.Min.Minor(e.Exponent); err != nil {
+			return nil, fmt.Errorf("%s: currency %s min: %w", path, e.Code, err)
+		}
+		if c.Max, err = e.Max.Minor(e.Exponent); err != nil {
+			return nil, fmt.Errorf("%s: currency %s max: %w", path, e.Code, err)
+		}
+		currencies = append(currencies, c)
+	}
+
+	r, err := NewRegistry(currencies)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return r, nil
+}
@@ -0,0 +1,156 @@
+package currency
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/GordenArcher/Idempotency-Gateway/money"
+)
+
+func decimal(t *testing.T, s string) money.Decimal {
+	t.Helper()
+	d, err := money.ParseDecimal(s)
+	if err != nil {
+		t.Fatalf("ParseDecimal(%q): %v", s, err)
+	}
+	return d
+}
+
+func testRegistry(t *testing.T) *Registry {
+	t.Helper()
+	r, err := NewRegistry([]Currency{
+		{Code: "GHS", Exponent: 2, Min: 100, Max: 5_000_00, Enabled: true},
+		{Code: "XOF", Exponent: 0, Min: 100, Max: 1_000_000, Enabled: true},
+		{Code: "NGN", Exponent: 2, Min: 1, Max: 1_000_00},
+	})
+	if err != nil {
+		t.Fatalf("NewRegistry: %v", err)
+	}
+	return r
+}
+
+func TestParse_Valid(t *testing.T) {
+	r := testRegistry(t)
+
+	m, err := r.Parse(decimal(t, "250.5"), "GHS")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if m.Minor != 25050 || m.Exponent != 2 || m.String() != "250.50 GHS" {
+		t.Errorf("unexpected money %+v", m)
+	}
+
+	m, err = r.Parse(decimal(t, "1500"), "XOF")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if m.Minor != 1500 || m.String() != "1500 XOF" {
+		t.Errorf("unexpected money %+v", m)
+	}
+}
+
+func TestParse_Errors(t *testing.T) {
+	r := testRegistry(t)
+
+	cases := []struct {
+		amount, code string
+		err          error
+		message      string
+	}{
+		{"10", "USD", ErrUnsupported, "supported currencies are GHS, XOF"},
+		{"10", "NGN", ErrDisabled, "NGN payments are not enabled"},
+		{"10.005", "GHS", money.ErrPrecision, "GHS amounts have at most 2 decimal places"},
+		{"150.5", "XOF", money.ErrPrecision, "XOF amounts must be whole numbers"},
+		{"0.50", "GHS", ErrOutOfLimits, "the minimum GHS payment is 1.00 GHS"},
+		{"-5", "GHS", ErrOutOfLimits, "the minimum GHS payment is 1.00 GHS"},
+		{"5000.01", "GHS", ErrOutOfLimits, "the maximum GHS payment is 5000.00 GHS"},
+		{"99", "XOF", ErrOutOfLimits, "the minimum XOF payment is 100 XOF"},
+	}
+
+	for _, tc := range cases {
+		_, err := r.Parse(decimal(t, tc.amount), tc.code)
+		if !errors.Is(err, tc.err) {
+			t.Errorf("%s %s: expected %v, got %v", tc.amount, tc.code, tc.err, err)
+			continue
+		}
+		if !strings.Contains(err.Error(), tc.message) {
+			t.Errorf("%s %s: expected message containing %q, got %q", tc.amount, tc.code, tc.message, err)
+		}
+	}
+}
+
+func TestNewRegistry_RejectsBadEntries(t *testing.T) {
+	bad := []Currency{
+		{Code: "ghs", Exponent: 2, Min: 1, Max: 10},
+		{Code: "GH", Exponent: 2, Min: 1, Max: 10},
+		{Code: "GHS", Exponent: 5, Min: 1, Max: 10},
+		{Code: "GHS", Exponent: 2, Min: 0, Max: 10},
+		{Code: "GHS", Exponent: 2, Min: 10, Max: 1},
+	}
+	for _, c := range bad {
+		if _, err := NewRegistry([]Currency{c}); err == nil {
+			t.Errorf("expected an error for %+v", c)
+		}
+	}
+
+	dup := Currency{Code: "GHS", Exponent: 2, Min: 1, Max: 10}
+	if _, err := NewRegistry([]Currency{dup, dup}); err == nil {
+		t.Error("expected an error for a duplicate code")
+	}
+}
+
+func TestDefault_OnlyGHSEnabled(t *testing.T) {
+	got := Default().Enabled()
+	if len(got) != 1 || got[0] != "GHS" {
+		t.Errorf("expected only GHS enabled by default, got %v", got)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "currencies.json")
+	os.WriteFile(path, []byte(`[
+		{"code": "GHS", "name": "Ghanaian cedi", "exponent": 2, "min": "1.00", "max": "50000", "enabled": true},
+		{"code": "XOF", "exponent": 0, "min": 100, "max": "10000000", "enabled": true}
+	]`), 0o644)
+
+	r, err := Load(path)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ghs, ok := r.Lookup("GHS")
+	if !ok || ghs.Min != 100 || ghs.Max != 50_000_00 || ghs.Name != "Ghanaian cedi" {
+		t.Errorf("unexpected GHS entry %+v", ghs)
+	}
+	if got := r.Enabled(); strings.Join(got, ",") != "GHS,XOF" {
+		t.Errorf("expected GHS and XOF enabled, got %v", got)
+	}
+	if _, ok := r.Lookup("NGN"); ok {
+		t.Error("the file should replace the defaults, not add to them")
+	}
+}
+
+func TestLoad_Invalid(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"syntax":    `[{"code": "GHS"`,
+		"unknown":   `[{"code": "GHS", "exponent": 2, "min": "1", "max": "10", "enabeld": true}]`,
+		"precision": `[{"code": "GHS", "exponent": 2, "min": "0.001", "max": "10"}]`,
+		"missing":   `[{"code": "GHS", "exponent": 2, "max": "10"}]`,
+	}
+
+	for name, content := range files {
+		path := filepath.Join(dir, name+".json")
+		os.WriteFile(path, []byte(content), 0o644)
+		if _, err := Load(path); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+
+	if _, err := Load(filepath.Join(dir, "nope.json")); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
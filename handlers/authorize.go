@@ -0,0 +1,213 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/GordenArcher/Idempotency-Gateway/models"
+	"github.com/GordenArcher/Idempotency-Gateway/money"
+	"github.com/GordenArcher/Idempotency-Gateway/payments"
+	"github.com/GordenArcher/Idempotency-Gateway/processor"
+	"github.com/GordenArcher/Idempotency-Gateway/webhooks"
+)
+
+// Authorize handles POST /payments/authorize, the first half of a two-phase
+// payment. The funds are held but not taken, the payment stays authorized
+// until it's captured, voided, or AuthorizationTTL runs out.
+func (h *PaymentHandler) Authorize(w http.ResponseWriter, r *http.Request) {
+	req, amount, ok := h.decodePaymentRequest(w, r)
+	if !ok {
+		return
+	}
+
+	decision, ok := h.screen(w, r, req, amount)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := h.processorContext(r)
+	defer cancel()
+
+	auth, err := h.processor.Authorize(ctx, processor.AuthorizeRequest{
+		Reference: requestKey(r, ""),
+		Amount:    amount.Minor,
+		Currency:  amount.Currency,
+	})
+	if err != nil {
+		writeProcessorError(w, err)
+		return
+	}
+
+	now := time.Now().UTC()
+	payment := &models.Payment{
+		ID:              payments.NewID(),
+		Status:          models.PaymentAuthorized,
+		Amount:          amount,
+		AuthorizationID: auth.ID,
+		Merchant:        merchant(r),
+		Risk:            decision,
+		CreatedAt:       now,
+		UpdatedAt:       now,
+	}
+	if h.cfg.AuthorizationTTL > 0 {
+		payment.ExpiresAt = now.Add(h.cfg.AuthorizationTTL)
+	}
+	if err := h.payments.Create(payment); err != nil {
+		slog.Error("payment authorized but not recorded",
+			"error", err, "payment_id", payment.ID, "authorization_id", auth.ID)
+		writeError(w, http.StatusInternalServerError, "payment was authorized but could not be recorded, authorization "+auth.ID)
+		return
+	}
+
+	h.publish(r, webhooks.PaymentAuthorized, payment.ID, paymentView(payment))
+	w.Header().Set("Location", "/payments/"+payment.ID)
+	writeJSON(w, http.StatusCreated, paymentView(payment))
+}
+
+// Capture handles POST /payments/{id}/capture. The body is optional:
+// {"amount": "..."} captures part of the authorization, no amount captures all of it.
+func (h *PaymentHandler) Capture(w http.ResponseWriter, r *http.Request) {
+	var req models.CaptureRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, http.StatusBadRequest, "invalid request body, expected {amount}")
+		return
+	}
+
+	payment, err := h.findPayment(r, r.PathValue("id"))
+	if err != nil {
+		writePaymentError(w, err)
+		return
+	}
+
+	amount := payment.Amount.Minor
+	if !req.Amount.IsZero() {
+		m, err := money.New(req.Amount, payment.Amount.Currency, payment.Amount.Exponent)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if m.Minor <= 0 {
+			writeError(w, http.StatusBadRequest, "amount must be > 0")
+			return
+		}
+		if m.Minor > payment.Amount.Minor {
+			writeError(w, http.StatusUnprocessableEntity, "cannot capture "+m.String()+", only "+payment.Amount.String()+" was authorized")
+			return
+		}
+		amount = m.Minor
+	}
+
+	captured, ok := h.transition(w, r, payment.ID, models.PaymentCaptured,
+		func(ctx context.Context, p *models.Payment) (string, error) {
+			capture, err := h.processor.Capture(ctx, processor.CaptureRequest{
+				Reference:       requestKey(r, ""),
+				AuthorizationID: p.AuthorizationID,
+				Amount:          amount,
+			})
+			return capture.ID, err
+		},
+		func(p *models.Payment, id string) {
+			p.CaptureID = id
+			p.Captured = amount
+		},
+	)
+	if !ok {
+		return
+	}
+
+	h.postCharge(r, captured.ID, captured.Amount.WithMinor(captured.Captured))
+	h.publish(r, webhooks.PaymentCaptured, captured.ID, paymentView(captured))
+	writeJSON(w, http.StatusOK, paymentView(captured))
+}
+
+// Void handles POST /payments/{id}/void, releasing an authorization
+// that hasn't been captured.
+func (h *PaymentHandler) Void(w http.ResponseWriter, r *http.Request) {
+	payment, err := h.findPayment(r, r.PathValue("id"))
+	if err != nil {
+		writePaymentError(w, err)
+		return
+	}
+
+	voided, ok := h.transition(w, r, payment.ID, models.PaymentVoided,
+		func(ctx context.Context, p *models.Payment) (string, error) {
+			void, err := h.processor.Void(ctx, processor.VoidRequest{
+				Reference:       requestKey(r, ""),
+				AuthorizationID: p.AuthorizationID,
+			})
+			return void.ID, err
+		},
+		func(p *models.Payment, id string) {
+			p.VoidID = id
+		},
+	)
+	if !ok {
+		return
+	}
+
+	h.publish(r, webhooks.PaymentVoided, voided.ID, paymentView(voided))
+	writeJSON(w, http.StatusOK, paymentView(voided))
+}
+
+// transition runs one processor-backed state change:
+//  1. Begin the move in an Update, which rejects illegal transitions and
+//     anything racing with another capture or void.
+//  2. Call the processor (call gets the payment as it was when the move began).
+//  3. Complete the move and let apply record the processor's ID, or Abort it
+//     if the processor said no.
+//
+// It returns the payment as saved. If ok is false it has already written the error.
+func (h *PaymentHandler) transition(w http.ResponseWriter, r *http.Request, id string, to models.PaymentStatus,
+	call func(ctx context.Context, p *models.Payment) (string, error), apply func(p *models.Payment, processorID string)) (updated *models.Payment, ok bool) {
+
+	began, err := h.payments.Update(id, func(p *models.Payment) error {
+		return payments.Begin(p, to, time.Now())
+	})
+	if err != nil {
+		writePaymentError(w, err)
+		return nil, false
+	}
+
+	ctx, cancel := h.processorContext(r)
+	defer cancel()
+
+	processorID, callErr := call(ctx, began)
+
+	updated, err = h.payments.Update(id, func(p *models.Payment) error {
+		if callErr != nil {
+			payments.Abort(p)
+			return nil
+		}
+		apply(p, processorID)
+		payments.Complete(p, time.Now())
+		return nil
+	})
+	if callErr != nil {
+		writeProcessorError(w, callErr)
+		return nil, false
+	}
+	if err != nil {
+		slog.Error("payment transition made at the processor but not recorded",
+			"error", err, "payment_id", id, "to", to, "processor_id", processorID)
+		writeError(w, http.StatusInternalServerError, "the processor accepted the "+string(to)+" but it could not be recorded, reference "+processorID)
+		return nil, false
+	}
+	return updated, true
+}
+
+// writePaymentError maps repository and state machine errors onto HTTP statuses.
+func writePaymentError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, payments.ErrNotFound):
+		writeError(w, http.StatusNotFound, "payment not found")
+	case errors.Is(err, payments.ErrIllegalTransition), errors.Is(err, payments.ErrInFlight):
+		writeError(w, http.StatusConflict, err.Error())
+	default:
+		writeError(w, http.StatusInternalServerError, err.Error())
+	}
+}
@@ -0,0 +1,185 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// twoPhaseMux routes the two-phase endpoints the way main.go does.
+func twoPhaseMux(h *PaymentHandler) *http.ServeMux {
+	mux := refundMux(h)
+	mux.HandleFunc("POST /payments/authorize", h.Authorize)
+	mux.HandleFunc("POST /payments/{id}/capture", h.Capture)
+	mux.HandleFunc("POST /payments/{id}/void", h.Void)
+	return mux
+}
+
+func post(mux http.Handler, path, key, body string) (*httptest.ResponseRecorder, map[string]interface{}) {
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	req.Header.Set("Idempotency-Key", key)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+
+	var resp map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	return w, resp
+}
+
+func authorizePayment(t *testing.T, mux http.Handler, amount string) string {
+	t.Helper()
+	w, resp := post(mux, "/payments/authorize", "auth-"+amount, `{"amount": "`+amount+`", "currency": "GHS"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("authorize: expected 201, got %d: %s", w.Code, w.Body)
+	}
+	if resp["status"] != "authorized" {
+		t.Fatalf("expected status authorized, got %v", resp["status"])
+	}
+	if w.Header().Get("Location") != "/payments/"+resp["id"].(string) {
+		t.Errorf("unexpected Location %q", w.Header().Get("Location"))
+	}
+	return resp["id"].(string)
+}
+
+func TestAuthorize_ThenCapture_ThenRefund(t *testing.T) {
+	mux := twoPhaseMux(NewPaymentHandler(testConfig()))
+	id := authorizePayment(t, mux, "80.00")
+
+	// Nothing has been captured, so there's nothing to refund yet.
+	if w, _ := post(mux, "/payments/"+id+"/refunds", "r0", ``); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("expected 422 refunding an uncaptured payment, got %d", w.Code)
+	}
+
+	w, resp := post(mux, "/payments/"+id+"/capture", "c1", ``)
+	if w.Code != http.StatusOK {
+		t.Fatalf("capture: expected 200, got %d: %s", w.Code, w.Body)
+	}
+	if resp["status"] != "captured" || resp["captured_amount"] != "80.00" || resp["transaction_id"] == "" {
+		t.Errorf("unexpected payment after capture %v", resp)
+	}
+
+	if w, _ := post(mux, "/payments/"+id+"/refunds", "r1", ``); w.Code != http.StatusCreated {
+		t.Errorf("expected the captured payment to be refundable, got %d: %s", w.Code, w.Body)
+	}
+}
+
+func TestCapture_Partial(t *testing.T) {
+	mux := twoPhaseMux(NewPaymentHandler(testConfig()))
+	id := authorizePayment(t, mux, "80.00")
+
+	w, resp := post(mux, "/payments/"+id+"/capture", "c1", `{"amount": "50.00"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body)
+	}
+	if resp["captured_amount"] != "50.00" || resp["amount"] != "80.00" {
+		t.Errorf("unexpected payment %v", resp)
+	}
+
+	// Refunds are limited to what was captured, not what was authorized.
+	if w, _ := post(mux, "/payments/"+id+"/refunds", "r1", `{"amount": "60.00"}`); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("expected 422 refunding more than was captured, got %d", w.Code)
+	}
+}
+
+func TestCapture_MoreThanAuthorized_Returns422(t *testing.T) {
+	mux := twoPhaseMux(NewPaymentHandler(testConfig()))
+	id := authorizePayment(t, mux, "80.00")
+
+	if w, _ := post(mux, "/payments/"+id+"/capture", "c1", `{"amount": "80.01"}`); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("expected 422, got %d", w.Code)
+	}
+}
+
+func TestIllegalTransitions_Return409(t *testing.T) {
+	mux := twoPhaseMux(NewPaymentHandler(testConfig()))
+
+	voided := authorizePayment(t, mux, "10.00")
+	if w, resp := post(mux, "/payments/"+voided+"/void", "v1", ``); w.Code != http.StatusOK || resp["status"] != "voided" {
+		t.Fatalf("void: expected 200 voided, got %d %v", w.Code, resp)
+	}
+
+	captured := authorizePayment(t, mux, "20.00")
+	post(mux, "/payments/"+captured+"/capture", "c1", ``)
+
+	cases := []struct {
+		path, message string
+	}{
+		{"/payments/" + voided + "/capture", "cannot capture a payment that is voided"},
+		{"/payments/" + voided + "/void", "cannot void a payment that is voided"},
+		{"/payments/" + captured + "/void", "cannot void a payment that is captured"},
+		{"/payments/" + captured + "/capture", "cannot capture a payment that is captured"},
+	}
+
+	for i, tc := range cases {
+		w, _ := post(mux, tc.path, fmt.Sprintf("illegal-%d", i), ``)
+		if w.Code != http.StatusConflict {
+			t.Errorf("%s: expected 409, got %d", tc.path, w.Code)
+		}
+		if !strings.Contains(w.Body.String(), tc.message) {
+			t.Errorf("%s: expected %q, got %s", tc.path, tc.message, w.Body)
+		}
+	}
+}
+
+func TestAuthorization_Expires(t *testing.T) {
+	cfg := testConfig()
+	cfg.AuthorizationTTL = 10 * time.Millisecond
+	mux := twoPhaseMux(NewPaymentHandler(cfg))
+	id := authorizePayment(t, mux, "10.00")
+
+	time.Sleep(20 * time.Millisecond)
+
+	payment := getPaymentStatus(t, mux, id)
+	if payment["status"] != "expired" {
+		t.Errorf("expected GET to show expired, got %v", payment["status"])
+	}
+
+	w, _ := post(mux, "/payments/"+id+"/capture", "c1", ``)
+	if w.Code != http.StatusConflict || !strings.Contains(w.Body.String(), "expired") {
+		t.Errorf("expected 409 capturing an expired authorization, got %d %s", w.Code, w.Body)
+	}
+}
+
+func TestCaptureAndVoid_Concurrently_OnlyOneWins(t *testing.T) {
+	// Different keys, so the idempotency layer can't serialise them.
+	// The state machine has to.
+	cfg := testConfig()
+	cfg.ProcessingDelay = 20 * time.Millisecond
+	h := NewPaymentHandler(cfg)
+	mux := twoPhaseMux(h)
+	id := authorizePayment(t, mux, "10.00")
+
+	var wg sync.WaitGroup
+	var captureCode, voidCode int
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		w, _ := post(mux, "/payments/"+id+"/capture", "race-capture", ``)
+		captureCode = w.Code
+	}()
+	go func() {
+		defer wg.Done()
+		w, _ := post(mux, "/payments/"+id+"/void", "race-void", ``)
+		voidCode = w.Code
+	}()
+	wg.Wait()
+
+	if (captureCode == http.StatusOK) == (voidCode == http.StatusOK) {
+		t.Fatalf("expected exactly one of capture/void to succeed, got capture %d, void %d", captureCode, voidCode)
+	}
+	if captureCode != http.StatusConflict && voidCode != http.StatusConflict {
+		t.Errorf("expected the loser to get 409, got capture %d, void %d", captureCode, voidCode)
+	}
+}
+
+func TestCapture_UnknownPayment_Returns404(t *testing.T) {
+	mux := twoPhaseMux(NewPaymentHandler(testConfig()))
+	if w, _ := post(mux, "/payments/pay_missing/capture", "c1", ``); w.Code != http.StatusNotFound {
+		t.Errorf("expected 404, got %d", w.Code)
+	}
+}
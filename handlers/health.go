@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"runtime/debug"
+	"time"
+
+	"github.com/GordenArcher/Idempotency-Gateway/store"
+)
+
+// readinessTimeout bounds how long /readyz waits on the store.
+// An orchestrator probe usually times out at 1s, answer before it does.
+const readinessTimeout = 500 * time.Millisecond
+
+// HealthHandler serves the liveness, readiness and version endpoints
+// the orchestrator and on-call engineers look at.
+type HealthHandler struct {
+	store    store.Store
+	draining func() bool
+}
+
+// NewHealthHandler builds the health endpoints. draining reports whether
+// graceful shutdown has started, a draining instance is alive but not ready.
+func NewHealthHandler(s store.Store, draining func() bool) *HealthHandler {
+	return &HealthHandler{store: s, draining: draining}
+}
+
+// Healthz handles GET /healthz.
+// If we can run this handler the process is alive, that's all liveness means.
+// It deliberately checks nothing else, a store hiccup shouldn't get us restarted.
+func (h *HealthHandler) Healthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// Readyz handles GET /readyz.
+// Ready means: not shutting down, and the store (including its sweeper)
+// reports healthy. Any failed check returns 503 so the load balancer
+// stops routing to us, and the body says which check failed.
+func (h *HealthHandler) Readyz(w http.ResponseWriter, r *http.Request) {
+	checks := map[string]string{}
+	ready := true
+
+	if h.draining != nil && h.draining() {
+		checks["draining"] = "server is shutting down"
+		ready = false
+	} else {
+		checks["draining"] = "ok"
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+	defer cancel()
+	if err := h.store.Health(ctx); err != nil {
+		checks["store"] = err.Error()
+		ready = false
+	} else {
+		checks["store"] = "ok"
+	}
+
+	status, code := "ready", http.StatusOK
+	if !ready {
+		status, code = "not_ready", http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]any{
+		"status": status,
+		"checks": checks,
+	})
+}
+
+// Version handles GET /version.
+func (h *HealthHandler) Version(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(CurrentBuild())
+}
+
+// BuildInfo describes the running binary.
+type BuildInfo struct {
+	Version   string `json:"version"`
+	GoVersion string `json:"go_version"`
+	Revision  string `json:"revision,omitempty"`
+	BuildTime string `json:"build_time,omitempty"`
+	Modified  bool   `json:"modified,omitempty"`
+}
+
+// CurrentBuild reads the version stamped into the binary by the Go toolchain.
+// A `go build` from a git checkout gets the commit and time for free,
+// `go install ...@v1.2.3` gets the module version. `go run` and tests get "(devel)".
+func CurrentBuild() BuildInfo {
+	info := BuildInfo{Version: "(devel)"}
+
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+
+	info.GoVersion = bi.GoVersion
+	if bi.Main.Version != "" {
+		info.Version = bi.Main.Version
+	}
+	for _, setting := range bi.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			info.Revision = setting.Value
+		case "vcs.time":
+			info.BuildTime = setting.Value
+		case "vcs.modified":
+			info.Modified = setting.Value == "true"
+		}
+	}
+	return info
+}
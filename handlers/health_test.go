@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/GordenArcher/Idempotency-Gateway/store"
+)
+
+func readyStore(t *testing.T) *store.MemoryStore {
+	s := store.NewMemoryStore(time.Hour)
+	s.StartSweeper(time.Minute)
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func readyz(h *HealthHandler) (int, map[string]any) {
+	w := httptest.NewRecorder()
+	h.Readyz(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+	var body map[string]any
+	json.Unmarshal(w.Body.Bytes(), &body)
+	return w.Code, body
+}
+
+func TestHealthz_AlwaysOK(t *testing.T) {
+	// Liveness doesn't look at the store, a closed store is still a live process.
+	s := store.NewMemoryStore(time.Hour)
+	s.Close()
+	h := NewHealthHandler(s, func() bool { return true })
+
+	w := httptest.NewRecorder()
+	h.Healthz(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+	if w.Code != http.StatusOK {
+		t.Errorf("expected 200, got %d", w.Code)
+	}
+}
+
+func TestReadyz_ReadyWhenStoreHealthyAndNotDraining(t *testing.T) {
+	h := NewHealthHandler(readyStore(t), func() bool { return false })
+
+	code, body := readyz(h)
+
+	if code != http.StatusOK || body["status"] != "ready" {
+		t.Errorf("expected 200 ready, got %d %v", code, body)
+	}
+}
+
+func TestReadyz_NotReadyWhileDraining(t *testing.T) {
+	h := NewHealthHandler(readyStore(t), func() bool { return true })
+
+	code, body := readyz(h)
+
+	if code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503 while draining, got %d", code)
+	}
+	if checks := body["checks"].(map[string]any); checks["draining"] == "ok" {
+		t.Errorf("expected draining check to fail, got %v", checks)
+	}
+}
+
+func TestReadyz_NotReadyWithoutSweeper(t *testing.T) {
+	h := NewHealthHandler(store.NewMemoryStore(time.Hour), func() bool { return false })
+
+	code, body := readyz(h)
+
+	if code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503 without a sweeper, got %d", code)
+	}
+	if checks := body["checks"].(map[string]any); checks["store"] == "ok" {
+		t.Errorf("expected store check to fail, got %v", checks)
+	}
+}
+
+func TestVersion_ReturnsBuildInfo(t *testing.T) {
+	h := NewHealthHandler(readyStore(t), nil)
+
+	w := httptest.NewRecorder()
+	h.Version(w, httptest.NewRequest(http.MethodGet, "/version", nil))
+
+	var info BuildInfo
+	if err := json.Unmarshal(w.Body.Bytes(), &info); err != nil {
+		t.Fatalf("response is not valid JSON: %v", err)
+	}
+	if info.Version == "" || info.GoVersion == "" {
+		t.Errorf("expected version and go_version, got %+v", info)
+	}
+}
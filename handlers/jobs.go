@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/GordenArcher/Idempotency-Gateway/jobs"
+)
+
+// JobsHandler serves the status of requests that were processed async.
+type JobsHandler struct {
+	pool *jobs.Pool
+}
+
+func NewJobsHandler(pool *jobs.Pool) *JobsHandler {
+	return &JobsHandler{pool: pool}
+}
+
+// Status handles GET /jobs/{id}.
+// While the job is queued or running this says how far along it is. Once
+// it's complete the handler's response is in "result", and retrying the
+// original request with its key replays that same response.
+func (h *JobsHandler) Status(w http.ResponseWriter, r *http.Request) {
+	// Jobs are owned by the idempotency scope they were queued under, which
+	// is the merchant. Someone else's job is reported as missing.
+	job, ok := h.pool.Get(r.PathValue("id"))
+	if !ok || job.Owner != merchant(r) {
+		writeError(w, http.StatusNotFound, "job not found")
+		return
+	}
+
+	view := map[string]any{
+		"id":         job.ID,
+		"status":     job.State,
+		"created_at": job.CreatedAt,
+	}
+	switch job.State {
+	case jobs.StateQueued:
+		view["queue_position"] = job.Position
+	case jobs.StateProcessing:
+		view["started_at"] = job.StartedAt
+	case jobs.StateComplete:
+		view["started_at"] = job.StartedAt
+		view["completed_at"] = job.CompletedAt
+		view["result"] = resultView(job.Result)
+	}
+	writeJSON(w, http.StatusOK, view)
+}
+
+// resultView embeds the handler's response. Every handler here writes JSON,
+// so the body goes in as-is rather than as an escaped string.
+func resultView(res *jobs.Result) map[string]any {
+	view := map[string]any{
+		"status_code": res.StatusCode,
+		"headers":     res.Headers,
+	}
+	if json.Valid(res.Body) {
+		view["body"] = json.RawMessage(res.Body)
+	} else if len(res.Body) > 0 {
+		view["body"] = string(res.Body)
+	}
+	return view
+}
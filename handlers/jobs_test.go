@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/GordenArcher/Idempotency-Gateway/jobs"
+)
+
+func TestJobStatus(t *testing.T) {
+	pool := jobs.NewPool(jobs.Config{Workers: 1, QueueSize: 1})
+	defer pool.Close(context.Background())
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /jobs/{id}", NewJobsHandler(pool).Status)
+
+	id := jobs.NewID()
+	pool.Submit(id, "", func() jobs.Result {
+		return jobs.Result{StatusCode: http.StatusCreated, Body: []byte(`{"status":"success"}`)}
+	})
+
+	var body map[string]any
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/jobs/"+id, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("expected 200, got %d", w.Code)
+		}
+		body = nil
+		json.Unmarshal(w.Body.Bytes(), &body)
+		if body["status"] == string(jobs.StateComplete) {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	result, _ := body["result"].(map[string]any)
+	if result == nil {
+		t.Fatalf("expected a result once complete, got %v", body)
+	}
+	if result["status_code"] != float64(http.StatusCreated) {
+		t.Errorf("expected status_code 201, got %v", result["status_code"])
+	}
+	// The handler's JSON is embedded, not escaped into a string.
+	if inner, _ := result["body"].(map[string]any); inner["status"] != "success" {
+		t.Errorf("expected the handler's body, got %v", result["body"])
+	}
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/jobs/job_missing", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown job, got %d", w.Code)
+	}
+}
+
+func TestJobStatus_OtherMerchant_Returns404(t *testing.T) {
+	pool := jobs.NewPool(jobs.Config{Workers: 1})
+	defer pool.Close(context.Background())
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /jobs/{id}", NewJobsHandler(pool).Status)
+
+	id := jobs.NewID()
+	pool.Submit(id, "acme", func() jobs.Result { return jobs.Result{StatusCode: http.StatusCreated} })
+
+	for merchant, want := range map[string]int{"acme": http.StatusOK, "globex": http.StatusNotFound, "": http.StatusNotFound} {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, asMerchant(httptest.NewRequest(http.MethodGet, "/jobs/"+id, nil), merchant))
+		if w.Code != want {
+			t.Errorf("merchant %q: expected %d, got %d", merchant, want, w.Code)
+		}
+	}
+}
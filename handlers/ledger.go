@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/GordenArcher/Idempotency-Gateway/ledger"
+)
+
+const (
+	defaultLedgerPageSize = 100
+	maxLedgerPageSize     = 1000
+)
+
+// LedgerHandler serves read-only views of the ledger for reconciliation.
+type LedgerHandler struct {
+	ledger ledger.Ledger
+}
+
+func NewLedgerHandler(l ledger.Ledger) *LedgerHandler {
+	return &LedgerHandler{ledger: l}
+}
+
+// Balances handles GET /admin/ledger/balances.
+// Debit balances are positive, credit balances negative, so across all
+// accounts each currency sums to zero.
+func (h *LedgerHandler) Balances(w http.ResponseWriter, r *http.Request) {
+	balances := h.ledger.Balances()
+
+	views := make([]map[string]any, len(balances))
+	for i, b := range balances {
+		views[i] = map[string]any{
+			"account":       b.Account,
+			"currency":      b.Amount.Currency,
+			"balance":       b.Amount.Decimal(),
+			"balance_minor": b.Amount.Minor,
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"balances": views})
+}
+
+// Entries handles GET /admin/ledger/accounts/{account}/entries?cursor=&limit=.
+// cursor is the seq of the last entry on the previous page.
+func (h *LedgerHandler) Entries(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	limit := defaultLedgerPageSize
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxLedgerPageSize {
+			writeError(w, http.StatusBadRequest, "limit must be between 1 and "+strconv.Itoa(maxLedgerPageSize))
+			return
+		}
+		limit = n
+	}
+
+	var after int64
+	if v := q.Get("cursor"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 0 {
+			writeError(w, http.StatusBadRequest, "cursor must be a non-negative integer")
+			return
+		}
+		after = n
+	}
+
+	entries := h.ledger.Entries(r.PathValue("account"), after, limit)
+
+	views := make([]map[string]any, len(entries))
+	for i, e := range entries {
+		postings := make([]map[string]any, len(e.Postings))
+		for j, p := range e.Postings {
+			postings[j] = map[string]any{
+				"account":      p.Account,
+				"currency":     p.Amount.Currency,
+				"amount":       p.Amount.Decimal(),
+				"amount_minor": p.Amount.Minor,
+			}
+		}
+		views[i] = map[string]any{
+			"seq":        e.Seq,
+			"reference":  e.Reference,
+			"kind":       e.Kind,
+			"payment_id": e.PaymentID,
+			"postings":   postings,
+			"created_at": e.CreatedAt,
+		}
+	}
+
+	// A full page might have more behind it, a short one is the end.
+	var next string
+	if len(entries) == limit {
+		next = strconv.FormatInt(entries[len(entries)-1].Seq, 10)
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"entries":     views,
+		"next_cursor": next,
+	})
+}
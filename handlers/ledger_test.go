@@ -0,0 +1,138 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/GordenArcher/Idempotency-Gateway/ledger"
+)
+
+func ledgerMux(h *PaymentHandler, l ledger.Ledger) *http.ServeMux {
+	mux := twoPhaseMux(h)
+	mux.HandleFunc("POST /process-payment", h.ProcessPayment)
+	lh := NewLedgerHandler(l)
+	mux.HandleFunc("GET /admin/ledger/balances", lh.Balances)
+	mux.HandleFunc("GET /admin/ledger/accounts/{account}/entries", lh.Entries)
+	return mux
+}
+
+func balances(t *testing.T, mux http.Handler) map[string]string {
+	t.Helper()
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/ledger/balances", nil))
+
+	var resp struct {
+		Balances []struct {
+			Account string `json:"account"`
+			Balance string `json:"balance"`
+		} `json:"balances"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+
+	got := map[string]string{}
+	for _, b := range resp.Balances {
+		got[b.Account] = b.Balance
+	}
+	return got
+}
+
+func TestLedger_ChargeFeeAndRefund(t *testing.T) {
+	cfg := testConfig()
+	cfg.FeeBasisPoints = 150
+	l := ledger.NewMemoryLedger()
+	h := NewPaymentHandler(cfg, WithLedger(l))
+	mux := ledgerMux(h, l)
+
+	w, resp := post(mux, "/process-payment", "pay-1", `{"amount": "100.00", "currency": "GHS"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d", w.Code)
+	}
+	post(mux, "/payments/"+resp["id"].(string)+"/refunds", "refund-1", `{"amount": "40.00"}`)
+
+	want := map[string]string{
+		ledger.ProcessorReceivable: "60.00",
+		ledger.MerchantPayable:     "-58.50",
+		ledger.FeeRevenue:          "-1.50",
+	}
+	got := balances(t, mux)
+	for account, balance := range want {
+		if got[account] != balance {
+			t.Errorf("%s: expected %s, got %s", account, balance, got[account])
+		}
+	}
+}
+
+func TestLedger_TwoPhaseCapturePostsCapturedAmount(t *testing.T) {
+	l := ledger.NewMemoryLedger()
+	h := NewPaymentHandler(testConfig(), WithLedger(l))
+	mux := ledgerMux(h, l)
+
+	id := authorizePayment(t, mux, "80.00")
+	if got := balances(t, mux); len(got) != 0 {
+		t.Errorf("an authorization moves no money, expected no balances, got %v", got)
+	}
+
+	post(mux, "/payments/"+id+"/capture", "cap-1", `{"amount": "50.00"}`)
+	if got := balances(t, mux)[ledger.ProcessorReceivable]; got != "50.00" {
+		t.Errorf("expected 50.00 receivable, got %s", got)
+	}
+}
+
+func TestLedger_RetriedRequestPostsOnce(t *testing.T) {
+	// Running the handler twice with the same key is what happens when
+	// a key expires and the client retries. The ledger must not move twice.
+	l := ledger.NewMemoryLedger()
+	h := NewPaymentHandler(testConfig(), WithLedger(l))
+	mux := ledgerMux(h, l)
+
+	post(mux, "/process-payment", "retry-key", `{"amount": "25.00", "currency": "GHS"}`)
+	post(mux, "/process-payment", "retry-key", `{"amount": "25.00", "currency": "GHS"}`)
+
+	if got := balances(t, mux)[ledger.ProcessorReceivable]; got != "25.00" {
+		t.Errorf("expected 25.00 receivable after a retry, got %s", got)
+	}
+}
+
+func TestLedger_Entries(t *testing.T) {
+	l := ledger.NewMemoryLedger()
+	h := NewPaymentHandler(testConfig(), WithLedger(l))
+	mux := ledgerMux(h, l)
+
+	for _, key := range []string{"k1", "k2", "k3"} {
+		post(mux, "/process-payment", key, `{"amount": "1.00", "currency": "GHS"}`)
+	}
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/ledger/accounts/merchant_payable/entries?limit=2", nil))
+	var page struct {
+		Entries []struct {
+			Kind     string           `json:"kind"`
+			Postings []map[string]any `json:"postings"`
+		} `json:"entries"`
+		NextCursor string `json:"next_cursor"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &page)
+
+	if len(page.Entries) != 2 || page.NextCursor != "2" {
+		t.Fatalf("unexpected first page %s", w.Body)
+	}
+	if page.Entries[0].Kind != "charge" || len(page.Entries[0].Postings) != 2 {
+		t.Errorf("unexpected entry %+v", page.Entries[0])
+	}
+
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/ledger/accounts/merchant_payable/entries?limit=2&cursor=2", nil))
+	json.Unmarshal(w.Body.Bytes(), &page)
+	if len(page.Entries) != 1 || page.NextCursor != "" {
+		t.Errorf("unexpected last page %s", w.Body)
+	}
+
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/admin/ledger/accounts/merchant_payable/entries?limit=0", nil))
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "limit") {
+		t.Errorf("expected 400 for limit=0, got %d", w.Code)
+	}
+}
@@ -1,21 +1,123 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
-	"fmt"
+	"errors"
+	"log/slog"
 	"net/http"
+	"net/url"
 	"time"
 
+	"github.com/GordenArcher/Idempotency-Gateway/auth"
 	"github.com/GordenArcher/Idempotency-Gateway/config"
+	"github.com/GordenArcher/Idempotency-Gateway/currency"
+	"github.com/GordenArcher/Idempotency-Gateway/ledger"
 	"github.com/GordenArcher/Idempotency-Gateway/models"
+	"github.com/GordenArcher/Idempotency-Gateway/money"
+	"github.com/GordenArcher/Idempotency-Gateway/payments"
+	"github.com/GordenArcher/Idempotency-Gateway/processor"
+	"github.com/GordenArcher/Idempotency-Gateway/risk"
+	"github.com/GordenArcher/Idempotency-Gateway/webhooks"
 )
 
 type PaymentHandler struct {
-	cfg *config.Config
+	cfg        *config.Config
+	processor  processor.Provider
+	currencies *currency.Registry
+	payments   payments.Repository
+	ledger     ledger.Ledger
+	events     webhooks.Publisher
+	risk       *risk.Engine
 }
 
-func NewPaymentHandler(cfg *config.Config) *PaymentHandler {
-	return &PaymentHandler{cfg: cfg}
+// Option customises a PaymentHandler.
+type Option func(*PaymentHandler)
+
+// WithProcessor swaps the default simulated processor for p.
+func WithProcessor(p processor.Provider) Option {
+	return func(h *PaymentHandler) {
+		h.processor = p
+	}
+}
+
+// WithCurrencies sets the currencies payments are accepted in.
+// Without it the handler uses currency.Default().
+func WithCurrencies(r *currency.Registry) Option {
+	return func(h *PaymentHandler) {
+		h.currencies = r
+	}
+}
+
+// WithRepository sets where payment records are kept.
+// Without it they go in a fresh in-memory repository.
+func WithRepository(r payments.Repository) Option {
+	return func(h *PaymentHandler) {
+		h.payments = r
+	}
+}
+
+// WithLedger sets the ledger charges, fees and refunds are posted to.
+// Without it they go to a fresh in-memory ledger.
+func WithLedger(l ledger.Ledger) Option {
+	return func(h *PaymentHandler) {
+		h.ledger = l
+	}
+}
+
+// WithWebhooks sends an event to p whenever a payment or refund completes.
+// Without it no events are sent.
+func WithWebhooks(p webhooks.Publisher) Option {
+	return func(h *PaymentHandler) {
+		h.events = p
+	}
+}
+
+// WithRisk screens every new payment with e before it goes to the processor.
+// Without it every payment is allowed.
+func WithRisk(e *risk.Engine) Option {
+	return func(h *PaymentHandler) {
+		h.risk = e
+	}
+}
+
+func NewPaymentHandler(cfg *config.Config, opts ...Option) *PaymentHandler {
+	h := &PaymentHandler{cfg: cfg}
+	for _, opt := range opts {
+		opt(h)
+	}
+	if h.processor == nil {
+		h.processor = newSimulator(cfg)
+	}
+	if h.currencies == nil {
+		h.currencies = currency.Default()
+	}
+	if h.payments == nil {
+		h.payments = payments.NewMemoryRepository()
+	}
+	if h.ledger == nil {
+		h.ledger = ledger.NewMemoryLedger()
+	}
+	return h
+}
+
+// newSimulator builds the default processor from config. ProcessingDelay
+// is the authorization round-trip, which is where the spec's 2 seconds go.
+func newSimulator(cfg *config.Config) *processor.Simulator {
+	var latency processor.Latency = processor.Fixed(cfg.ProcessingDelay)
+	if cfg.ProcessingJitter > 0 {
+		latency = processor.Uniform{
+			Min: max(cfg.ProcessingDelay-cfg.ProcessingJitter, 0),
+			Max: cfg.ProcessingDelay + cfg.ProcessingJitter,
+		}
+	}
+
+	return processor.NewSimulator(processor.SimulatorConfig{
+		Latency:     latency,
+		DeclineRate: cfg.ProcessorDeclineRate,
+		TimeoutRate: cfg.ProcessorTimeoutRate,
+		ErrorRate:   cfg.ProcessorErrorRate,
+	})
 }
 
 // ProcessPayment handles POST /process-payment.
@@ -24,45 +126,320 @@ func NewPaymentHandler(cfg *config.Config) *PaymentHandler {
 // dealing with a genuinely new, first-time request.
 // It doesn't need to know anything about keys or caching.
 func (h *PaymentHandler) ProcessPayment(w http.ResponseWriter, r *http.Request) {
+	req, amount, ok := h.decodePaymentRequest(w, r)
+	if !ok {
+		return
+	}
 
-	var req models.PaymentRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{
-			"error": "invalid request body, expected {amount, currency}",
-		})
+	decision, ok := h.screen(w, r, req, amount)
+	if !ok {
 		return
 	}
 
-	if req.Amount <= 0 || req.Currency == "" {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{
-			"error": "amount must be > 0 and currency must not be empty",
-		})
+	ctx, cancel := h.processorContext(r)
+	defer cancel()
+
+	reference := requestKey(r, "")
+
+	authorization, err := h.processor.Authorize(ctx, processor.AuthorizeRequest{
+		Reference: reference,
+		Amount:    amount.Minor,
+		Currency:  amount.Currency,
+	})
+	if err != nil {
+		writeProcessorError(w, err)
 		return
 	}
 
-	if req.Currency != "GHS" {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]string{
-			"error": "unsupported currency — only GHS is allowed",
-		})
+	capture, err := h.processor.Capture(ctx, processor.CaptureRequest{
+		Reference:       reference,
+		AuthorizationID: authorization.ID,
+		Amount:          authorization.Amount,
+	})
+	if err != nil {
+		writeProcessorError(w, err)
 		return
 	}
 
-	time.Sleep(h.cfg.ProcessingDelay)
+	now := time.Now().UTC()
+	payment := &models.Payment{
+		ID:              payments.NewID(),
+		Status:          models.PaymentCaptured,
+		Amount:          amount,
+		AuthorizationID: authorization.ID,
+		CaptureID:       capture.ID,
+		Captured:        capture.Amount,
+		Merchant:        merchant(r),
+		Risk:            decision,
+		CreatedAt:       now,
+		UpdatedAt:       now,
+	}
+	if err := h.payments.Create(payment); err != nil {
+		// The money has moved, so this is bad. Log everything needed to
+		// reconcile by hand, and don't pretend it failed at the processor.
+		slog.Error("payment captured but not recorded",
+			"error", err, "payment_id", payment.ID, "capture_id", capture.ID)
+		writeError(w, http.StatusInternalServerError, "payment was captured but could not be recorded, transaction "+capture.ID)
+		return
+	}
+	h.postCharge(r, payment.ID, amount)
+	h.publish(r, webhooks.PaymentCaptured, payment.ID, paymentView(payment))
 
+	// amount goes out as a string ("250.50") so clients don't parse it
+	// into a float either, amount_minor is there for anyone who wants the integer.
 	response := map[string]interface{}{
-		"status":   "success",
-		"message":  fmt.Sprintf("Charged %.2f %s", req.Amount, req.Currency),
-		"amount":   req.Amount,
-		"currency": req.Currency,
+		"id":             payment.ID,
+		"status":         "success",
+		"message":        "Charged " + amount.String(),
+		"amount":         amount.Decimal(),
+		"amount_minor":   amount.Minor,
+		"currency":       amount.Currency,
+		"transaction_id": capture.ID,
+		"created_at":     payment.CreatedAt,
+	}
+	if decision.Action != models.RiskAllow {
+		response["risk"] = riskView(decision)
+	}
+
+	w.Header().Set("Location", "/payments/"+payment.ID)
+	writeJSON(w, http.StatusCreated, response)
+}
+
+// decodePaymentRequest reads {amount, currency} from the body and checks it
+// against the currency registry. If it returns false it has already
+// written the 400.
+func (h *PaymentHandler) decodePaymentRequest(w http.ResponseWriter, r *http.Request) (models.PaymentRequest, money.Money, bool) {
+	var req models.PaymentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body, expected {amount, currency}")
+		return req, money.Money{}, false
+	}
+
+	if req.Amount.IsZero() || req.Currency == "" {
+		writeError(w, http.StatusBadRequest, "amount must be > 0 and currency must not be empty")
+		return req, money.Money{}, false
+	}
+
+	// The registry checks the currency is enabled, the precision and the
+	// limits, and phrases the error in that currency's terms. From here on
+	// the amount is an integer in minor units, nothing downstream sees a float.
+	amount, err := h.currencies.Parse(req.Amount, req.Currency)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return req, money.Money{}, false
+	}
+	return req, amount, true
+}
+
+// screen runs the risk rules on a new payment. A denied payment is recorded
+// with status denied and answered with a 402 here, so it never reaches the
+// processor, and the middleware caches that 402 like any other response.
+// Review doesn't stop anything, the decision is kept on the payment.
+func (h *PaymentHandler) screen(w http.ResponseWriter, r *http.Request, req models.PaymentRequest, amount money.Money) (models.RiskDecision, bool) {
+	decision := h.risk.Evaluate(risk.Transaction{
+		Merchant:   merchant(r),
+		CustomerID: req.CustomerID,
+		Card:       req.Card,
+		Country:    req.Country,
+		Amount:     amount,
+		At:         time.Now(),
+	})
+	if decision.Action != models.RiskDeny {
+		return decision, true
+	}
+
+	now := time.Now().UTC()
+	payment := &models.Payment{
+		ID:        payments.NewID(),
+		Status:    models.PaymentDenied,
+		Amount:    amount,
+		Merchant:  merchant(r),
+		Risk:      decision,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := h.payments.Create(payment); err != nil {
+		// Nothing was charged, so failing the request is safe.
+		slog.Error("denied payment not recorded", "error", err, "payment_id", payment.ID)
+		writeError(w, http.StatusInternalServerError, "payment could not be recorded")
+		return decision, false
+	}
+
+	view := paymentView(payment)
+	h.publish(r, webhooks.PaymentDenied, payment.ID, view)
+	view["error"] = "payment denied by risk rules"
+	w.Header().Set("Location", "/payments/"+payment.ID)
+	writeJSON(w, http.StatusPaymentRequired, view)
+	return decision, false
+}
+
+// processorContext is the context processor calls run under.
+// The client hanging up must not abort a payment halfway through.
+// The middleware still caches whatever we return, so their retry
+// gets the real outcome instead of starting over.
+func (h *PaymentHandler) processorContext(r *http.Request) (context.Context, context.CancelFunc) {
+	ctx := context.WithoutCancel(r.Context())
+	if h.cfg.ProcessorTimeout > 0 {
+		return context.WithTimeout(ctx, h.cfg.ProcessorTimeout)
+	}
+	return ctx, func() {}
+}
+
+// postCharge records a capture in the ledger: the full amount is owed to
+// us by the processor and to the merchant, then the fee moves from the
+// merchant's side to ours.
+//
+// The references come from the idempotency key, so if this request is ever
+// run twice (its key expired and the client retried) nothing posts twice.
+// Failing to post doesn't fail the request, the money has already moved,
+// it's logged loudly for reconciliation instead.
+func (h *PaymentHandler) postCharge(r *http.Request, paymentID string, amount money.Money) {
+	key := requestKey(r, paymentID)
+	entries := []ledger.Entry{
+		ledger.Transfer(ledger.KindCharge, ledger.Reference(ledger.KindCharge, key), paymentID,
+			ledger.ProcessorReceivable, ledger.MerchantPayable, amount),
+	}
+	if fee := ledger.Fee(amount.Minor, h.cfg.FeeBasisPoints); fee > 0 {
+		entries = append(entries, ledger.Transfer(ledger.KindFee, ledger.Reference(ledger.KindFee, key), paymentID,
+			ledger.MerchantPayable, ledger.FeeRevenue, amount.WithMinor(fee)))
+	}
+	h.post(entries...)
+}
+
+func (h *PaymentHandler) post(entries ...ledger.Entry) {
+	for _, e := range entries {
+		if _, _, err := h.ledger.Post(e); err != nil {
+			slog.Error("failed to post ledger entry",
+				"error", err, "payment_id", e.PaymentID, "kind", e.Kind, "reference", e.Reference)
+		}
+	}
+}
+
+// requestKey is what processor references, ledger references and event IDs
+// are derived from: the idempotency key, or fallback when a request somehow
+// arrives without one. Like the middleware's store key it's prefixed with
+// the merchant, two merchants picking the same key mustn't collide here either.
+func requestKey(r *http.Request, fallback string) string {
+	key := r.Header.Get("Idempotency-Key")
+	if key == "" {
+		key = fallback
+	}
+	if m := merchant(r); m != "" && key != "" {
+		return url.QueryEscape(m) + ":" + key
+	}
+	return key
+}
+
+// merchant is who the request was authenticated as, "" with authentication off.
+func merchant(r *http.Request) string {
+	return auth.Merchant(r.Context())
+}
+
+// findPayment looks up a payment the request's merchant is allowed to see.
+// Another merchant's payment is reported as not found rather than forbidden,
+// so IDs can't be probed.
+func (h *PaymentHandler) findPayment(r *http.Request, id string) (*models.Payment, error) {
+	payment, err := h.payments.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if payment.Merchant != merchant(r) {
+		return nil, payments.ErrNotFound
+	}
+	return payment, nil
+}
+
+// publish tells webhook endpoints about what this request did. The event
+// ID comes from the idempotency key, same as the ledger references, so a
+// re-run request doesn't notify anyone twice.
+func (h *PaymentHandler) publish(r *http.Request, eventType, fallback string, data any) {
+	if h.events == nil {
+		return
+	}
+	e, err := webhooks.NewEvent(eventType, requestKey(r, fallback), data)
+	if err != nil {
+		slog.Error("failed to build webhook event", "error", err, "type", eventType)
+		return
+	}
+	e.Merchant = merchant(r)
+	h.events.Publish(e)
+}
+
+// GetPayment handles GET /payments/{id}.
+// It reads the repository directly, no idempotency key needed for a read.
+func (h *PaymentHandler) GetPayment(w http.ResponseWriter, r *http.Request) {
+	payment, err := h.findPayment(r, r.PathValue("id"))
+	if errors.Is(err, payments.ErrNotFound) {
+		writeError(w, http.StatusNotFound, "payment not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// Expiry is worked out from ExpiresAt whenever a payment is looked at,
+	// nothing has to run at the moment it happens.
+	payments.Expire(payment, time.Now())
+	writeJSON(w, http.StatusOK, paymentView(payment))
+}
+
+// paymentView is how a payment record looks in JSON.
+func paymentView(p *models.Payment) map[string]any {
+	view := map[string]any{
+		"id":              p.ID,
+		"status":          p.Status,
+		"amount":          p.Amount.Decimal(),
+		"amount_minor":    p.Amount.Minor,
+		"currency":        p.Amount.Currency,
+		"transaction_id":  p.CaptureID,
+		"captured_amount": p.Amount.WithMinor(p.Captured).Decimal(),
+		"refunded_amount": p.Amount.WithMinor(p.Refunded).Decimal(),
+		"created_at":      p.CreatedAt,
+		"updated_at":      p.UpdatedAt,
 	}
+	if !p.ExpiresAt.IsZero() {
+		view["expires_at"] = p.ExpiresAt
+	}
+	if p.Risk.Action != "" && p.Risk.Action != models.RiskAllow {
+		view["risk"] = riskView(p.Risk)
+	}
+	return view
+}
+
+func riskView(d models.RiskDecision) map[string]any {
+	return map[string]any{
+		"decision": d.Action,
+		"rules":    d.Rules,
+		"reasons":  d.Reasons,
+	}
+}
+
+// writeProcessorError maps processor failures onto HTTP statuses.
+// A decline is a final answer (402). Timeouts and upstream errors are 5xx
+// because the client did nothing wrong and the outcome may be unknown.
+func writeProcessorError(w http.ResponseWriter, err error) {
+	status, body := http.StatusBadGateway, map[string]string{"error": err.Error()}
 
+	switch {
+	case errors.Is(err, processor.ErrDeclined):
+		status = http.StatusPaymentRequired
+		body["status"] = "declined"
+	case errors.Is(err, processor.ErrTimeout):
+		status = http.StatusGatewayTimeout
+	case errors.Is(err, processor.ErrInvalidRequest):
+		status = http.StatusUnprocessableEntity
+	}
+
+	writeJSON(w, status, body)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(response)
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	writeJSON(w, status, map[string]string{"error": msg})
 }
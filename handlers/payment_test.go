@@ -1,14 +1,19 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
 	"time"
 
+	"github.com/GordenArcher/Idempotency-Gateway/auth"
 	"github.com/GordenArcher/Idempotency-Gateway/config"
+	"github.com/GordenArcher/Idempotency-Gateway/currency"
+	"github.com/GordenArcher/Idempotency-Gateway/processor"
 )
 
 // testConfig returns a config with zero delay so tests don't wait 2 seconds each.
@@ -69,8 +74,12 @@ func TestProcessPayment_ResponseContainsAmountAndCurrency(t *testing.T) {
 	var resp map[string]interface{}
 	json.Unmarshal(w.Body.Bytes(), &resp)
 
-	if resp["amount"] != 250.50 {
-		t.Errorf("expected amount 250.50, got %v", resp["amount"])
+	// The amount comes back as a string so it never round-trips through a float.
+	if resp["amount"] != "250.50" {
+		t.Errorf("expected amount \"250.50\", got %v", resp["amount"])
+	}
+	if resp["amount_minor"] != float64(25050) {
+		t.Errorf("expected amount_minor 25050, got %v", resp["amount_minor"])
 	}
 	if resp["currency"] != "GHS" {
 		t.Errorf("expected currency GHS, got %v", resp["currency"])
@@ -121,6 +130,78 @@ func TestProcessPayment_NegativeAmount_Returns400(t *testing.T) {
 	}
 }
 
+func TestProcessPayment_ExcessPrecision_Returns400(t *testing.T) {
+	// GHS has two decimal places, there's no such thing as half a pesewa.
+	handler := NewPaymentHandler(testConfig())
+
+	for _, amount := range []string{`100.005`, `"100.005"`, `1e2`, `"abc"`, `true`} {
+		body := `{"amount": ` + amount + `, "currency": "GHS"}`
+		req := httptest.NewRequest(http.MethodPost, "/process-payment", strings.NewReader(body))
+		w := httptest.NewRecorder()
+
+		handler.ProcessPayment(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("amount %s: expected 400, got %d", amount, w.Code)
+		}
+	}
+}
+
+func TestProcessPayment_StringAmount_Returns201(t *testing.T) {
+	handler := NewPaymentHandler(testConfig())
+
+	body := `{"amount": "0.30", "currency": "GHS"}`
+	req := httptest.NewRequest(http.MethodPost, "/process-payment", strings.NewReader(body))
+	w := httptest.NewRecorder()
+
+	handler.ProcessPayment(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201 for a string amount, got %d: %s", w.Code, w.Body)
+	}
+	if !strings.Contains(w.Body.String(), "Charged 0.30 GHS") {
+		t.Errorf("unexpected body: %s", w.Body)
+	}
+}
+
+func TestProcessPayment_CurrencyRegistry(t *testing.T) {
+	currencies, err := currency.NewRegistry([]currency.Currency{
+		{Code: "GHS", Exponent: 2, Min: 1, Max: 1_000_00, Enabled: true},
+		{Code: "XOF", Exponent: 0, Min: 1, Max: 1_000_000, Enabled: true},
+		{Code: "NGN", Exponent: 2, Min: 1, Max: 1_000_00},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := NewPaymentHandler(testConfig(), WithCurrencies(currencies))
+
+	cases := []struct {
+		body    string
+		status  int
+		message string
+	}{
+		{`{"amount": 1500, "currency": "XOF"}`, http.StatusCreated, "Charged 1500 XOF"},
+		{`{"amount": 1500.5, "currency": "XOF"}`, http.StatusBadRequest, "XOF amounts must be whole numbers"},
+		{`{"amount": 10, "currency": "NGN"}`, http.StatusBadRequest, "NGN payments are not enabled"},
+		{`{"amount": 10, "currency": "USD"}`, http.StatusBadRequest, "unsupported currency"},
+		{`{"amount": 1000.01, "currency": "GHS"}`, http.StatusBadRequest, "the maximum GHS payment is 1000.00 GHS"},
+	}
+
+	for _, tc := range cases {
+		req := httptest.NewRequest(http.MethodPost, "/process-payment", strings.NewReader(tc.body))
+		w := httptest.NewRecorder()
+
+		handler.ProcessPayment(w, req)
+
+		if w.Code != tc.status {
+			t.Errorf("%s: expected %d, got %d", tc.body, tc.status, w.Code)
+		}
+		if !strings.Contains(w.Body.String(), tc.message) {
+			t.Errorf("%s: expected %q in %s", tc.body, tc.message, w.Body)
+		}
+	}
+}
+
 func TestProcessPayment_MissingCurrency_Returns400(t *testing.T) {
 	// Currency is required, we need to know what denomination to charge in.
 	handler := NewPaymentHandler(testConfig())
@@ -163,3 +244,182 @@ func TestProcessPayment_ContentTypeIsJSON(t *testing.T) {
 		t.Errorf("expected Content-Type: application/json, got %s", contentType)
 	}
 }
+
+// fakeProvider fails Authorize with authErr, or succeeds with fixed IDs.
+type fakeProvider struct {
+	authErr  error
+	captured processor.CaptureRequest
+}
+
+func (f *fakeProvider) Authorize(ctx context.Context, req processor.AuthorizeRequest) (processor.Authorization, error) {
+	if f.authErr != nil {
+		return processor.Authorization{}, f.authErr
+	}
+	return processor.Authorization{ID: "auth_1", Amount: req.Amount, Currency: req.Currency}, nil
+}
+
+func (f *fakeProvider) Capture(ctx context.Context, req processor.CaptureRequest) (processor.Capture, error) {
+	f.captured = req
+	return processor.Capture{ID: "cap_1", AuthorizationID: req.AuthorizationID, Amount: req.Amount}, nil
+}
+
+func (f *fakeProvider) Void(ctx context.Context, req processor.VoidRequest) (processor.Void, error) {
+	return processor.Void{}, processor.ErrInvalidRequest
+}
+
+func (f *fakeProvider) Refund(ctx context.Context, req processor.RefundRequest) (processor.Refund, error) {
+	return processor.Refund{}, processor.ErrInvalidRequest
+}
+
+func TestProcessPayment_CapturesInMinorUnits(t *testing.T) {
+	provider := &fakeProvider{}
+	handler := NewPaymentHandler(testConfig(), WithProcessor(provider))
+
+	req := httptest.NewRequest(http.MethodPost, "/process-payment", strings.NewReader(`{"amount": 250.50, "currency": "GHS"}`))
+	req.Header.Set("Idempotency-Key", "key-1")
+	w := httptest.NewRecorder()
+
+	handler.ProcessPayment(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d", w.Code)
+	}
+	if provider.captured.Amount != 25050 {
+		t.Errorf("expected 25050 pesewas captured, got %d", provider.captured.Amount)
+	}
+	if provider.captured.Reference != "key-1" {
+		t.Errorf("expected the idempotency key as reference, got %q", provider.captured.Reference)
+	}
+
+	var resp map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	if resp["transaction_id"] != "cap_1" {
+		t.Errorf("expected transaction_id cap_1, got %v", resp["transaction_id"])
+	}
+}
+
+func TestProcessPayment_ProcessorErrors(t *testing.T) {
+	// Every processor failure has to come back as something the client
+	// can act on, never a generic 500.
+	cases := []struct {
+		err  error
+		want int
+	}{
+		{processor.ErrDeclined, http.StatusPaymentRequired},
+		{processor.ErrTimeout, http.StatusGatewayTimeout},
+		{processor.ErrUnavailable, http.StatusBadGateway},
+		{processor.ErrInvalidRequest, http.StatusUnprocessableEntity},
+	}
+
+	for _, tc := range cases {
+		provider := &fakeProvider{authErr: fmt.Errorf("upstream: %w", tc.err)}
+		handler := NewPaymentHandler(testConfig(), WithProcessor(provider))
+
+		req := httptest.NewRequest(http.MethodPost, "/process-payment", strings.NewReader(`{"amount": 100, "currency": "GHS"}`))
+		w := httptest.NewRecorder()
+
+		handler.ProcessPayment(w, req)
+
+		if w.Code != tc.want {
+			t.Errorf("%v: expected %d, got %d", tc.err, tc.want, w.Code)
+		}
+	}
+}
+
+func TestProcessPayment_SimulatorTimeout_Returns504(t *testing.T) {
+	cfg := testConfig()
+	cfg.ProcessorTimeout = 20 * time.Millisecond
+	cfg.ProcessorTimeoutRate = 1
+	handler := NewPaymentHandler(cfg)
+
+	req := httptest.NewRequest(http.MethodPost, "/process-payment", strings.NewReader(`{"amount": 100, "currency": "GHS"}`))
+	w := httptest.NewRecorder()
+
+	handler.ProcessPayment(w, req)
+
+	if w.Code != http.StatusGatewayTimeout {
+		t.Errorf("expected 504 when the processor hangs, got %d", w.Code)
+	}
+}
+
+func TestProcessPayment_ThenGetPayment(t *testing.T) {
+	handler := NewPaymentHandler(testConfig())
+
+	req := httptest.NewRequest(http.MethodPost, "/process-payment", strings.NewReader(`{"amount": "99.90", "currency": "GHS"}`))
+	w := httptest.NewRecorder()
+	handler.ProcessPayment(w, req)
+
+	var created map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &created)
+	id, _ := created["id"].(string)
+	if !strings.HasPrefix(id, "pay_") {
+		t.Fatalf("expected a payment ID in the 201 body, got %v", created["id"])
+	}
+	if got := w.Header().Get("Location"); got != "/payments/"+id {
+		t.Errorf("expected Location /payments/%s, got %q", id, got)
+	}
+
+	// Route through a mux so r.PathValue is populated the way it is in main.go.
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /payments/{id}", handler.GetPayment)
+
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/payments/"+id, nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	var got map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &got)
+	if got["id"] != id || got["status"] != "captured" || got["amount"] != "99.90" || got["currency"] != "GHS" {
+		t.Errorf("unexpected payment record %v", got)
+	}
+	if got["transaction_id"] != created["transaction_id"] {
+		t.Errorf("expected transaction_id %v, got %v", created["transaction_id"], got["transaction_id"])
+	}
+}
+
+func TestGetPayment_Unknown_Returns404(t *testing.T) {
+	handler := NewPaymentHandler(testConfig())
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /payments/{id}", handler.GetPayment)
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/payments/pay_missing", nil))
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected 404, got %d", w.Code)
+	}
+}
+
+func asMerchant(r *http.Request, merchant string) *http.Request {
+	return r.WithContext(auth.WithIdentity(r.Context(), auth.Identity{Merchant: merchant}))
+}
+
+func TestGetPayment_OtherMerchant_Returns404(t *testing.T) {
+	provider := &fakeProvider{}
+	handler := NewPaymentHandler(testConfig(), WithProcessor(provider))
+
+	req := httptest.NewRequest(http.MethodPost, "/process-payment", strings.NewReader(`{"amount": 10, "currency": "GHS"}`))
+	req.Header.Set("Idempotency-Key", "order-1")
+	w := httptest.NewRecorder()
+	handler.ProcessPayment(w, asMerchant(req, "acme"))
+
+	// The processor dedupes on reference, so it has to be per merchant too.
+	if provider.captured.Reference != "acme:order-1" {
+		t.Errorf("expected the reference scoped to the merchant, got %q", provider.captured.Reference)
+	}
+
+	var created map[string]any
+	json.Unmarshal(w.Body.Bytes(), &created)
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /payments/{id}", handler.GetPayment)
+
+	for merchant, want := range map[string]int{"acme": http.StatusOK, "globex": http.StatusNotFound} {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, asMerchant(httptest.NewRequest(http.MethodGet, fmt.Sprintf("/payments/%s", created["id"]), nil), merchant))
+		if w.Code != want {
+			t.Errorf("%s: expected %d, got %d", merchant, want, w.Code)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/GordenArcher/Idempotency-Gateway/ledger"
+	"github.com/GordenArcher/Idempotency-Gateway/models"
+	"github.com/GordenArcher/Idempotency-Gateway/money"
+	"github.com/GordenArcher/Idempotency-Gateway/payments"
+	"github.com/GordenArcher/Idempotency-Gateway/processor"
+	"github.com/GordenArcher/Idempotency-Gateway/webhooks"
+)
+
+// errNotRefundable covers everything that stops a refund from being reserved:
+// the payment is in the wrong state, or there isn't enough left on it.
+var errNotRefundable = errors.New("payment cannot be refunded")
+
+// CreateRefund handles POST /payments/{id}/refunds.
+// Like ProcessPayment it sits behind the idempotency middleware, so a
+// retried refund with the same key never refunds twice. Different keys
+// are different refunds, and those are kept within the captured amount
+// by reserving the amount on the payment before calling the processor.
+func (h *PaymentHandler) CreateRefund(w http.ResponseWriter, r *http.Request) {
+	paymentID := r.PathValue("id")
+
+	// An empty body is a full refund of whatever is left.
+	var req models.RefundRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, http.StatusBadRequest, "invalid request body, expected {amount, reason}")
+		return
+	}
+
+	payment, err := h.findPayment(r, paymentID)
+	if errors.Is(err, payments.ErrNotFound) {
+		writeError(w, http.StatusNotFound, "payment not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// Refunds are always in the payment's currency, so the amount is
+	// parsed with its exponent rather than looked up again in the registry.
+	var amount int64
+	if !req.Amount.IsZero() {
+		m, err := money.New(req.Amount, payment.Amount.Currency, payment.Amount.Exponent)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if m.Minor <= 0 {
+			writeError(w, http.StatusBadRequest, "amount must be > 0")
+			return
+		}
+		amount = m.Minor
+	}
+
+	// Reserve the amount. This check and the reservation happen in one
+	// Update, so two refunds racing with different keys can't both fit
+	// into the same headroom.
+	_, err = h.payments.Update(paymentID, func(p *models.Payment) error {
+		if amount == 0 {
+			amount = p.Refundable()
+		}
+		if err := payments.CheckRefund(p, amount); err != nil {
+			return fmt.Errorf("%w: %v", errNotRefundable, err)
+		}
+		if amount <= 0 {
+			return fmt.Errorf("%w: nothing left to refund", errNotRefundable)
+		}
+		if amount > p.Refundable() {
+			return fmt.Errorf("%w: %s exceeds the %s still refundable", errNotRefundable,
+				p.Amount.WithMinor(amount), p.Amount.WithMinor(p.Refundable()))
+		}
+		p.RefundPending += amount
+		return nil
+	})
+	if errors.Is(err, errNotRefundable) {
+		writeError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	ctx, cancel := h.processorContext(r)
+	defer cancel()
+
+	result, err := h.processor.Refund(ctx, processor.RefundRequest{
+		Reference: requestKey(r, ""),
+		CaptureID: payment.CaptureID,
+		Amount:    amount,
+	})
+
+	// Settle the reservation either way. On a timeout the refund may still
+	// have gone through, but the processor keeps its own running total per
+	// capture, so releasing here can't lead to refunding more than was captured.
+	updated, updateErr := h.payments.Update(paymentID, func(p *models.Payment) error {
+		p.RefundPending -= amount
+		if err == nil {
+			return payments.CompleteRefund(p, amount, time.Now())
+		}
+		return nil
+	})
+	if err != nil {
+		writeProcessorError(w, err)
+		return
+	}
+
+	refund := &models.Refund{
+		ID:          payments.NewRefundID(),
+		PaymentID:   paymentID,
+		Amount:      payment.Amount.WithMinor(amount),
+		ProcessorID: result.ID,
+		Reason:      req.Reason,
+		CreatedAt:   time.Now().UTC(),
+	}
+	if updateErr == nil {
+		updateErr = h.payments.CreateRefund(refund)
+	}
+	if updateErr != nil {
+		slog.Error("refund made but not recorded",
+			"error", updateErr, "payment_id", paymentID, "refund_id", refund.ID, "processor_refund_id", result.ID)
+		writeError(w, http.StatusInternalServerError, "refund was made but could not be recorded, processor refund "+result.ID)
+		return
+	}
+
+	// Refunds come out of the merchant's balance. The fee isn't given back.
+	h.post(ledger.Transfer(ledger.KindRefund, ledger.Reference(ledger.KindRefund, requestKey(r, refund.ID)), paymentID,
+		ledger.MerchantPayable, ledger.ProcessorReceivable, refund.Amount))
+
+	view := refundView(refund)
+	view["payment_status"] = updated.Status
+	h.publish(r, webhooks.RefundCreated, refund.ID, view)
+	w.Header().Set("Location", "/payments/"+paymentID+"/refunds/"+refund.ID)
+	writeJSON(w, http.StatusCreated, view)
+}
+
+// GetRefund handles GET /payments/{id}/refunds/{refund_id}.
+func (h *PaymentHandler) GetRefund(w http.ResponseWriter, r *http.Request) {
+	refund, err := h.payments.GetRefund(r.PathValue("refund_id"))
+	if err == nil {
+		// Only the payment's merchant gets to see its refunds.
+		_, err = h.findPayment(r, refund.PaymentID)
+	}
+
+	// A refund looked up under the wrong payment is as good as missing.
+	if errors.Is(err, payments.ErrRefundNotFound) || errors.Is(err, payments.ErrNotFound) ||
+		(err == nil && refund.PaymentID != r.PathValue("id")) {
+		writeError(w, http.StatusNotFound, "refund not found")
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, refundView(refund))
+}
+
+func refundView(r *models.Refund) map[string]any {
+	view := map[string]any{
+		"id":             r.ID,
+		"payment_id":     r.PaymentID,
+		"amount":         r.Amount.Decimal(),
+		"amount_minor":   r.Amount.Minor,
+		"currency":       r.Amount.Currency,
+		"transaction_id": r.ProcessorID,
+		"created_at":     r.CreatedAt,
+	}
+	if r.Reason != "" {
+		view["reason"] = r.Reason
+	}
+	return view
+}
@@ -0,0 +1,195 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// refundMux routes the refund endpoints the way main.go does, so r.PathValue works.
+func refundMux(h *PaymentHandler) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /payments/{id}", h.GetPayment)
+	mux.HandleFunc("POST /payments/{id}/refunds", h.CreateRefund)
+	mux.HandleFunc("GET /payments/{id}/refunds/{refund_id}", h.GetRefund)
+	return mux
+}
+
+// createPayment charges amount GHS and returns the new payment's ID.
+func createPayment(t *testing.T, h *PaymentHandler, amount string) string {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/process-payment", strings.NewReader(`{"amount": "`+amount+`", "currency": "GHS"}`))
+	w := httptest.NewRecorder()
+	h.ProcessPayment(w, req)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("creating payment: %d %s", w.Code, w.Body)
+	}
+
+	var resp map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	return resp["id"].(string)
+}
+
+func refund(mux http.Handler, paymentID, key, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/payments/"+paymentID+"/refunds", strings.NewReader(body))
+	req.Header.Set("Idempotency-Key", key)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	return w
+}
+
+func getPaymentStatus(t *testing.T, mux http.Handler, id string) map[string]interface{} {
+	t.Helper()
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/payments/"+id, nil))
+	var resp map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &resp)
+	return resp
+}
+
+func TestRefund_PartialThenFull(t *testing.T) {
+	h := NewPaymentHandler(testConfig())
+	mux := refundMux(h)
+	id := createPayment(t, h, "100.00")
+
+	w := refund(mux, id, "r1", `{"amount": "30.00", "reason": "damaged"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", w.Code, w.Body)
+	}
+	var first map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &first)
+	if first["amount"] != "30.00" || first["payment_status"] != "partially_refunded" || first["reason"] != "damaged" {
+		t.Errorf("unexpected refund %v", first)
+	}
+	if w.Header().Get("Location") != "/payments/"+id+"/refunds/"+first["id"].(string) {
+		t.Errorf("unexpected Location %q", w.Header().Get("Location"))
+	}
+
+	// No amount refunds whatever is left.
+	w = refund(mux, id, "r2", ``)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", w.Code, w.Body)
+	}
+	var second map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &second)
+	if second["amount"] != "70.00" || second["payment_status"] != "refunded" {
+		t.Errorf("unexpected refund %v", second)
+	}
+
+	payment := getPaymentStatus(t, mux, id)
+	if payment["status"] != "refunded" || payment["refunded_amount"] != "100.00" {
+		t.Errorf("unexpected payment after refunds %v", payment)
+	}
+
+	w = refund(mux, id, "r3", `{"amount": "1"}`)
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("expected 422 refunding a fully refunded payment, got %d", w.Code)
+	}
+}
+
+func TestRefund_ExceedsCaptured_Returns422(t *testing.T) {
+	h := NewPaymentHandler(testConfig())
+	mux := refundMux(h)
+	id := createPayment(t, h, "50.00")
+
+	w := refund(mux, id, "r1", `{"amount": "50.01"}`)
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected 422, got %d", w.Code)
+	}
+	if !strings.Contains(w.Body.String(), "50.01 GHS exceeds the 50.00 GHS still refundable") {
+		t.Errorf("unexpected error %s", w.Body)
+	}
+}
+
+func TestRefund_BadRequests(t *testing.T) {
+	h := NewPaymentHandler(testConfig())
+	mux := refundMux(h)
+	id := createPayment(t, h, "50.00")
+
+	cases := []struct {
+		paymentID, body string
+		want            int
+	}{
+		{"pay_missing", `{"amount": "1"}`, http.StatusNotFound},
+		{id, `{"amount": "1.005"}`, http.StatusBadRequest},
+		{id, `{"amount": "-1"}`, http.StatusBadRequest},
+		{id, `not json`, http.StatusBadRequest},
+	}
+
+	for _, tc := range cases {
+		if w := refund(mux, tc.paymentID, "k", tc.body); w.Code != tc.want {
+			t.Errorf("%s %s: expected %d, got %d", tc.paymentID, tc.body, tc.want, w.Code)
+		}
+	}
+}
+
+func TestRefund_ConcurrentDifferentKeys_NeverExceedCaptured(t *testing.T) {
+	// Ten refunds of 30 against a 100 payment, all at once, each with its
+	// own key so the idempotency layer can't help. Exactly three fit.
+	h := NewPaymentHandler(testConfig())
+	mux := refundMux(h)
+	id := createPayment(t, h, "100.00")
+
+	var wg sync.WaitGroup
+	codes := make([]int, 10)
+	for i := range codes {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			codes[i] = refund(mux, id, fmt.Sprintf("key-%d", i), `{"amount": "30.00"}`).Code
+		}(i)
+	}
+	wg.Wait()
+
+	succeeded := 0
+	for _, code := range codes {
+		switch code {
+		case http.StatusCreated:
+			succeeded++
+		case http.StatusUnprocessableEntity:
+		default:
+			t.Errorf("unexpected status %d", code)
+		}
+	}
+	if succeeded != 3 {
+		t.Errorf("expected exactly 3 refunds to succeed, got %d", succeeded)
+	}
+
+	payment := getPaymentStatus(t, mux, id)
+	if payment["refunded_amount"] != "90.00" {
+		t.Errorf("expected 90.00 refunded, got %v", payment["refunded_amount"])
+	}
+}
+
+func TestGetRefund(t *testing.T) {
+	h := NewPaymentHandler(testConfig())
+	mux := refundMux(h)
+	id := createPayment(t, h, "20.00")
+	other := createPayment(t, h, "20.00")
+
+	var created map[string]interface{}
+	json.Unmarshal(refund(mux, id, "r1", `{"amount": "5"}`).Body.Bytes(), &created)
+	refundID := created["id"].(string)
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/payments/"+id+"/refunds/"+refundID, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d", w.Code)
+	}
+	var got map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &got)
+	if got["amount"] != "5.00" || got["payment_id"] != id {
+		t.Errorf("unexpected refund %v", got)
+	}
+
+	// The refund exists, but not under this payment.
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/payments/"+other+"/refunds/"+refundID, nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 under the wrong payment, got %d", w.Code)
+	}
+}
@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/GordenArcher/Idempotency-Gateway/currency"
+	"github.com/GordenArcher/Idempotency-Gateway/middleware"
+	"github.com/GordenArcher/Idempotency-Gateway/models"
+	"github.com/GordenArcher/Idempotency-Gateway/money"
+	"github.com/GordenArcher/Idempotency-Gateway/processor"
+	"github.com/GordenArcher/Idempotency-Gateway/risk"
+	"github.com/GordenArcher/Idempotency-Gateway/store"
+)
+
+// countingProvider counts authorizations, to prove a denied payment never
+// reached the processor.
+type countingProvider struct {
+	fakeProvider
+	authorizations atomic.Int32
+}
+
+func (c *countingProvider) Authorize(ctx context.Context, req processor.AuthorizeRequest) (processor.Authorization, error) {
+	c.authorizations.Add(1)
+	return c.fakeProvider.Authorize(ctx, req)
+}
+
+func riskHandler(t *testing.T, p processor.Provider) *PaymentHandler {
+	t.Helper()
+	min, _ := money.ParseDecimal("1000")
+	engine, err := risk.NewEngine([]risk.Rule{
+		{ID: "large", Type: risk.TypeAmount, Action: models.RiskReview, Currency: "GHS", Min: min},
+		{ID: "blocked", Type: risk.TypeBlocklist, Action: models.RiskDeny, Field: risk.FieldCountry, Values: []string{"KP"}},
+	}, currency.Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewPaymentHandler(testConfig(), WithProcessor(p), WithRisk(engine))
+}
+
+func TestRisk_DeniedPaymentIsRecordedAndNeverProcessed(t *testing.T) {
+	provider := &countingProvider{}
+	h := riskHandler(t, provider)
+	mux := refundMux(h)
+	mux.HandleFunc("POST /process-payment", h.ProcessPayment)
+
+	w, resp := post(mux, "/process-payment", "risk-1", `{"amount": "10.00", "currency": "GHS", "country": "KP"}`)
+
+	if w.Code != http.StatusPaymentRequired {
+		t.Fatalf("expected 402, got %d: %s", w.Code, w.Body)
+	}
+	if resp["status"] != string(models.PaymentDenied) {
+		t.Errorf("expected status denied, got %v", resp["status"])
+	}
+	if n := provider.authorizations.Load(); n != 0 {
+		t.Errorf("expected the processor not to be called, it was called %d times", n)
+	}
+
+	// The decision is on the record.
+	req := httptest.NewRequest(http.MethodGet, w.Header().Get("Location"), nil)
+	got := httptest.NewRecorder()
+	mux.ServeHTTP(got, req)
+	if !strings.Contains(got.Body.String(), `"decision":"deny"`) || !strings.Contains(got.Body.String(), `"blocked"`) {
+		t.Errorf("expected the deny decision on the payment, got %s", got.Body)
+	}
+}
+
+func TestRisk_ReviewIsProcessedAndFlagged(t *testing.T) {
+	h := riskHandler(t, &countingProvider{})
+	mux := twoPhaseMux(h)
+
+	w, resp := post(mux, "/payments/authorize", "risk-2", `{"amount": "1500.00", "currency": "GHS", "country": "GH"}`)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", w.Code, w.Body)
+	}
+	flags, _ := resp["risk"].(map[string]any)
+	if flags["decision"] != string(models.RiskReview) {
+		t.Errorf("expected the payment flagged for review, got %v", resp["risk"])
+	}
+}
+
+func TestRisk_AllowedPaymentHasNoRiskField(t *testing.T) {
+	h := riskHandler(t, &countingProvider{})
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /process-payment", h.ProcessPayment)
+
+	w, resp := post(mux, "/process-payment", "risk-3", `{"amount": "10.00", "currency": "GHS", "country": "GH"}`)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d", w.Code)
+	}
+	if _, ok := resp["risk"]; ok {
+		t.Errorf("expected no risk field on an allowed payment, got %v", resp["risk"])
+	}
+}
+
+func TestRisk_DenialIsReplayedByTheMiddleware(t *testing.T) {
+	h := riskHandler(t, &countingProvider{})
+	wrapped := middleware.Idempotency(store.NewMemoryStore(time.Hour), http.HandlerFunc(h.ProcessPayment))
+	body := `{"amount": "10.00", "currency": "GHS", "country": "KP"}`
+
+	first, _ := post(wrapped, "/process-payment", "risk-4", body)
+	retry, _ := post(wrapped, "/process-payment", "risk-4", body)
+
+	if first.Code != http.StatusPaymentRequired || retry.Code != http.StatusPaymentRequired {
+		t.Fatalf("expected 402 both times, got %d and %d", first.Code, retry.Code)
+	}
+	if retry.Header().Get("X-Cache-Hit") != "true" || retry.Body.String() != first.Body.String() {
+		t.Error("expected the retry to get the cached denial, not a new one")
+	}
+}
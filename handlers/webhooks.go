@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/GordenArcher/Idempotency-Gateway/webhooks"
+)
+
+// WebhooksHandler shows what happened to each webhook delivery, so "we never
+// got the event" can be answered with the attempts and what the endpoint said.
+type WebhooksHandler struct {
+	dispatcher *webhooks.Dispatcher
+}
+
+func NewWebhooksHandler(d *webhooks.Dispatcher) *WebhooksHandler {
+	return &WebhooksHandler{dispatcher: d}
+}
+
+// Deliveries handles GET /webhooks/deliveries, newest first.
+// ?event_id=, ?endpoint_id= and ?state= narrow it down. A merchant only
+// ever sees deliveries of its own events.
+func (h *WebhooksHandler) Deliveries(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	deliveries := h.dispatcher.List(webhooks.Filter{
+		EventID:    q.Get("event_id"),
+		EndpointID: q.Get("endpoint_id"),
+		Merchant:   merchant(r),
+		State:      q.Get("state"),
+	})
+
+	views := make([]map[string]any, len(deliveries))
+	for i, d := range deliveries {
+		views[i] = deliveryView(d)
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"deliveries": views})
+}
+
+// Delivery handles GET /webhooks/deliveries/{id}.
+func (h *WebhooksHandler) Delivery(w http.ResponseWriter, r *http.Request) {
+	d, ok := h.dispatcher.Get(r.PathValue("id"))
+	if !ok || (merchant(r) != "" && d.Merchant != merchant(r)) {
+		writeError(w, http.StatusNotFound, "delivery not found")
+		return
+	}
+	writeJSON(w, http.StatusOK, deliveryView(d))
+}
+
+func deliveryView(d webhooks.Delivery) map[string]any {
+	attempts := make([]map[string]any, len(d.Attempts))
+	for i, a := range d.Attempts {
+		attempt := map[string]any{
+			"at":          a.At,
+			"duration_ms": a.Duration.Milliseconds(),
+		}
+		if a.StatusCode != 0 {
+			attempt["status_code"] = a.StatusCode
+		}
+		if a.Error != "" {
+			attempt["error"] = a.Error
+		}
+		attempts[i] = attempt
+	}
+
+	view := map[string]any{
+		"id":          d.ID,
+		"event_id":    d.EventID,
+		"event_type":  d.EventType,
+		"endpoint_id": d.EndpointID,
+		"url":         d.URL,
+		"state":       d.State,
+		"attempts":    attempts,
+		"created_at":  d.CreatedAt,
+		"updated_at":  d.UpdatedAt,
+	}
+	if d.State == webhooks.StatePending {
+		view["next_attempt_at"] = d.NextAttemptAt
+	}
+	return view
+}
@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/GordenArcher/Idempotency-Gateway/webhooks"
+)
+
+// eventRecorder is a webhooks.Publisher that keeps what it's given.
+type eventRecorder struct {
+	mu     sync.Mutex
+	events []webhooks.Event
+}
+
+func (e *eventRecorder) Publish(event webhooks.Event) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.events = append(e.events, event)
+}
+
+func (e *eventRecorder) types() []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	types := make([]string, len(e.events))
+	for i, event := range e.events {
+		types[i] = event.Type
+	}
+	return types
+}
+
+func TestWebhooks_PublishedOnEveryStateChange(t *testing.T) {
+	events := &eventRecorder{}
+	mux := twoPhaseMux(NewPaymentHandler(testConfig(), WithWebhooks(events)))
+
+	id := authorizePayment(t, mux, "50.00")
+	post(mux, "/payments/"+id+"/capture", "wh-capture", ``)
+	post(mux, "/payments/"+id+"/refunds", "wh-refund", `{"amount": "10.00"}`)
+
+	voidID := authorizePayment(t, mux, "20.00")
+	post(mux, "/payments/"+voidID+"/void", "wh-void", ``)
+
+	want := []string{
+		webhooks.PaymentAuthorized, webhooks.PaymentCaptured, webhooks.RefundCreated,
+		webhooks.PaymentAuthorized, webhooks.PaymentVoided,
+	}
+	got := events.types()
+	if len(got) != len(want) {
+		t.Fatalf("expected events %v, got %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("event %d: expected %s, got %s", i, want[i], got[i])
+		}
+	}
+
+	// The event ID comes from the request's idempotency key.
+	capture := events.events[1]
+	if capture.ID != webhooks.EventID(webhooks.PaymentCaptured, "wh-capture") {
+		t.Errorf("expected the capture event ID to come from its key, got %s", capture.ID)
+	}
+	var data map[string]any
+	json.Unmarshal(capture.Data, &data)
+	if data["id"] != id || data["status"] != "captured" {
+		t.Errorf("expected the captured payment in the event, got %v", data)
+	}
+}
+
+func TestWebhooks_FailedRequestPublishesNothing(t *testing.T) {
+	events := &eventRecorder{}
+	mux := twoPhaseMux(NewPaymentHandler(testConfig(), WithWebhooks(events)))
+
+	post(mux, "/payments/pay_missing/capture", "wh-missing", ``)
+
+	if got := events.types(); len(got) != 0 {
+		t.Errorf("expected no events, got %v", got)
+	}
+}
+
+func TestWebhookDeliveries(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer receiver.Close()
+
+	dispatcher := webhooks.NewDispatcher([]webhooks.Endpoint{{ID: "shop", URL: receiver.URL, Secret: "s"}},
+		webhooks.Config{MaxAttempts: 1, Timeout: time.Second}, nil)
+	defer dispatcher.Close(context.Background())
+
+	h := NewWebhooksHandler(dispatcher)
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /webhooks/deliveries", h.Deliveries)
+	mux.HandleFunc("GET /webhooks/deliveries/{id}", h.Delivery)
+
+	event, _ := webhooks.NewEvent(webhooks.PaymentCaptured, "key-1", map[string]string{"id": "pay_1"})
+	dispatcher.Publish(event)
+
+	var list struct {
+		Deliveries []map[string]any `json:"deliveries"`
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/webhooks/deliveries?event_id="+event.ID, nil))
+		json.Unmarshal(w.Body.Bytes(), &list)
+		if len(list.Deliveries) == 1 && list.Deliveries[0]["state"] == webhooks.StateDelivered {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if len(list.Deliveries) != 1 || list.Deliveries[0]["state"] != webhooks.StateDelivered {
+		t.Fatalf("expected one delivered delivery, got %v", list.Deliveries)
+	}
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/webhooks/deliveries/"+list.Deliveries[0]["id"].(string), nil))
+	var delivery map[string]any
+	json.Unmarshal(w.Body.Bytes(), &delivery)
+	attempts, _ := delivery["attempts"].([]any)
+	if w.Code != http.StatusOK || len(attempts) != 1 {
+		t.Errorf("expected the delivery with one attempt, got %d: %s", w.Code, w.Body)
+	}
+
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/webhooks/deliveries/whd_missing", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected 404, got %d", w.Code)
+	}
+}
@@ -0,0 +1,230 @@
+// Package jobs runs work in the background on a fixed pool of workers and
+// keeps track of each job so its progress can be polled. The idempotency
+// middleware uses it for async requests: the client gets a 202 straight
+// away and the handler runs here.
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrQueueFull means every worker is busy and the queue is at capacity.
+	ErrQueueFull = errors.New("job queue is full")
+
+	// ErrClosed means the pool is shutting down and takes no new jobs.
+	ErrClosed = errors.New("job pool is closed")
+)
+
+type State string
+
+const (
+	StateQueued     State = "queued"
+	StateProcessing State = "processing"
+	StateComplete   State = "complete"
+)
+
+// Result is what a job produced: the HTTP response the handler wrote.
+type Result struct {
+	StatusCode int
+	Headers    http.Header
+	Body       []byte
+}
+
+// Job is a snapshot of one job.
+type Job struct {
+	ID          string
+	Owner       string // who submitted it, only they get to see it
+	State       State
+	Position    int // place in the queue while queued, 1 is next
+	CreatedAt   time.Time
+	StartedAt   time.Time
+	CompletedAt time.Time
+	Result      *Result // set once complete
+}
+
+// Config sizes a Pool.
+type Config struct {
+	Workers   int           // jobs run at once
+	QueueSize int           // jobs waiting for a worker before Submit says ErrQueueFull
+	Retention time.Duration // how long a finished job stays pollable
+}
+
+type job struct {
+	Job
+	seq int64
+	run func() Result
+}
+
+// Pool is a fixed set of workers fed by a bounded queue.
+type Pool struct {
+	cfg   Config
+	queue chan *job
+	wg    sync.WaitGroup
+
+	mu     sync.Mutex
+	jobs   map[string]*job
+	active int   // jobs queued or running
+	seq    int64 // last seq handed out
+	done   int64 // highest seq a worker has picked up, for queue positions
+	closed bool
+}
+
+func NewPool(cfg Config) *Pool {
+	if cfg.Workers < 1 {
+		cfg.Workers = 1
+	}
+	p := &Pool{
+		cfg: cfg,
+		// Room for every job we'll accept, so sending never blocks.
+		queue: make(chan *job, cfg.Workers+cfg.QueueSize),
+		jobs:  make(map[string]*job),
+	}
+	for i := 0; i < cfg.Workers; i++ {
+		p.wg.Add(1)
+		go p.worker()
+	}
+	return p
+}
+
+// NewID returns a fresh job ID. Callers that need to record the ID somewhere
+// before the job can possibly finish (the middleware does) generate it first
+// and pass it to Submit.
+func NewID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return "job_" + hex.EncodeToString(b)
+}
+
+// Submit queues run under id for owner. It never blocks: if the queue is full
+// it returns ErrQueueFull and the caller decides what to tell the client.
+func (p *Pool) Submit(id, owner string, run func() Result) (Job, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed {
+		return Job{}, ErrClosed
+	}
+	p.prune()
+
+	// Counting rather than relying on the channel being full means an idle
+	// worker always counts as room, even before its goroutine is scheduled.
+	if p.active >= p.cfg.Workers+p.cfg.QueueSize {
+		return Job{}, ErrQueueFull
+	}
+
+	p.seq++
+	j := &job{
+		Job: Job{ID: id, Owner: owner, State: StateQueued, CreatedAt: time.Now().UTC()},
+		seq: p.seq,
+		run: run,
+	}
+	p.active++
+	p.queue <- j // never blocks, see NewPool
+	p.jobs[id] = j
+	return p.snapshot(j), nil
+}
+
+// Get returns the job's current state.
+func (p *Pool) Get(id string) (Job, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	j, ok := p.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+	return p.snapshot(j), true
+}
+
+// snapshot copies j, working out its queue position. Jobs are picked up
+// in seq order, so everything between the last one picked up and this one
+// is ahead of it. Must be called with p.mu held.
+func (p *Pool) snapshot(j *job) Job {
+	s := j.Job
+	if s.State == StateQueued {
+		s.Position = int(j.seq - p.done)
+	}
+	return s
+}
+
+// Close stops taking jobs and waits for the queued and running ones to
+// finish, or for ctx to end, whichever is first.
+func (p *Pool) Close(ctx context.Context) error {
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.queue)
+	}
+	p.mu.Unlock()
+
+	finished := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (p *Pool) worker() {
+	defer p.wg.Done()
+
+	for j := range p.queue {
+		p.mu.Lock()
+		j.State = StateProcessing
+		j.StartedAt = time.Now().UTC()
+		p.done = max(p.done, j.seq)
+		p.mu.Unlock()
+
+		result := p.run(j)
+
+		p.mu.Lock()
+		j.State = StateComplete
+		j.CompletedAt = time.Now().UTC()
+		j.Result = &result
+		j.run = nil
+		p.active--
+		p.mu.Unlock()
+	}
+}
+
+// run calls the job's function. A panic becomes a 500 result instead of
+// taking the whole process down, net/http does the same for handlers.
+func (p *Pool) run(j *job) (result Result) {
+	defer func() {
+		if r := recover(); r != nil {
+			slog.Error("job panicked", "job_id", j.ID, "panic", r, "stack", string(debug.Stack()))
+			result = Result{StatusCode: http.StatusInternalServerError}
+		}
+	}()
+	return j.run()
+}
+
+// prune drops finished jobs older than Retention. It runs on Submit, so the
+// map never holds more than a Retention's worth of jobs. Must be called
+// with p.mu held.
+func (p *Pool) prune() {
+	if p.cfg.Retention <= 0 {
+		return
+	}
+	cutoff := time.Now().Add(-p.cfg.Retention)
+	for id, j := range p.jobs {
+		if j.State == StateComplete && j.CompletedAt.Before(cutoff) {
+			delete(p.jobs, id)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func waitFor(t *testing.T, p *Pool, id string, state State) Job {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		if job, _ := p.Get(id); job.State == state {
+			return job
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("job %s never reached %s", id, state)
+	return Job{}
+}
+
+func TestPool_RunsJobAndKeepsResult(t *testing.T) {
+	p := NewPool(Config{Workers: 1, QueueSize: 1})
+	defer p.Close(context.Background())
+
+	id := NewID()
+	if _, err := p.Submit(id, "", func() Result {
+		return Result{StatusCode: http.StatusCreated, Body: []byte(`{"ok":true}`)}
+	}); err != nil {
+		t.Fatalf("submit: %v", err)
+	}
+
+	job := waitFor(t, p, id, StateComplete)
+	if job.Result == nil || job.Result.StatusCode != http.StatusCreated {
+		t.Fatalf("expected a 201 result, got %+v", job.Result)
+	}
+	if job.StartedAt.IsZero() || job.CompletedAt.IsZero() {
+		t.Error("expected start and completion times")
+	}
+}
+
+func TestPool_QueuePositionAndQueueFull(t *testing.T) {
+	p := NewPool(Config{Workers: 1, QueueSize: 2})
+	release := make(chan struct{})
+	defer p.Close(context.Background())
+	defer close(release)
+
+	block := func() Result { <-release; return Result{} }
+
+	running := NewID()
+	p.Submit(running, "", block)
+	waitFor(t, p, running, StateProcessing)
+
+	first, second := NewID(), NewID()
+	p.Submit(first, "", block)
+	p.Submit(second, "", block)
+
+	if job, _ := p.Get(first); job.Position != 1 {
+		t.Errorf("expected first queued job at position 1, got %d", job.Position)
+	}
+	if job, _ := p.Get(second); job.Position != 2 {
+		t.Errorf("expected second queued job at position 2, got %d", job.Position)
+	}
+
+	if _, err := p.Submit(NewID(), "", block); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("expected ErrQueueFull, got %v", err)
+	}
+}
+
+func TestPool_PanicBecomes500(t *testing.T) {
+	p := NewPool(Config{Workers: 1})
+	defer p.Close(context.Background())
+
+	id := NewID()
+	p.Submit(id, "", func() Result { panic("boom") })
+
+	job := waitFor(t, p, id, StateComplete)
+	if job.Result.StatusCode != http.StatusInternalServerError {
+		t.Errorf("expected 500, got %d", job.Result.StatusCode)
+	}
+}
+
+func TestPool_CloseDrainsQueue(t *testing.T) {
+	p := NewPool(Config{Workers: 1, QueueSize: 5})
+
+	ids := []string{NewID(), NewID(), NewID()}
+	for _, id := range ids {
+		p.Submit(id, "", func() Result {
+			time.Sleep(5 * time.Millisecond)
+			return Result{StatusCode: http.StatusOK}
+		})
+	}
+
+	if err := p.Close(context.Background()); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	for _, id := range ids {
+		if job, _ := p.Get(id); job.State != StateComplete {
+			t.Errorf("job %s left %s after Close", id, job.State)
+		}
+	}
+	if _, err := p.Submit(NewID(), "", func() Result { return Result{} }); !errors.Is(err, ErrClosed) {
+		t.Errorf("expected ErrClosed after Close, got %v", err)
+	}
+}
+
+func TestPool_PrunesOldJobs(t *testing.T) {
+	p := NewPool(Config{Workers: 1, QueueSize: 1, Retention: time.Millisecond})
+	defer p.Close(context.Background())
+
+	old := NewID()
+	p.Submit(old, "", func() Result { return Result{} })
+	waitFor(t, p, old, StateComplete)
+	time.Sleep(5 * time.Millisecond)
+
+	// Pruning happens on the next Submit.
+	p.Submit(NewID(), "", func() Result { return Result{} })
+	if _, ok := p.Get(old); ok {
+		t.Error("expected the finished job to be pruned")
+	}
+}
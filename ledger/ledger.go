@@ -0,0 +1,142 @@
+// Package ledger records money movements as balanced double-entry postings.
+// Every charge, fee and refund becomes an Entry whose postings sum to zero
+// per currency, so balances can always be reconciled: if they don't add up,
+// something posted that shouldn't have.
+package ledger
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/GordenArcher/Idempotency-Gateway/money"
+)
+
+// Accounts the gateway posts to. Debits are positive, credits negative.
+const (
+	// ProcessorReceivable is what the processor owes us for captured
+	// payments, until it settles.
+	ProcessorReceivable = "processor_receivable"
+
+	// MerchantPayable is what we owe the merchant, captures net of fees.
+	MerchantPayable = "merchant_payable"
+
+	// FeeRevenue is what we've earned in fees.
+	FeeRevenue = "fee_revenue"
+)
+
+// Kinds of entry.
+const (
+	KindCharge = "charge"
+	KindFee    = "fee"
+	KindRefund = "refund"
+)
+
+var (
+	// ErrUnbalanced is an entry whose postings don't sum to zero in every currency.
+	ErrUnbalanced = errors.New("ledger entry is not balanced")
+
+	// ErrReferenceConflict is a reference that was already posted with
+	// different postings. The same reference must always mean the same entry.
+	ErrReferenceConflict = errors.New("ledger reference already used for a different entry")
+)
+
+// Posting moves Amount into (positive) or out of (negative) Account.
+type Posting struct {
+	Account string
+	Amount  money.Money
+}
+
+// Entry is one balanced movement. Reference is what makes posting
+// idempotent: a second Post with the same Reference is a no-op.
+type Entry struct {
+	Seq       int64 // assigned by the ledger, increasing
+	Reference string
+	Kind      string
+	PaymentID string
+	Postings  []Posting
+	CreatedAt time.Time
+}
+
+// Balance is an account's total in one currency.
+type Balance struct {
+	Account string
+	Amount  money.Money
+}
+
+// Ledger stores entries. As with the store and the payments repository,
+// the in-memory version can be replaced by a database.
+type Ledger interface {
+	// Post records e and returns it with Seq and CreatedAt filled in.
+	// If e.Reference was posted before, the original entry is returned
+	// with posted=false and nothing changes.
+	Post(e Entry) (entry Entry, posted bool, err error)
+
+	// Balances returns every non-empty account balance, sorted by
+	// account then currency.
+	Balances() []Balance
+
+	// Entries returns entries touching account with Seq > after, oldest
+	// first, at most limit of them (<= 0 means no limit).
+	Entries(account string, after int64, limit int) []Entry
+}
+
+// Reference derives an entry reference from the idempotency key of the
+// request that caused it. The key is hashed so it never sits in the ledger
+// in the clear, and kind is part of it because one request can post
+// several entries (a charge and its fee).
+func Reference(kind, idempotencyKey string) string {
+	h := sha256.Sum256([]byte(idempotencyKey))
+	return kind + ":" + hex.EncodeToString(h[:16])
+}
+
+// validate checks every currency in e nets to zero.
+func (e Entry) validate() error {
+	if len(e.Postings) < 2 {
+		return ErrUnbalanced
+	}
+	sums := map[string]int64{}
+	for _, p := range e.Postings {
+		sums[p.Amount.Currency] += p.Amount.Minor
+	}
+	for _, sum := range sums {
+		if sum != 0 {
+			return ErrUnbalanced
+		}
+	}
+	return nil
+}
+
+// samePostings reports whether a and b move the same amounts between the same accounts.
+func samePostings(a, b []Posting) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Transfer is the common two-posting entry: amount moves from one account to another.
+func Transfer(kind, reference, paymentID, debit, credit string, amount money.Money) Entry {
+	return Entry{
+		Reference: reference,
+		Kind:      kind,
+		PaymentID: paymentID,
+		Postings: []Posting{
+			{Account: debit, Amount: amount},
+			{Account: credit, Amount: amount.WithMinor(-amount.Minor)},
+		},
+	}
+}
+
+// Fee works out a fee of bps basis points (1/100th of a percent) on amount,
+// rounded half up to the nearest minor unit. Split into whole and remainder
+// parts so large amounts don't overflow int64.
+func Fee(amount int64, bps int64) int64 {
+	return amount/10000*bps + (amount%10000*bps+5000)/10000
+}
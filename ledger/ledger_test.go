@@ -0,0 +1,164 @@
+package ledger
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/GordenArcher/Idempotency-Gateway/money"
+)
+
+func ghs(minor int64) money.Money {
+	return money.Money{Minor: minor, Currency: "GHS", Exponent: 2}
+}
+
+func TestPost_UpdatesBalances(t *testing.T) {
+	l := NewMemoryLedger()
+
+	e, posted, err := l.Post(Transfer(KindCharge, "charge:1", "pay_1", ProcessorReceivable, MerchantPayable, ghs(10000)))
+	if err != nil || !posted {
+		t.Fatalf("unexpected result posted=%v err=%v", posted, err)
+	}
+	if e.Seq != 1 || e.CreatedAt.IsZero() {
+		t.Errorf("expected seq and time to be filled in, got %+v", e)
+	}
+	l.Post(Transfer(KindFee, "fee:1", "pay_1", MerchantPayable, FeeRevenue, ghs(150)))
+
+	want := map[string]int64{
+		FeeRevenue:          -150,
+		MerchantPayable:     -9850,
+		ProcessorReceivable: 10000,
+	}
+	var sum int64
+	for _, b := range l.Balances() {
+		if b.Amount.Minor != want[b.Account] {
+			t.Errorf("%s: expected %d, got %d", b.Account, want[b.Account], b.Amount.Minor)
+		}
+		sum += b.Amount.Minor
+	}
+	if sum != 0 {
+		t.Errorf("balances must net to zero, got %d", sum)
+	}
+}
+
+func TestPost_SameReference_PostsOnce(t *testing.T) {
+	l := NewMemoryLedger()
+	entry := Transfer(KindCharge, "charge:1", "pay_1", ProcessorReceivable, MerchantPayable, ghs(10000))
+
+	first, _, _ := l.Post(entry)
+	again, posted, err := l.Post(entry)
+	if err != nil || posted {
+		t.Fatalf("expected the repeat to be a no-op, got posted=%v err=%v", posted, err)
+	}
+	if again.Seq != first.Seq {
+		t.Errorf("expected the original entry back, got seq %d", again.Seq)
+	}
+	if got := l.Balances()[1].Amount.Minor; got != 10000 {
+		t.Errorf("expected the receivable to be 10000, got %d", got)
+	}
+}
+
+func TestPost_SameReferenceDifferentPostings_Conflicts(t *testing.T) {
+	l := NewMemoryLedger()
+	l.Post(Transfer(KindCharge, "charge:1", "pay_1", ProcessorReceivable, MerchantPayable, ghs(10000)))
+
+	_, _, err := l.Post(Transfer(KindCharge, "charge:1", "pay_1", ProcessorReceivable, MerchantPayable, ghs(500)))
+	if !errors.Is(err, ErrReferenceConflict) {
+		t.Errorf("expected ErrReferenceConflict, got %v", err)
+	}
+}
+
+func TestPost_RejectsUnbalanced(t *testing.T) {
+	l := NewMemoryLedger()
+
+	cases := []Entry{
+		{Reference: "one-sided", Postings: []Posting{{Account: FeeRevenue, Amount: ghs(1)}}},
+		{Reference: "off-by-one", Postings: []Posting{{Account: FeeRevenue, Amount: ghs(1)}, {Account: MerchantPayable, Amount: ghs(-2)}}},
+		{Reference: "mixed-currency", Postings: []Posting{
+			{Account: FeeRevenue, Amount: ghs(100)},
+			{Account: MerchantPayable, Amount: money.Money{Minor: -100, Currency: "NGN", Exponent: 2}},
+		}},
+	}
+	for _, e := range cases {
+		if _, _, err := l.Post(e); !errors.Is(err, ErrUnbalanced) {
+			t.Errorf("%s: expected ErrUnbalanced, got %v", e.Reference, err)
+		}
+	}
+	if len(l.Balances()) != 0 {
+		t.Error("a rejected entry must not touch balances")
+	}
+}
+
+func TestPost_ConcurrentSameReference(t *testing.T) {
+	l := NewMemoryLedger()
+	entry := Transfer(KindCharge, "charge:1", "pay_1", ProcessorReceivable, MerchantPayable, ghs(100))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			l.Post(entry)
+		}()
+	}
+	wg.Wait()
+
+	if n := len(l.Entries(ProcessorReceivable, 0, 0)); n != 1 {
+		t.Errorf("expected exactly one entry, got %d", n)
+	}
+}
+
+func TestEntries_FiltersAndPaginates(t *testing.T) {
+	l := NewMemoryLedger()
+	for i, ref := range []string{"a", "b", "c", "d"} {
+		l.Post(Transfer(KindCharge, ref, "pay", ProcessorReceivable, MerchantPayable, ghs(int64(i+1))))
+	}
+	l.Post(Transfer(KindFee, "fee", "pay", MerchantPayable, FeeRevenue, ghs(1)))
+
+	page := l.Entries(ProcessorReceivable, 0, 3)
+	if len(page) != 3 || page[0].Reference != "a" || page[2].Reference != "c" {
+		t.Fatalf("unexpected first page %+v", page)
+	}
+	page = l.Entries(ProcessorReceivable, page[2].Seq, 3)
+	if len(page) != 1 || page[0].Reference != "d" {
+		t.Errorf("unexpected second page %+v", page)
+	}
+
+	if n := len(l.Entries(FeeRevenue, 0, 0)); n != 1 {
+		t.Errorf("expected 1 fee entry, got %d", n)
+	}
+	if n := len(l.Entries(MerchantPayable, 0, 0)); n != 5 {
+		t.Errorf("expected 5 merchant entries, got %d", n)
+	}
+}
+
+func TestReference(t *testing.T) {
+	a := Reference(KindCharge, "key-1")
+	if a != Reference(KindCharge, "key-1") {
+		t.Error("Reference must be deterministic")
+	}
+	if a == Reference(KindFee, "key-1") || a == Reference(KindCharge, "key-2") {
+		t.Error("different kinds or keys must give different references")
+	}
+	if strings.Contains(a, "key-1") {
+		t.Error("the raw key mustn't appear in the reference")
+	}
+}
+
+func TestFee(t *testing.T) {
+	cases := []struct {
+		amount, bps, want int64
+	}{
+		{10000, 150, 150},
+		{333, 150, 5}, // 4.995 rounds up
+		{100, 0, 0},
+		{1, 10000, 1},
+		{9_000_000_000_000_000_000, 100, 90_000_000_000_000_000},
+	}
+	for _, tc := range cases {
+		if got := Fee(tc.amount, tc.bps); got != tc.want {
+			t.Errorf("Fee(%d, %d): expected %d, got %d", tc.amount, tc.bps, tc.want, got)
+		}
+	}
+}
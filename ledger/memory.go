@@ -0,0 +1,100 @@
+package ledger
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryLedger keeps entries in a slice, lost on restart like everything else.
+type MemoryLedger struct {
+	mu          sync.RWMutex
+	entries     []Entry
+	byReference map[string]int // reference -> index in entries
+	balances    map[balanceKey]Balance
+}
+
+type balanceKey struct {
+	account, currency string
+}
+
+func NewMemoryLedger() *MemoryLedger {
+	return &MemoryLedger{
+		byReference: make(map[string]int),
+		balances:    make(map[balanceKey]Balance),
+	}
+}
+
+func (l *MemoryLedger) Post(e Entry) (Entry, bool, error) {
+	if err := e.validate(); err != nil {
+		return Entry{}, false, fmt.Errorf("%w: %s", err, e.Reference)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if i, ok := l.byReference[e.Reference]; ok {
+		existing := l.entries[i]
+		if !samePostings(existing.Postings, e.Postings) {
+			return Entry{}, false, fmt.Errorf("%w: %s", ErrReferenceConflict, e.Reference)
+		}
+		return existing, false, nil
+	}
+
+	e.Seq = int64(len(l.entries)) + 1
+	e.CreatedAt = time.Now().UTC()
+	e.Postings = append([]Posting(nil), e.Postings...)
+
+	for _, p := range e.Postings {
+		key := balanceKey{p.Account, p.Amount.Currency}
+		b, ok := l.balances[key]
+		if !ok {
+			b = Balance{Account: p.Account, Amount: p.Amount.WithMinor(0)}
+		}
+		b.Amount.Minor += p.Amount.Minor
+		l.balances[key] = b
+	}
+
+	l.byReference[e.Reference] = len(l.entries)
+	l.entries = append(l.entries, e)
+	return e, true, nil
+}
+
+func (l *MemoryLedger) Balances() []Balance {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	balances := make([]Balance, 0, len(l.balances))
+	for _, b := range l.balances {
+		balances = append(balances, b)
+	}
+	sort.Slice(balances, func(i, j int) bool {
+		if balances[i].Account != balances[j].Account {
+			return balances[i].Account < balances[j].Account
+		}
+		return balances[i].Amount.Currency < balances[j].Amount.Currency
+	})
+	return balances
+}
+
+// Entries scans everything after the cursor. Fine for an in-memory ledger,
+// a database would index postings by account.
+func (l *MemoryLedger) Entries(account string, after int64, limit int) []Entry {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	var result []Entry
+	for _, e := range l.entries[min(max(after, 0), int64(len(l.entries))):] {
+		for _, p := range e.Postings {
+			if p.Account == account {
+				result = append(result, e)
+				break
+			}
+		}
+		if limit > 0 && len(result) == limit {
+			break
+		}
+	}
+	return result
+}
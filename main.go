@@ -2,27 +2,265 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"html/template"
-	"log"
+	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 
+	"github.com/GordenArcher/Idempotency-Gateway/admin"
+	"github.com/GordenArcher/Idempotency-Gateway/audit"
+	"github.com/GordenArcher/Idempotency-Gateway/auth"
+	"github.com/GordenArcher/Idempotency-Gateway/batch"
 	"github.com/GordenArcher/Idempotency-Gateway/config"
+	"github.com/GordenArcher/Idempotency-Gateway/currency"
 	"github.com/GordenArcher/Idempotency-Gateway/handlers"
+	"github.com/GordenArcher/Idempotency-Gateway/jobs"
+	"github.com/GordenArcher/Idempotency-Gateway/ledger"
+	"github.com/GordenArcher/Idempotency-Gateway/metrics"
 	"github.com/GordenArcher/Idempotency-Gateway/middleware"
+	"github.com/GordenArcher/Idempotency-Gateway/risk"
+	"github.com/GordenArcher/Idempotency-Gateway/signing"
 	"github.com/GordenArcher/Idempotency-Gateway/store"
+	"github.com/GordenArcher/Idempotency-Gateway/tlsutil"
+	"github.com/GordenArcher/Idempotency-Gateway/tracing"
+	"github.com/GordenArcher/Idempotency-Gateway/webhooks"
 )
 
 func main() {
-	cfg := config.Default()
+	if len(os.Args) > 1 && os.Args[1] == "snapshot" {
+		os.Exit(snapshotCommand(os.Args[2:]))
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		slog.Error("invalid configuration", "error", err)
+		os.Exit(1)
+	}
+
+	// Every log line is JSON so it can be shipped and queried as-is.
+	// Setting it as the default means the store's sweeper logs the same way.
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{Level: cfg.LogLevel}))
+	slog.SetDefault(logger)
 
 	// This is the in-memory map that tracks every idempotency key we've seen.
 	memStore := store.NewMemoryStore(cfg.KeyTTL)
 
-	memStore.StartSweeper()
+	memStore.StartSweeper(cfg.SweepInterval)
+
+	// Cached responses are full payment responses. With a key ring
+	// configured they're encrypted before they go in the store, and
+	// everything that reads or writes keys goes through the wrapper.
+	var keyStore store.Store = memStore
+	if cfg.EncryptionKeysFile != "" {
+		keys, err := store.LoadEncryptionKeys(cfg.EncryptionKeysFile)
+		if err == nil {
+			keyStore, err = store.NewEncryptedStore(memStore, keys)
+		}
+		if err != nil {
+			slog.Error("failed to load encryption keys", "path", cfg.EncryptionKeysFile, "error", err)
+			os.Exit(1)
+		}
+		slog.Info("response bodies encrypted at rest", "key_id", keys[0].ID, "keys", len(keys))
+	}
+
+	// Big bodies are compressed on the way in. This wraps the encryption,
+	// so they're compressed first, ciphertext doesn't compress.
+	var compressed *store.CompressedStore
+	if cfg.StoreCompression != "off" {
+		codec, err := store.CodecByName(cfg.StoreCompression)
+		if err != nil {
+			slog.Error("failed to set up store compression", "error", err)
+			os.Exit(1)
+		}
+		compressed = store.NewCompressedStore(keyStore, codec, int(cfg.StoreCompressionMinBytes))
+		keyStore = compressed
+	}
+
+	// Loaded before anything starts so a bad currencies file stops startup
+	// instead of turning into 400s on every payment.
+	currencies, err := currency.Load(cfg.CurrenciesFile)
+	if err != nil {
+		slog.Error("failed to load currencies", "path", cfg.CurrenciesFile, "error", err)
+		os.Exit(1)
+	}
+
+	// Risk rules reference currencies, so they're loaded after them.
+	riskEngine, err := risk.Load(cfg.RiskRulesFile, currencies)
+	if err != nil {
+		slog.Error("failed to load risk rules", "path", cfg.RiskRulesFile, "error", err)
+		os.Exit(1)
+	}
+
+	// API keys say which merchant each request is from. Without a keys file
+	// the API is open, which is fine for the demo and nothing else.
+	var keyring *auth.Keyring
+	if cfg.APIKeysFile != "" {
+		keys, err := auth.Load(cfg.APIKeysFile)
+		if err == nil {
+			keyring, err = auth.NewKeyring(keys)
+		}
+		if err != nil {
+			slog.Error("failed to load API keys", "path", cfg.APIKeysFile, "error", err)
+			os.Exit(1)
+		}
+		slog.Info("API keys loaded", "keys", keyring.Len())
+		go reloadKeysOnHangup(keyring, cfg.APIKeysFile)
+	} else {
+		slog.Warn("GATEWAY_API_KEYS_FILE not set, anyone who can reach the gateway can make payments")
+	}
+
+	// Partners that sign their requests have a secret here. Everyone else
+	// only needs their API key.
+	var verifier *signing.Verifier
+	if cfg.SigningSecretsFile != "" {
+		secrets, err := signing.Load(cfg.SigningSecretsFile)
+		if err == nil {
+			verifier, err = signing.NewVerifier(secrets, cfg.SignatureTolerance)
+		}
+		if err != nil {
+			slog.Error("failed to load signing secrets", "path", cfg.SigningSecretsFile, "error", err)
+			os.Exit(1)
+		}
+	}
+
+	// Every charge, fee and refund is posted here as double-entry.
+	paymentLedger := ledger.NewMemoryLedger()
+
+	tracer, traceExporter, err := newTracer(cfg.TraceOutput)
+	if err != nil {
+		slog.Error("failed to set up tracing", "error", err)
+		os.Exit(1)
+	}
+
+	// Merchants are told about payments and refunds by webhook. With no
+	// endpoints configured the dispatcher just has nobody to send to.
+	webhookEndpoints, err := webhooks.Load(cfg.WebhooksFile)
+	if err != nil {
+		slog.Error("failed to load webhook endpoints", "path", cfg.WebhooksFile, "error", err)
+		os.Exit(1)
+	}
+	dispatcher := webhooks.NewDispatcher(webhookEndpoints, webhooks.Config{
+		Workers:        4,
+		MaxAttempts:    int(cfg.WebhookMaxAttempts),
+		InitialBackoff: cfg.WebhookBackoff,
+		MaxBackoff:     time.Hour,
+		Timeout:        cfg.WebhookTimeout,
+		Retention:      cfg.KeyTTL,
+	}, &http.Client{Transport: &tracing.Transport{Tracer: tracer}})
+
+	paymentHandler := handlers.NewPaymentHandler(cfg,
+		handlers.WithCurrencies(currencies),
+		handlers.WithLedger(paymentLedger),
+		handlers.WithWebhooks(dispatcher),
+		handlers.WithRisk(riskEngine),
+	)
+
+	idempotencyOpts := []middleware.Option{}
+
+	// Each merchant gets its own idempotency key namespace, so the same key
+	// from two merchants is two requests and neither sees the other's response.
+	// With mutual TLS the certificate subject can be the merchant instead.
+	if keyring != nil || cfg.TLSClientCertScope {
+		idempotencyOpts = append(idempotencyOpts, middleware.WithScope(middleware.MerchantScope))
+	}
+
+	// Append-only, hash-chained record of every decision, for disputes.
+	var auditSink *audit.FileSink
+	if cfg.AuditLogPath != "" {
+		auditSink, err = audit.NewFileSink(cfg.AuditLogPath, cfg.AuditMaxBytes)
+		if err != nil {
+			slog.Error("failed to open audit log", "path", cfg.AuditLogPath, "error", err)
+			os.Exit(1)
+		}
+		idempotencyOpts = append(idempotencyOpts, middleware.WithAudit(auditSink))
+	}
+
+	// Everything exposed on /metrics gets registered here.
+	registry := metrics.NewRegistry()
+	idempotencyMetrics := middleware.NewMetrics(registry)
+	registerStoreMetrics(registry, memStore)
+	if compressed != nil {
+		registerCompressionMetrics(registry, compressed)
+	}
+
+	// The idempotency middleware wraps the payment handler.
+	// Every request to /process-payment goes through the middleware first,
+	// and only reaches the handler if it's a genuine first-time request.
+	// The HTML form posts through the same instance so its requests are counted too.
+	// Requests sent with Prefer: respond-async run here instead of on the
+	// client's connection. Finished jobs stay pollable as long as their key lives.
+	jobPool := jobs.NewPool(jobs.Config{
+		Workers:   int(cfg.AsyncWorkers),
+		QueueSize: int(cfg.AsyncQueueSize),
+		Retention: cfg.KeyTTL,
+	})
+
+	idempotencyOpts = append(idempotencyOpts,
+		middleware.WithMetrics(idempotencyMetrics),
+		middleware.WithTracer(tracer),
+		middleware.WithAsync(jobPool),
+	)
+
+	// Batch items go through their own instance of the middleware. A batch
+	// and its items both re-run a cached 5xx, that's how a retried batch picks
+	// up the items that didn't finish while replaying the ones that did.
+	// Items aren't rate limited, the batch they came in has already been counted.
+	itemOpts := append(idempotencyOpts[:len(idempotencyOpts):len(idempotencyOpts)], middleware.WithRetryServerErrors())
+	batchHandler := batch.NewHandler(
+		middleware.Idempotency(keyStore, http.HandlerFunc(paymentHandler.ProcessPayment), itemOpts...),
+		batch.Config{
+			ItemPath: "/process-payment",
+			Workers:  int(cfg.BatchWorkers),
+			MaxItems: int(cfg.BatchMaxItems),
+		},
+	)
 
-	paymentHandler := handlers.NewPaymentHandler(cfg)
+	// Everything a client calls directly is rate limited per client,
+	// counting only requests that actually run. Authenticated requests are
+	// limited per merchant, whatever X-Client-ID they send. The rest by IP,
+	// unless a proxy in front is trusted to set X-Client-ID.
+	if cfg.RateLimitPerMinute > 0 {
+		clientID := middleware.ClientID
+		if cfg.TrustClientID {
+			clientID = middleware.TrustedClientID
+		}
+		limiter := middleware.NewRateLimiter(int(cfg.RateLimitPerMinute), int(cfg.RateLimitBurst),
+			func(r *http.Request) string {
+				if merchant := auth.Merchant(r.Context()); merchant != "" {
+					return "merchant:" + merchant
+				}
+				return clientID(r)
+			})
+		idempotencyOpts = append(idempotencyOpts, middleware.WithRateLimit(limiter))
+	}
+
+	// Every merchant-facing route needs an API key. It's checked before the
+	// idempotency middleware, which needs the merchant for the key scope.
+	// Calls that move money also have their signature checked, for the
+	// merchants that sign.
+	authenticated := func(h http.Handler) http.Handler {
+		h = middleware.Authenticate(keyring, h)
+		if cfg.TLSClientCertScope {
+			h = middleware.ClientCertIdentity(h)
+		}
+		return h
+	}
+	signed := func(h http.Handler) http.Handler {
+		return authenticated(middleware.VerifySignature(verifier, h))
+	}
+	idempotent := func(h http.HandlerFunc) http.Handler {
+		return signed(middleware.Idempotency(keyStore, h, idempotencyOpts...))
+	}
+	processPayment := idempotent(paymentHandler.ProcessPayment)
+	batchEndpoint := signed(middleware.Idempotency(keyStore, batchHandler,
+		append(idempotencyOpts[:len(idempotencyOpts):len(idempotencyOpts)], middleware.WithRetryServerErrors())...))
 
 	mux := http.NewServeMux()
 
@@ -38,7 +276,7 @@ func main() {
 
 		response := map[string]any{
 			"message":        "Idempotency Gateway is running",
-			"version":        "v1.0.0",
+			"version":        handlers.CurrentBuild().Version,
 			"uptime_seconds": int(time.Since(startTime).Seconds()),
 			"timestamp":      time.Now().UTC(),
 			"next_steps": []string{
@@ -62,13 +300,38 @@ func main() {
 		json.NewEncoder(w).Encode(response)
 	})
 
-	// The idempotency middleware wraps the payment handler.
-	// Every request to /process-payment goes through the middleware first,
-	// and only reaches the handler if it's a genuine first-time request.
-	mux.Handle(
-		"POST /process-payment",
-		middleware.Idempotency(memStore, http.HandlerFunc(paymentHandler.ProcessPayment)),
-	)
+	mux.Handle("POST /process-payment", processPayment)
+	mux.Handle("GET /payments/{id}", authenticated(http.HandlerFunc(paymentHandler.GetPayment)))
+	mux.Handle("POST /payment-batches", batchEndpoint)
+
+	// Two-phase payments. Every step that moves money is idempotent.
+	mux.Handle("POST /payments/authorize", idempotent(paymentHandler.Authorize))
+	mux.Handle("POST /payments/{id}/capture", idempotent(paymentHandler.Capture))
+	mux.Handle("POST /payments/{id}/void", idempotent(paymentHandler.Void))
+	mux.Handle("POST /payments/{id}/refunds", idempotent(paymentHandler.CreateRefund))
+	mux.Handle("GET /payments/{id}/refunds/{refund_id}", authenticated(http.HandlerFunc(paymentHandler.GetRefund)))
+
+	jobsHandler := handlers.NewJobsHandler(jobPool)
+	mux.Handle("GET /jobs/{id}", authenticated(http.HandlerFunc(jobsHandler.Status)))
+
+	webhooksHandler := handlers.NewWebhooksHandler(dispatcher)
+	mux.Handle("GET /webhooks/deliveries", authenticated(http.HandlerFunc(webhooksHandler.Deliveries)))
+	mux.Handle("GET /webhooks/deliveries/{id}", authenticated(http.HandlerFunc(webhooksHandler.Delivery)))
+
+	mux.Handle("GET /metrics", registry.Handler())
+
+	// Support tooling for inspecting and clearing keys, and the ledger,
+	// which totals every merchant's payments together so it's no merchant's
+	// to read. Without a token configured none of it is mounted.
+	if cfg.AdminToken != "" {
+		adminHandler := admin.NewHandler(keyStore, cfg)
+		ledgerHandler := handlers.NewLedgerHandler(paymentLedger)
+		adminHandler.Handle("GET /admin/ledger/balances", http.HandlerFunc(ledgerHandler.Balances))
+		adminHandler.Handle("GET /admin/ledger/accounts/{account}/entries", http.HandlerFunc(ledgerHandler.Entries))
+		mux.Handle("/admin/", adminHandler)
+	} else {
+		slog.Warn("GATEWAY_ADMIN_TOKEN not set, admin API disabled")
+	}
 
 	tmpl := template.Must(template.ParseFiles("templates/index.html"))
 
@@ -87,6 +350,7 @@ func main() {
 		amount := r.FormValue("amount")
 		currency := r.FormValue("currency")
 		key := r.FormValue("idempotency_key")
+		apiKey := r.FormValue("api_key")
 
 		reqBody := map[string]interface{}{
 			"amount":   amount,
@@ -94,14 +358,23 @@ func main() {
 		}
 		jsonBytes, _ := json.Marshal(reqBody)
 
-		req, _ := http.NewRequest("POST", "/process-payment", bytes.NewReader(jsonBytes))
+		// Carry the form request's context so the outcome shows up on its log line.
+		req, _ := http.NewRequestWithContext(r.Context(), "POST", "/process-payment", bytes.NewReader(jsonBytes))
 		req.Header.Set("Content-Type", "application/json")
 		req.Header.Set("Idempotency-Key", key)
+		// With GATEWAY_TLS_CLIENT_CERT_SCOPE the caller is its certificate,
+		// without the connection's TLS state the payment would go unscoped.
+		req.TLS = r.TLS
+		// And without its address every unauthenticated form user would
+		// share one rate limit bucket.
+		req.RemoteAddr = r.RemoteAddr
+		if apiKey != "" {
+			req.Header.Set("Authorization", "Bearer "+apiKey)
+		}
 
 		rec := &responseRecorder{}
 
-		handler := middleware.Idempotency(memStore, http.HandlerFunc(paymentHandler.ProcessPayment))
-		handler.ServeHTTP(rec, req)
+		processPayment.ServeHTTP(rec, req)
 
 		tmpl.Execute(w, map[string]interface{}{
 			"Response": string(rec.Body),
@@ -111,12 +384,218 @@ func main() {
 		})
 	})
 
-	log.Printf("[server] idempotency gateway running on %s", cfg.Port)
-	if err := http.ListenAndServe(cfg.Port, mux); err != nil {
-		log.Fatalf("[server] failed to start: %v", err)
+	// The drainer sits in front of everything so that once shutdown starts,
+	// new requests get a 503 instead of starting a payment we can't finish.
+	drainer := middleware.NewDrainer(cfg.DrainRetryAfter)
+
+	// Health endpoints live outside the drainer. While draining, /healthz
+	// must keep saying we're alive and /readyz must be able to say why
+	// we're not ready, rather than both getting a blanket 503.
+	healthHandler := handlers.NewHealthHandler(memStore, drainer.Draining)
+
+	root := http.NewServeMux()
+	root.HandleFunc("GET /healthz", healthHandler.Healthz)
+	root.HandleFunc("GET /readyz", healthHandler.Readyz)
+	root.HandleFunc("GET /version", healthHandler.Version)
+	root.Handle("/", drainer.Middleware(mux))
+
+	// The request logger goes outermost so even 503s from the drainer get a log line.
+	// Tracing sits just inside it so the server span covers the drainer too.
+	server := &http.Server{
+		Addr:    cfg.Port,
+		Handler: middleware.RequestLogger(logger, tracing.Middleware(tracer, root)),
+	}
+
+	// HTTPS when there's a certificate, and mutual TLS on top when there are
+	// client CAs. Renewed certificates are picked up from disk as they land.
+	var certs *tlsutil.Reloader
+	if cfg.TLSCertFile != "" {
+		var suites []string
+		if cfg.TLSCipherSuites != "" {
+			suites = strings.Split(cfg.TLSCipherSuites, ",")
+		}
+		certs, err = tlsutil.NewReloader(tlsutil.Config{
+			CertFile:     cfg.TLSCertFile,
+			KeyFile:      cfg.TLSKeyFile,
+			MinVersion:   cfg.TLSMinVersion,
+			CipherSuites: suites,
+			ClientCAFile: cfg.TLSClientCAFile,
+		})
+		if err != nil {
+			slog.Error("failed to set up TLS", "error", err)
+			os.Exit(1)
+		}
+		certs.Watch(cfg.TLSReloadInterval)
+		server.TLSConfig = certs.TLSConfig()
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	serverErr := make(chan error, 1)
+	go func() {
+		if certs != nil {
+			slog.Info("idempotency gateway running", "addr", cfg.Port, "tls", true, "mtls", cfg.TLSClientCAFile != "")
+			// The certificate comes from TLSConfig, not these file names.
+			serverErr <- server.ListenAndServeTLS("", "")
+			return
+		}
+		slog.Info("idempotency gateway running", "addr", cfg.Port)
+		serverErr <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-serverErr:
+		if !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("server failed to start", "error", err)
+			os.Exit(1)
+		}
+		return
+	case <-ctx.Done():
+	}
+
+	// Restore default signal handling, a second Ctrl+C kills us immediately.
+	stop()
+
+	slog.Info("shutdown signal received, draining in-flight requests",
+		"delay", cfg.DrainDelay.String(), "timeout", cfg.ShutdownTimeout.String())
+	drainer.DrainFor(server, cfg.DrainDelay)
+
+	// Shutdown stops accepting connections and waits for every active handler
+	// to return. For the idempotency middleware that means PROCESSING keys get
+	// their final Set(COMPLETE) before we tear the store down.
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		slog.Warn("drain timed out, forcing remaining connections closed", "error", err)
+		server.Close()
+	}
+
+	// Async jobs aren't tied to a connection, so Shutdown didn't wait for
+	// them. Give the queue what's left of the timeout to finish.
+	if err := jobPool.Close(shutdownCtx); err != nil {
+		slog.Warn("async jobs still running at shutdown", "error", err)
+	}
+
+	// Last, since the jobs above may still have been publishing events.
+	if err := dispatcher.Close(shutdownCtx); err != nil {
+		slog.Warn("webhook deliveries still in flight at shutdown", "error", err)
+	}
+
+	if certs != nil {
+		certs.Close()
+	}
+
+	if err := memStore.Close(); err != nil {
+		slog.Error("failed to close store", "error", err)
+	}
+
+	if traceExporter != nil {
+		traceExporter.Close()
+	}
+
+	if auditSink != nil {
+		if err := auditSink.Close(); err != nil {
+			slog.Error("failed to close audit log", "error", err)
+		}
+	}
+
+	slog.Info("shutdown complete")
+}
+
+// reloadKeysOnHangup re-reads the API keys file on every SIGHUP, which is
+// how a key is rotated without a restart. A file that doesn't load leaves
+// the keys as they were.
+func reloadKeysOnHangup(keyring *auth.Keyring, path string) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	for range hup {
+		keys, err := auth.Load(path)
+		if err == nil {
+			err = keyring.Replace(keys)
+		}
+		if err != nil {
+			slog.Error("failed to reload API keys, keeping the old ones", "path", path, "error", err)
+			continue
+		}
+		slog.Info("API keys reloaded", "keys", keyring.Len())
+	}
+}
+
+// newTracer builds the tracer for the configured output.
+// An empty output means tracing is off, which is a nil tracer.
+func newTracer(output string) (*tracing.Tracer, *tracing.JSONExporter, error) {
+	switch output {
+	case "":
+		return nil, nil, nil
+	case "stdout":
+		exporter := tracing.NewJSONExporter(os.Stdout)
+		return tracing.NewTracer(exporter), exporter, nil
+	default:
+		exporter, err := tracing.NewFileExporter(output)
+		if err != nil {
+			return nil, nil, err
+		}
+		return tracing.NewTracer(exporter), exporter, nil
 	}
 }
 
+// registerStoreMetrics exposes the store's key counts and sweeper evictions.
+// These are read from the store on every scrape rather than tracked twice.
+func registerStoreMetrics(reg *metrics.Registry, s store.Store) {
+	reg.NewGaugeFunc(
+		"idempotency_keys",
+		"Idempotency keys currently held in the store.",
+		func() float64 { return float64(s.Stats().Keys) },
+	)
+	reg.NewGaugeFunc(
+		"idempotency_keys_processing",
+		"Idempotency keys whose first request is still in-flight.",
+		func() float64 { return float64(s.Stats().Processing) },
+	)
+	reg.NewCounterFunc(
+		"idempotency_sweeper_evictions_total",
+		"Expired idempotency keys removed by the sweeper.",
+		func() float64 { return float64(s.Stats().Evicted) },
+	)
+}
+
+// registerCompressionMetrics exposes how much store compression is saving.
+func registerCompressionMetrics(reg *metrics.Registry, s *store.CompressedStore) {
+	reg.NewCounterFunc(
+		"idempotency_store_compressed_bodies_total",
+		"Cached response bodies stored compressed.",
+		func() float64 { return float64(s.CompressionStats().Compressed) },
+	)
+	reg.NewCounterFunc(
+		"idempotency_store_compression_skipped_total",
+		"Cached response bodies over the size threshold that didn't get smaller, stored as they were.",
+		func() float64 { return float64(s.CompressionStats().Skipped) },
+	)
+	reg.NewCounterFunc(
+		"idempotency_store_compression_input_bytes_total",
+		"Size of the compressed bodies before compression.",
+		func() float64 { return float64(s.CompressionStats().InputBytes) },
+	)
+	reg.NewCounterFunc(
+		"idempotency_store_compression_output_bytes_total",
+		"Size of the compressed bodies after compression.",
+		func() float64 { return float64(s.CompressionStats().OutputBytes) },
+	)
+	reg.NewGaugeFunc(
+		"idempotency_store_compression_ratio",
+		"Input bytes over output bytes for every body compressed so far, 0 before the first.",
+		func() float64 {
+			stats := s.CompressionStats()
+			if stats.OutputBytes == 0 {
+				return 0
+			}
+			return float64(stats.InputBytes) / float64(stats.OutputBytes)
+		},
+	)
+}
+
 type responseRecorder struct {
 	Body []byte
 	Code int
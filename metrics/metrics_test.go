@@ -0,0 +1,109 @@
+package metrics
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func render(r *Registry) string {
+	var buf bytes.Buffer
+	r.Write(&buf)
+	return buf.String()
+}
+
+func TestCounterVec_RendersEachLabelSet(t *testing.T) {
+	r := NewRegistry()
+	c := r.NewCounterVec("requests_total", "Requests by outcome.", "outcome")
+
+	c.Inc("new")
+	c.Inc("replay")
+	c.Inc("replay")
+
+	out := render(r)
+
+	for _, want := range []string{
+		"# HELP requests_total Requests by outcome.",
+		"# TYPE requests_total counter",
+		`requests_total{outcome="new"} 1`,
+		`requests_total{outcome="replay"} 2`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected output to contain %q, got:\n%s", want, out)
+		}
+	}
+}
+
+func TestCounterVec_EscapesLabelValues(t *testing.T) {
+	r := NewRegistry()
+	c := r.NewCounterVec("odd_total", "Odd labels.", "v")
+	c.Inc(`a"b`)
+
+	if out := render(r); !strings.Contains(out, `odd_total{v="a\"b"} 1`) {
+		t.Errorf("expected escaped quote in label value, got:\n%s", out)
+	}
+}
+
+func TestHistogram_BucketsAreCumulative(t *testing.T) {
+	r := NewRegistry()
+	h := r.NewHistogram("latency_seconds", "Latency.", []float64{0.1, 1})
+
+	h.Observe(0.05)
+	h.Observe(0.5)
+	h.Observe(5)
+
+	out := render(r)
+
+	for _, want := range []string{
+		"# TYPE latency_seconds histogram",
+		`latency_seconds_bucket{le="0.1"} 1`,
+		`latency_seconds_bucket{le="1"} 2`,
+		`latency_seconds_bucket{le="+Inf"} 3`,
+		"latency_seconds_sum 5.55",
+		"latency_seconds_count 3",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected output to contain %q, got:\n%s", want, out)
+		}
+	}
+}
+
+func TestHistogram_ValueOnBucketBoundaryCountsInThatBucket(t *testing.T) {
+	// Prometheus buckets are "less than or equal", so 1.0 belongs in le="1".
+	r := NewRegistry()
+	h := r.NewHistogram("edge_seconds", "Edge.", []float64{1, 2})
+	h.Observe(1)
+
+	if out := render(r); !strings.Contains(out, `edge_seconds_bucket{le="1"} 1`) {
+		t.Errorf("expected boundary value in le=\"1\", got:\n%s", out)
+	}
+}
+
+func TestGaugeFunc_ReadsValueAtScrapeTime(t *testing.T) {
+	r := NewRegistry()
+	n := 3
+	r.NewGaugeFunc("keys", "Keys.", func() float64 { return float64(n) })
+
+	n = 7
+
+	if out := render(r); !strings.Contains(out, "keys 7") {
+		t.Errorf("expected gauge to read latest value, got:\n%s", out)
+	}
+}
+
+func TestHandler_ServesTextFormat(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounterVec("hits_total", "Hits.").Inc()
+
+	w := httptest.NewRecorder()
+	r.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	if !strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain") {
+		t.Errorf("expected text/plain content type, got %s", w.Header().Get("Content-Type"))
+	}
+	if !strings.Contains(w.Body.String(), "hits_total 1") {
+		t.Errorf("expected hits_total 1, got:\n%s", w.Body.String())
+	}
+}
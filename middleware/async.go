@@ -0,0 +1,138 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/GordenArcher/Idempotency-Gateway/jobs"
+	"github.com/GordenArcher/Idempotency-Gateway/models"
+	"github.com/GordenArcher/Idempotency-Gateway/store"
+)
+
+// WithAsync lets clients opt out of holding the connection open while the
+// handler runs. A request sent with "Prefer: respond-async" is queued on
+// pool and answered straight away with a 202 pointing at /jobs/{id}.
+// Requests without the header behave exactly as before.
+func WithAsync(pool *jobs.Pool) Option {
+	return func(o *options) {
+		o.async = pool
+	}
+}
+
+// wantsAsync reports whether this request should be queued rather than run inline.
+func (o *options) wantsAsync(r *http.Request) bool {
+	return o.async != nil && prefersAsync(r)
+}
+
+// prefersAsync looks for the respond-async preference (RFC 7240) among
+// everything in the Prefer headers.
+func prefersAsync(r *http.Request) bool {
+	for _, header := range r.Header.Values("Prefer") {
+		for _, pref := range strings.Split(header, ",") {
+			token, _, _ := strings.Cut(pref, ";")
+			if strings.EqualFold(strings.TrimSpace(token), "respond-async") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// runAsync queues next to run in the background for a key that has just
+// been set to PROCESSING with entry.JobID, and sends the client a 202.
+// When the job finishes it completes the key exactly as the inline path
+// would, so a retry after that gets the real response replayed.
+func (o *options) runAsync(w http.ResponseWriter, r *http.Request, s store.Store, next http.Handler,
+	storeKey string, entry *models.CachedEntry, rawBody []byte, d *decision) {
+	// The job outlives this request, so it works on its own copy that isn't
+	// cancelled when the client hangs up, with a body it can still read.
+	jobReq := r.Clone(context.WithoutCancel(r.Context()))
+	jobReq.Body = io.NopCloser(bytes.NewReader(rawBody))
+
+	// The job belongs to the same scope as the key, so one caller can't poll
+	// another's result by its job ID.
+	_, err := o.async.Submit(entry.JobID, d.scope, func() jobs.Result {
+		// If the handler panics, don't leave duplicates parked on a key
+		// that's never going to complete.
+		defer func() {
+			if p := recover(); p != nil {
+				s.Delete(storeKey)
+				panic(p)
+			}
+		}()
+
+		recorder := &responseRecorder{
+			ResponseWriter: &discardWriter{header: http.Header{}},
+			statusCode:     http.StatusOK,
+		}
+		handlerStart := time.Now()
+		next.ServeHTTP(recorder, jobReq)
+		o.metrics.observeHandler(time.Since(handlerStart))
+
+		// Nothing but the handler has touched these headers, so all of them get cached.
+		headers := handlerHeaders(http.Header{}, recorder.header)
+		s.Set(storeKey, &models.CachedEntry{
+			State:        models.StateComplete,
+			BodyHash:     entry.BodyHash,
+			StatusCode:   recorder.statusCode,
+			ResponseBody: recorder.body.Bytes(),
+			Headers:      headers,
+			CreatedAt:    time.Now().Unix(),
+		})
+		return jobs.Result{StatusCode: recorder.statusCode, Headers: headers, Body: recorder.body.Bytes()}
+	})
+	if err != nil {
+		// Nothing ran, so forget the key and let the client retry later.
+		// A duplicate that raced in between may have been handed this job
+		// ID already, its poll gets a 404 and the retry starts clean.
+		s.Delete(storeKey)
+		if !errors.Is(err, jobs.ErrQueueFull) && !errors.Is(err, jobs.ErrClosed) {
+			slog.Error("failed to queue async request", "error", err, "request_id", RequestID(r.Context()))
+		}
+
+		d.outcome, d.status = OutcomeQueueFull, http.StatusServiceUnavailable
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Retry-After", "1")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "too many requests are queued for async processing, retry shortly",
+		})
+		return
+	}
+
+	d.outcome, d.status = OutcomeAccepted, http.StatusAccepted
+	writeAccepted(w, entry.JobID)
+}
+
+// writeAccepted is the 202 for a request being processed in the background.
+// The first request and any duplicates while it runs all get the same one.
+func writeAccepted(w http.ResponseWriter, jobID string) {
+	statusURL := "/jobs/" + jobID
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", statusURL)
+	w.Header().Set("Preference-Applied", "respond-async")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{
+		"status":     "accepted",
+		"job_id":     jobID,
+		"status_url": statusURL,
+	})
+}
+
+// discardWriter is the ResponseWriter an async job's handler writes to.
+// There's no client on the other end, the recorder wrapped around it keeps
+// everything that matters.
+type discardWriter struct {
+	header http.Header
+}
+
+func (dw *discardWriter) Header() http.Header         { return dw.header }
+func (dw *discardWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (dw *discardWriter) WriteHeader(int)             {}
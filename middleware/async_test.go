@@ -0,0 +1,181 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/GordenArcher/Idempotency-Gateway/jobs"
+	"github.com/GordenArcher/Idempotency-Gateway/store"
+)
+
+// asyncServer wraps a handler that blocks until release is closed, so tests
+// can look at a key while its job is still running.
+func asyncServer(t *testing.T, queueSize int) (h http.Handler, release chan struct{}, calls *atomic.Int32) {
+	t.Helper()
+	pool := jobs.NewPool(jobs.Config{Workers: 1, QueueSize: queueSize})
+	t.Cleanup(func() { pool.Close(context.Background()) })
+
+	release = make(chan struct{})
+	calls = &atomic.Int32{}
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		<-release
+		w.Header().Set("Location", "/payments/pay_123")
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"status":"success"}`))
+	})
+	return Idempotency(store.NewMemoryStore(time.Hour), handler, WithAsync(pool)), release, calls
+}
+
+func asyncRequest(h http.Handler, key, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/process-payment", strings.NewReader(body))
+	req.Header.Set("Idempotency-Key", key)
+	req.Header.Set("Prefer", "respond-async")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w
+}
+
+func TestAsync_FirstRequestReturns202WithStatusURL(t *testing.T) {
+	h, release, _ := asyncServer(t, 10)
+	defer close(release)
+
+	w := asyncRequest(h, "async-001", `{"amount": 100, "currency": "GHS"}`)
+
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("expected 202, got %d: %s", w.Code, w.Body.String())
+	}
+	var body map[string]string
+	json.Unmarshal(w.Body.Bytes(), &body)
+	if !strings.HasPrefix(body["job_id"], "job_") {
+		t.Errorf("expected a job ID, got %q", body["job_id"])
+	}
+	if loc := w.Header().Get("Location"); loc != "/jobs/"+body["job_id"] || body["status_url"] != loc {
+		t.Errorf("expected Location and status_url /jobs/%s, got %q and %q", body["job_id"], loc, body["status_url"])
+	}
+	if w.Header().Get("Preference-Applied") != "respond-async" {
+		t.Error("expected Preference-Applied: respond-async")
+	}
+}
+
+func TestAsync_DuplicateWhileRunningGetsSame202(t *testing.T) {
+	h, release, calls := asyncServer(t, 10)
+	defer close(release)
+	body := `{"amount": 100, "currency": "GHS"}`
+
+	first := asyncRequest(h, "async-002", body)
+
+	// Answered straight away, without waiting on the running job.
+	done := make(chan *httptest.ResponseRecorder)
+	go func() { done <- asyncRequest(h, "async-002", body) }()
+	select {
+	case second := <-done:
+		if second.Code != http.StatusAccepted {
+			t.Fatalf("expected 202, got %d", second.Code)
+		}
+		if second.Header().Get("Location") != first.Header().Get("Location") {
+			t.Errorf("expected the same job, got %q and %q",
+				first.Header().Get("Location"), second.Header().Get("Location"))
+		}
+	case <-time.After(time.Second):
+		t.Fatal("duplicate async request blocked on the running job")
+	}
+
+	if n := calls.Load(); n > 1 {
+		t.Errorf("expected the handler to run once, ran %d times", n)
+	}
+}
+
+func TestAsync_DuplicateAfterCompletionGetsFinalResult(t *testing.T) {
+	h, release, calls := asyncServer(t, 10)
+	body := `{"amount": 100, "currency": "GHS"}`
+
+	asyncRequest(h, "async-003", body)
+	close(release)
+
+	// A synchronous retry waits for the job like any other duplicate.
+	req := httptest.NewRequest(http.MethodPost, "/process-payment", strings.NewReader(body))
+	req.Header.Set("Idempotency-Key", "async-003")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected the final 201, got %d: %s", w.Code, w.Body.String())
+	}
+	if w.Header().Get("Location") != "/payments/pay_123" {
+		t.Errorf("expected the handler's Location header, got %q", w.Header().Get("Location"))
+	}
+
+	// And once it's complete, an async retry gets the result too, not another 202.
+	again := asyncRequest(h, "async-003", body)
+	if again.Code != http.StatusCreated || again.Header().Get("X-Cache-Hit") != "true" {
+		t.Errorf("expected a replayed 201, got %d", again.Code)
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("expected the handler to run once, ran %d times", n)
+	}
+}
+
+func TestAsync_QueueFullReturns503AndReleasesKey(t *testing.T) {
+	h, release, _ := asyncServer(t, 0)
+	defer close(release)
+
+	// The only worker picks this one up and blocks.
+	asyncRequest(h, "async-004", `{"amount": 1, "currency": "GHS"}`)
+	time.Sleep(20 * time.Millisecond)
+
+	w := asyncRequest(h, "async-005", `{"amount": 2, "currency": "GHS"}`)
+	if w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503, got %d", w.Code)
+	}
+	if w.Header().Get("Retry-After") == "" {
+		t.Error("expected a Retry-After header")
+	}
+
+	// The key was released, so the retry isn't a conflict or a wait.
+	w = asyncRequest(h, "async-005", `{"amount": 3, "currency": "GHS"}`)
+	if w.Code == http.StatusConflict {
+		t.Error("expected the rejected key to be forgotten")
+	}
+}
+
+func TestAsync_WithoutPreferHeaderRunsInline(t *testing.T) {
+	h, release, _ := asyncServer(t, 10)
+	close(release)
+
+	req := httptest.NewRequest(http.MethodPost, "/process-payment", strings.NewReader(`{}`))
+	req.Header.Set("Idempotency-Key", "async-006")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Errorf("expected 201, got %d", w.Code)
+	}
+}
+
+func TestPrefersAsync(t *testing.T) {
+	tests := map[string]bool{
+		"respond-async":                 true,
+		"Respond-Async":                 true,
+		"return=minimal, respond-async": true,
+		"respond-async; wait=10":        true,
+		"wait=10":                       false,
+		"":                              false,
+	}
+	for header, want := range tests {
+		r := httptest.NewRequest(http.MethodPost, "/", nil)
+		if header != "" {
+			r.Header.Set("Prefer", header)
+		}
+		if got := prefersAsync(r); got != want {
+			t.Errorf("Prefer %q: expected %v, got %v", header, want, got)
+		}
+	}
+}
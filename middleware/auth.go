@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/GordenArcher/Idempotency-Gateway/auth"
+)
+
+// Authenticate only lets through requests with a valid API key in
+// "Authorization: Bearer <key>", and puts the key's merchant in the request
+// context for everything further down. A nil keyring means authentication
+// is off and every request goes straight through.
+//
+// It has to sit outside Idempotency: the merchant is the key scope, and a
+// request that fails here must never get as far as storing its key.
+func Authenticate(keys *auth.Keyring, next http.Handler) http.Handler {
+	if keys == nil {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		secret, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || secret == "" {
+			unauthorized(w, "missing API key, send it as Authorization: Bearer <key>")
+			return
+		}
+
+		key, err := keys.Authenticate(secret)
+		switch {
+		case errors.Is(err, auth.ErrKeyExpired):
+			unauthorized(w, "API key has expired")
+			return
+		case errors.Is(err, auth.ErrKeyNotYetValid):
+			unauthorized(w, "API key is not valid yet")
+			return
+		case err != nil:
+			unauthorized(w, "invalid API key")
+			return
+		}
+
+		id := auth.Identity{Merchant: key.Merchant, KeyID: key.ID}
+		if rl, ok := r.Context().Value(requestLogKey{}).(*requestLog); ok {
+			rl.merchant, rl.keyID = id.Merchant, id.KeyID
+		}
+		next.ServeHTTP(w, r.WithContext(auth.WithIdentity(r.Context(), id)))
+	})
+}
+
+// MerchantScope is the idempotency key scope for authenticated requests.
+// Pass it to WithScope so one merchant's keys can never match another's.
+func MerchantScope(r *http.Request) string {
+	return auth.Merchant(r.Context())
+}
+
+func unauthorized(w http.ResponseWriter, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("WWW-Authenticate", `Bearer realm="gateway"`)
+	w.WriteHeader(http.StatusUnauthorized)
+	json.NewEncoder(w).Encode(map[string]string{"error": msg})
+}
@@ -0,0 +1,134 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GordenArcher/Idempotency-Gateway/auth"
+	"github.com/GordenArcher/Idempotency-Gateway/store"
+)
+
+func testKeyring(t *testing.T) *auth.Keyring {
+	t.Helper()
+	keys, err := auth.NewKeyring([]auth.Key{
+		{ID: "key_acme", Merchant: "acme", Hash: auth.Hash("sk_acme")},
+		{ID: "key_globex", Merchant: "globex", Hash: auth.Hash("sk_globex")},
+		{ID: "key_old", Merchant: "acme", Hash: auth.Hash("sk_old"), ExpiresAt: time.Now().Add(-time.Minute)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keys
+}
+
+func authedRequest(h http.Handler, apiKey, idempotencyKey, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/process-payment", strings.NewReader(body))
+	req.Header.Set("Idempotency-Key", idempotencyKey)
+	if apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w
+}
+
+func TestAuthenticate_RejectsBadKeys(t *testing.T) {
+	memStore := store.NewMemoryStore(time.Hour)
+	ran := false
+	h := Authenticate(testKeyring(t), Idempotency(memStore, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ran = true
+	}), WithScope(MerchantScope)))
+
+	for apiKey, want := range map[string]string{
+		"":        "missing API key",
+		"sk_nope": "invalid API key",
+		"sk_old":  "API key has expired",
+	} {
+		w := authedRequest(h, apiKey, "auth-1", `{"amount": 1}`)
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("key %q: expected 401, got %d", apiKey, w.Code)
+		}
+		if w.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("key %q: expected a WWW-Authenticate challenge", apiKey)
+		}
+		var resp map[string]string
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		if !strings.HasPrefix(resp["error"], want) {
+			t.Errorf("key %q: expected %q, got %q", apiKey, want, resp["error"])
+		}
+	}
+	if ran {
+		t.Error("handler ran for an unauthenticated request")
+	}
+	if memStore.Stats().Keys != 0 {
+		t.Error("an unauthenticated request stored its idempotency key")
+	}
+}
+
+func TestAuthenticate_PutsMerchantInContext(t *testing.T) {
+	var got auth.Identity
+	h := Authenticate(testKeyring(t), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = auth.FromContext(r.Context())
+	}))
+
+	authedRequest(h, "sk_globex", "auth-2", "")
+	if got.Merchant != "globex" || got.KeyID != "key_globex" {
+		t.Errorf("expected globex/key_globex, got %+v", got)
+	}
+}
+
+func TestAuthenticate_NilKeyringIsOpen(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	w := authedRequest(Authenticate(nil, next), "", "auth-3", "")
+	if w.Code != http.StatusOK {
+		t.Errorf("expected requests through with auth off, got %d", w.Code)
+	}
+}
+
+// The whole point: the same key from two merchants is two payments, and
+// neither gets the other's response.
+func TestAuthenticate_ScopesKeysPerMerchant(t *testing.T) {
+	memStore := store.NewMemoryStore(time.Hour)
+	h := Authenticate(testKeyring(t), Idempotency(memStore, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(auth.Merchant(r.Context())))
+	}), WithScope(MerchantScope)))
+
+	a := authedRequest(h, "sk_acme", "order-1", `{"amount": 100}`)
+	b := authedRequest(h, "sk_globex", "order-1", `{"amount": 200}`)
+	if a.Code != http.StatusCreated || b.Code != http.StatusCreated {
+		t.Fatalf("expected both merchants to get 201, got %d and %d", a.Code, b.Code)
+	}
+	if b.Header().Get("X-Cache-Hit") != "" || b.Body.String() != "globex" {
+		t.Errorf("globex got acme's response: %q", b.Body.String())
+	}
+
+	replay := authedRequest(h, "sk_acme", "order-1", `{"amount": 100}`)
+	if replay.Header().Get("X-Cache-Hit") != "true" || replay.Body.String() != "acme" {
+		t.Errorf("expected acme's own response replayed, got %q", replay.Body.String())
+	}
+}
+
+func TestAuthenticate_LogsMerchant(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	h := RequestLogger(logger, Authenticate(testKeyring(t), next))
+
+	authedRequest(h, "sk_acme", "auth-4", "")
+
+	var line map[string]any
+	json.Unmarshal(buf.Bytes(), &line)
+	if line["merchant"] != "acme" || line["api_key_id"] != "key_acme" {
+		t.Errorf("expected merchant and key ID on the log line, got %v", line)
+	}
+	if strings.Contains(buf.String(), "sk_acme") {
+		t.Error("the API key itself ended up in the log")
+	}
+}
@@ -0,0 +1,39 @@
+package middleware
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+)
+
+// bufferedBody is a request body that has already been read into memory.
+type bufferedBody struct {
+	*bytes.Reader
+	raw []byte
+}
+
+func (b *bufferedBody) Close() error { return nil }
+
+// ReadBody returns the request's body bytes and leaves a fresh reader over
+// them in r.Body, so the handler can still read it. Every middleware that
+// looks at the body goes through here, and only the first one actually
+// reads it: the signature check and the idempotency fingerprint are
+// guaranteed to see exactly the same bytes.
+func ReadBody(r *http.Request) ([]byte, error) {
+	if b, ok := r.Body.(*bufferedBody); ok {
+		r.Body = &bufferedBody{Reader: bytes.NewReader(b.raw), raw: b.raw}
+		return b.raw, nil
+	}
+
+	var raw []byte
+	if r.Body != nil {
+		var err error
+		raw, err = io.ReadAll(r.Body)
+		r.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	r.Body = &bufferedBody{Reader: bytes.NewReader(raw), raw: raw}
+	return raw, nil
+}
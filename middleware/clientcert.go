@@ -0,0 +1,39 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/GordenArcher/Idempotency-Gateway/auth"
+)
+
+// ClientCertIdentity makes the subject of the caller's verified TLS client
+// certificate its identity, for mutual TLS deployments where the
+// certificate is how callers are told apart. Everything that scopes by
+// merchant, idempotency keys first of all, then scopes by certificate.
+//
+// Put it outside Authenticate: when a request has an API key as well, the
+// key's merchant replaces the certificate's subject.
+func ClientCertIdentity(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		subject := ClientSubject(r)
+		if subject == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if rl, ok := r.Context().Value(requestLogKey{}).(*requestLog); ok {
+			rl.merchant = subject
+		}
+		next.ServeHTTP(w, r.WithContext(auth.WithIdentity(r.Context(), auth.Identity{Merchant: subject})))
+	})
+}
+
+// ClientSubject is the subject of the request's client certificate, e.g.
+// "CN=bank-a,O=Bank A". Only a certificate that verified against the client
+// CAs counts, otherwise it's "".
+func ClientSubject(r *http.Request) string {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return ""
+	}
+	return r.TLS.VerifiedChains[0][0].Subject.String()
+}
@@ -0,0 +1,81 @@
+package middleware
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GordenArcher/Idempotency-Gateway/auth"
+	"github.com/GordenArcher/Idempotency-Gateway/store"
+)
+
+// withClientCert makes r look like it came over mutual TLS with a verified
+// certificate for cn. The handshake itself is tested in tlsutil.
+func withClientCert(r *http.Request, cn string) *http.Request {
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: cn, Organization: []string{"Banks"}}}
+	r.TLS = &tls.ConnectionState{
+		PeerCertificates: []*x509.Certificate{cert},
+		VerifiedChains:   [][]*x509.Certificate{{cert}},
+	}
+	return r
+}
+
+func TestClientSubject(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "/", nil)
+	if ClientSubject(r) != "" {
+		t.Error("expected no subject over plain HTTP")
+	}
+
+	// Presented but not verified doesn't count.
+	r.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{{Subject: pkix.Name{CommonName: "bank-a"}}}}
+	if ClientSubject(r) != "" {
+		t.Error("expected an unverified certificate to be ignored")
+	}
+
+	if got := ClientSubject(withClientCert(r, "bank-a")); got != "CN=bank-a,O=Banks" {
+		t.Errorf("unexpected subject %q", got)
+	}
+}
+
+func TestClientCertIdentity_ScopesKeysPerCertificate(t *testing.T) {
+	memStore := store.NewMemoryStore(time.Hour)
+	h := ClientCertIdentity(Idempotency(memStore, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(auth.Merchant(r.Context())))
+	}), WithScope(MerchantScope)))
+
+	send := func(cn string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/process-payment", strings.NewReader(`{"amount": 1}`))
+		req.Header.Set("Idempotency-Key", "shared")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, withClientCert(req, cn))
+		return w
+	}
+
+	a, b := send("bank-a"), send("bank-b")
+	if b.Header().Get("X-Cache-Hit") != "" || b.Body.String() != "CN=bank-b,O=Banks" {
+		t.Errorf("bank-b got %q, expected its own response", b.Body.String())
+	}
+	if a.Body.String() != "CN=bank-a,O=Banks" || send("bank-a").Header().Get("X-Cache-Hit") != "true" {
+		t.Error("expected bank-a's retry replayed from its own scope")
+	}
+}
+
+func TestClientCertIdentity_APIKeyWins(t *testing.T) {
+	var got string
+	h := ClientCertIdentity(Authenticate(testKeyring(t), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = auth.Merchant(r.Context())
+	})))
+
+	req := httptest.NewRequest(http.MethodPost, "/", nil)
+	req.Header.Set("Authorization", "Bearer sk_acme")
+	h.ServeHTTP(httptest.NewRecorder(), withClientCert(req, "bank-a"))
+	if got != "acme" {
+		t.Errorf("expected the API key's merchant, got %q", got)
+	}
+}
@@ -0,0 +1,73 @@
+package middleware
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// Drainer tracks whether the gateway is shutting down.
+// Once Drain() is called every new request is turned away with a 503,
+// while requests that were already inside the handler keep running
+// so their results still make it into the store.
+type Drainer struct {
+	draining   atomic.Bool
+	retryAfter time.Duration
+}
+
+// NewDrainer builds a Drainer that advertises retryAfter in the
+// Retry-After header of the 503s it sends while draining.
+func NewDrainer(retryAfter time.Duration) *Drainer {
+	return &Drainer{retryAfter: retryAfter}
+}
+
+// Drain flips the gateway into draining mode. There's no way back,
+// this only ever happens on the way out.
+func (d *Drainer) Drain() {
+	d.draining.Store(true)
+}
+
+// DrainFor starts draining and keeps server answering for delay before
+// returning, so new requests get the 503 and /readyz reports it while a load
+// balancer catches up, rather than finding the port closed. Keep-alives are
+// turned off, so each open connection closes after its next response and the
+// client reconnects somewhere else. Call server.Shutdown after this.
+func (d *Drainer) DrainFor(server *http.Server, delay time.Duration) {
+	d.Drain()
+	server.SetKeepAlivesEnabled(false)
+	time.Sleep(delay)
+}
+
+// Draining reports whether Drain() has been called.
+func (d *Drainer) Draining() bool {
+	return d.draining.Load()
+}
+
+// Middleware rejects requests that arrive after Drain() was called.
+// Requests that got past this check before draining started are untouched,
+// http.Server.Shutdown waits for those to finish.
+func (d *Drainer) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !d.Draining() {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Retry-After is whole seconds, round up so we never tell the client 0.
+		seconds := int(math.Ceil(d.retryAfter.Seconds()))
+		if seconds < 1 {
+			seconds = 1
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Retry-After", strconv.Itoa(seconds))
+		w.Header().Set("Connection", "close")
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "server is shutting down, retry the request",
+		})
+	})
+}
@@ -0,0 +1,129 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestDrainer_PassesRequestsThroughBeforeDrain(t *testing.T) {
+	d := NewDrainer(5 * time.Second)
+	called := false
+	h := d.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		w.WriteHeader(http.StatusCreated)
+	}))
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/process-payment", nil))
+
+	if !called {
+		t.Error("expected the wrapped handler to be called before draining")
+	}
+	if w.Code != http.StatusCreated {
+		t.Errorf("expected 201, got %d", w.Code)
+	}
+}
+
+func TestDrainer_RejectsNewRequestsWith503(t *testing.T) {
+	// Once we're draining, new work must not start, a payment that begins
+	// now might not finish before the process exits.
+	d := NewDrainer(5 * time.Second)
+	h := d.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("handler should not run while draining")
+	}))
+
+	d.Drain()
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/process-payment", nil))
+
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503, got %d", w.Code)
+	}
+	if got := w.Header().Get("Retry-After"); got != "5" {
+		t.Errorf("expected Retry-After: 5, got %q", got)
+	}
+}
+
+func TestDrainer_RetryAfterNeverZero(t *testing.T) {
+	d := NewDrainer(0)
+	d.Drain()
+
+	w := httptest.NewRecorder()
+	d.Middleware(http.NotFoundHandler()).ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if got := w.Header().Get("Retry-After"); got != "1" {
+		t.Errorf("expected Retry-After: 1, got %q", got)
+	}
+}
+
+func TestDrainer_InFlightRequestFinishesAfterDrain(t *testing.T) {
+	// A request that was already inside the handler when Drain() ran
+	// must complete normally, that's the whole point of draining.
+	d := NewDrainer(time.Second)
+	started := make(chan struct{})
+	release := make(chan struct{})
+
+	h := d.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		w.WriteHeader(http.StatusCreated)
+	}))
+
+	w := httptest.NewRecorder()
+	done := make(chan struct{})
+	go func() {
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/process-payment", nil))
+		close(done)
+	}()
+
+	<-started
+	d.Drain()
+	close(release)
+	<-done
+
+	if w.Code != http.StatusCreated {
+		t.Errorf("expected in-flight request to finish with 201, got %d", w.Code)
+	}
+}
+
+func TestDrainer_DrainForKeepsAnsweringWith503(t *testing.T) {
+	// Between the signal and Shutdown a client must get the 503 and its
+	// Retry-After, not a refused connection.
+	d := NewDrainer(5 * time.Second)
+	srv := httptest.NewServer(d.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	})))
+	defer srv.Close()
+
+	// Leaves an idle keep-alive connection behind, the next request reuses it.
+	resp, err := srv.Client().Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	done := make(chan struct{})
+	go func() {
+		d.DrainFor(srv.Config, 200*time.Millisecond)
+		close(done)
+	}()
+	for !d.Draining() {
+		time.Sleep(time.Millisecond)
+	}
+
+	resp, err = srv.Client().Get(srv.URL)
+	if err != nil {
+		t.Fatalf("expected an answer during the drain delay, got %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable || resp.Header.Get("Retry-After") != "5" {
+		t.Errorf("expected 503 with Retry-After 5, got %d with %q", resp.StatusCode, resp.Header.Get("Retry-After"))
+	}
+	if !resp.Close {
+		t.Error("expected the connection to be closed after the response")
+	}
+	<-done
+}
@@ -5,90 +5,220 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
-	"io"
+	"log/slog"
 	"net/http"
+	"net/url"
+	"slices"
 	"time"
 
+	"github.com/GordenArcher/Idempotency-Gateway/audit"
+	"github.com/GordenArcher/Idempotency-Gateway/jobs"
 	"github.com/GordenArcher/Idempotency-Gateway/models"
 	"github.com/GordenArcher/Idempotency-Gateway/store"
+	"github.com/GordenArcher/Idempotency-Gateway/tracing"
 )
 
 type responseRecorder struct {
 	http.ResponseWriter
 	statusCode int
 	body       bytes.Buffer
+	header     http.Header // snapshot of the headers as they went out
 }
 
 // WriteHeader intercepts the status code before it goes out to the client.
 func (rr *responseRecorder) WriteHeader(code int) {
 	rr.statusCode = code
+	rr.header = rr.ResponseWriter.Header().Clone()
 	rr.ResponseWriter.WriteHeader(code)
 }
 
 // Write intercepts the body bytes, writes to both the buffer (for caching)
 // and the real ResponseWriter (so the client still gets a response).
 func (rr *responseRecorder) Write(b []byte) (int, error) {
+	if rr.header == nil {
+		// Write without WriteHeader is an implicit 200, headers go out now.
+		rr.header = rr.ResponseWriter.Header().Clone()
+	}
 	rr.body.Write(b)
 	return rr.ResponseWriter.Write(b)
 }
 
+// Option configures optional behaviour of the Idempotency middleware.
+type Option func(*options)
+
+type options struct {
+	metrics *Metrics
+	tracer  *tracing.Tracer
+	audit   audit.Sink
+	scope   func(r *http.Request) string
+	async   *jobs.Pool
+	limiter *RateLimiter
+
+	retryServerErrors bool
+}
+
+// WithMetrics records every decision the middleware makes on m.
+func WithMetrics(m *Metrics) Option {
+	return func(o *options) {
+		o.metrics = m
+	}
+}
+
+// WithTracer emits a span for each step of the idempotency flow
+// (store lookup, wait, handler, cache write) so a slow request shows
+// exactly where its time went.
+func WithTracer(t *tracing.Tracer) Option {
+	return func(o *options) {
+		o.tracer = t
+	}
+}
+
+// WithAudit writes every decision, including rejections, to sink.
+func WithAudit(sink audit.Sink) Option {
+	return func(o *options) {
+		o.audit = sink
+	}
+}
+
+// WithScope namespaces idempotency keys per caller. Two callers sending the
+// same Idempotency-Key get separate entries, so one can never be replayed
+// the other's response. An empty scope leaves the key as-is.
+func WithScope(scope func(r *http.Request) string) Option {
+	return func(o *options) {
+		o.scope = scope
+	}
+}
+
+// WithRetryServerErrors runs a key again when its cached response is a 5xx,
+// instead of replaying it. That's for endpoints where a 5xx means "didn't
+// finish" rather than a final answer, like a batch with items still to do.
+// The handler must be safe to run twice, e.g. by passing the key on to the
+// processor as its reference.
+func WithRetryServerErrors() Option {
+	return func(o *options) {
+		o.retryServerErrors = true
+	}
+}
+
+// decision collects what happened to one request so it can be reported
+// once, after the response has gone out.
+type decision struct {
+	start    time.Time
+	scope    string
+	outcome  Outcome
+	keyHash  string
+	bodyHash string
+	status   int
+}
+
+// record reports a decision to everything that wants to know about it:
+// the metrics counters, the request's log line, the active span and the audit log.
+func (o *options) record(r *http.Request, d *decision) {
+	o.metrics.countOutcome(d.outcome)
+	annotate(r, d.outcome, d.keyHash)
+
+	span := tracing.SpanFromContext(r.Context())
+	span.SetAttribute("idempotency.outcome", string(d.outcome))
+	if d.keyHash != "" {
+		span.SetAttribute("idempotency.key_hash", d.keyHash)
+	}
+
+	if o.audit != nil {
+		err := o.audit.Write(audit.Record{
+			Time:            d.start,
+			Scope:           d.scope,
+			KeyHash:         d.keyHash,
+			BodyFingerprint: d.bodyHash,
+			Outcome:         string(d.outcome),
+			Status:          d.status,
+			LatencyMicros:   time.Since(d.start).Microseconds(),
+		})
+		if err != nil {
+			// The response has already gone out, all we can do is shout.
+			slog.Error("failed to write audit record", "error", err, "request_id", RequestID(r.Context()))
+		}
+	}
+}
+
+// startSpan starts a child span of the request's span for one step of the flow.
+func (o *options) startSpan(r *http.Request, name string) (*http.Request, *tracing.Span) {
+	ctx, span := o.tracer.Start(r.Context(), name, tracing.KindInternal)
+	return r.WithContext(ctx), span
+}
+
 // Idempotency returns an HTTP middleware that wraps any handler with idempotency logic.
 // This is the core of the whole project, everything flows through here.
 //
 // The Flow we follow:
 //  1. No Idempotency-Key header > reject immediately
 //  2. Key not seen before > process normally, cache the result
-//  3. Key seen, still PROCESSING > block until it's done, return cached result
-//  4. Key seen, COMPLETE, same body > return cached result instantly
-//  5. Key seen, COMPLETE, different body > reject with 409
-func Idempotency(s *store.MemoryStore, next http.Handler) http.Handler {
+//  3. Key seen, different body > reject with 409
+//  4. Key seen, still PROCESSING > block until it's done, return cached result
+//  5. Key seen, COMPLETE, same body > return cached result instantly
+//
+// With WithAsync, a request that prefers respond-async gets a 202 in step 2
+// instead, and a duplicate of it in step 4 gets the same 202 without waiting.
+func Idempotency(s store.Store, next http.Handler, opts ...Option) http.Handler {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Every path below fills in the decision, and it's reported exactly
+		// once on the way out, whichever return we leave through.
+		d := &decision{start: time.Now()}
+		if o.scope != nil {
+			d.scope = o.scope(r)
+		}
+		defer o.record(r, d)
 
 		// I extract and validate the Idempotency-Key header
 		// Without this header we have no way to deduplicate, reject the request.
 		idempotencyKey := r.Header.Get("Idempotency-Key")
 		if idempotencyKey == "" {
+			d.outcome, d.status = OutcomeMissingKey, http.StatusBadRequest
 			http.Error(w, `{"error": "missing Idempotency-Key header"}`, http.StatusBadRequest)
 			return
 		}
 
+		// The raw key never leaves this function, logs, metrics and the
+		// audit trail only ever see the hash.
+		d.keyHash = hashKey(idempotencyKey)
+		storeKey := scopedKey(d.scope, idempotencyKey)
+
 		// I need to hash the body to detect conflicts (same key, different payload).
-		// Reading the body also drains the reader, so I need to restore it
-		// afterwards so the actual handler can read it too.
-		rawBody, err := io.ReadAll(r.Body)
+		// ReadBody leaves it readable for the actual handler afterwards.
+		rawBody, err := ReadBody(r)
 		if err != nil {
+			d.outcome, d.status = OutcomeInvalidBody, http.StatusInternalServerError
 			http.Error(w, `{"error": "failed to read request body"}`, http.StatusInternalServerError)
 			return
 		}
-		// Restore the body so the downstream handler can read it normally
-		r.Body = io.NopCloser(bytes.NewBuffer(rawBody))
 
-		// Hash the raw body bytes, this is what we compare on duplicate requests
-		bodyHash := hashBody(rawBody)
+		// Hash the raw body bytes, this is what we compare on duplicate requests.
+		// Method and path go in too, so a key reused on a different endpoint
+		// is a conflict rather than a replay of some other endpoint's response.
+		bodyHash := fingerprint(r.Method, r.URL.Path, rawBody)
+		d.bodyHash = bodyHash
 
 		//I check the store
-		existing := s.Get(idempotencyKey)
+		_, lookupSpan := o.startSpan(r, "idempotency.lookup")
+		existing := s.Get(storeKey)
+		lookupSpan.SetAttribute("idempotency.found", existing != nil)
+		lookupSpan.Finish()
 
 		if existing != nil {
 			// Key exists ? figure out which scenario we're in
 
-			if existing.State == models.StateProcessing {
-				// Race condition handling
-				// Another request with this key is currently in-flight.
-				// We don't process again, we don't reject, we just wait.
-				// WaitForComplete parks this goroutine until the other one finishes.
-				completed := s.WaitForComplete(idempotencyKey)
-				if completed != nil {
-					replayResponse(w, completed)
-					return
-				}
-			}
-
-			// Key is COMPLETE, check if the body matches
+			// Check the body first, even if the key is still PROCESSING.
+			// A different payload must never be handed the response that
+			// was produced for someone else's body.
 			if existing.BodyHash != bodyHash {
 				// Conflict detection
 				// Same key, different payload, this is either a bug or fraud.
 				// The system eeject it hard.
+				d.outcome, d.status = OutcomeConflict, http.StatusConflict
 				w.Header().Set("Content-Type", "application/json")
 				w.WriteHeader(http.StatusConflict)
 				json.NewEncoder(w).Encode(map[string]string{
@@ -97,20 +227,87 @@ func Idempotency(s *store.MemoryStore, next http.Handler) http.Handler {
 				return
 			}
 
+			if existing.State == models.StateProcessing {
+				// The first request was queued async and this one is happy to
+				// poll too, point it at the same job rather than blocking.
+				if existing.JobID != "" && o.wantsAsync(r) {
+					d.outcome, d.status = OutcomeAsyncQueued, http.StatusAccepted
+					writeAccepted(w, existing.JobID)
+					return
+				}
+
+				// Race condition handling
+				// Another request with this key is currently in-flight.
+				// We don't process again, we don't reject, we just wait.
+				// WaitForComplete parks this goroutine until the other one finishes.
+				_, waitSpan := o.startSpan(r, "idempotency.wait")
+				waitStart := time.Now()
+				completed := s.WaitForComplete(storeKey)
+				o.metrics.observeWait(time.Since(waitStart))
+				waitSpan.Finish()
+
+				if completed == nil {
+					// The key was deleted while we were parked on it (admin purge
+					// or sweeper). The first request may still be running, so
+					// processing this one now could charge twice. Tell the client
+					// to try again instead.
+					d.outcome, d.status = OutcomeConflict, http.StatusConflict
+					w.Header().Set("Content-Type", "application/json")
+					w.WriteHeader(http.StatusConflict)
+					json.NewEncoder(w).Encode(map[string]string{
+						"error": "Idempotency key was removed while a request with it was in progress, retry the request.",
+					})
+					return
+				}
+
+				d.outcome, d.status = OutcomeWait, completed.StatusCode
+				replayResponse(w, completed)
+				return
+			}
+
 			// Duplicate request, same body
 			// This is the happy-path duplicate, just replay the cached response.
-			replayResponse(w, existing)
+			if !o.retryServerErrors || existing.StatusCode < 500 {
+				d.outcome, d.status = OutcomeReplay, existing.StatusCode
+				replayResponse(w, existing)
+				return
+			}
+			// Otherwise the last run didn't finish, fall through and run it again.
+		}
+
+		// Only now do we know this request will actually run, so this is
+		// where it's charged against the client's rate limit. Nothing has
+		// been stored yet, a 429 leaves the key free for the retry.
+		if o.limiter != nil && !o.limiter.admit(w, r) {
+			d.outcome, d.status = OutcomeRateLimited, http.StatusTooManyRequests
 			return
 		}
 
-		// First time we've seen this key
+		// First time we've seen this key (or a retry of one that didn't finish)
 		// Mark it as PROCESSING immediately so any concurrent duplicate requests
 		// know to wait rather than start their own processing.
-		s.Set(idempotencyKey, &models.CachedEntry{
+		processing := &models.CachedEntry{
 			State:     models.StateProcessing,
 			BodyHash:  bodyHash,
 			CreatedAt: time.Now().Unix(),
-		})
+		}
+		// An async request's job ID goes in with the PROCESSING entry,
+		// so a duplicate arriving a moment later already knows where to poll.
+		async := o.wantsAsync(r)
+		if async {
+			processing.JobID = jobs.NewID()
+		}
+		s.Set(storeKey, processing)
+
+		if async {
+			o.runAsync(w, r, s, next, storeKey, processing, rawBody, d)
+			return
+		}
+
+		// Remember what the headers looked like before the handler ran, so
+		// only the ones it set get cached. X-Request-ID and friends belong
+		// to this request and mustn't be replayed onto the next one.
+		headersBefore := w.Header().Clone()
 
 		// Wrap the ResponseWriter so we can capture what the handler sends back
 		recorder := &responseRecorder{
@@ -120,31 +317,81 @@ func Idempotency(s *store.MemoryStore, next http.Handler) http.Handler {
 
 		// Call the actual payment handler endpoint
 		// The 2-second simulated delay happens inside here.
-		next.ServeHTTP(recorder, r)
+		handlerReq, handlerSpan := o.startSpan(r, "idempotency.handler")
+		handlerStart := time.Now()
+		next.ServeHTTP(recorder, handlerReq)
+		o.metrics.observeHandler(time.Since(handlerStart))
+		handlerSpan.SetAttribute("http.response.status_code", recorder.statusCode)
+		handlerSpan.Finish()
+
+		d.outcome, d.status = OutcomeNew, recorder.statusCode
+		if existing != nil {
+			d.outcome = OutcomeRetry
+		}
 
 		// Cache the result
 		// Now that the handler is done, save what it returned so future
 		// duplicate requests can get the exact same response replayed.
-		s.Set(idempotencyKey, &models.CachedEntry{
+		_, writeSpan := o.startSpan(r, "idempotency.cache_write")
+		s.Set(storeKey, &models.CachedEntry{
 			State:        models.StateComplete,
 			BodyHash:     bodyHash,
 			StatusCode:   recorder.statusCode,
 			ResponseBody: recorder.body.Bytes(),
+			Headers:      handlerHeaders(headersBefore, recorder.header),
 			CreatedAt:    time.Now().Unix(),
 		})
+		writeSpan.Finish()
 	})
 }
 
+// scopedKey is the key actually used in the store. The scope is escaped
+// so a ':' inside it can't make two different scope/key pairs collide.
+func scopedKey(scope, key string) string {
+	if scope == "" {
+		return key
+	}
+	return url.QueryEscape(scope) + ":" + key
+}
+
 // replayResponse sends back the exact same response we cached from the first request.
 // Sets X-Cache-Hit: true so the client knows this was a replayed response.
 func replayResponse(w http.ResponseWriter, entry *models.CachedEntry) {
 	w.Header().Set("Content-Type", "application/json")
+	for name, values := range entry.Headers {
+		w.Header()[name] = values
+	}
 	w.Header().Set("X-Cache-Hit", "true")
 	w.WriteHeader(entry.StatusCode)
 	w.Write(entry.ResponseBody)
 }
 
+// handlerHeaders returns the headers in after that weren't already in before.
+func handlerHeaders(before, after http.Header) http.Header {
+	var added http.Header
+	for name, values := range after {
+		if slices.Equal(before[name], values) {
+			continue
+		}
+		if added == nil {
+			added = make(http.Header)
+		}
+		added[name] = values
+	}
+	return added
+}
+
+// fingerprint identifies a request for conflict detection.
+func fingerprint(method, path string, body []byte) string {
+	return hashBody(append([]byte(method+" "+path+"\n"), body...))
+}
+
 func hashBody(body []byte) string {
 	h := sha256.Sum256(body)
 	return hex.EncodeToString(h[:])
 }
+
+// hashKey is what we log in place of the raw idempotency key.
+func hashKey(key string) string {
+	return hashBody([]byte(key))
+}
@@ -9,9 +9,12 @@ import (
 	"testing"
 	"time"
 
+	"github.com/GordenArcher/Idempotency-Gateway/audit"
 	"github.com/GordenArcher/Idempotency-Gateway/config"
 	"github.com/GordenArcher/Idempotency-Gateway/handlers"
+	"github.com/GordenArcher/Idempotency-Gateway/metrics"
 	"github.com/GordenArcher/Idempotency-Gateway/store"
+	"github.com/GordenArcher/Idempotency-Gateway/tracing"
 )
 
 // testServer wires the full stack: store → middleware → handler.
@@ -206,6 +209,61 @@ func TestConflict_DifferentCurrencySameAmount_Returns409(t *testing.T) {
 	}
 }
 
+func TestConflict_WhileFirstRequestStillProcessing_Returns409(t *testing.T) {
+	// A different body arriving while the first request is in-flight
+	// must be rejected straight away, not parked and then handed
+	// the response that belongs to the other body.
+	_, h := testServer(150 * time.Millisecond)
+
+	key := "key-conflict-inflight"
+	done := make(chan struct{})
+	go func() {
+		makeRequest(h, key, `{"amount": 100, "currency": "GHS"}`)
+		close(done)
+	}()
+
+	time.Sleep(30 * time.Millisecond)
+	w := makeRequest(h, key, `{"amount": 900, "currency": "GHS"}`)
+	<-done
+
+	if w.Code != http.StatusConflict {
+		t.Errorf("expected 409 while key is PROCESSING, got %d — body: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestKeyDeletedWhileWaiting_Returns409(t *testing.T) {
+	// If the key is purged while a duplicate is parked on it, the duplicate
+	// must not replay an empty PROCESSING entry or start processing itself.
+	memStore := store.NewMemoryStore(24 * time.Hour)
+	release := make(chan struct{})
+	slow := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.WriteHeader(http.StatusCreated)
+	})
+	h := Idempotency(memStore, slow)
+
+	body := `{"amount": 100, "currency": "GHS"}`
+	done := make(chan struct{})
+	go func() {
+		makeRequest(h, "purged-key", body)
+		close(done)
+	}()
+	time.Sleep(30 * time.Millisecond)
+
+	waiter := make(chan *httptest.ResponseRecorder, 1)
+	go func() { waiter <- makeRequest(h, "purged-key", body) }()
+	time.Sleep(30 * time.Millisecond)
+
+	memStore.Delete("purged-key")
+	w := <-waiter
+	close(release)
+	<-done
+
+	if w.Code != http.StatusConflict {
+		t.Errorf("expected 409 for a key purged mid-wait, got %d — body: %s", w.Code, w.Body.String())
+	}
+}
+
 // --- Missing header ---
 
 func TestMissingIdempotencyKey_Returns400(t *testing.T) {
@@ -418,3 +476,321 @@ func TestHashBody_EmptyBody_DoesNotPanic(t *testing.T) {
 		t.Error("expected non-empty hash for empty input")
 	}
 }
+
+func TestFingerprint_IncludesMethodAndPath(t *testing.T) {
+	body := []byte(`{"amount":100}`)
+	base := fingerprint(http.MethodPost, "/process-payment", body)
+
+	if base == fingerprint(http.MethodPost, "/payments/pay_1/refunds", body) {
+		t.Error("same body on a different path must not fingerprint the same")
+	}
+	if base == fingerprint(http.MethodPut, "/process-payment", body) {
+		t.Error("same body with a different method must not fingerprint the same")
+	}
+}
+
+func TestSameKey_DifferentEndpoint_Returns409(t *testing.T) {
+	s := store.NewMemoryStore(time.Hour)
+	h := Idempotency(s, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	}))
+
+	body := `{"amount": 100}`
+	first := httptest.NewRequest(http.MethodPost, "/process-payment", strings.NewReader(body))
+	first.Header.Set("Idempotency-Key", "shared-key")
+	h.ServeHTTP(httptest.NewRecorder(), first)
+
+	second := httptest.NewRequest(http.MethodPost, "/payments/pay_1/refunds", strings.NewReader(body))
+	second.Header.Set("Idempotency-Key", "shared-key")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, second)
+
+	if w.Code != http.StatusConflict {
+		t.Errorf("expected 409 for a key reused on another endpoint, got %d", w.Code)
+	}
+}
+
+func TestMetrics_CountsEachOutcome(t *testing.T) {
+	reg := metrics.NewRegistry()
+	m := NewMetrics(reg)
+
+	memStore := store.NewMemoryStore(24 * time.Hour)
+	handler := handlers.NewPaymentHandler(&config.Config{})
+	h := Idempotency(memStore, http.HandlerFunc(handler.ProcessPayment), WithMetrics(m))
+
+	body := `{"amount": 100, "currency": "GHS"}`
+	makeRequest(h, "metrics-key", body)
+	makeRequest(h, "metrics-key", body)
+	makeRequest(h, "metrics-key", `{"amount": 1, "currency": "GHS"}`)
+	makeRequest(h, "", body)
+
+	for outcome, want := range map[Outcome]float64{
+		OutcomeNew:        1,
+		OutcomeReplay:     1,
+		OutcomeConflict:   1,
+		OutcomeMissingKey: 1,
+	} {
+		if got := m.requests.Value(string(outcome)); got != want {
+			t.Errorf("outcome %s: expected %v, got %v", outcome, want, got)
+		}
+	}
+
+	if got := m.handlerLatency.Count(); got != 1 {
+		t.Errorf("expected handler latency observed once, got %d", got)
+	}
+}
+
+// spanRecorder collects finished spans by name.
+type spanRecorder struct {
+	mu    sync.Mutex
+	spans map[string][]*tracing.Span
+}
+
+func (sr *spanRecorder) ExportSpan(s *tracing.Span) {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+	if sr.spans == nil {
+		sr.spans = make(map[string][]*tracing.Span)
+	}
+	sr.spans[s.Name] = append(sr.spans[s.Name], s)
+}
+
+func TestTracing_NewRequestEmitsLookupHandlerAndWriteSpans(t *testing.T) {
+	rec := &spanRecorder{}
+	tracer := tracing.NewTracer(rec)
+
+	memStore := store.NewMemoryStore(24 * time.Hour)
+	handler := handlers.NewPaymentHandler(&config.Config{})
+	h := tracing.Middleware(tracer, Idempotency(memStore, http.HandlerFunc(handler.ProcessPayment), WithTracer(tracer)))
+
+	makeRequest(h, "trace-key-001", `{"amount": 100, "currency": "GHS"}`)
+
+	server := rec.spans["POST /process-payment"]
+	if len(server) != 1 {
+		t.Fatalf("expected one server span, got %d", len(server))
+	}
+	if got := server[0].Attributes()["idempotency.outcome"]; got != string(OutcomeNew) {
+		t.Errorf("expected outcome attribute on server span, got %v", got)
+	}
+
+	for _, name := range []string{"idempotency.lookup", "idempotency.handler", "idempotency.cache_write"} {
+		spans := rec.spans[name]
+		if len(spans) != 1 {
+			t.Errorf("expected one %s span, got %d", name, len(spans))
+			continue
+		}
+		if spans[0].ParentSpanID != server[0].Context.SpanID {
+			t.Errorf("%s should be a child of the server span", name)
+		}
+	}
+}
+
+func TestTracing_DuplicateEmitsWaitSpan(t *testing.T) {
+	rec := &spanRecorder{}
+	tracer := tracing.NewTracer(rec)
+
+	memStore := store.NewMemoryStore(24 * time.Hour)
+	handler := handlers.NewPaymentHandler(&config.Config{ProcessingDelay: 100 * time.Millisecond})
+	h := Idempotency(memStore, http.HandlerFunc(handler.ProcessPayment), WithTracer(tracer))
+
+	body := `{"amount": 100, "currency": "GHS"}`
+	done := make(chan struct{})
+	go func() {
+		makeRequest(h, "trace-key-002", body)
+		close(done)
+	}()
+	time.Sleep(30 * time.Millisecond)
+	makeRequest(h, "trace-key-002", body)
+	<-done
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	if len(rec.spans["idempotency.wait"]) != 1 {
+		t.Errorf("expected one wait span, got %d", len(rec.spans["idempotency.wait"]))
+	}
+	if len(rec.spans["idempotency.handler"]) != 1 {
+		t.Errorf("handler should only run once, got %d handler spans", len(rec.spans["idempotency.handler"]))
+	}
+}
+
+// auditRecorder is an in-memory audit.Sink.
+type auditRecorder struct {
+	mu      sync.Mutex
+	records []audit.Record
+}
+
+func (a *auditRecorder) Write(rec audit.Record) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.records = append(a.records, rec)
+	return nil
+}
+
+func TestAudit_RecordsEveryDecision(t *testing.T) {
+	sink := &auditRecorder{}
+	memStore := store.NewMemoryStore(24 * time.Hour)
+	handler := handlers.NewPaymentHandler(&config.Config{})
+	h := Idempotency(memStore, http.HandlerFunc(handler.ProcessPayment), WithAudit(sink))
+
+	body := `{"amount": 100, "currency": "GHS"}`
+	makeRequest(h, "audit-key", body)
+	makeRequest(h, "audit-key", body)
+	makeRequest(h, "audit-key", `{"amount": 7, "currency": "GHS"}`)
+	makeRequest(h, "", body)
+
+	want := []struct {
+		outcome Outcome
+		status  int
+	}{
+		{OutcomeNew, http.StatusCreated},
+		{OutcomeReplay, http.StatusCreated},
+		{OutcomeConflict, http.StatusConflict},
+		{OutcomeMissingKey, http.StatusBadRequest},
+	}
+
+	if len(sink.records) != len(want) {
+		t.Fatalf("expected %d audit records, got %d", len(want), len(sink.records))
+	}
+	for i, w := range want {
+		rec := sink.records[i]
+		if rec.Outcome != string(w.outcome) || rec.Status != w.status {
+			t.Errorf("record %d: expected %s/%d, got %s/%d", i, w.outcome, w.status, rec.Outcome, rec.Status)
+		}
+	}
+
+	first := sink.records[0]
+	if first.KeyHash != hashKey("audit-key") {
+		t.Errorf("expected key hash, got %q", first.KeyHash)
+	}
+	if first.BodyFingerprint != fingerprint(http.MethodPost, "/process-payment", []byte(body)) {
+		t.Errorf("expected body fingerprint, got %q", first.BodyFingerprint)
+	}
+	if sink.records[1].BodyFingerprint != first.BodyFingerprint {
+		t.Error("replay should carry the same body fingerprint as the original")
+	}
+}
+
+func TestScope_SameKeyDifferentScopesAreIndependent(t *testing.T) {
+	// Two callers picking the same Idempotency-Key must not see
+	// each other's cached responses.
+	memStore := store.NewMemoryStore(24 * time.Hour)
+	handler := handlers.NewPaymentHandler(&config.Config{})
+	h := Idempotency(memStore, http.HandlerFunc(handler.ProcessPayment), WithScope(func(r *http.Request) string {
+		return r.Header.Get("X-Tenant")
+	}))
+
+	send := func(tenant, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/process-payment", strings.NewReader(body))
+		req.Header.Set("Idempotency-Key", "shared-key")
+		req.Header.Set("X-Tenant", tenant)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		return w
+	}
+
+	a := send("tenant-a", `{"amount": 100, "currency": "GHS"}`)
+	b := send("tenant-b", `{"amount": 200, "currency": "GHS"}`)
+
+	if a.Code != http.StatusCreated || b.Code != http.StatusCreated {
+		t.Errorf("expected both tenants to get 201, got %d and %d", a.Code, b.Code)
+	}
+	if b.Header().Get("X-Cache-Hit") == "true" {
+		t.Error("tenant-b was replayed tenant-a's response")
+	}
+	if memStore.Get("tenant-a:shared-key") == nil || memStore.Get("tenant-b:shared-key") == nil {
+		t.Error("expected entries stored under scoped keys")
+	}
+}
+
+func TestScopedKey_EscapesSeparator(t *testing.T) {
+	if scopedKey("a:b", "c") == scopedKey("a", "b:c") {
+		t.Error("scope containing ':' collided with a different scope/key pair")
+	}
+	if scopedKey("", "plain") != "plain" {
+		t.Error("empty scope should leave the key untouched")
+	}
+}
+
+func TestReplay_IncludesHandlerHeaders(t *testing.T) {
+	// A replay has to point at the same payment as the original,
+	// so the Location header is cached along with the body.
+	s := store.NewMemoryStore(time.Hour)
+	h := Idempotency(s, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Location", "/payments/pay_1")
+		w.WriteHeader(http.StatusCreated)
+	}))
+
+	// Outer middleware sets its own per-request headers first.
+	withRequestID := func(id string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Request-ID", id)
+			h.ServeHTTP(w, r)
+		})
+	}
+
+	makeRequest(withRequestID("req-1"), "key-headers", `{"amount": 100, "currency": "GHS"}`)
+	w := makeRequest(withRequestID("req-2"), "key-headers", `{"amount": 100, "currency": "GHS"}`)
+
+	if got := w.Header().Get("Location"); got != "/payments/pay_1" {
+		t.Errorf("expected the cached Location header, got %q", got)
+	}
+	if got := w.Header().Get("X-Request-ID"); got != "req-2" {
+		t.Errorf("the replay must keep its own request ID, got %q", got)
+	}
+	if _, cached := s.Get("key-headers").Headers["X-Request-Id"]; cached {
+		t.Error("headers set outside the handler shouldn't be cached")
+	}
+}
+
+func TestRetryServerErrors_RerunsCached5xx(t *testing.T) {
+	s := store.NewMemoryStore(time.Hour)
+	var calls int
+	flaky := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	})
+
+	plain := Idempotency(s, flaky)
+	retrying := Idempotency(s, flaky, WithRetryServerErrors())
+
+	makeRequest(retrying, "retry-001", `{}`)
+	if w := makeRequest(plain, "retry-001", `{}`); w.Code != http.StatusBadGateway || calls != 1 {
+		t.Fatalf("expected the 502 replayed without the option, got %d after %d calls", w.Code, calls)
+	}
+
+	if w := makeRequest(retrying, "retry-001", `{}`); w.Code != http.StatusCreated || calls != 2 {
+		t.Fatalf("expected the 502 to be re-run, got %d after %d calls", w.Code, calls)
+	}
+
+	// A success is final, even with the option.
+	if w := makeRequest(retrying, "retry-001", `{}`); w.Code != http.StatusCreated || calls != 2 {
+		t.Errorf("expected the 201 replayed, got %d after %d calls", w.Code, calls)
+	}
+}
+
+func TestEncryptedStore_ReplaysDecryptedResponse(t *testing.T) {
+	cfg := &config.Config{KeyTTL: time.Hour}
+	memStore := store.NewMemoryStore(cfg.KeyTTL)
+	encrypted, err := store.NewEncryptedStore(memStore, []store.EncryptionKey{
+		{ID: "k1", Key: []byte(strings.Repeat("k", 32))},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := Idempotency(encrypted, http.HandlerFunc(handlers.NewPaymentHandler(cfg).ProcessPayment))
+
+	first := makeRequest(h, "key-enc-001", `{"amount": 100, "currency": "GHS"}`)
+	second := makeRequest(h, "key-enc-001", `{"amount": 100, "currency": "GHS"}`)
+
+	if second.Header().Get("X-Cache-Hit") != "true" || second.Body.String() != first.Body.String() {
+		t.Errorf("expected the first response replayed, got %s", second.Body.String())
+	}
+	if strings.Contains(string(memStore.Get("key-enc-001").ResponseBody), "GHS") {
+		t.Error("expected the stored body to be encrypted")
+	}
+}
@@ -0,0 +1,161 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/GordenArcher/Idempotency-Gateway/tracing"
+)
+
+// RequestIDHeader is read from incoming requests and echoed on every response
+// so a client (or the load balancer in front of us) can correlate its logs with ours.
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength stops a client from stuffing an arbitrarily large
+// value into every log line we write.
+const maxRequestIDLength = 128
+
+type requestLogKey struct{}
+
+// requestLog is what gets written out once a request finishes.
+// RequestLogger puts a pointer to it in the request context and the
+// idempotency middleware fills in its decision further down the chain.
+type requestLog struct {
+	requestID string
+	outcome   Outcome
+	keyHash   string
+	merchant  string // set by Authenticate or ClientCertIdentity
+	keyID     string
+}
+
+// RequestID returns the correlation ID for the request, or "" when the
+// request didn't come through RequestLogger.
+func RequestID(ctx context.Context) string {
+	if rl, ok := ctx.Value(requestLogKey{}).(*requestLog); ok {
+		return rl.requestID
+	}
+	return ""
+}
+
+// annotate records the idempotency decision on the request's log entry.
+// It's a no-op when there's no RequestLogger upstream, e.g. in tests.
+func annotate(r *http.Request, outcome Outcome, keyHash string) {
+	if rl, ok := r.Context().Value(requestLogKey{}).(*requestLog); ok {
+		rl.outcome = outcome
+		rl.keyHash = keyHash
+	}
+}
+
+// SubrequestContext is the context for a request the handler makes to
+// itself, like a batch item, that may run alongside others. The subrequest
+// gets its own copy of the request log, so its idempotency decision doesn't
+// land on the parent's log line or race with its siblings. Its spans are
+// still children of the parent's span, but the parent's span isn't the
+// active one any more, so they don't set attributes on it either.
+func SubrequestContext(ctx context.Context) context.Context {
+	if rl, ok := ctx.Value(requestLogKey{}).(*requestLog); ok {
+		own := &requestLog{requestID: rl.requestID, merchant: rl.merchant, keyID: rl.keyID}
+		ctx = context.WithValue(ctx, requestLogKey{}, own)
+	}
+	return tracing.ContextWithParent(ctx)
+}
+
+// statusWriter remembers the status code so it can be logged.
+// Unlike responseRecorder it doesn't buffer the body, we only need the code.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (sw *statusWriter) WriteHeader(code int) {
+	sw.status = code
+	sw.ResponseWriter.WriteHeader(code)
+}
+
+func (sw *statusWriter) Write(b []byte) (int, error) {
+	if sw.status == 0 {
+		sw.status = http.StatusOK
+	}
+	return sw.ResponseWriter.Write(b)
+}
+
+// RequestLogger writes one structured log record per request.
+// It takes X-Request-ID from the client when there is one, otherwise it
+// generates one, and puts it on the response either way.
+//
+// The idempotency key is only ever logged as a SHA-256 hash. Keys are
+// often derived from order IDs or customer data, the raw value has no
+// business sitting in a log pipeline.
+func RequestLogger(logger *slog.Logger, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		rl := &requestLog{requestID: requestIDFrom(r)}
+		w.Header().Set(RequestIDHeader, rl.requestID)
+		r = r.WithContext(context.WithValue(r.Context(), requestLogKey{}, rl))
+
+		sw := &statusWriter{ResponseWriter: w}
+		next.ServeHTTP(sw, r)
+
+		if sw.status == 0 {
+			sw.status = http.StatusOK
+		}
+
+		attrs := []slog.Attr{
+			slog.String("request_id", rl.requestID),
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", sw.status),
+			slog.Float64("latency_ms", float64(time.Since(start).Microseconds())/1000),
+		}
+		if rl.outcome != "" {
+			attrs = append(attrs, slog.String("idempotency_outcome", string(rl.outcome)))
+		}
+		if rl.keyHash != "" {
+			attrs = append(attrs, slog.String("idempotency_key_hash", rl.keyHash))
+		}
+		if rl.merchant != "" {
+			attrs = append(attrs, slog.String("merchant", rl.merchant))
+		}
+		if rl.keyID != "" {
+			attrs = append(attrs, slog.String("api_key_id", rl.keyID))
+		}
+
+		level := slog.LevelInfo
+		if sw.status >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+
+		logger.LogAttrs(r.Context(), level, "request", attrs...)
+	})
+}
+
+// requestIDFrom reuses the caller's X-Request-ID if it looks sane,
+// and generates a fresh random one otherwise.
+func requestIDFrom(r *http.Request) string {
+	if id := r.Header.Get(RequestIDHeader); validRequestID(id) {
+		return id
+	}
+
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// validRequestID only lets through printable ASCII without spaces,
+// anything else could break log parsing or be used for header injection.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,143 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GordenArcher/Idempotency-Gateway/store"
+)
+
+// loggedServer wires RequestLogger in front of the idempotency middleware
+// and captures the JSON log output in a buffer.
+func loggedServer() (*bytes.Buffer, http.Handler) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+
+	_, h := testServer(0)
+	return &buf, RequestLogger(logger, h)
+}
+
+// lastLogRecord decodes the most recent line written to buf.
+func lastLogRecord(t *testing.T, buf *bytes.Buffer) map[string]any {
+	t.Helper()
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+
+	var record map[string]any
+	if err := json.Unmarshal([]byte(lines[len(lines)-1]), &record); err != nil {
+		t.Fatalf("log line is not valid JSON: %v — %s", err, buf.String())
+	}
+	return record
+}
+
+func TestRequestLogger_GeneratesRequestID(t *testing.T) {
+	buf, h := loggedServer()
+
+	w := makeRequest(h, "log-key-001", `{"amount": 100, "currency": "GHS"}`)
+
+	id := w.Header().Get(RequestIDHeader)
+	if id == "" {
+		t.Fatal("expected a generated X-Request-ID on the response")
+	}
+	if got := lastLogRecord(t, buf)["request_id"]; got != id {
+		t.Errorf("expected log request_id %q, got %v", id, got)
+	}
+}
+
+func TestRequestLogger_PropagatesClientRequestID(t *testing.T) {
+	buf, h := loggedServer()
+
+	req := httptest.NewRequest(http.MethodPost, "/process-payment", strings.NewReader(`{"amount": 100, "currency": "GHS"}`))
+	req.Header.Set("Idempotency-Key", "log-key-002")
+	req.Header.Set(RequestIDHeader, "client-req-42")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+
+	if got := w.Header().Get(RequestIDHeader); got != "client-req-42" {
+		t.Errorf("expected client request ID echoed back, got %q", got)
+	}
+	if got := lastLogRecord(t, buf)["request_id"]; got != "client-req-42" {
+		t.Errorf("expected client request ID in log, got %v", got)
+	}
+}
+
+func TestRequestLogger_ReplacesInvalidRequestID(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set(RequestIDHeader, "has spaces\nand newlines")
+
+	if id := requestIDFrom(req); strings.ContainsAny(id, " \n") {
+		t.Errorf("expected a generated ID, got %q", id)
+	}
+}
+
+func TestRequestLogger_LogsIdempotencyOutcomes(t *testing.T) {
+	buf, h := loggedServer()
+	body := `{"amount": 100, "currency": "GHS"}`
+
+	cases := []struct {
+		key, body string
+		want      Outcome
+	}{
+		{"log-key-003", body, OutcomeNew},
+		{"log-key-003", body, OutcomeReplay},
+		{"log-key-003", `{"amount": 5, "currency": "GHS"}`, OutcomeConflict},
+		{"", body, OutcomeMissingKey},
+	}
+
+	for _, tc := range cases {
+		w := makeRequest(h, tc.key, tc.body)
+		record := lastLogRecord(t, buf)
+
+		if record["idempotency_outcome"] != string(tc.want) {
+			t.Errorf("expected outcome %s, got %v", tc.want, record["idempotency_outcome"])
+		}
+		if record["status"] != float64(w.Code) {
+			t.Errorf("expected logged status %d, got %v", w.Code, record["status"])
+		}
+	}
+}
+
+func TestRequestLogger_NeverLogsRawKey(t *testing.T) {
+	buf, h := loggedServer()
+
+	makeRequest(h, "customer-order-98765", `{"amount": 100, "currency": "GHS"}`)
+
+	if strings.Contains(buf.String(), "customer-order-98765") {
+		t.Errorf("raw idempotency key leaked into logs: %s", buf.String())
+	}
+	if got := lastLogRecord(t, buf)["idempotency_key_hash"]; got != hashKey("customer-order-98765") {
+		t.Errorf("expected key hash in log, got %v", got)
+	}
+}
+
+func TestRequestLogger_LogsWaitOutcome(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+
+	memStore := store.NewMemoryStore(time.Hour)
+	slow := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+		w.WriteHeader(http.StatusCreated)
+	})
+	h := RequestLogger(logger, Idempotency(memStore, slow))
+
+	done := make(chan struct{})
+	go func() {
+		makeRequest(h, "log-key-wait", `{}`)
+		close(done)
+	}()
+	time.Sleep(30 * time.Millisecond)
+	makeRequest(h, "log-key-wait", `{}`)
+	<-done
+
+	// Both requests finish at roughly the same moment, so don't rely on
+	// which line was written last.
+	if !strings.Contains(buf.String(), `"idempotency_outcome":"wait"`) {
+		t.Errorf("expected a wait outcome in the logs, got: %s", buf.String())
+	}
+}
@@ -0,0 +1,76 @@
+package middleware
+
+import (
+	"time"
+
+	"github.com/GordenArcher/Idempotency-Gateway/metrics"
+)
+
+// Outcome is what the idempotency middleware decided to do with a request.
+// It's the label on idempotency_requests_total.
+type Outcome string
+
+const (
+	OutcomeNew         Outcome = "new"          // first time we've seen the key, handler ran
+	OutcomeReplay      Outcome = "replay"       // key was COMPLETE, cached response replayed
+	OutcomeWait        Outcome = "wait"         // key was PROCESSING, waited for it, then replayed
+	OutcomeConflict    Outcome = "conflict"     // same key, different body, 409
+	OutcomeMissingKey  Outcome = "missing_key"  // no Idempotency-Key header, 400
+	OutcomeInvalidBody Outcome = "invalid_body" // body couldn't be read, never reached the store
+	OutcomeRetry       Outcome = "retry"        // key's cached response was a 5xx, ran it again (WithRetryServerErrors)
+	OutcomeRateLimited Outcome = "rate_limited" // would have run, but the client was out of tokens, 429
+	OutcomeAccepted    Outcome = "accepted"     // first time we've seen the key, queued to run async, 202
+	OutcomeAsyncQueued Outcome = "async_queued" // key's async job still running, same 202 sent back
+	OutcomeQueueFull   Outcome = "queue_full"   // wanted async but the job queue was full, 503
+)
+
+// Metrics are the counters and histograms the idempotency middleware feeds.
+// A nil *Metrics is valid and records nothing, so tests and callers that
+// don't care about metrics don't have to build a registry.
+type Metrics struct {
+	requests       *metrics.CounterVec
+	handlerLatency *metrics.Histogram
+	waitLatency    *metrics.Histogram
+}
+
+// NewMetrics registers the middleware's metrics on reg.
+func NewMetrics(reg *metrics.Registry) *Metrics {
+	return &Metrics{
+		requests: reg.NewCounterVec(
+			"idempotency_requests_total",
+			"Requests seen by the idempotency middleware, by outcome.",
+			"outcome",
+		),
+		handlerLatency: reg.NewHistogram(
+			"idempotency_handler_duration_seconds",
+			"Time spent in the wrapped handler for first-time requests.",
+			metrics.DefaultBuckets,
+		),
+		waitLatency: reg.NewHistogram(
+			"idempotency_wait_duration_seconds",
+			"Time duplicate requests spent waiting on a PROCESSING key.",
+			metrics.DefaultBuckets,
+		),
+	}
+}
+
+func (m *Metrics) countOutcome(o Outcome) {
+	if m == nil {
+		return
+	}
+	m.requests.Inc(string(o))
+}
+
+func (m *Metrics) observeHandler(d time.Duration) {
+	if m == nil {
+		return
+	}
+	m.handlerLatency.Observe(d.Seconds())
+}
+
+func (m *Metrics) observeWait(d time.Duration) {
+	if m == nil {
+		return
+	}
+	m.waitLatency.Observe(d.Seconds())
+}
@@ -0,0 +1,163 @@
+package middleware
+
+import (
+	"encoding/json"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RateLimiter is a token bucket per API client. It's plugged into the
+// idempotency middleware with WithRateLimit rather than wrapped around it,
+// because only the middleware knows whether a request is a genuinely new
+// execution. Replays and waits cost us nothing and never take a token.
+type RateLimiter struct {
+	rate   float64 // tokens added per second
+	burst  float64 // bucket size
+	client func(r *http.Request) string
+	now    func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastPrune time.Time
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// NewRateLimiter allows each client perMinute new executions a minute, with
+// up to burst at once. client picks the bucket a request belongs to, nil
+// uses ClientID.
+func NewRateLimiter(perMinute, burst int, client func(r *http.Request) string) *RateLimiter {
+	if client == nil {
+		client = ClientID
+	}
+	return &RateLimiter{
+		rate:    float64(perMinute) / 60,
+		burst:   float64(max(burst, 1)),
+		client:  client,
+		now:     time.Now,
+		buckets: make(map[string]*bucket),
+	}
+}
+
+// ClientID identifies an unauthenticated caller by the connection's IP.
+// Anything the client sends itself, like X-Client-ID, could be changed on
+// every request to get a fresh bucket each time.
+func ClientID(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// TrustedClientID identifies the caller by its X-Client-ID header, falling
+// back to ClientID without one. Only use it behind a proxy that sets the
+// header itself and drops whatever the client sent.
+func TrustedClientID(r *http.Request) string {
+	if id := r.Header.Get("X-Client-ID"); id != "" {
+		return id
+	}
+	return ClientID(r)
+}
+
+// WithRateLimit makes every new execution take a token from the client's
+// bucket first. Without one it gets a 429, and the key isn't stored, so the
+// same request is free to try again once Retry-After has passed.
+func WithRateLimit(l *RateLimiter) Option {
+	return func(o *options) {
+		o.limiter = l
+	}
+}
+
+// rateLimit is the state of one client's bucket after a request.
+type rateLimit struct {
+	allowed    bool
+	remaining  int
+	reset      time.Duration // until the bucket is full again
+	retryAfter time.Duration // until the next token, when not allowed
+}
+
+// take tries to take a token for client.
+func (l *RateLimiter) take(client string) rateLimit {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.prune(now)
+
+	b, ok := l.buckets[client]
+	if !ok {
+		b = &bucket{tokens: l.burst, updated: now}
+		l.buckets[client] = b
+	}
+	b.tokens = min(l.burst, b.tokens+now.Sub(b.updated).Seconds()*l.rate)
+	b.updated = now
+
+	result := rateLimit{}
+	if b.tokens >= 1 {
+		b.tokens--
+		result.allowed = true
+	} else {
+		result.retryAfter = l.wait(1 - b.tokens)
+	}
+	result.remaining = int(b.tokens)
+	result.reset = l.wait(l.burst - b.tokens)
+	return result
+}
+
+// wait is how long it takes to earn tokens.
+func (l *RateLimiter) wait(tokens float64) time.Duration {
+	if l.rate <= 0 {
+		return time.Duration(math.MaxInt64)
+	}
+	return time.Duration(tokens / l.rate * float64(time.Second))
+}
+
+// prune drops buckets that have refilled completely, they're no different
+// from a client we've never seen. It runs at most once a minute.
+// Must be called with l.mu held.
+func (l *RateLimiter) prune(now time.Time) {
+	if now.Sub(l.lastPrune) < time.Minute {
+		return
+	}
+	l.lastPrune = now
+	for client, b := range l.buckets {
+		if b.tokens+now.Sub(b.updated).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, client)
+		}
+	}
+}
+
+// admit takes a token for r's client and sets the RateLimit headers.
+// If there wasn't one it has already written the 429 and returns false.
+func (l *RateLimiter) admit(w http.ResponseWriter, r *http.Request) bool {
+	limit := l.take(l.client(r))
+
+	h := w.Header()
+	h.Set("RateLimit-Limit", strconv.Itoa(int(l.burst)))
+	h.Set("RateLimit-Remaining", strconv.Itoa(limit.remaining))
+	h.Set("RateLimit-Reset", strconv.Itoa(seconds(limit.reset)))
+	if limit.allowed {
+		return true
+	}
+
+	h.Set("Content-Type", "application/json")
+	h.Set("Retry-After", strconv.Itoa(max(seconds(limit.retryAfter), 1)))
+	w.WriteHeader(http.StatusTooManyRequests)
+	json.NewEncoder(w).Encode(map[string]string{
+		"error": "rate limit exceeded, retry after the time in Retry-After",
+	})
+	return false
+}
+
+// seconds rounds up to whole seconds, the unit the headers use.
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
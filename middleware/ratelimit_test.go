@@ -0,0 +1,182 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GordenArcher/Idempotency-Gateway/store"
+)
+
+// fakeClock lets tests move time forward instead of sleeping for refills.
+type fakeClock struct{ t time.Time }
+
+func (c *fakeClock) now() time.Time          { return c.t }
+func (c *fakeClock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func rateLimited(perMinute, burst int) (http.Handler, *fakeClock, *int) {
+	clock := &fakeClock{t: time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)}
+	limiter := NewRateLimiter(perMinute, burst, nil)
+	limiter.now = clock.now
+
+	runs := new(int)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*runs++
+		w.WriteHeader(http.StatusCreated)
+	})
+	return Idempotency(store.NewMemoryStore(time.Hour), handler, WithRateLimit(limiter)), clock, runs
+}
+
+func clientRequest(h http.Handler, client, key string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/process-payment", strings.NewReader(`{"amount": 1}`))
+	req.Header.Set("Idempotency-Key", key)
+	req.RemoteAddr = client + ":51234"
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	return w
+}
+
+func TestRateLimit_NewRequestsTakeTokens(t *testing.T) {
+	h, _, _ := rateLimited(60, 2)
+
+	first := clientRequest(h, "acme", "rl-1")
+	if first.Code != http.StatusCreated || first.Header().Get("RateLimit-Remaining") != "1" {
+		t.Errorf("expected 201 with 1 remaining, got %d with %q", first.Code, first.Header().Get("RateLimit-Remaining"))
+	}
+	clientRequest(h, "acme", "rl-2")
+
+	w := clientRequest(h, "acme", "rl-3")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429 once the burst is used, got %d", w.Code)
+	}
+	if w.Header().Get("Retry-After") != "1" {
+		t.Errorf("expected Retry-After 1 at one token a second, got %q", w.Header().Get("Retry-After"))
+	}
+	if w.Header().Get("RateLimit-Limit") != "2" || w.Header().Get("RateLimit-Remaining") != "0" {
+		t.Errorf("unexpected RateLimit headers: limit %q remaining %q",
+			w.Header().Get("RateLimit-Limit"), w.Header().Get("RateLimit-Remaining"))
+	}
+}
+
+func TestRateLimit_ReplaysAreFree(t *testing.T) {
+	h, _, runs := rateLimited(60, 1)
+
+	clientRequest(h, "acme", "rl-replay")
+	for i := 0; i < 5; i++ {
+		w := clientRequest(h, "acme", "rl-replay")
+		if w.Code != http.StatusCreated || w.Header().Get("X-Cache-Hit") != "true" {
+			t.Fatalf("replay %d: expected the cached 201, got %d", i+1, w.Code)
+		}
+		if w.Header().Get("RateLimit-Remaining") != "" {
+			t.Errorf("replay %d: expected no RateLimit headers, a replay doesn't touch the bucket", i+1)
+		}
+	}
+	if *runs != 1 {
+		t.Errorf("expected the handler to run once, ran %d times", *runs)
+	}
+}
+
+func TestRateLimit_RejectedKeyIsNotStored(t *testing.T) {
+	h, clock, runs := rateLimited(60, 1)
+
+	clientRequest(h, "acme", "rl-a")
+	if w := clientRequest(h, "acme", "rl-b"); w.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429, got %d", w.Code)
+	}
+
+	// After Retry-After the same key runs for real, it isn't a replay of the 429.
+	clock.advance(time.Second)
+	w := clientRequest(h, "acme", "rl-b")
+	if w.Code != http.StatusCreated || w.Header().Get("X-Cache-Hit") != "" {
+		t.Errorf("expected rl-b to run after the refill, got %d", w.Code)
+	}
+	if *runs != 2 {
+		t.Errorf("expected 2 runs, got %d", *runs)
+	}
+}
+
+func TestRateLimit_ClientsHaveSeparateBuckets(t *testing.T) {
+	h, _, _ := rateLimited(60, 1)
+
+	clientRequest(h, "acme", "rl-acme")
+	if w := clientRequest(h, "globex", "rl-globex"); w.Code != http.StatusCreated {
+		t.Errorf("expected another client unaffected, got %d", w.Code)
+	}
+}
+
+func TestRateLimit_RefillsOverTime(t *testing.T) {
+	h, clock, _ := rateLimited(60, 3)
+	for i := 0; i < 3; i++ {
+		clientRequest(h, "acme", "rl-fill-"+string(rune('a'+i)))
+	}
+
+	clock.advance(2 * time.Second)
+	w := clientRequest(h, "acme", "rl-fill-d")
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected a token after 2s, got %d", w.Code)
+	}
+	// Two earned, one spent, and 2s more to fill the bucket back to 3.
+	if w.Header().Get("RateLimit-Remaining") != "1" || w.Header().Get("RateLimit-Reset") != "2" {
+		t.Errorf("expected 1 remaining and reset in 2s, got %q and %q",
+			w.Header().Get("RateLimit-Remaining"), w.Header().Get("RateLimit-Reset"))
+	}
+}
+
+func TestRateLimit_PrunesFullBuckets(t *testing.T) {
+	l := NewRateLimiter(60, 1, nil)
+	clock := &fakeClock{t: time.Now()}
+	l.now = clock.now
+
+	l.take("acme")
+	clock.advance(2 * time.Minute)
+	l.take("globex")
+
+	if _, ok := l.buckets["acme"]; ok {
+		t.Error("expected acme's refilled bucket to be pruned")
+	}
+}
+
+func TestClientID(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "/", nil)
+	r.RemoteAddr = "203.0.113.7:51234"
+	if got := ClientID(r); got != "203.0.113.7" {
+		t.Errorf("expected the IP without a header, got %q", got)
+	}
+
+	// A client could send a new one with every request.
+	r.Header.Set("X-Client-ID", "acme")
+	if got := ClientID(r); got != "203.0.113.7" {
+		t.Errorf("expected X-Client-ID to be ignored, got %q", got)
+	}
+}
+
+func TestTrustedClientID(t *testing.T) {
+	r := httptest.NewRequest(http.MethodPost, "/", nil)
+	r.RemoteAddr = "203.0.113.7:51234"
+	if got := TrustedClientID(r); got != "203.0.113.7" {
+		t.Errorf("expected the IP without a header, got %q", got)
+	}
+
+	r.Header.Set("X-Client-ID", "acme")
+	if got := TrustedClientID(r); got != "acme" {
+		t.Errorf("expected the header, got %q", got)
+	}
+}
+
+func TestRateLimit_RotatingClientIDDoesNotGetNewTokens(t *testing.T) {
+	h, _, runs := rateLimited(60, 1)
+
+	for i := 0; i < 3; i++ {
+		req := httptest.NewRequest(http.MethodPost, "/process-payment", strings.NewReader(`{"amount": 1}`))
+		req.Header.Set("Idempotency-Key", fmt.Sprintf("rotate-%d", i))
+		req.Header.Set("X-Client-ID", fmt.Sprintf("client-%d", i))
+		h.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	if *runs != 1 {
+		t.Errorf("expected one run from the same address whatever X-Client-ID says, got %d", *runs)
+	}
+}
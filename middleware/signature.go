@@ -0,0 +1,69 @@
+package middleware
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/GordenArcher/Idempotency-Gateway/auth"
+	"github.com/GordenArcher/Idempotency-Gateway/signing"
+)
+
+// VerifySignature rejects requests from merchants that sign their calls
+// when the signature is missing, wrong, stale or a replay. Merchants without
+// a signing secret go straight through, as does everything when v is nil.
+//
+// It goes after Authenticate, which says who the merchant is, and before
+// Idempotency, so a request that fails here never stores its key. Both read
+// the body through ReadBody, so what's verified is byte for byte what gets
+// fingerprinted and handled.
+func VerifySignature(v *signing.Verifier, next http.Handler) http.Handler {
+	if v == nil {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		merchant := auth.Merchant(r.Context())
+		if !v.Requires(merchant) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		body, err := ReadBody(r)
+		if err != nil {
+			http.Error(w, `{"error": "failed to read request body"}`, http.StatusInternalServerError)
+			return
+		}
+
+		err = v.Verify(merchant, r.Header.Get(signing.HeaderTimestamp), r.Header.Get(signing.HeaderSignature), signing.Request{
+			Method:         r.Method,
+			Path:           r.URL.Path,
+			IdempotencyKey: r.Header.Get("Idempotency-Key"),
+			Body:           body,
+		})
+		if err != nil {
+			slog.Warn("rejected request signature",
+				"error", err, "merchant", merchant, "request_id", RequestID(r.Context()))
+			writeSignatureError(w, err)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func writeSignatureError(w http.ResponseWriter, err error) {
+	msg := "invalid request signature"
+	switch {
+	case errors.Is(err, signing.ErrMissingSignature):
+		msg = "missing request signature, send " + signing.HeaderSignature + " and " + signing.HeaderTimestamp
+	case errors.Is(err, signing.ErrStaleTimestamp):
+		msg = "request signature timestamp is too far from the current time"
+	case errors.Is(err, signing.ErrReplayed):
+		msg = "request signature has already been used, sign each attempt afresh"
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnauthorized)
+	json.NewEncoder(w).Encode(map[string]string{"error": msg})
+}
@@ -0,0 +1,144 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GordenArcher/Idempotency-Gateway/signing"
+	"github.com/GordenArcher/Idempotency-Gateway/store"
+)
+
+const acmeSigningSecret = "acme-signing-secret-0123456789abcdef"
+
+// signedServer is the chain main.go builds: who's calling, is it signed,
+// then idempotency. The handler echoes the body it was given.
+func signedServer(t *testing.T) (*store.MemoryStore, http.Handler) {
+	t.Helper()
+	verifier, err := signing.NewVerifier([]signing.Secret{
+		{ID: "acme-1", Merchant: "acme", Secret: acmeSigningSecret},
+	}, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	memStore := store.NewMemoryStore(time.Hour)
+	echo := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusCreated)
+		w.Write(body)
+	})
+	h := Authenticate(testKeyring(t), VerifySignature(verifier,
+		Idempotency(memStore, echo, WithScope(MerchantScope))))
+	return memStore, h
+}
+
+func signedRequest(apiKey, key, body string, at time.Time, sign func(signing.Request) string) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, "/process-payment", strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+	req.Header.Set("Idempotency-Key", key)
+	if sign != nil {
+		req.Header.Set(signing.HeaderTimestamp, strconv.FormatInt(at.Unix(), 10))
+		req.Header.Set(signing.HeaderSignature, sign(signing.Request{
+			Method: http.MethodPost, Path: "/process-payment", Timestamp: at, IdempotencyKey: key, Body: []byte(body),
+		}))
+	}
+	return req
+}
+
+func acmeSigns(r signing.Request) string { return signing.Sign(acmeSigningSecret, r) }
+
+func serve(h http.Handler, r *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestVerifySignature_SignedRequestReachesHandler(t *testing.T) {
+	_, h := signedServer(t)
+	body := `{"amount": 100, "currency": "GHS"}`
+
+	w := serve(h, signedRequest("sk_acme", "sig-1", body, time.Now(), acmeSigns))
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", w.Code, w.Body)
+	}
+	if w.Body.String() != body {
+		t.Errorf("expected the handler to get the verified body, got %q", w.Body.String())
+	}
+}
+
+func TestVerifySignature_Rejections(t *testing.T) {
+	body := `{"amount": 100, "currency": "GHS"}`
+	cases := map[string]*http.Request{
+		"unsigned": signedRequest("sk_acme", "sig-2", body, time.Now(), nil),
+		"stale":    signedRequest("sk_acme", "sig-2", body, time.Now().Add(-2*time.Minute), acmeSigns),
+		"future":   signedRequest("sk_acme", "sig-2", body, time.Now().Add(2*time.Minute), acmeSigns),
+		"wrong secret": signedRequest("sk_acme", "sig-2", body, time.Now(), func(r signing.Request) string {
+			return signing.Sign("not-acmes-secret-at-all-0123456789", r)
+		}),
+	}
+
+	// Signed for one body, sent with another.
+	tampered := signedRequest("sk_acme", "sig-2", body, time.Now(), acmeSigns)
+	tampered.Body = io.NopCloser(strings.NewReader(`{"amount": 999, "currency": "GHS"}`))
+	cases["tampered body"] = tampered
+
+	// Signed for one key, sent with another.
+	rekeyed := signedRequest("sk_acme", "sig-2", body, time.Now(), acmeSigns)
+	rekeyed.Header.Set("Idempotency-Key", "sig-3")
+	cases["tampered key"] = rekeyed
+
+	for name, req := range cases {
+		memStore, h := signedServer(t)
+		w := serve(h, req)
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("%s: expected 401, got %d", name, w.Code)
+		}
+		if memStore.Stats().Keys != 0 {
+			t.Errorf("%s: a rejected request stored its idempotency key", name)
+		}
+	}
+}
+
+func TestVerifySignature_ReplayedSignature(t *testing.T) {
+	_, h := signedServer(t)
+	body := `{"amount": 100, "currency": "GHS"}`
+	at := time.Now()
+
+	serve(h, signedRequest("sk_acme", "sig-4", body, at, acmeSigns))
+	w := serve(h, signedRequest("sk_acme", "sig-4", body, at, acmeSigns))
+	if w.Code != http.StatusUnauthorized || !strings.Contains(w.Body.String(), "already been used") {
+		t.Errorf("expected the replayed signature rejected, got %d: %s", w.Code, w.Body)
+	}
+
+	// Signed afresh, the retry gets the cached response like any other.
+	w = serve(h, signedRequest("sk_acme", "sig-4", body, at.Add(time.Second), acmeSigns))
+	if w.Code != http.StatusCreated || w.Header().Get("X-Cache-Hit") != "true" {
+		t.Errorf("expected the re-signed retry replayed, got %d", w.Code)
+	}
+}
+
+func TestVerifySignature_MerchantWithoutSecret(t *testing.T) {
+	_, h := signedServer(t)
+	w := serve(h, signedRequest("sk_globex", "sig-5", `{"amount": 1}`, time.Now(), nil))
+	if w.Code != http.StatusCreated {
+		t.Errorf("expected globex, which doesn't sign, to go through, got %d", w.Code)
+	}
+}
+
+func TestReadBody_SameBytesEveryTime(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("payload"))
+
+	first, _ := ReadBody(req)
+	io.ReadAll(req.Body) // a handler in between drains it
+	second, _ := ReadBody(req)
+	rest, _ := io.ReadAll(req.Body)
+
+	if string(first) != "payload" || string(second) != "payload" || string(rest) != "payload" {
+		t.Errorf("expected the same body every time, got %q, %q and %q", first, second, rest)
+	}
+}
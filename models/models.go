@@ -1,8 +1,28 @@
 package models
 
+import (
+	"net/http"
+	"time"
+
+	"github.com/GordenArcher/Idempotency-Gateway/money"
+)
+
 type PaymentRequest struct {
-	Amount   float64 `json:"amount"`
-	Currency string  `json:"currency"`
+	Amount   money.Decimal `json:"amount"`
+	Currency string        `json:"currency"`
+
+	// Optional, for the risk rules. Card is the processor's fingerprint or
+	// token for the card, never the card number.
+	CustomerID string `json:"customer_id,omitempty"`
+	Card       string `json:"card,omitempty"`
+	Country    string `json:"country,omitempty"`
+}
+
+// RefundRequest is the body of POST /payments/{id}/refunds.
+// A zero Amount means refund everything that's left.
+type RefundRequest struct {
+	Amount money.Decimal `json:"amount"`
+	Reason string        `json:"reason"`
 }
 
 type KeyState string
@@ -17,5 +37,104 @@ type CachedEntry struct {
 	BodyHash     string
 	StatusCode   int
 	ResponseBody []byte
-	CreatedAt    int64
+	// Headers the handler set on the response, e.g. Location,
+	// so a replay sends them back too.
+	Headers http.Header
+	// JobID is set while an async request is being processed in the
+	// background, so duplicates can be pointed at the same job.
+	JobID string
+	// KeyID is the encryption key ResponseBody was encrypted under,
+	// "" when it's plaintext. See store.EncryptedStore.
+	KeyID string
+	// Encoding is the codec ResponseBody was compressed with,
+	// "" when it isn't. See store.CompressedStore.
+	Encoding  string
+	CreatedAt int64
+}
+
+type PaymentStatus string
+
+// The payment state machine. payments.CanTransition knows which moves are legal.
+const (
+	PaymentAuthorized        PaymentStatus = "authorized"
+	PaymentCaptured          PaymentStatus = "captured"
+	PaymentVoided            PaymentStatus = "voided"
+	PaymentExpired           PaymentStatus = "expired"
+	PaymentPartiallyRefunded PaymentStatus = "partially_refunded"
+	PaymentRefunded          PaymentStatus = "refunded"
+	PaymentDenied            PaymentStatus = "denied" // stopped by the risk rules, never reached the processor
+)
+
+type RiskAction string
+
+// What the risk rules decided about a payment, from least to most severe.
+const (
+	RiskAllow  RiskAction = "allow"
+	RiskReview RiskAction = "review" // processed, but flagged for someone to look at
+	RiskDeny   RiskAction = "deny"
+)
+
+// RiskDecision is the risk engine's verdict on a payment and the rules
+// that led to it. Allowed payments usually have no rules listed.
+type RiskDecision struct {
+	Action  RiskAction
+	Rules   []string
+	Reasons []string
+}
+
+// CaptureRequest is the body of POST /payments/{id}/capture.
+// A zero Amount captures the full authorization.
+type CaptureRequest struct {
+	Amount money.Decimal `json:"amount"`
+}
+
+// Payment is the record kept for every payment the processor accepted.
+// Amount is what was authorized, Captured is how much of it was taken.
+type Payment struct {
+	ID              string
+	Merchant        string // who made it, "" with authentication off
+	Status          PaymentStatus
+	Amount          money.Money
+	Captured        int64
+	AuthorizationID string
+	CaptureID       string
+	VoidID          string
+
+	// ExpiresAt is when an uncaptured authorization lapses.
+	// Zero for one-shot payments, which are captured straight away.
+	ExpiresAt time.Time
+
+	// InFlight is the status a capture or void currently at the processor
+	// will move the payment to. While it's set, no other transition can
+	// start, so two different keys can't capture and void at once.
+	InFlight PaymentStatus
+
+	// Refunded is what has been refunded so far, in minor units.
+	// RefundPending is refunds currently in flight at the processor. It's
+	// reserved before the processor is called, so two concurrent refunds
+	// can't both see the same headroom.
+	Refunded      int64
+	RefundPending int64
+
+	// Risk is what the risk rules decided before the processor was called.
+	Risk RiskDecision
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// Refundable is how much can still be refunded, in minor units.
+func (p *Payment) Refundable() int64 {
+	return p.Captured - p.Refunded - p.RefundPending
+}
+
+// Refund is one refund against a payment.
+type Refund struct {
+	ID        string
+	PaymentID string
+	Amount    money.Money
+	// ProcessorID is the processor's own ID for the refund.
+	ProcessorID string
+	Reason      string
+	CreatedAt   time.Time
 }
@@ -0,0 +1,192 @@
+// Package money keeps amounts as integers. A float64 can't hold 0.1 exactly,
+// so anything that touches a charge goes through Decimal and Money instead.
+package money
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+var (
+	// ErrSyntax is a value that isn't a plain decimal like "100" or "100.50".
+	// Exponents, leading '+', spaces and NaN/Infinity are all rejected.
+	ErrSyntax = errors.New("invalid decimal amount")
+
+	// ErrPrecision is an amount with more decimal places than its currency has,
+	// like 100.005 GHS. I'd rather reject it than guess which way to round.
+	ErrPrecision = errors.New("amount has more decimal places than the currency allows")
+
+	// ErrRange is an amount that doesn't fit in int64 minor units.
+	ErrRange = errors.New("amount out of range")
+)
+
+// Decimal is an amount exactly as the client wrote it. It can't be turned
+// into minor units on its own because the exponent depends on the currency,
+// which is a sibling field, so the conversion happens in New.
+//
+// In JSON it accepts both a number (100.50) and a string ("100.50"), and
+// always encodes as a string so no client ever has to parse it as a float.
+type Decimal struct {
+	neg   bool
+	whole string // digits before the point, no leading zeros, "0" for zero
+	frac  string // digits after the point, as written
+}
+
+// ParseDecimal parses a plain decimal: optional '-', digits, optional '.' and digits.
+func ParseDecimal(s string) (Decimal, error) {
+	var d Decimal
+	rest := s
+	if strings.HasPrefix(rest, "-") {
+		d.neg = true
+		rest = rest[1:]
+	}
+
+	whole, frac, hasPoint := strings.Cut(rest, ".")
+	if whole == "" || !allDigits(whole) || (hasPoint && (frac == "" || !allDigits(frac))) {
+		return Decimal{}, fmt.Errorf("%w: %q", ErrSyntax, s)
+	}
+
+	d.whole = strings.TrimLeft(whole, "0")
+	if d.whole == "" {
+		d.whole = "0"
+	}
+	d.frac = frac
+	return d, nil
+}
+
+func allDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// IsZero reports whether d is the zero value, i.e. was never set.
+func (d Decimal) IsZero() bool {
+	return d.whole == ""
+}
+
+// String returns the decimal as written, minus any leading zeros.
+func (d Decimal) String() string {
+	if d.IsZero() {
+		return ""
+	}
+	s := d.whole
+	if d.frac != "" {
+		s += "." + d.frac
+	}
+	if d.neg {
+		s = "-" + s
+	}
+	return s
+}
+
+// Minor converts d to an integer count of minor units for a currency with
+// the given exponent. Trailing zeros past the exponent are fine ("1.500" is
+// 150 cents), anything else there is ErrPrecision.
+func (d Decimal) Minor(exponent int) (int64, error) {
+	if d.IsZero() {
+		return 0, fmt.Errorf("%w: empty", ErrSyntax)
+	}
+
+	frac := d.frac
+	if len(frac) > exponent {
+		if strings.TrimRight(frac[exponent:], "0") != "" {
+			return 0, fmt.Errorf("%w: %s has %d, at most %d", ErrPrecision, d, len(strings.TrimRight(frac, "0")), exponent)
+		}
+		frac = frac[:exponent]
+	}
+	frac += strings.Repeat("0", exponent-len(frac))
+
+	var minor int64
+	for _, c := range d.whole + frac {
+		digit := int64(c - '0')
+		if minor > (math.MaxInt64-digit)/10 {
+			return 0, fmt.Errorf("%w: %s", ErrRange, d)
+		}
+		minor = minor*10 + digit
+	}
+	if d.neg {
+		minor = -minor
+	}
+	return minor, nil
+}
+
+// MarshalJSON encodes d as a JSON string.
+func (d Decimal) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// UnmarshalJSON accepts a JSON number or a JSON string holding one.
+// The number is taken from the raw token, it never goes through a float64.
+func (d *Decimal) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if bytes.Equal(data, []byte("null")) {
+		*d = Decimal{}
+		return nil
+	}
+
+	s := string(data)
+	if len(data) > 0 && data[0] == '"' {
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+	}
+
+	parsed, err := ParseDecimal(s)
+	if err != nil {
+		return err
+	}
+	*d = parsed
+	return nil
+}
+
+// Money is an amount in integer minor units of a currency. Exponent is
+// carried along so it can be formatted without going back to the registry.
+type Money struct {
+	Minor    int64
+	Currency string
+	Exponent int
+}
+
+// New converts a client-supplied decimal into Money. Which exponent a
+// currency has is the currency registry's call, not this package's.
+func New(d Decimal, currency string, exponent int) (Money, error) {
+	minor, err := d.Minor(exponent)
+	if err != nil {
+		return Money{}, err
+	}
+	return Money{Minor: minor, Currency: currency, Exponent: exponent}, nil
+}
+
+// WithMinor returns a different amount in the same currency as m.
+func (m Money) WithMinor(minor int64) Money {
+	m.Minor = minor
+	return m
+}
+
+// Decimal formats m back into a decimal with exactly as many places as
+// its currency has, so 10050 GHS comes out as "100.50".
+func (m Money) Decimal() Decimal {
+	exponent := m.Exponent
+
+	// Work on the magnitude as a uint64 so MinInt64 doesn't overflow.
+	magnitude := uint64(m.Minor)
+	if m.Minor < 0 {
+		magnitude = -magnitude
+	}
+	digits := fmt.Sprintf("%0*d", exponent+1, magnitude)
+
+	return Decimal{neg: m.Minor < 0, whole: digits[:len(digits)-exponent], frac: digits[len(digits)-exponent:]}
+}
+
+// String formats m for humans, e.g. "100.50 GHS".
+func (m Money) String() string {
+	return m.Decimal().String() + " " + m.Currency
+}
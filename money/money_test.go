@@ -0,0 +1,120 @@
+package money
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestDecimal_UnmarshalJSON(t *testing.T) {
+	cases := []struct {
+		in   string
+		want string
+	}{
+		{`100`, "100"},
+		{`100.50`, "100.50"},
+		{`"100.50"`, "100.50"},
+		{`0.1`, "0.1"},
+		{`"007.5"`, "7.5"},
+		{`-3`, "-3"},
+	}
+
+	for _, tc := range cases {
+		var d Decimal
+		if err := json.Unmarshal([]byte(tc.in), &d); err != nil {
+			t.Errorf("%s: unexpected error %v", tc.in, err)
+			continue
+		}
+		if d.String() != tc.want {
+			t.Errorf("%s: expected %q, got %q", tc.in, tc.want, d.String())
+		}
+	}
+}
+
+func TestDecimal_UnmarshalJSON_RejectsNonDecimals(t *testing.T) {
+	for _, in := range []string{`1e2`, `"1e2"`, `"+1"`, `" 1"`, `"1."`, `".5"`, `""`, `"NaN"`, `true`, `{}`} {
+		var d Decimal
+		if err := json.Unmarshal([]byte(in), &d); err == nil {
+			t.Errorf("%s: expected an error, got %q", in, d)
+		}
+	}
+}
+
+func TestDecimal_Minor(t *testing.T) {
+	cases := []struct {
+		in       string
+		exponent int
+		want     int64
+	}{
+		{"100", 2, 10000},
+		{"100.5", 2, 10050},
+		{"100.50", 2, 10050},
+		{"100.500", 2, 10050}, // trailing zeros aren't extra precision
+		{"0.01", 2, 1},
+		{"1500", 0, 1500},
+		{"-2.25", 2, -225},
+	}
+
+	for _, tc := range cases {
+		d, err := ParseDecimal(tc.in)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.in, err)
+		}
+		got, err := d.Minor(tc.exponent)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", tc.in, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("%s at exponent %d: expected %d, got %d", tc.in, tc.exponent, tc.want, got)
+		}
+	}
+}
+
+func TestDecimal_Minor_RejectsExcessPrecision(t *testing.T) {
+	d, _ := ParseDecimal("100.005")
+	if _, err := d.Minor(2); !errors.Is(err, ErrPrecision) {
+		t.Errorf("expected ErrPrecision, got %v", err)
+	}
+
+	d, _ = ParseDecimal("1.5")
+	if _, err := d.Minor(0); !errors.Is(err, ErrPrecision) {
+		t.Errorf("expected ErrPrecision for a zero-exponent currency, got %v", err)
+	}
+}
+
+func TestDecimal_Minor_Overflow(t *testing.T) {
+	d, _ := ParseDecimal("92233720368547758.08") // MaxInt64 + 1 in cents
+	if _, err := d.Minor(2); !errors.Is(err, ErrRange) {
+		t.Errorf("expected ErrRange, got %v", err)
+	}
+
+	d, _ = ParseDecimal("92233720368547758.07")
+	if got, err := d.Minor(2); err != nil || got != math.MaxInt64 {
+		t.Errorf("expected MaxInt64, got %d, %v", got, err)
+	}
+}
+
+func TestMoney_Format(t *testing.T) {
+	cases := []struct {
+		m    Money
+		want string
+	}{
+		{Money{Minor: 10050, Currency: "GHS", Exponent: 2}, "100.50 GHS"},
+		{Money{Minor: 5, Currency: "GHS", Exponent: 2}, "0.05 GHS"},
+		{Money{Minor: 1500, Currency: "XOF", Exponent: 0}, "1500 XOF"},
+		{Money{Minor: -225, Currency: "USD", Exponent: 2}, "-2.25 USD"},
+	}
+
+	for _, tc := range cases {
+		if got := tc.m.String(); got != tc.want {
+			t.Errorf("expected %q, got %q", tc.want, got)
+		}
+	}
+
+	b, _ := json.Marshal(Money{Minor: 10050, Currency: "GHS", Exponent: 2}.Decimal())
+	if string(b) != `"100.50"` {
+		t.Errorf("expected the decimal to marshal as a string, got %s", b)
+	}
+}
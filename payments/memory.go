@@ -0,0 +1,96 @@
+package payments
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/GordenArcher/Idempotency-Gateway/models"
+)
+
+// MemoryRepository keeps payments in a map. Like the key store, it's
+// lost on restart.
+type MemoryRepository struct {
+	mu       sync.RWMutex
+	payments map[string]*models.Payment
+	refunds  map[string]*models.Refund
+}
+
+func NewMemoryRepository() *MemoryRepository {
+	return &MemoryRepository{
+		payments: make(map[string]*models.Payment),
+		refunds:  make(map[string]*models.Refund),
+	}
+}
+
+// Create stores a copy of p, so the caller changing p afterwards
+// doesn't change the record.
+func (r *MemoryRepository) Create(p *models.Payment) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.payments[p.ID]; exists {
+		return fmt.Errorf("%w: %s", ErrExists, p.ID)
+	}
+	stored := *p
+	r.payments[p.ID] = &stored
+	return nil
+}
+
+// Get returns a copy of the payment, for the same reason.
+func (r *MemoryRepository) Get(id string) (*models.Payment, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	p, ok := r.payments[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	found := *p
+	return &found, nil
+}
+
+// Update holds the write lock for the whole of fn, so fn must be quick and
+// must not call back into the repository. fn works on a copy, which only
+// replaces the stored payment if fn succeeds.
+func (r *MemoryRepository) Update(id string, fn func(p *models.Payment) error) (*models.Payment, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	p, ok := r.payments[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+
+	updated := *p
+	if err := fn(&updated); err != nil {
+		return nil, err
+	}
+	r.payments[id] = &updated
+
+	saved := updated
+	return &saved, nil
+}
+
+func (r *MemoryRepository) CreateRefund(refund *models.Refund) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.refunds[refund.ID]; exists {
+		return fmt.Errorf("%w: %s", ErrExists, refund.ID)
+	}
+	stored := *refund
+	r.refunds[refund.ID] = &stored
+	return nil
+}
+
+func (r *MemoryRepository) GetRefund(id string) (*models.Refund, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	refund, ok := r.refunds[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrRefundNotFound, id)
+	}
+	found := *refund
+	return &found, nil
+}
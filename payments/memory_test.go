@@ -0,0 +1,169 @@
+package payments
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/GordenArcher/Idempotency-Gateway/models"
+	"github.com/GordenArcher/Idempotency-Gateway/money"
+)
+
+func makePayment(id string) *models.Payment {
+	return &models.Payment{
+		ID:        id,
+		Status:    models.PaymentCaptured,
+		Amount:    money.Money{Minor: 10050, Currency: "GHS", Exponent: 2},
+		CreatedAt: time.Now(),
+	}
+}
+
+func TestCreate_ThenGet(t *testing.T) {
+	r := NewMemoryRepository()
+	if err := r.Create(makePayment("pay_1")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	got, err := r.Get("pay_1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.Amount.Minor != 10050 || got.Status != models.PaymentCaptured {
+		t.Errorf("unexpected payment %+v", got)
+	}
+}
+
+func TestGet_Unknown_ReturnsErrNotFound(t *testing.T) {
+	r := NewMemoryRepository()
+	if _, err := r.Get("pay_nope"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestCreate_DuplicateID_ReturnsErrExists(t *testing.T) {
+	r := NewMemoryRepository()
+	r.Create(makePayment("pay_1"))
+	if err := r.Create(makePayment("pay_1")); !errors.Is(err, ErrExists) {
+		t.Errorf("expected ErrExists, got %v", err)
+	}
+}
+
+func TestRecordsAreCopies(t *testing.T) {
+	// Changing a payment after Create or Get mustn't reach into the repository.
+	r := NewMemoryRepository()
+	p := makePayment("pay_1")
+	r.Create(p)
+	p.Status = "tampered"
+
+	got, _ := r.Get("pay_1")
+	got.Amount.Minor = 1
+
+	again, _ := r.Get("pay_1")
+	if again.Status != models.PaymentCaptured || again.Amount.Minor != 10050 {
+		t.Errorf("stored payment was modified from outside: %+v", again)
+	}
+}
+
+func TestNewID_Unique(t *testing.T) {
+	seen := map[string]bool{}
+	for i := 0; i < 1000; i++ {
+		id := NewID()
+		if !strings.HasPrefix(id, "pay_") || len(id) != len("pay_")+32 {
+			t.Fatalf("unexpected ID format %q", id)
+		}
+		if seen[id] {
+			t.Fatalf("duplicate ID %q", id)
+		}
+		seen[id] = true
+	}
+}
+
+func TestUpdate_AppliesAndSaves(t *testing.T) {
+	r := NewMemoryRepository()
+	r.Create(makePayment("pay_1"))
+
+	saved, err := r.Update("pay_1", func(p *models.Payment) error {
+		p.Refunded = 50
+		return nil
+	})
+	if err != nil || saved.Refunded != 50 {
+		t.Fatalf("unexpected result %+v, %v", saved, err)
+	}
+
+	got, _ := r.Get("pay_1")
+	if got.Refunded != 50 {
+		t.Errorf("update wasn't saved, got %+v", got)
+	}
+}
+
+func TestUpdate_ErrorDiscardsChanges(t *testing.T) {
+	r := NewMemoryRepository()
+	r.Create(makePayment("pay_1"))
+
+	boom := errors.New("boom")
+	_, err := r.Update("pay_1", func(p *models.Payment) error {
+		p.Refunded = 50
+		return boom
+	})
+	if !errors.Is(err, boom) {
+		t.Fatalf("expected fn's error back, got %v", err)
+	}
+
+	got, _ := r.Get("pay_1")
+	if got.Refunded != 0 {
+		t.Errorf("a failed update must not be saved, got %+v", got)
+	}
+}
+
+func TestUpdate_Unknown_ReturnsErrNotFound(t *testing.T) {
+	r := NewMemoryRepository()
+	_, err := r.Update("pay_nope", func(p *models.Payment) error { return nil })
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestUpdate_IsAtomic(t *testing.T) {
+	// Read-modify-write from many goroutines must not lose any increments.
+	r := NewMemoryRepository()
+	r.Create(makePayment("pay_1"))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.Update("pay_1", func(p *models.Payment) error {
+				p.Refunded++
+				return nil
+			})
+		}()
+	}
+	wg.Wait()
+
+	got, _ := r.Get("pay_1")
+	if got.Refunded != 100 {
+		t.Errorf("expected 100, got %d", got.Refunded)
+	}
+}
+
+func TestRefunds_CreateThenGet(t *testing.T) {
+	r := NewMemoryRepository()
+	refund := &models.Refund{ID: "re_1", PaymentID: "pay_1", Amount: money.Money{Minor: 500, Currency: "GHS", Exponent: 2}}
+	if err := r.CreateRefund(refund); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := r.CreateRefund(refund); !errors.Is(err, ErrExists) {
+		t.Errorf("expected ErrExists, got %v", err)
+	}
+
+	got, err := r.GetRefund("re_1")
+	if err != nil || got.PaymentID != "pay_1" || got.Amount.Minor != 500 {
+		t.Errorf("unexpected refund %+v, %v", got, err)
+	}
+	if _, err := r.GetRefund("re_nope"); !errors.Is(err, ErrRefundNotFound) {
+		t.Errorf("expected ErrRefundNotFound, got %v", err)
+	}
+}
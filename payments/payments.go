@@ -0,0 +1,56 @@
+// Package payments keeps a record of every payment the gateway has made,
+// so a client can look one up by ID long after the idempotency key
+// that created it has expired.
+package payments
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+
+	"github.com/GordenArcher/Idempotency-Gateway/models"
+)
+
+// ErrNotFound is returned by Get for an ID that was never created.
+var ErrNotFound = errors.New("payment not found")
+
+// ErrRefundNotFound is ErrNotFound for refunds.
+var ErrRefundNotFound = errors.New("refund not found")
+
+// ErrExists is returned by Create when the ID is already taken.
+var ErrExists = errors.New("payment already exists")
+
+// Repository stores payments. Like the store, it's an interface so the
+// in-memory version can be swapped for a database without touching handlers.
+type Repository interface {
+	Create(p *models.Payment) error
+	Get(id string) (*models.Payment, error)
+
+	// Update runs fn on the payment and saves the result, atomically with
+	// respect to every other Update of the same payment. If fn returns an
+	// error nothing is saved. It returns the payment as saved.
+	// Anything that reads a payment to decide how to change it (like
+	// checking refund headroom) has to go through here.
+	Update(id string, fn func(p *models.Payment) error) (*models.Payment, error)
+
+	CreateRefund(r *models.Refund) error
+	GetRefund(id string) (*models.Refund, error)
+}
+
+// NewID returns a fresh payment ID like "pay_3f9c...". 128 random bits,
+// so there's no counter to coordinate between instances.
+func NewID() string {
+	return newID("pay_")
+}
+
+// NewRefundID returns a fresh refund ID like "re_3f9c...".
+func NewRefundID() string {
+	return newID("re_")
+}
+
+func newID(prefix string) string {
+	b := make([]byte, 16)
+	// crypto/rand.Read never returns an error on supported platforms.
+	rand.Read(b)
+	return prefix + hex.EncodeToString(b)
+}
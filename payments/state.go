@@ -0,0 +1,122 @@
+package payments
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/GordenArcher/Idempotency-Gateway/models"
+)
+
+var (
+	// ErrIllegalTransition is a move the state machine doesn't allow,
+	// like capturing a voided payment.
+	ErrIllegalTransition = errors.New("illegal payment state transition")
+
+	// ErrInFlight means another capture or void is at the processor right now.
+	ErrInFlight = errors.New("another operation on this payment is in progress")
+)
+
+// transitions lists where each status can go next. Anything missing is
+// terminal: voided, expired, denied and refunded payments are done.
+var transitions = map[models.PaymentStatus][]models.PaymentStatus{
+	models.PaymentAuthorized:        {models.PaymentCaptured, models.PaymentVoided, models.PaymentExpired},
+	models.PaymentCaptured:          {models.PaymentPartiallyRefunded, models.PaymentRefunded},
+	models.PaymentPartiallyRefunded: {models.PaymentPartiallyRefunded, models.PaymentRefunded},
+}
+
+// verbs names the action behind each target status, for error messages.
+var verbs = map[models.PaymentStatus]string{
+	models.PaymentCaptured:          "capture",
+	models.PaymentVoided:            "void",
+	models.PaymentExpired:           "expire",
+	models.PaymentPartiallyRefunded: "refund",
+	models.PaymentRefunded:          "refund",
+}
+
+// CanTransition reports whether a payment in status from may move to to.
+func CanTransition(from, to models.PaymentStatus) bool {
+	for _, next := range transitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Expire moves an authorization that's past ExpiresAt to expired and
+// reports whether it did. One with a capture or void in flight is left
+// alone, the processor call that's already running decides its fate.
+func Expire(p *models.Payment, now time.Time) bool {
+	if p.Status != models.PaymentAuthorized || p.InFlight != "" || p.ExpiresAt.IsZero() || now.Before(p.ExpiresAt) {
+		return false
+	}
+	p.Status = models.PaymentExpired
+	p.UpdatedAt = now.UTC()
+	return true
+}
+
+// Begin checks p can move to to and marks the move as in flight.
+// Call it inside Repository.Update before going to the processor, then
+// Complete or Abort in a second Update once the processor has answered.
+func Begin(p *models.Payment, to models.PaymentStatus, now time.Time) error {
+	Expire(p, now)
+
+	if p.InFlight != "" {
+		return fmt.Errorf("%w: a %s is already being processed", ErrInFlight, verbs[p.InFlight])
+	}
+	if !CanTransition(p.Status, to) {
+		return fmt.Errorf("%w: cannot %s a payment that is %s", ErrIllegalTransition, verbs[to], p.Status)
+	}
+	p.InFlight = to
+	return nil
+}
+
+// Complete moves p to the status Begin marked as in flight.
+func Complete(p *models.Payment, now time.Time) {
+	if p.InFlight == "" {
+		return
+	}
+	p.Status = p.InFlight
+	p.InFlight = ""
+	p.UpdatedAt = now.UTC()
+}
+
+// Abort drops the in-flight move, leaving p where it was.
+func Abort(p *models.Payment) {
+	p.InFlight = ""
+}
+
+// Refunds don't go through Begin: several can be at the processor at once,
+// each holding its share in RefundPending, so they're checked against the
+// transitions on the way in and out instead.
+
+// CheckRefund reports whether p may be refunded amount more, on top of the
+// refunds already in flight.
+func CheckRefund(p *models.Payment, amount int64) error {
+	if to := refundTarget(p, p.Refunded+p.RefundPending+amount); !CanTransition(p.Status, to) {
+		return fmt.Errorf("%w: cannot %s a payment that is %s", ErrIllegalTransition, verbs[to], p.Status)
+	}
+	return nil
+}
+
+// CompleteRefund records amount as refunded and moves p to partially
+// refunded, or refunded once everything captured has been given back.
+func CompleteRefund(p *models.Payment, amount int64, now time.Time) error {
+	to := refundTarget(p, p.Refunded+amount)
+	if !CanTransition(p.Status, to) {
+		return fmt.Errorf("%w: cannot %s a payment that is %s", ErrIllegalTransition, verbs[to], p.Status)
+	}
+	p.Refunded += amount
+	p.Status = to
+	p.UpdatedAt = now.UTC()
+	return nil
+}
+
+// refundTarget is where a payment goes once refunded in total.
+func refundTarget(p *models.Payment, refunded int64) models.PaymentStatus {
+	if refunded >= p.Captured {
+		return models.PaymentRefunded
+	}
+	return models.PaymentPartiallyRefunded
+}
@@ -0,0 +1,138 @@
+package payments
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GordenArcher/Idempotency-Gateway/models"
+)
+
+func TestCanTransition(t *testing.T) {
+	cases := []struct {
+		from, to models.PaymentStatus
+		want     bool
+	}{
+		{models.PaymentAuthorized, models.PaymentCaptured, true},
+		{models.PaymentAuthorized, models.PaymentVoided, true},
+		{models.PaymentAuthorized, models.PaymentExpired, true},
+		{models.PaymentCaptured, models.PaymentRefunded, true},
+		{models.PaymentPartiallyRefunded, models.PaymentRefunded, true},
+		{models.PaymentCaptured, models.PaymentVoided, false},
+		{models.PaymentCaptured, models.PaymentCaptured, false},
+		{models.PaymentVoided, models.PaymentCaptured, false},
+		{models.PaymentExpired, models.PaymentCaptured, false},
+		{models.PaymentRefunded, models.PaymentPartiallyRefunded, false},
+	}
+
+	for _, tc := range cases {
+		if got := CanTransition(tc.from, tc.to); got != tc.want {
+			t.Errorf("%s -> %s: expected %v, got %v", tc.from, tc.to, tc.want, got)
+		}
+	}
+}
+
+func TestBegin_ThenComplete(t *testing.T) {
+	p := &models.Payment{Status: models.PaymentAuthorized}
+	now := time.Now()
+
+	if err := Begin(p, models.PaymentCaptured, now); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if p.Status != models.PaymentAuthorized || p.InFlight != models.PaymentCaptured {
+		t.Errorf("Begin shouldn't change the status yet, got %+v", p)
+	}
+
+	// Anything else has to wait for the capture to finish.
+	if err := Begin(p, models.PaymentVoided, now); !errors.Is(err, ErrInFlight) {
+		t.Errorf("expected ErrInFlight, got %v", err)
+	}
+
+	Complete(p, now)
+	if p.Status != models.PaymentCaptured || p.InFlight != "" {
+		t.Errorf("expected captured with nothing in flight, got %+v", p)
+	}
+}
+
+func TestBegin_ThenAbort(t *testing.T) {
+	p := &models.Payment{Status: models.PaymentAuthorized}
+	Begin(p, models.PaymentCaptured, time.Now())
+	Abort(p)
+
+	if p.Status != models.PaymentAuthorized || p.InFlight != "" {
+		t.Errorf("expected the payment back where it was, got %+v", p)
+	}
+	if err := Begin(p, models.PaymentVoided, time.Now()); err != nil {
+		t.Errorf("expected a new transition to be allowed after Abort, got %v", err)
+	}
+}
+
+func TestBegin_IllegalTransition(t *testing.T) {
+	p := &models.Payment{Status: models.PaymentVoided}
+
+	err := Begin(p, models.PaymentCaptured, time.Now())
+	if !errors.Is(err, ErrIllegalTransition) {
+		t.Fatalf("expected ErrIllegalTransition, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "cannot capture a payment that is voided") {
+		t.Errorf("unexpected message %q", err)
+	}
+}
+
+func TestRefund_FollowsTheTransitions(t *testing.T) {
+	now := time.Now()
+	p := &models.Payment{Status: models.PaymentAuthorized}
+	if err := CheckRefund(p, 0); !errors.Is(err, ErrIllegalTransition) {
+		t.Errorf("expected an uncaptured payment not to be refundable, got %v", err)
+	}
+
+	p = &models.Payment{Status: models.PaymentCaptured, Captured: 100}
+	if err := CheckRefund(p, 30); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := CompleteRefund(p, 30, now); err != nil || p.Status != models.PaymentPartiallyRefunded {
+		t.Fatalf("expected partially refunded, got %s, %v", p.Status, err)
+	}
+	if err := CompleteRefund(p, 70, now); err != nil || p.Status != models.PaymentRefunded || p.Refunded != 100 {
+		t.Fatalf("expected refunded in full, got %+v, %v", p, err)
+	}
+
+	// Refunded is terminal.
+	if err := CheckRefund(p, 1); !errors.Is(err, ErrIllegalTransition) {
+		t.Errorf("expected a refunded payment not to be refundable again, got %v", err)
+	}
+}
+
+func TestExpire(t *testing.T) {
+	now := time.Now()
+
+	p := &models.Payment{Status: models.PaymentAuthorized, ExpiresAt: now.Add(-time.Second)}
+	if !Expire(p, now) || p.Status != models.PaymentExpired {
+		t.Errorf("expected a lapsed authorization to expire, got %+v", p)
+	}
+
+	p = &models.Payment{Status: models.PaymentAuthorized, ExpiresAt: now.Add(time.Hour)}
+	if Expire(p, now) {
+		t.Error("an authorization inside its TTL mustn't expire")
+	}
+
+	p = &models.Payment{Status: models.PaymentAuthorized}
+	if Expire(p, now) {
+		t.Error("a zero ExpiresAt means it never expires")
+	}
+
+	p = &models.Payment{Status: models.PaymentAuthorized, ExpiresAt: now.Add(-time.Second), InFlight: models.PaymentCaptured}
+	if Expire(p, now) {
+		t.Error("a payment with a capture in flight mustn't expire under it")
+	}
+}
+
+func TestBegin_ExpiredAuthorization(t *testing.T) {
+	p := &models.Payment{Status: models.PaymentAuthorized, ExpiresAt: time.Now().Add(-time.Minute)}
+
+	err := Begin(p, models.PaymentCaptured, time.Now())
+	if !errors.Is(err, ErrIllegalTransition) || !strings.Contains(err.Error(), "expired") {
+		t.Errorf("expected capturing an expired authorization to fail, got %v", err)
+	}
+}
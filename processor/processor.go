@@ -0,0 +1,92 @@
+// Package processor is the boundary between the gateway and whoever
+// actually moves the money. Handlers only talk to the Provider interface,
+// so a real acquirer can be dropped in without touching them, and the
+// Simulator can stand in for one in tests and demos.
+package processor
+
+import (
+	"context"
+	"errors"
+)
+
+// Amounts are integer minor units (pesewas for GHS, cents for USD).
+// Providers never see floats.
+
+type AuthorizeRequest struct {
+	// Reference is our idempotency reference for the call. Real processors
+	// dedupe on it, so a retried Authorize never places a second hold.
+	Reference string
+	Amount    int64
+	Currency  string
+}
+
+type Authorization struct {
+	ID       string
+	Amount   int64
+	Currency string
+}
+
+type CaptureRequest struct {
+	Reference       string
+	AuthorizationID string
+	Amount          int64 // may be less than the authorized amount
+}
+
+type Capture struct {
+	ID              string
+	AuthorizationID string
+	Amount          int64
+	Currency        string
+}
+
+type VoidRequest struct {
+	Reference       string
+	AuthorizationID string
+}
+
+type Void struct {
+	ID              string
+	AuthorizationID string
+}
+
+type RefundRequest struct {
+	Reference string
+	CaptureID string
+	Amount    int64 // may be less than the captured amount
+}
+
+type Refund struct {
+	ID        string
+	CaptureID string
+	Amount    int64
+	Currency  string
+}
+
+// Provider is a payment processor.
+// Every method must honour ctx cancellation and deadlines.
+type Provider interface {
+	Authorize(ctx context.Context, req AuthorizeRequest) (Authorization, error)
+	Capture(ctx context.Context, req CaptureRequest) (Capture, error)
+	// Void releases an authorization that hasn't been captured.
+	Void(ctx context.Context, req VoidRequest) (Void, error)
+	Refund(ctx context.Context, req RefundRequest) (Refund, error)
+}
+
+// Errors a Provider returns. Implementations wrap these with detail,
+// so callers should match with errors.Is.
+var (
+	// ErrDeclined means the processor answered and said no. Not retryable.
+	ErrDeclined = errors.New("payment declined")
+
+	// ErrTimeout means we gave up waiting. The outcome is unknown,
+	// the payment may or may not have gone through.
+	ErrTimeout = errors.New("payment processor timed out")
+
+	// ErrUnavailable is a transient upstream failure (their 5xx).
+	ErrUnavailable = errors.New("payment processor unavailable")
+
+	// ErrInvalidRequest covers calls that could never succeed:
+	// unknown authorization, capturing or refunding more than is available,
+	// capturing a voided authorization or voiding a captured one.
+	ErrInvalidRequest = errors.New("invalid processor request")
+)
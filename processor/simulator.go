@@ -0,0 +1,312 @@
+package processor
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	mathrand "math/rand"
+	"sync"
+	"time"
+)
+
+// Latency produces how long one simulated call takes.
+type Latency interface {
+	Sample(r *mathrand.Rand) time.Duration
+}
+
+// Fixed always takes exactly d.
+type Fixed time.Duration
+
+func (f Fixed) Sample(*mathrand.Rand) time.Duration { return time.Duration(f) }
+
+// Uniform takes anywhere between Min and Max.
+type Uniform struct {
+	Min, Max time.Duration
+}
+
+func (u Uniform) Sample(r *mathrand.Rand) time.Duration {
+	if u.Max <= u.Min {
+		return u.Min
+	}
+	return u.Min + time.Duration(r.Int63n(int64(u.Max-u.Min)))
+}
+
+// Normal is centred on Mean with the given standard deviation, never negative.
+// Closer to what real processors look like than a flat spread.
+type Normal struct {
+	Mean, StdDev time.Duration
+}
+
+func (n Normal) Sample(r *mathrand.Rand) time.Duration {
+	d := n.Mean + time.Duration(r.NormFloat64()*float64(n.StdDev))
+	if d < 0 {
+		return 0
+	}
+	return d
+}
+
+// SimulatorConfig controls which failures the simulator injects.
+// Rates are probabilities between 0 and 1, checked in the order
+// timeout, unavailable, decline. Zero values give a processor that
+// always succeeds instantly.
+type SimulatorConfig struct {
+	// Latency is the issuer round-trip, applied to Authorize and Refund.
+	// CaptureLatency applies to Capture, which for most acquirers is a quick
+	// settlement instruction rather than a trip to the issuer.
+	Latency        Latency
+	CaptureLatency Latency
+
+	// DeclineRate is the chance Authorize is declined.
+	DeclineRate float64
+
+	// TimeoutRate is the chance a call hangs. A hanging call blocks until
+	// ctx is done or HangFor has passed, then returns ErrTimeout.
+	TimeoutRate float64
+	HangFor     time.Duration
+
+	// ErrorRate is the chance a call fails with an intermittent 5xx.
+	ErrorRate float64
+
+	// Seed makes the injected failures reproducible. Zero picks one from the clock.
+	Seed int64
+}
+
+// Simulator is an in-memory Provider. It tracks authorizations and captures
+// so it rejects the same things a real processor would (over-capturing,
+// over-refunding, unknown IDs), and it dedupes on Reference.
+type Simulator struct {
+	cfg SimulatorConfig
+
+	randMu sync.Mutex // *rand.Rand isn't safe for concurrent use
+	rand   *mathrand.Rand
+
+	mu             sync.Mutex
+	authorizations map[string]*Authorization
+	captures       map[string]*Capture
+	captured       map[string]int64  // authorization ID -> amount captured so far
+	voided         map[string]bool   // authorization IDs that have been voided
+	refunded       map[string]int64  // capture ID -> amount refunded so far
+	byReference    map[replayKey]any // operation and reference -> result already returned for it
+}
+
+// replayKey keeps each operation's results apart. One payment authorizes
+// and captures under the same reference, and the capture mustn't replace
+// the authorization it was made against.
+type replayKey struct {
+	op        string
+	reference string
+}
+
+func NewSimulator(cfg SimulatorConfig) *Simulator {
+	seed := cfg.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	if cfg.Latency == nil {
+		cfg.Latency = Fixed(0)
+	}
+	if cfg.CaptureLatency == nil {
+		cfg.CaptureLatency = Fixed(0)
+	}
+	if cfg.HangFor == 0 {
+		cfg.HangFor = 30 * time.Second
+	}
+
+	return &Simulator{
+		cfg:            cfg,
+		rand:           mathrand.New(mathrand.NewSource(seed)),
+		authorizations: make(map[string]*Authorization),
+		captures:       make(map[string]*Capture),
+		captured:       make(map[string]int64),
+		voided:         make(map[string]bool),
+		refunded:       make(map[string]int64),
+		byReference:    make(map[replayKey]any),
+	}
+}
+
+func (s *Simulator) Authorize(ctx context.Context, req AuthorizeRequest) (Authorization, error) {
+	if prior, ok := s.replay("authorize", req.Reference); ok {
+		if auth, ok := prior.(Authorization); ok {
+			return auth, nil
+		}
+	}
+
+	if err := s.simulateCall(ctx, s.cfg.Latency); err != nil {
+		return Authorization{}, err
+	}
+	if req.Amount <= 0 {
+		return Authorization{}, fmt.Errorf("%w: amount must be positive", ErrInvalidRequest)
+	}
+	if s.roll(s.cfg.DeclineRate) {
+		return Authorization{}, fmt.Errorf("%w: insufficient funds", ErrDeclined)
+	}
+
+	auth := Authorization{ID: newID("auth"), Amount: req.Amount, Currency: req.Currency}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.authorizations[auth.ID] = &auth
+	s.remember("authorize", req.Reference, auth)
+	return auth, nil
+}
+
+func (s *Simulator) Capture(ctx context.Context, req CaptureRequest) (Capture, error) {
+	if prior, ok := s.replay("capture", req.Reference); ok {
+		if capture, ok := prior.(Capture); ok {
+			return capture, nil
+		}
+	}
+
+	if err := s.simulateCall(ctx, s.cfg.CaptureLatency); err != nil {
+		return Capture{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	auth, ok := s.authorizations[req.AuthorizationID]
+	if !ok {
+		return Capture{}, fmt.Errorf("%w: unknown authorization %s", ErrInvalidRequest, req.AuthorizationID)
+	}
+	if s.voided[auth.ID] {
+		return Capture{}, fmt.Errorf("%w: authorization %s was voided", ErrInvalidRequest, auth.ID)
+	}
+	if req.Amount <= 0 || s.captured[auth.ID]+req.Amount > auth.Amount {
+		return Capture{}, fmt.Errorf("%w: capture exceeds authorized amount", ErrInvalidRequest)
+	}
+
+	capture := Capture{ID: newID("cap"), AuthorizationID: auth.ID, Amount: req.Amount, Currency: auth.Currency}
+	s.captures[capture.ID] = &capture
+	s.captured[auth.ID] += req.Amount
+	s.remember("capture", req.Reference, capture)
+	return capture, nil
+}
+
+func (s *Simulator) Void(ctx context.Context, req VoidRequest) (Void, error) {
+	if prior, ok := s.replay("void", req.Reference); ok {
+		if void, ok := prior.(Void); ok {
+			return void, nil
+		}
+	}
+
+	if err := s.simulateCall(ctx, s.cfg.CaptureLatency); err != nil {
+		return Void{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	auth, ok := s.authorizations[req.AuthorizationID]
+	if !ok {
+		return Void{}, fmt.Errorf("%w: unknown authorization %s", ErrInvalidRequest, req.AuthorizationID)
+	}
+	if s.captured[auth.ID] > 0 {
+		return Void{}, fmt.Errorf("%w: authorization %s has already been captured", ErrInvalidRequest, auth.ID)
+	}
+
+	void := Void{ID: newID("void"), AuthorizationID: auth.ID}
+	s.voided[auth.ID] = true
+	s.remember("void", req.Reference, void)
+	return void, nil
+}
+
+func (s *Simulator) Refund(ctx context.Context, req RefundRequest) (Refund, error) {
+	if prior, ok := s.replay("refund", req.Reference); ok {
+		if refund, ok := prior.(Refund); ok {
+			return refund, nil
+		}
+	}
+
+	if err := s.simulateCall(ctx, s.cfg.Latency); err != nil {
+		return Refund{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	capture, ok := s.captures[req.CaptureID]
+	if !ok {
+		return Refund{}, fmt.Errorf("%w: unknown capture %s", ErrInvalidRequest, req.CaptureID)
+	}
+	if req.Amount <= 0 || s.refunded[capture.ID]+req.Amount > capture.Amount {
+		return Refund{}, fmt.Errorf("%w: refund exceeds captured amount", ErrInvalidRequest)
+	}
+
+	refund := Refund{ID: newID("ref"), CaptureID: capture.ID, Amount: req.Amount, Currency: capture.Currency}
+	s.refunded[capture.ID] += req.Amount
+	s.remember("refund", req.Reference, refund)
+	return refund, nil
+}
+
+// simulateCall waits out the sampled latency and rolls for the
+// failures that can hit any call: timeouts and intermittent 5xx.
+func (s *Simulator) simulateCall(ctx context.Context, latency Latency) error {
+	if s.roll(s.cfg.TimeoutRate) {
+		// Hang like an unresponsive upstream until the caller gives up.
+		if err := sleep(ctx, s.cfg.HangFor); err != nil {
+			return fmt.Errorf("%w: %v", ErrTimeout, err)
+		}
+		return ErrTimeout
+	}
+
+	s.randMu.Lock()
+	delay := latency.Sample(s.rand)
+	s.randMu.Unlock()
+
+	if err := sleep(ctx, delay); err != nil {
+		return fmt.Errorf("%w: %v", ErrTimeout, err)
+	}
+
+	if s.roll(s.cfg.ErrorRate) {
+		return fmt.Errorf("%w: upstream returned 503", ErrUnavailable)
+	}
+	return nil
+}
+
+func (s *Simulator) roll(rate float64) bool {
+	if rate <= 0 {
+		return false
+	}
+	s.randMu.Lock()
+	defer s.randMu.Unlock()
+	return s.rand.Float64() < rate
+}
+
+func (s *Simulator) replay(op, reference string) (any, bool) {
+	if reference == "" {
+		return nil, false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	prior, ok := s.byReference[replayKey{op, reference}]
+	return prior, ok
+}
+
+// remember must be called with s.mu held.
+func (s *Simulator) remember(op, reference string, result any) {
+	if reference != "" {
+		s.byReference[replayKey{op, reference}] = result
+	}
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func newID(prefix string) string {
+	var b [8]byte
+	rand.Read(b[:])
+	return prefix + "_" + hex.EncodeToString(b[:])
+}
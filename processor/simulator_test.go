@@ -0,0 +1,212 @@
+package processor
+
+import (
+	"context"
+	"errors"
+	mathrand "math/rand"
+	"testing"
+	"time"
+)
+
+func authorize(t *testing.T, s *Simulator, amount int64) Authorization {
+	t.Helper()
+	auth, err := s.Authorize(context.Background(), AuthorizeRequest{Amount: amount, Currency: "GHS"})
+	if err != nil {
+		t.Fatalf("authorize failed: %v", err)
+	}
+	return auth
+}
+
+func TestSimulator_DefaultConfigAlwaysSucceeds(t *testing.T) {
+	s := NewSimulator(SimulatorConfig{})
+	ctx := context.Background()
+
+	auth := authorize(t, s, 10000)
+	capture, err := s.Capture(ctx, CaptureRequest{AuthorizationID: auth.ID, Amount: 10000})
+	if err != nil {
+		t.Fatalf("capture failed: %v", err)
+	}
+	if _, err := s.Refund(ctx, RefundRequest{CaptureID: capture.ID, Amount: 2500}); err != nil {
+		t.Fatalf("refund failed: %v", err)
+	}
+}
+
+func TestSimulator_InjectsDeclines(t *testing.T) {
+	s := NewSimulator(SimulatorConfig{DeclineRate: 1})
+
+	_, err := s.Authorize(context.Background(), AuthorizeRequest{Amount: 100, Currency: "GHS"})
+	if !errors.Is(err, ErrDeclined) {
+		t.Errorf("expected ErrDeclined, got %v", err)
+	}
+}
+
+func TestSimulator_InjectsIntermittentErrors(t *testing.T) {
+	s := NewSimulator(SimulatorConfig{ErrorRate: 1})
+
+	_, err := s.Authorize(context.Background(), AuthorizeRequest{Amount: 100, Currency: "GHS"})
+	if !errors.Is(err, ErrUnavailable) {
+		t.Errorf("expected ErrUnavailable, got %v", err)
+	}
+}
+
+func TestSimulator_TimeoutHonoursContextDeadline(t *testing.T) {
+	// A hanging processor must give up when the caller's deadline hits,
+	// not after its own (much longer) hang time.
+	s := NewSimulator(SimulatorConfig{TimeoutRate: 1, HangFor: time.Minute})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := s.Authorize(ctx, AuthorizeRequest{Amount: 100, Currency: "GHS"})
+
+	if !errors.Is(err, ErrTimeout) {
+		t.Errorf("expected ErrTimeout, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("timeout took %v, expected it to follow the context deadline", elapsed)
+	}
+}
+
+func TestSimulator_RatesAreReproducibleWithSeed(t *testing.T) {
+	run := func() []bool {
+		s := NewSimulator(SimulatorConfig{DeclineRate: 0.5, Seed: 42})
+		var declined []bool
+		for i := 0; i < 20; i++ {
+			_, err := s.Authorize(context.Background(), AuthorizeRequest{Amount: 100, Currency: "GHS"})
+			declined = append(declined, errors.Is(err, ErrDeclined))
+		}
+		return declined
+	}
+
+	a, b := run(), run()
+	for i := range a {
+		if a[i] != b[i] {
+			t.Fatalf("same seed gave different results at call %d", i)
+		}
+	}
+}
+
+func TestSimulator_RejectsOverCapture(t *testing.T) {
+	s := NewSimulator(SimulatorConfig{})
+	auth := authorize(t, s, 1000)
+	ctx := context.Background()
+
+	if _, err := s.Capture(ctx, CaptureRequest{AuthorizationID: auth.ID, Amount: 600}); err != nil {
+		t.Fatalf("partial capture failed: %v", err)
+	}
+	_, err := s.Capture(ctx, CaptureRequest{AuthorizationID: auth.ID, Amount: 600})
+	if !errors.Is(err, ErrInvalidRequest) {
+		t.Errorf("expected over-capture to be rejected, got %v", err)
+	}
+}
+
+func TestSimulator_RejectsOverRefund(t *testing.T) {
+	s := NewSimulator(SimulatorConfig{})
+	auth := authorize(t, s, 1000)
+	ctx := context.Background()
+	capture, _ := s.Capture(ctx, CaptureRequest{AuthorizationID: auth.ID, Amount: 1000})
+
+	s.Refund(ctx, RefundRequest{CaptureID: capture.ID, Amount: 700})
+	_, err := s.Refund(ctx, RefundRequest{CaptureID: capture.ID, Amount: 301})
+	if !errors.Is(err, ErrInvalidRequest) {
+		t.Errorf("expected over-refund to be rejected, got %v", err)
+	}
+}
+
+func TestSimulator_Void(t *testing.T) {
+	s := NewSimulator(SimulatorConfig{})
+	ctx := context.Background()
+
+	auth := authorize(t, s, 1000)
+	if _, err := s.Void(ctx, VoidRequest{AuthorizationID: auth.ID}); err != nil {
+		t.Fatalf("void failed: %v", err)
+	}
+	if _, err := s.Capture(ctx, CaptureRequest{AuthorizationID: auth.ID, Amount: 1000}); !errors.Is(err, ErrInvalidRequest) {
+		t.Errorf("expected capturing a voided authorization to be rejected, got %v", err)
+	}
+
+	captured := authorize(t, s, 1000)
+	s.Capture(ctx, CaptureRequest{AuthorizationID: captured.ID, Amount: 1000})
+	if _, err := s.Void(ctx, VoidRequest{AuthorizationID: captured.ID}); !errors.Is(err, ErrInvalidRequest) {
+		t.Errorf("expected voiding a captured authorization to be rejected, got %v", err)
+	}
+}
+
+func TestSimulator_UnknownAuthorization(t *testing.T) {
+	s := NewSimulator(SimulatorConfig{})
+
+	_, err := s.Capture(context.Background(), CaptureRequest{AuthorizationID: "auth_nope", Amount: 1})
+	if !errors.Is(err, ErrInvalidRequest) {
+		t.Errorf("expected ErrInvalidRequest, got %v", err)
+	}
+}
+
+func TestSimulator_DedupesOnReference(t *testing.T) {
+	// A retried Authorize with the same reference must not place a second hold.
+	s := NewSimulator(SimulatorConfig{})
+	req := AuthorizeRequest{Reference: "ref-1", Amount: 100, Currency: "GHS"}
+
+	first, _ := s.Authorize(context.Background(), req)
+	second, _ := s.Authorize(context.Background(), req)
+
+	if first.ID != second.ID {
+		t.Errorf("expected the same authorization for a repeated reference, got %s and %s", first.ID, second.ID)
+	}
+}
+
+func TestSimulator_AuthorizeAndCaptureShareAReference(t *testing.T) {
+	// The payment handler authorizes and captures under one reference. Run it
+	// twice and the second run must get back the original authorization and
+	// capture, not place a new hold and capture it again.
+	s := NewSimulator(SimulatorConfig{})
+	ctx := context.Background()
+
+	run := func() (Authorization, Capture) {
+		t.Helper()
+		auth, err := s.Authorize(ctx, AuthorizeRequest{Reference: "ref-1", Amount: 100, Currency: "GHS"})
+		if err != nil {
+			t.Fatalf("authorize failed: %v", err)
+		}
+		capture, err := s.Capture(ctx, CaptureRequest{Reference: "ref-1", AuthorizationID: auth.ID, Amount: auth.Amount})
+		if err != nil {
+			t.Fatalf("capture failed: %v", err)
+		}
+		return auth, capture
+	}
+
+	firstAuth, firstCapture := run()
+	secondAuth, secondCapture := run()
+
+	if secondAuth.ID != firstAuth.ID {
+		t.Errorf("expected the original authorization %s, got %s", firstAuth.ID, secondAuth.ID)
+	}
+	if secondCapture.ID != firstCapture.ID {
+		t.Errorf("expected the original capture %s, got %s", firstCapture.ID, secondCapture.ID)
+	}
+	if len(s.authorizations) != 1 || len(s.captures) != 1 {
+		t.Errorf("expected 1 authorization and 1 capture, got %d and %d", len(s.authorizations), len(s.captures))
+	}
+}
+
+func TestLatency_Distributions(t *testing.T) {
+	r := mathrand.New(mathrand.NewSource(1))
+
+	if d := Fixed(time.Second).Sample(r); d != time.Second {
+		t.Errorf("Fixed: expected 1s, got %v", d)
+	}
+
+	u := Uniform{Min: 10 * time.Millisecond, Max: 20 * time.Millisecond}
+	for i := 0; i < 100; i++ {
+		if d := u.Sample(r); d < u.Min || d >= u.Max {
+			t.Fatalf("Uniform sample %v outside [%v, %v)", d, u.Min, u.Max)
+		}
+	}
+
+	n := Normal{Mean: time.Millisecond, StdDev: 10 * time.Millisecond}
+	for i := 0; i < 100; i++ {
+		if d := n.Sample(r); d < 0 {
+			t.Fatalf("Normal sample went negative: %v", d)
+		}
+	}
+}
@@ -0,0 +1,339 @@
+// Package risk decides whether a payment should go to the processor at all.
+// Rules come from configuration: amount thresholds, velocity limits per
+// customer or card, and blocklists. Every matching rule is reported, and
+// the most severe action among them is the decision.
+package risk
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/GordenArcher/Idempotency-Gateway/currency"
+	"github.com/GordenArcher/Idempotency-Gateway/models"
+	"github.com/GordenArcher/Idempotency-Gateway/money"
+)
+
+// Rule types.
+const (
+	TypeAmount    = "amount"    // amount at or above Min in Currency
+	TypeVelocity  = "velocity"  // more than Limit payments for the same Field within Window
+	TypeBlocklist = "blocklist" // Field is one of Values
+)
+
+// Fields velocity and blocklist rules can look at.
+const (
+	FieldCustomer = "customer"
+	FieldCard     = "card"
+	FieldCountry  = "country"
+)
+
+// Transaction is what the rules see of a payment.
+type Transaction struct {
+	Merchant   string // who it's for, "" with authentication off
+	CustomerID string
+	Card       string
+	Country    string
+	Amount     money.Money
+	At         time.Time
+}
+
+func (t Transaction) field(name string) string {
+	switch name {
+	case FieldCustomer:
+		return t.CustomerID
+	case FieldCard:
+		return t.Card
+	case FieldCountry:
+		return t.Country
+	}
+	return ""
+}
+
+// velocityKey is what a velocity rule on field counts tx under. Customer IDs
+// are the merchant's own, two merchants' cust_1 are different people and
+// mustn't share a count. Cards and countries are the same everywhere.
+func (t Transaction) velocityKey(field string) string {
+	v := t.field(field)
+	if v == "" || field != FieldCustomer {
+		return v
+	}
+	// Quoted, so where the merchant ends is never in doubt.
+	return strconv.Quote(t.Merchant) + v
+}
+
+// Rule is a rule as written in the rules file. Which fields matter depends on Type.
+type Rule struct {
+	ID     string            `json:"id"`
+	Type   string            `json:"type"`
+	Action models.RiskAction `json:"action"`
+
+	// amount
+	Currency string        `json:"currency,omitempty"`
+	Min      money.Decimal `json:"min,omitempty"`
+
+	// velocity and blocklist
+	Field string `json:"field,omitempty"`
+
+	// velocity
+	Limit  int    `json:"limit,omitempty"`
+	Window string `json:"window,omitempty"` // a Go duration, "1h"
+
+	// blocklist
+	Values []string `json:"values,omitempty"`
+}
+
+// severity orders actions so the worst match wins.
+var severity = map[models.RiskAction]int{
+	models.RiskAllow:  0,
+	models.RiskReview: 1,
+	models.RiskDeny:   2,
+}
+
+// Engine evaluates payments against a fixed set of rules. It's safe for
+// concurrent use. The zero of *Engine (nil) allows everything.
+type Engine struct {
+	rules []rule
+}
+
+// rule is a compiled Rule.
+type rule interface {
+	id() string
+	action() models.RiskAction
+	// match reports whether tx trips the rule, and why.
+	match(tx Transaction) (bool, string)
+}
+
+// NewEngine checks and compiles rules. Amount thresholds are converted to
+// minor units with the currency's exponent from currencies.
+func NewEngine(rules []Rule, currencies *currency.Registry) (*Engine, error) {
+	e := &Engine{}
+	seen := make(map[string]bool, len(rules))
+	for _, r := range rules {
+		if r.ID == "" {
+			return nil, errors.New("rule with no id")
+		}
+		if seen[r.ID] {
+			return nil, fmt.Errorf("rule %s listed twice", r.ID)
+		}
+		seen[r.ID] = true
+
+		if r.Action != models.RiskReview && r.Action != models.RiskDeny {
+			return nil, fmt.Errorf("rule %s: action must be review or deny, got %q", r.ID, r.Action)
+		}
+
+		compiled, err := compile(r, currencies)
+		if err != nil {
+			return nil, fmt.Errorf("rule %s: %w", r.ID, err)
+		}
+		e.rules = append(e.rules, compiled)
+	}
+	return e, nil
+}
+
+func compile(r Rule, currencies *currency.Registry) (rule, error) {
+	switch r.Type {
+	case TypeAmount:
+		c, ok := currencies.Lookup(r.Currency)
+		if !ok {
+			return nil, fmt.Errorf("unknown currency %q", r.Currency)
+		}
+		min, err := r.Min.Minor(c.Exponent)
+		if err != nil {
+			return nil, fmt.Errorf("min: %w", err)
+		}
+		if min <= 0 {
+			return nil, errors.New("min must be > 0")
+		}
+		return &amountRule{base: base{r.ID, r.Action}, currency: c.Code, min: min, minText: r.Min.String()}, nil
+
+	case TypeVelocity:
+		if err := checkField(r.Field); err != nil {
+			return nil, err
+		}
+		window, err := time.ParseDuration(r.Window)
+		if err != nil || window <= 0 {
+			return nil, fmt.Errorf("window must be a positive duration like 1h, got %q", r.Window)
+		}
+		if r.Limit < 1 {
+			return nil, errors.New("limit must be at least 1")
+		}
+		return &velocityRule{base: base{r.ID, r.Action}, field: r.Field, limit: r.Limit, window: window, seen: map[string][]time.Time{}}, nil
+
+	case TypeBlocklist:
+		if err := checkField(r.Field); err != nil {
+			return nil, err
+		}
+		if len(r.Values) == 0 {
+			return nil, errors.New("blocklist has no values")
+		}
+		values := make(map[string]bool, len(r.Values))
+		for _, v := range r.Values {
+			values[strings.ToUpper(v)] = true
+		}
+		return &blocklistRule{base: base{r.ID, r.Action}, field: r.Field, values: values}, nil
+	}
+	return nil, fmt.Errorf("unknown type %q", r.Type)
+}
+
+func checkField(f string) error {
+	switch f {
+	case FieldCustomer, FieldCard, FieldCountry:
+		return nil
+	}
+	return fmt.Errorf("field must be customer, card or country, got %q", f)
+}
+
+// Load reads rules from a JSON array. An empty path means no rules, every
+// payment is allowed.
+func Load(path string, currencies *currency.Registry) (*Engine, error) {
+	if path == "" {
+		return &Engine{}, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var rules []Rule
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&rules); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	e, err := NewEngine(rules, currencies)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return e, nil
+}
+
+// Evaluate runs every rule against tx. Velocity rules count tx as an
+// attempt whatever the outcome, so a card being tried over and over keeps
+// tripping its limit even while it's being denied.
+func (e *Engine) Evaluate(tx Transaction) models.RiskDecision {
+	decision := models.RiskDecision{Action: models.RiskAllow}
+	if e == nil {
+		return decision
+	}
+	if tx.At.IsZero() {
+		tx.At = time.Now()
+	}
+
+	for _, r := range e.rules {
+		matched, reason := r.match(tx)
+		if !matched {
+			continue
+		}
+		decision.Rules = append(decision.Rules, r.id())
+		decision.Reasons = append(decision.Reasons, reason)
+		if severity[r.action()] > severity[decision.Action] {
+			decision.Action = r.action()
+		}
+	}
+	return decision
+}
+
+type base struct {
+	ruleID     string
+	ruleAction models.RiskAction
+}
+
+func (b base) id() string                { return b.ruleID }
+func (b base) action() models.RiskAction { return b.ruleAction }
+
+type amountRule struct {
+	base
+	currency string
+	min      int64
+	minText  string
+}
+
+func (r *amountRule) match(tx Transaction) (bool, string) {
+	if tx.Amount.Currency != r.currency || tx.Amount.Minor < r.min {
+		return false, ""
+	}
+	return true, fmt.Sprintf("amount %s is at or above %s %s", tx.Amount, r.minText, r.currency)
+}
+
+type blocklistRule struct {
+	base
+	field  string
+	values map[string]bool
+}
+
+func (r *blocklistRule) match(tx Transaction) (bool, string) {
+	v := tx.field(r.field)
+	if v == "" || !r.values[strings.ToUpper(v)] {
+		return false, ""
+	}
+	return true, r.field + " is blocklisted"
+}
+
+// velocityRule keeps the recent attempt times for every value of its field.
+type velocityRule struct {
+	base
+	field  string
+	limit  int
+	window time.Duration
+
+	mu        sync.Mutex
+	seen      map[string][]time.Time
+	lastSweep time.Time
+}
+
+func (r *velocityRule) match(tx Transaction) (bool, string) {
+	v := tx.velocityKey(r.field)
+	if v == "" {
+		return false, ""
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cutoff := tx.At.Add(-r.window)
+	r.sweep(tx.At, cutoff)
+
+	attempts := append(recent(r.seen[v], cutoff), tx.At)
+	r.seen[v] = attempts
+	if len(attempts) <= r.limit {
+		return false, ""
+	}
+	return true, fmt.Sprintf("%d payments from this %s within %s, the limit is %d", len(attempts), r.field, r.window, r.limit)
+}
+
+// sweep drops values with no attempts inside the window, at most once per
+// window, so one-off customers and cards don't pile up forever.
+// Must be called with r.mu held.
+func (r *velocityRule) sweep(now, cutoff time.Time) {
+	if now.Sub(r.lastSweep) < r.window {
+		return
+	}
+	r.lastSweep = now
+	for v, times := range r.seen {
+		if times = recent(times, cutoff); len(times) == 0 {
+			delete(r.seen, v)
+		} else {
+			r.seen[v] = times
+		}
+	}
+}
+
+// recent drops the times at or before cutoff. Times are appended in order,
+// so everything after the first recent one is recent too.
+func recent(times []time.Time, cutoff time.Time) []time.Time {
+	for i, t := range times {
+		if t.After(cutoff) {
+			return times[i:]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,177 @@
+package risk
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/GordenArcher/Idempotency-Gateway/currency"
+	"github.com/GordenArcher/Idempotency-Gateway/models"
+	"github.com/GordenArcher/Idempotency-Gateway/money"
+)
+
+func ghs(t *testing.T, amount string) money.Money {
+	t.Helper()
+	d, err := money.ParseDecimal(amount)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := currency.Default().Parse(d, "GHS")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func mustEngine(t *testing.T, rules ...Rule) *Engine {
+	t.Helper()
+	e, err := NewEngine(rules, currency.Default())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return e
+}
+
+func decimal(s string) money.Decimal {
+	d, _ := money.ParseDecimal(s)
+	return d
+}
+
+func TestEvaluate_NoRulesAllows(t *testing.T) {
+	var nilEngine *Engine
+	for _, e := range []*Engine{nilEngine, mustEngine(t)} {
+		if d := e.Evaluate(Transaction{Amount: ghs(t, "1.00")}); d.Action != models.RiskAllow || len(d.Rules) != 0 {
+			t.Errorf("expected allow with no rules, got %+v", d)
+		}
+	}
+}
+
+func TestEvaluate_AmountThreshold(t *testing.T) {
+	e := mustEngine(t, Rule{ID: "large", Type: TypeAmount, Action: models.RiskReview, Currency: "GHS", Min: decimal("5000")})
+
+	if d := e.Evaluate(Transaction{Amount: ghs(t, "4999.99")}); d.Action != models.RiskAllow {
+		t.Errorf("expected allow below the threshold, got %s", d.Action)
+	}
+	d := e.Evaluate(Transaction{Amount: ghs(t, "5000.00")})
+	if d.Action != models.RiskReview || !slices.Equal(d.Rules, []string{"large"}) {
+		t.Errorf("expected review by rule large, got %+v", d)
+	}
+}
+
+func TestEvaluate_Blocklist(t *testing.T) {
+	e := mustEngine(t, Rule{ID: "countries", Type: TypeBlocklist, Action: models.RiskDeny, Field: FieldCountry, Values: []string{"KP", "IR"}})
+
+	if d := e.Evaluate(Transaction{Country: "kp", Amount: ghs(t, "1.00")}); d.Action != models.RiskDeny {
+		t.Errorf("expected deny for a blocked country whatever its case, got %s", d.Action)
+	}
+	if d := e.Evaluate(Transaction{Country: "GH", Amount: ghs(t, "1.00")}); d.Action != models.RiskAllow {
+		t.Errorf("expected allow, got %s", d.Action)
+	}
+	if d := e.Evaluate(Transaction{Amount: ghs(t, "1.00")}); d.Action != models.RiskAllow {
+		t.Errorf("expected allow with no country, got %s", d.Action)
+	}
+}
+
+func TestEvaluate_VelocityPerCard(t *testing.T) {
+	e := mustEngine(t, Rule{ID: "card-velocity", Type: TypeVelocity, Action: models.RiskDeny, Field: FieldCard, Limit: 3, Window: "1h"})
+	start := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+
+	for i := 0; i < 3; i++ {
+		tx := Transaction{Card: "card_a", Amount: ghs(t, "1.00"), At: start.Add(time.Duration(i) * time.Minute)}
+		if d := e.Evaluate(tx); d.Action != models.RiskAllow {
+			t.Fatalf("attempt %d: expected allow within the limit, got %s", i+1, d.Action)
+		}
+	}
+
+	if d := e.Evaluate(Transaction{Card: "card_a", Amount: ghs(t, "1.00"), At: start.Add(4 * time.Minute)}); d.Action != models.RiskDeny {
+		t.Errorf("expected the 4th attempt in the hour denied, got %s", d.Action)
+	}
+	if d := e.Evaluate(Transaction{Card: "card_b", Amount: ghs(t, "1.00"), At: start.Add(4 * time.Minute)}); d.Action != models.RiskAllow {
+		t.Errorf("expected another card unaffected, got %s", d.Action)
+	}
+
+	// Once the first attempts fall out of the window there's room again.
+	if d := e.Evaluate(Transaction{Card: "card_a", Amount: ghs(t, "1.00"), At: start.Add(62 * time.Minute)}); d.Action != models.RiskAllow {
+		t.Errorf("expected allow after the window moved on, got %s", d.Action)
+	}
+}
+
+func TestEvaluate_VelocityPerCustomerIsPerMerchant(t *testing.T) {
+	e := mustEngine(t, Rule{ID: "customer-velocity", Type: TypeVelocity, Action: models.RiskDeny, Field: FieldCustomer, Limit: 2, Window: "1h"})
+	start := time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+
+	for i := 0; i < 3; i++ {
+		e.Evaluate(Transaction{Merchant: "acme", CustomerID: "cust_1", Amount: ghs(t, "1.00"), At: start.Add(time.Duration(i) * time.Minute)})
+	}
+
+	d := e.Evaluate(Transaction{Merchant: "globex", CustomerID: "cust_1", Amount: ghs(t, "1.00"), At: start.Add(4 * time.Minute)})
+	if d.Action != models.RiskAllow {
+		t.Errorf("expected another merchant's cust_1 unaffected, got %s", d.Action)
+	}
+	d = e.Evaluate(Transaction{Merchant: "acme", CustomerID: "cust_1", Amount: ghs(t, "1.00"), At: start.Add(4 * time.Minute)})
+	if d.Action != models.RiskDeny {
+		t.Errorf("expected acme's cust_1 still over its limit, got %s", d.Action)
+	}
+}
+
+func TestEvaluate_MostSevereWins(t *testing.T) {
+	e := mustEngine(t,
+		Rule{ID: "large", Type: TypeAmount, Action: models.RiskReview, Currency: "GHS", Min: decimal("100")},
+		Rule{ID: "blocked", Type: TypeBlocklist, Action: models.RiskDeny, Field: FieldCustomer, Values: []string{"cus_bad"}},
+	)
+
+	d := e.Evaluate(Transaction{CustomerID: "cus_bad", Amount: ghs(t, "500.00")})
+	if d.Action != models.RiskDeny {
+		t.Errorf("expected deny, got %s", d.Action)
+	}
+	if !slices.Equal(d.Rules, []string{"large", "blocked"}) || len(d.Reasons) != 2 {
+		t.Errorf("expected both rules reported with reasons, got %+v", d)
+	}
+}
+
+func TestNewEngine_RejectsBadRules(t *testing.T) {
+	tests := map[string]Rule{
+		"no id":            {Type: TypeBlocklist, Action: models.RiskDeny, Field: FieldCard, Values: []string{"x"}},
+		"allow action":     {ID: "r", Type: TypeBlocklist, Action: models.RiskAllow, Field: FieldCard, Values: []string{"x"}},
+		"unknown type":     {ID: "r", Type: "geo", Action: models.RiskDeny},
+		"unknown currency": {ID: "r", Type: TypeAmount, Action: models.RiskDeny, Currency: "XYZ", Min: decimal("1")},
+		"zero min":         {ID: "r", Type: TypeAmount, Action: models.RiskDeny, Currency: "GHS"},
+		"bad window":       {ID: "r", Type: TypeVelocity, Action: models.RiskDeny, Field: FieldCard, Limit: 1, Window: "soon"},
+		"zero limit":       {ID: "r", Type: TypeVelocity, Action: models.RiskDeny, Field: FieldCard, Window: "1h"},
+		"bad field":        {ID: "r", Type: TypeBlocklist, Action: models.RiskDeny, Field: "email", Values: []string{"x"}},
+		"empty blocklist":  {ID: "r", Type: TypeBlocklist, Action: models.RiskDeny, Field: FieldCard},
+	}
+	for name, rule := range tests {
+		if _, err := NewEngine([]Rule{rule}, currency.Default()); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+
+	dup := Rule{ID: "r", Type: TypeBlocklist, Action: models.RiskDeny, Field: FieldCard, Values: []string{"x"}}
+	if _, err := NewEngine([]Rule{dup, dup}, currency.Default()); err == nil {
+		t.Error("duplicate id: expected an error")
+	}
+}
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.json")
+	os.WriteFile(path, []byte(`[
+		{"id": "large", "type": "amount", "action": "review", "currency": "GHS", "min": "5000.00"},
+		{"id": "card-velocity", "type": "velocity", "action": "deny", "field": "card", "limit": 5, "window": "1h"}
+	]`), 0o600)
+
+	e, err := Load(path, currency.Default())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if d := e.Evaluate(Transaction{Amount: ghs(t, "6000.00")}); d.Action != models.RiskReview {
+		t.Errorf("expected review from the loaded rules, got %s", d.Action)
+	}
+
+	os.WriteFile(path, []byte(`[{"id": "x", "type": "amount", "action": "deny", "threshold": 5}]`), 0o600)
+	if _, err := Load(path, currency.Default()); err == nil {
+		t.Error("expected an error for an unknown field")
+	}
+}
@@ -0,0 +1,226 @@
+package signing
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+const (
+	secret    = "s3cret-shared-with-the-bank-0123456789"
+	newSecret = "n3w-secret-shared-with-the-bank-9876543210"
+)
+
+var now = time.Date(2026, 10, 18, 12, 0, 0, 0, time.UTC)
+
+func testVerifier(t *testing.T, secrets ...Secret) *Verifier {
+	t.Helper()
+	if len(secrets) == 0 {
+		secrets = []Secret{{ID: "bank-1", Merchant: "bank", Secret: secret}}
+	}
+	v, err := NewVerifier(secrets, 5*time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v.now = func() time.Time { return now }
+	return v
+}
+
+func testRequest(at time.Time) Request {
+	return Request{
+		Method:         "POST",
+		Path:           "/process-payment",
+		Timestamp:      at,
+		IdempotencyKey: "order-1",
+		Body:           []byte(`{"amount": 100, "currency": "GHS"}`),
+	}
+}
+
+func ts(at time.Time) string { return strconv.FormatInt(at.Unix(), 10) }
+
+func TestVerify_Valid(t *testing.T) {
+	v := testVerifier(t)
+	req := testRequest(now)
+	if err := v.Verify("bank", ts(now), Sign(secret, req), req); err != nil {
+		t.Errorf("expected a valid signature, got %v", err)
+	}
+}
+
+func TestVerify_Tampering(t *testing.T) {
+	signed := testRequest(now)
+	sig := Sign(secret, signed)
+
+	tampered := map[string]func(r *Request){
+		"method": func(r *Request) { r.Method = "PUT" },
+		"path":   func(r *Request) { r.Path = "/payments/authorize" },
+		"key":    func(r *Request) { r.IdempotencyKey = "order-2" },
+		"body":   func(r *Request) { r.Body = []byte(`{"amount": 900, "currency": "GHS"}`) },
+	}
+	for name, tamper := range tampered {
+		req := signed
+		tamper(&req)
+		if err := testVerifier(t).Verify("bank", ts(now), sig, req); !errors.Is(err, ErrInvalidSignature) {
+			t.Errorf("%s changed: expected ErrInvalidSignature, got %v", name, err)
+		}
+	}
+
+	// Moving the timestamp to keep an old request fresh breaks the signature too.
+	if err := testVerifier(t).Verify("bank", ts(now.Add(time.Second)), sig, signed); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("timestamp changed: expected ErrInvalidSignature, got %v", err)
+	}
+	if err := testVerifier(t).Verify("bank", ts(now), Sign("some-other-secret-of-enough-length!!", signed), signed); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("wrong secret: expected ErrInvalidSignature, got %v", err)
+	}
+}
+
+func TestVerify_ClockSkew(t *testing.T) {
+	for _, c := range []struct {
+		skew time.Duration
+		want error
+	}{
+		{0, nil},
+		{-5 * time.Minute, nil}, // signer's clock behind ours, right at the edge
+		{5 * time.Minute, nil},  // and ahead
+		{-5*time.Minute - time.Second, ErrStaleTimestamp},
+		{5*time.Minute + time.Second, ErrStaleTimestamp},
+		{-time.Hour, ErrStaleTimestamp},
+	} {
+		at := now.Add(c.skew)
+		req := testRequest(at)
+		if err := testVerifier(t).Verify("bank", ts(at), Sign(secret, req), req); !errors.Is(err, c.want) {
+			t.Errorf("skew %s: expected %v, got %v", c.skew, c.want, err)
+		}
+	}
+}
+
+func TestVerify_RejectsReplay(t *testing.T) {
+	v := testVerifier(t)
+	req := testRequest(now)
+	sig := Sign(secret, req)
+
+	if err := v.Verify("bank", ts(now), sig, req); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.Verify("bank", ts(now), sig, req); !errors.Is(err, ErrReplayed) {
+		t.Errorf("expected ErrReplayed, got %v", err)
+	}
+
+	// A retry signed afresh is fine, it's the idempotency key that dedupes it.
+	later := now.Add(time.Second)
+	v.now = func() time.Time { return later }
+	retry := testRequest(later)
+	if err := v.Verify("bank", ts(later), Sign(secret, retry), retry); err != nil {
+		t.Errorf("expected a re-signed retry to pass, got %v", err)
+	}
+}
+
+func TestVerify_BadSignatureIsNotRemembered(t *testing.T) {
+	v := testVerifier(t)
+	req := testRequest(now)
+	v.Verify("bank", ts(now), "v1=deadbeef", req)
+	if err := v.Verify("bank", ts(now), Sign(secret, req), req); err != nil {
+		t.Errorf("expected the real signature to still work, got %v", err)
+	}
+}
+
+func TestVerify_PrunesOldSignatures(t *testing.T) {
+	v := testVerifier(t)
+	req := testRequest(now)
+	v.Verify("bank", ts(now), Sign(secret, req), req)
+
+	v.now = func() time.Time { return now.Add(10 * time.Minute) }
+	later := testRequest(now.Add(10 * time.Minute))
+	v.Verify("bank", ts(later.Timestamp), Sign(secret, later), later)
+
+	if len(v.seen) != 1 {
+		t.Errorf("expected only the fresh signature remembered, got %d", len(v.seen))
+	}
+}
+
+func TestVerify_SecretRotation(t *testing.T) {
+	v := testVerifier(t,
+		Secret{ID: "bank-old", Merchant: "bank", Secret: secret},
+		Secret{ID: "bank-new", Merchant: "bank", Secret: newSecret},
+	)
+	req := testRequest(now)
+	if err := v.Verify("bank", ts(now), Sign(newSecret, req), req); err != nil {
+		t.Errorf("expected the new secret to work, got %v", err)
+	}
+
+	req.IdempotencyKey = "order-2"
+	both := Sign(secret, req) + " " + Sign(newSecret, req)
+	if err := v.Verify("bank", ts(now), both, req); err != nil {
+		t.Errorf("expected either of two signatures to do, got %v", err)
+	}
+}
+
+func TestVerify_RejectsReplayWithOneOfTwoSignatures(t *testing.T) {
+	v := testVerifier(t,
+		Secret{ID: "bank-old", Merchant: "bank", Secret: secret},
+		Secret{ID: "bank-new", Merchant: "bank", Secret: newSecret},
+	)
+	req := testRequest(now)
+	old, fresh := Sign(secret, req), Sign(newSecret, req)
+	if err := v.Verify("bank", ts(now), old+" "+fresh, req); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, sig := range []string{old, fresh, fresh + " " + old} {
+		if err := v.Verify("bank", ts(now), sig, req); !errors.Is(err, ErrReplayed) {
+			t.Errorf("signature %q: expected ErrReplayed, got %v", sig, err)
+		}
+	}
+}
+
+func TestVerify_OtherMerchantsSecret(t *testing.T) {
+	v := testVerifier(t,
+		Secret{ID: "bank-1", Merchant: "bank", Secret: secret},
+		Secret{ID: "other-1", Merchant: "other", Secret: newSecret},
+	)
+	req := testRequest(now)
+	if err := v.Verify("other", ts(now), Sign(secret, req), req); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("expected bank's secret not to sign for other, got %v", err)
+	}
+	if v.Requires("acme") || !v.Requires("bank") {
+		t.Error("expected only merchants with a secret to require signing")
+	}
+}
+
+func TestVerify_MissingHeaders(t *testing.T) {
+	req := testRequest(now)
+	for _, c := range [][2]string{{"", Sign(secret, req)}, {ts(now), ""}} {
+		if err := testVerifier(t).Verify("bank", c[0], c[1], req); !errors.Is(err, ErrMissingSignature) {
+			t.Errorf("expected ErrMissingSignature, got %v", err)
+		}
+	}
+	if err := testVerifier(t).Verify("bank", "yesterday", Sign(secret, req), req); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("expected a garbled timestamp to be invalid, got %v", err)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	write := func(content string) string {
+		path := filepath.Join(t.TempDir(), "secrets.json")
+		os.WriteFile(path, []byte(content), 0o600)
+		return path
+	}
+
+	secrets, err := Load(write(`[{"id": "bank-1", "merchant": "bank", "secret": "` + secret + `"}]`))
+	if err != nil || len(secrets) != 1 || secrets[0].Merchant != "bank" {
+		t.Fatalf("unexpected %+v, %v", secrets, err)
+	}
+
+	for name, content := range map[string]string{
+		"short secret": `[{"id": "a", "secret": "short"}]`,
+		"no id":        `[{"secret": "` + secret + `"}]`,
+		"duplicate id": `[{"id": "a", "secret": "` + secret + `"}, {"id": "a", "secret": "` + newSecret + `"}]`,
+		"unknown":      `[{"id": "a", "secret": "` + secret + `", "algorithm": "md5"}]`,
+	} {
+		if _, err := Load(write(content)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
@@ -0,0 +1,248 @@
+// Package snapshot copies idempotency state between gateways. Export
+// writes every key in a store to a portable file, Import loads one into
+// any store.Store, so moving to a new host doesn't mean forgetting which
+// payments have already been made.
+//
+// The file is JSON lines: a header, one record per key, then a trailer
+// with the number of records, so a file cut short is noticed even when it
+// happens to end at a line break.
+//
+// Response bodies are written as the store hands them back, so export
+// through the same wrappers the gateway uses and they come out decrypted
+// and decompressed, readable by a gateway with different keys. That also
+// means the file holds full payment responses and should be handled like
+// the store itself.
+package snapshot
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/GordenArcher/Idempotency-Gateway/models"
+	"github.com/GordenArcher/Idempotency-Gateway/store"
+)
+
+const (
+	// Format is in every header, so something else's JSON lines can't be
+	// imported by mistake.
+	Format = "idempotency-gateway-snapshot"
+
+	// Version is bumped whenever Record changes in a way an older Import
+	// couldn't read.
+	Version = 1
+)
+
+// exportPageSize is how many keys Export reads from the store at a time.
+const exportPageSize = 500
+
+// Header is the first line of a snapshot.
+type Header struct {
+	Format     string    `json:"format"`
+	Version    int       `json:"version"`
+	ExportedAt time.Time `json:"exported_at"`
+	KeyTTL     string    `json:"key_ttl"` // of the exporting gateway, for whoever reads the file
+}
+
+// Record is one key. ExpiresAt is when the exporting gateway would have
+// dropped it.
+type Record struct {
+	Key          string          `json:"key"`
+	State        models.KeyState `json:"state"`
+	Fingerprint  string          `json:"fingerprint"`
+	StatusCode   int             `json:"status_code,omitempty"`
+	Headers      http.Header     `json:"headers,omitempty"`
+	ResponseBody []byte          `json:"response_body,omitempty"`
+	CreatedAt    time.Time       `json:"created_at"`
+	ExpiresAt    time.Time       `json:"expires_at"`
+}
+
+// trailer is the last line of a snapshot.
+type trailer struct {
+	End     bool `json:"end"`
+	Records int  `json:"records"`
+}
+
+// Export writes every key in s to w and returns how many it wrote. ttl is
+// the store's key TTL, for the records' expiry. Keys come out in order a
+// page at a time, so a store that's serving while this runs ends up in the
+// file as it was somewhere between the start and the end.
+func Export(w io.Writer, s store.Store, ttl time.Duration) (int, error) {
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+
+	err := enc.Encode(Header{
+		Format:     Format,
+		Version:    Version,
+		ExportedAt: time.Now().UTC(),
+		KeyTTL:     ttl.String(),
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	written := 0
+	opts := store.ListOptions{Limit: exportPageSize}
+	for {
+		page := s.List(opts)
+		for _, e := range page.Entries {
+			if e.Entry.KeyID != "" || e.Entry.Encoding != "" {
+				// Only this gateway's wrappers can read these, the file
+				// wouldn't be portable.
+				return written, fmt.Errorf("key %q is still encrypted or compressed, export through the wrapping store", e.Key)
+			}
+			created := time.Unix(e.Entry.CreatedAt, 0).UTC()
+			err := enc.Encode(Record{
+				Key:          e.Key,
+				State:        e.Entry.State,
+				Fingerprint:  e.Entry.BodyHash,
+				StatusCode:   e.Entry.StatusCode,
+				Headers:      e.Entry.Headers,
+				ResponseBody: e.Entry.ResponseBody,
+				CreatedAt:    created,
+				ExpiresAt:    created.Add(ttl),
+			})
+			if err != nil {
+				return written, err
+			}
+			written++
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		opts.After = page.NextCursor
+	}
+	if err := enc.Encode(trailer{End: true, Records: written}); err != nil {
+		return written, err
+	}
+	return written, bw.Flush()
+}
+
+// ImportResult counts what Import did with each record.
+type ImportResult struct {
+	Imported   int `json:"imported"`
+	Expired    int `json:"skipped_expired"`
+	Processing int `json:"skipped_processing"`
+	Newer      int `json:"skipped_newer"`
+}
+
+// Import reads a snapshot from r into s. The whole file is read and checked
+// before anything is written, so a truncated or corrupt file imports
+// nothing. Then each record is skipped if:
+//
+//   - it has expired
+//   - it's PROCESSING, its request was running on the old gateway and
+//     will never finish here, anyone waiting on it would wait forever
+//   - s already has the key, written at the same time or later, or still
+//     PROCESSING. What's there is newer than the file
+//
+// That last one makes importing the same file twice harmless. It's checked
+// with SetIfAbsentOrOlder, in the same step as the write, so the gateway
+// can keep serving while a file is imported: a request that reserves a key
+// just before its record is written keeps it.
+func Import(r io.Reader, s store.Store) (ImportResult, error) {
+	records, err := read(r)
+	if err != nil {
+		return ImportResult{}, err
+	}
+
+	var result ImportResult
+	now := time.Now()
+	for _, rec := range records {
+		switch {
+		case !rec.ExpiresAt.After(now):
+			result.Expired++
+			continue
+		case rec.State != models.StateComplete:
+			result.Processing++
+			continue
+		}
+
+		stored := s.SetIfAbsentOrOlder(rec.Key, &models.CachedEntry{
+			State:        rec.State,
+			BodyHash:     rec.Fingerprint,
+			StatusCode:   rec.StatusCode,
+			ResponseBody: rec.ResponseBody,
+			Headers:      rec.Headers,
+			CreatedAt:    rec.CreatedAt.Unix(),
+		})
+		if !stored {
+			result.Newer++
+			continue
+		}
+		result.Imported++
+	}
+	return result, nil
+}
+
+// Check reads a whole snapshot without importing it and returns how many
+// records it holds. An export that was cut short fails here, before the
+// gateway it came from is switched off.
+func Check(r io.Reader) (int, error) {
+	records, err := read(r)
+	return len(records), err
+}
+
+// read decodes and checks a whole snapshot.
+func read(r io.Reader) ([]Record, error) {
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+
+	var header Header
+	if err := dec.Decode(&header); err != nil {
+		return nil, fmt.Errorf("reading snapshot header: %w", err)
+	}
+	if header.Format != Format {
+		return nil, fmt.Errorf("not a snapshot file, format is %q", header.Format)
+	}
+	if header.Version != Version {
+		return nil, fmt.Errorf("snapshot version %d is not supported, this gateway reads version %d", header.Version, Version)
+	}
+
+	var records []Record
+	seen := make(map[string]bool)
+	for {
+		var line json.RawMessage
+		err := dec.Decode(&line)
+		if errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("snapshot ends after %d records without its trailer, the export was cut short", len(records))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading snapshot record %d: %w", len(records)+1, err)
+		}
+
+		var end trailer
+		if json.Unmarshal(line, &end) == nil && end.End {
+			if end.Records != len(records) {
+				return nil, fmt.Errorf("snapshot has %d records, its trailer says %d", len(records), end.Records)
+			}
+			if dec.More() {
+				return nil, errors.New("snapshot has data after its trailer")
+			}
+			return records, nil
+		}
+
+		var rec Record
+		strict := json.NewDecoder(bytes.NewReader(line))
+		strict.DisallowUnknownFields()
+		if err := strict.Decode(&rec); err != nil {
+			return nil, fmt.Errorf("reading snapshot record %d: %w", len(records)+1, err)
+		}
+
+		switch {
+		case rec.Key == "":
+			return nil, fmt.Errorf("snapshot record %d: key is empty", len(records)+1)
+		case seen[rec.Key]:
+			return nil, fmt.Errorf("snapshot record %d: key %q appears twice", len(records)+1, rec.Key)
+		case rec.State != models.StateComplete && rec.State != models.StateProcessing:
+			return nil, fmt.Errorf("snapshot record %d: unknown state %q", len(records)+1, rec.State)
+		}
+		seen[rec.Key] = true
+		records = append(records, rec)
+	}
+}
@@ -0,0 +1,192 @@
+package snapshot
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/GordenArcher/Idempotency-Gateway/models"
+	"github.com/GordenArcher/Idempotency-Gateway/store"
+)
+
+func entry(body string, createdAt time.Time) *models.CachedEntry {
+	return &models.CachedEntry{
+		State:        models.StateComplete,
+		BodyHash:     "fingerprint-" + body,
+		StatusCode:   http.StatusCreated,
+		ResponseBody: []byte(body),
+		Headers:      http.Header{"Location": {"/payments/pay_1"}},
+		CreatedAt:    createdAt.Unix(),
+	}
+}
+
+func export(t *testing.T, s store.Store, ttl time.Duration) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if _, err := Export(&buf, s, ttl); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestExportImport_RoundTrip(t *testing.T) {
+	now := time.Now()
+	src := store.NewMemoryStore(time.Hour)
+	src.Set("a", entry(`{"id":"a"}`, now))
+	src.Set("b", entry(`{"id":"b"}`, now.Add(-time.Minute)))
+
+	data := export(t, src, time.Hour)
+	if n, err := Check(bytes.NewReader(data)); err != nil || n != 2 {
+		t.Fatalf("expected 2 records, got %d, %v", n, err)
+	}
+
+	dst := store.NewMemoryStore(time.Hour)
+	result, err := Import(bytes.NewReader(data), dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result != (ImportResult{Imported: 2}) {
+		t.Errorf("unexpected result %+v", result)
+	}
+
+	got, want := dst.Get("b"), src.Get("b")
+	if got.BodyHash != want.BodyHash || got.StatusCode != want.StatusCode || got.CreatedAt != want.CreatedAt ||
+		string(got.ResponseBody) != string(want.ResponseBody) || got.Headers.Get("Location") != "/payments/pay_1" {
+		t.Errorf("entry changed in transit: %+v vs %+v", got, want)
+	}
+
+	// Importing the same file again changes nothing.
+	again, err := Import(bytes.NewReader(data), dst)
+	if err != nil || again != (ImportResult{Newer: 2}) {
+		t.Errorf("expected a second import to skip everything, got %+v, %v", again, err)
+	}
+}
+
+func TestImport_SkipsExpiredProcessingAndNewer(t *testing.T) {
+	now := time.Now()
+	src := store.NewMemoryStore(time.Hour)
+	src.Set("expired", entry("old", now.Add(-2*time.Hour)))
+	src.Set("processing", &models.CachedEntry{State: models.StateProcessing, BodyHash: "x", CreatedAt: now.Unix()})
+	src.Set("newer-there", entry("from file", now.Add(-time.Minute)))
+	src.Set("older-there", entry("from file", now.Add(-time.Minute)))
+	src.Set("in-flight-there", entry("from file", now.Add(-time.Minute)))
+
+	dst := store.NewMemoryStore(time.Hour)
+	dst.Set("newer-there", entry("kept", now))
+	dst.Set("older-there", entry("replaced", now.Add(-10*time.Minute)))
+	dst.Set("in-flight-there", &models.CachedEntry{State: models.StateProcessing, BodyHash: "y", CreatedAt: now.Add(-time.Hour).Unix()})
+
+	result, err := Import(bytes.NewReader(export(t, src, time.Hour)), dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result != (ImportResult{Imported: 1, Expired: 1, Processing: 1, Newer: 2}) {
+		t.Errorf("unexpected result %+v", result)
+	}
+
+	if dst.Get("expired") != nil || dst.Get("processing") != nil {
+		t.Error("expected expired and PROCESSING records not to be imported")
+	}
+	if string(dst.Get("newer-there").ResponseBody) != "kept" {
+		t.Error("a newer record was overwritten")
+	}
+	if dst.Get("in-flight-there").State != models.StateProcessing {
+		t.Error("an in-flight key was overwritten")
+	}
+	if string(dst.Get("older-there").ResponseBody) != "from file" {
+		t.Error("expected an older record to be replaced")
+	}
+}
+
+// racingStore has a live request reserve every key the moment Import
+// looks at it, after it's been read and before it's written.
+type racingStore struct {
+	*store.MemoryStore
+}
+
+func (rs racingStore) reserve(key string) {
+	rs.MemoryStore.Set(key, &models.CachedEntry{State: models.StateProcessing, BodyHash: "live", CreatedAt: time.Now().Unix()})
+}
+
+func (rs racingStore) Get(key string) *models.CachedEntry {
+	entry := rs.MemoryStore.Get(key)
+	rs.reserve(key)
+	return entry
+}
+
+func (rs racingStore) SetIfAbsentOrOlder(key string, entry *models.CachedEntry) bool {
+	rs.reserve(key)
+	return rs.MemoryStore.SetIfAbsentOrOlder(key, entry)
+}
+
+func TestImport_KeepsKeysReservedWhileImporting(t *testing.T) {
+	src := store.NewMemoryStore(time.Hour)
+	src.Set("pay-1", entry("from file", time.Now().Add(-time.Minute)))
+
+	dst := racingStore{store.NewMemoryStore(time.Hour)}
+	result, err := Import(bytes.NewReader(export(t, src, time.Hour)), dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := dst.MemoryStore.Get("pay-1"); got.State != models.StateProcessing || got.BodyHash != "live" {
+		t.Errorf("expected the live request's reservation to be kept, got %+v", got)
+	}
+	if result != (ImportResult{Newer: 1}) {
+		t.Errorf("expected the record skipped as newer, got %+v", result)
+	}
+}
+
+func TestImport_RejectsBrokenFilesWithoutWriting(t *testing.T) {
+	src := store.NewMemoryStore(time.Hour)
+	src.Set("a", entry("a", time.Now()))
+	src.Set("b", entry("b", time.Now()))
+	good := string(export(t, src, time.Hour))
+	lines := strings.SplitAfter(good, "\n")
+
+	cases := map[string]string{
+		"empty":          "",
+		"not a snapshot": `{"format": "something-else", "version": 1}` + "\n",
+		"future version": strings.Replace(good, `"version":1`, `"version":2`, 1),
+		"no trailer":     strings.Join(lines[:3], ""),
+		"cut mid-record": good[:len(lines[0])+len(lines[1])/2],
+		"wrong count":    strings.Replace(good, `"records":2`, `"records":3`, 1),
+		"after trailer":  good + lines[1],
+		"duplicate key":  lines[0] + lines[1] + lines[1] + `{"end":true,"records":2}` + "\n",
+		"unknown field":  strings.Replace(good, `"key":"a"`, `"key":"a","extra":1`, 1),
+		"unknown state":  strings.Replace(good, `"state":"COMPLETE"`, `"state":"DONE"`, 1),
+	}
+	for name, data := range cases {
+		dst := store.NewMemoryStore(time.Hour)
+		if _, err := Import(strings.NewReader(data), dst); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+		if dst.Stats().Keys != 0 {
+			t.Errorf("%s: expected nothing imported", name)
+		}
+	}
+}
+
+func TestExport_ThroughWrappersIsPortable(t *testing.T) {
+	mem := store.NewMemoryStore(time.Hour)
+	wrapped, err := store.NewEncryptedStore(mem, []store.EncryptionKey{{ID: "old-host", Key: bytes.Repeat([]byte{1}, 32)}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wrapped.Set("a", entry(`{"id":"a"}`, time.Now()))
+
+	if _, err := Export(&bytes.Buffer{}, mem, time.Hour); err == nil {
+		t.Error("expected exporting encrypted entries straight from the backend to fail")
+	}
+
+	// A new host with its own key reads what the old one exported.
+	dst, _ := store.NewEncryptedStore(store.NewMemoryStore(time.Hour), []store.EncryptionKey{{ID: "new-host", Key: bytes.Repeat([]byte{2}, 32)}})
+	if _, err := Import(bytes.NewReader(export(t, wrapped, time.Hour)), dst); err != nil {
+		t.Fatal(err)
+	}
+	if got := dst.Get("a"); string(got.ResponseBody) != `{"id":"a"}` {
+		t.Errorf("unexpected body %q", got.ResponseBody)
+	}
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/GordenArcher/Idempotency-Gateway/snapshot"
+)
+
+const snapshotUsage = `usage:
+  gateway snapshot export [flags] [-o file]   write a running gateway's keys to file, or stdout
+  gateway snapshot import [flags] [file]      load file, or stdin, into a running gateway
+
+The store lives in the gateway's memory, so both talk to its /admin/snapshot
+endpoint. Piping one into the other copies keys straight across:
+
+  gateway snapshot export -url https://old:8080 | gateway snapshot import -url https://new:8080
+
+flags:
+`
+
+// snapshotCommand runs "gateway snapshot ..." and returns the exit code.
+func snapshotCommand(args []string) int {
+	fs := flag.NewFlagSet("snapshot", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), snapshotUsage)
+		fs.PrintDefaults()
+	}
+	url := fs.String("url", "http://localhost:8080", "gateway to export from or import into")
+	token := fs.String("token", os.Getenv("GATEWAY_ADMIN_TOKEN"), "admin token, defaults to $GATEWAY_ADMIN_TOKEN")
+	out := fs.String("o", "-", "export: file to write, - for stdout")
+	caFile := fs.String("cacert", "", "PEM CAs to verify the gateway's certificate with")
+	certFile := fs.String("cert", "", "PEM client certificate, for a gateway with mutual TLS")
+	keyFile := fs.String("key", "", "PEM key for -cert")
+
+	if len(args) == 0 {
+		fs.Usage()
+		return 2
+	}
+	action := args[0]
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+	if *token == "" {
+		fmt.Fprintln(os.Stderr, "snapshot: no admin token, pass -token or set GATEWAY_ADMIN_TOKEN")
+		return 2
+	}
+
+	client, err := snapshotClient(*caFile, *certFile, *keyFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "snapshot:", err)
+		return 1
+	}
+	endpoint := strings.TrimSuffix(*url, "/") + "/admin/snapshot"
+
+	switch action {
+	case "export":
+		err = exportSnapshot(client, endpoint, *token, *out)
+	case "import":
+		in := "-"
+		if fs.NArg() > 0 {
+			in = fs.Arg(0)
+		}
+		err = importSnapshot(client, endpoint, *token, in)
+	default:
+		fs.Usage()
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "snapshot:", err)
+		return 1
+	}
+	return 0
+}
+
+// exportSnapshot downloads the snapshot and checks it parses to the end
+// before writing it out, so a partial file never looks like a good one.
+func exportSnapshot(client *http.Client, endpoint, token, out string) error {
+	body, err := snapshotRequest(client, http.MethodGet, endpoint, token, nil)
+	if err != nil {
+		return err
+	}
+	n, err := snapshot.Check(bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("export is incomplete, check the gateway's logs: %w", err)
+	}
+
+	if out == "-" {
+		_, err = os.Stdout.Write(body)
+	} else {
+		// It's full payment responses, only the owner should read it.
+		err = os.WriteFile(out, body, 0o600)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "exported %d keys\n", n)
+	return nil
+}
+
+func importSnapshot(client *http.Client, endpoint, token, in string) error {
+	var data []byte
+	var err error
+	if in == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(in)
+	}
+	if err != nil {
+		return err
+	}
+
+	body, err := snapshotRequest(client, http.MethodPost, endpoint, token, data)
+	if err != nil {
+		return err
+	}
+	var result snapshot.ImportResult
+	if err := json.Unmarshal(body, &result); err != nil {
+		return fmt.Errorf("unexpected response from the gateway: %w", err)
+	}
+	fmt.Fprintf(os.Stderr, "imported %d keys, skipped %d expired, %d still processing, %d already newer on the gateway\n",
+		result.Imported, result.Expired, result.Processing, result.Newer)
+	return nil
+}
+
+func snapshotRequest(client *http.Client, method, endpoint, token string, body []byte) ([]byte, error) {
+	req, err := http.NewRequest(method, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		var e struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(data, &e) == nil && e.Error != "" {
+			return nil, fmt.Errorf("%s: %s", resp.Status, e.Error)
+		}
+		return nil, errors.New(resp.Status)
+	}
+	return data, nil
+}
+
+func snapshotClient(caFile, certFile, keyFile string) (*http.Client, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates in %s", caFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	// No overall timeout, a big store takes a while, but a gateway that
+	// never answers shouldn't hang the migration.
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	transport.ResponseHeaderTimeout = 5 * time.Minute
+	return &http.Client{Transport: transport}, nil
+}
@@ -0,0 +1,211 @@
+package store
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+
+	"github.com/GordenArcher/Idempotency-Gateway/models"
+)
+
+// Codec compresses response bodies. Name is what goes in an entry's
+// Encoding, so it mustn't change once entries have been written with it.
+type Codec interface {
+	Name() string
+	Compress(src []byte) ([]byte, error)
+	Decompress(src []byte) ([]byte, error)
+}
+
+// CodecByName returns one of the built-in codecs, "gzip" or "deflate".
+func CodecByName(name string) (Codec, error) {
+	switch name {
+	case "gzip":
+		return gzipCodec, nil
+	case "deflate":
+		return deflateCodec, nil
+	}
+	return nil, fmt.Errorf("unknown compression codec %q, use gzip or deflate", name)
+}
+
+// streamCodec is a Codec over one of the compress packages. Writers
+// allocate hundreds of kilobytes of state, so they're pooled.
+type streamCodec struct {
+	name      string
+	writers   sync.Pool
+	newReader func(io.Reader) (io.ReadCloser, error)
+}
+
+var (
+	gzipCodec = &streamCodec{
+		name:      "gzip",
+		writers:   sync.Pool{New: func() any { return gzip.NewWriter(nil) }},
+		newReader: func(r io.Reader) (io.ReadCloser, error) { return gzip.NewReader(r) },
+	}
+	deflateCodec = &streamCodec{
+		name: "deflate",
+		writers: sync.Pool{New: func() any {
+			w, _ := flate.NewWriter(nil, flate.DefaultCompression) // only fails for a bad level
+			return w
+		}},
+		newReader: func(r io.Reader) (io.ReadCloser, error) { return flate.NewReader(r), nil },
+	}
+)
+
+type resetWriter interface {
+	io.WriteCloser
+	Reset(io.Writer)
+}
+
+func (c *streamCodec) Name() string { return c.name }
+
+func (c *streamCodec) Compress(src []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := c.writers.Get().(resetWriter)
+	defer c.writers.Put(w)
+
+	w.Reset(&buf)
+	if _, err := w.Write(src); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	// The buffer has grown past what it holds, and the spare capacity
+	// would sit in the store for the key's whole TTL.
+	return bytes.Clone(buf.Bytes()), nil
+}
+
+func (c *streamCodec) Decompress(src []byte) ([]byte, error) {
+	r, err := c.newReader(bytes.NewReader(src))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
+
+// CompressionStats is what CompressedStore has done since startup, for /metrics.
+type CompressionStats struct {
+	Compressed  uint64 // bodies stored compressed
+	Skipped     uint64 // bodies at or over the threshold that didn't get smaller, stored as they were
+	InputBytes  uint64 // size of the compressed bodies before compression
+	OutputBytes uint64 // and after
+}
+
+// CompressedStore wraps another Store so response bodies over a size
+// threshold are held compressed, with the codec's name in the entry's
+// Encoding. Small bodies aren't worth the CPU, a typical payment
+// response is a few hundred bytes and stays as it is.
+//
+// When bodies are also encrypted, this goes on the outside: ciphertext
+// doesn't compress.
+type CompressedStore struct {
+	Store
+
+	codec     Codec
+	threshold int
+
+	compressed  atomic.Uint64
+	skipped     atomic.Uint64
+	inputBytes  atomic.Uint64
+	outputBytes atomic.Uint64
+}
+
+// NewCompressedStore compresses bodies of threshold bytes or more with codec.
+func NewCompressedStore(s Store, codec Codec, threshold int) *CompressedStore {
+	return &CompressedStore{Store: s, codec: codec, threshold: threshold}
+}
+
+func (cs *CompressedStore) Get(key string) *models.CachedEntry {
+	return cs.open(cs.Store.Get(key))
+}
+
+func (cs *CompressedStore) WaitForComplete(key string) *models.CachedEntry {
+	return cs.open(cs.Store.WaitForComplete(key))
+}
+
+func (cs *CompressedStore) Set(key string, entry *models.CachedEntry) {
+	cs.Store.Set(key, cs.compress(entry))
+}
+
+func (cs *CompressedStore) SetIfAbsentOrOlder(key string, entry *models.CachedEntry) bool {
+	return cs.Store.SetIfAbsentOrOlder(key, cs.compress(entry))
+}
+
+// compress returns entry as it's held in the wrapped store, body
+// compressed if it's big enough and compressing helps.
+func (cs *CompressedStore) compress(entry *models.CachedEntry) *models.CachedEntry {
+	if entry == nil || len(entry.ResponseBody) == 0 || len(entry.ResponseBody) < cs.threshold {
+		return entry
+	}
+
+	packed, err := cs.codec.Compress(entry.ResponseBody)
+	if err != nil || len(packed) >= len(entry.ResponseBody) {
+		if err != nil {
+			slog.Error("failed to compress response body", "codec", cs.codec.Name(), "error", err)
+		}
+		cs.skipped.Add(1)
+		return entry
+	}
+	cs.compressed.Add(1)
+	cs.inputBytes.Add(uint64(len(entry.ResponseBody)))
+	cs.outputBytes.Add(uint64(len(packed)))
+
+	stored := *entry
+	stored.ResponseBody = packed
+	stored.Encoding = cs.codec.Name()
+	return &stored
+}
+
+func (cs *CompressedStore) List(opts ListOptions) ListResult {
+	result := cs.Store.List(opts)
+	for i, e := range result.Entries {
+		result.Entries[i].Entry = cs.open(e.Entry)
+	}
+	return result
+}
+
+// CompressionStats reports how much compression has saved so far.
+func (cs *CompressedStore) CompressionStats() CompressionStats {
+	return CompressionStats{
+		Compressed:  cs.compressed.Load(),
+		Skipped:     cs.skipped.Load(),
+		InputBytes:  cs.inputBytes.Load(),
+		OutputBytes: cs.outputBytes.Load(),
+	}
+}
+
+// open returns entry with its body decompressed. Like EncryptedStore, a
+// body that can't be read comes back as a 500 rather than as a missing key.
+func (cs *CompressedStore) open(entry *models.CachedEntry) *models.CachedEntry {
+	if entry == nil || entry.Encoding == "" {
+		return entry
+	}
+
+	codec := cs.codec
+	if entry.Encoding != codec.Name() {
+		// Written before the codec was changed, read it with the old one.
+		c, err := CodecByName(entry.Encoding)
+		if err != nil {
+			slog.Error("failed to decompress stored response body", "encoding", entry.Encoding, "error", err)
+			return unreadable(entry)
+		}
+		codec = c
+	}
+
+	body, err := codec.Decompress(entry.ResponseBody)
+	if err != nil {
+		slog.Error("failed to decompress stored response body", "encoding", entry.Encoding, "error", err)
+		return unreadable(entry)
+	}
+
+	plain := *entry
+	plain.ResponseBody = body
+	plain.Encoding = ""
+	return &plain
+}
@@ -0,0 +1,219 @@
+package store
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/GordenArcher/Idempotency-Gateway/models"
+)
+
+// largeBody is the kind of response compression is for: tens of kilobytes
+// of JSON with the same field names over and over.
+func largeBody() []byte {
+	type item struct {
+		SKU         string `json:"sku"`
+		Description string `json:"description"`
+		Quantity    int    `json:"quantity"`
+		Amount      string `json:"amount"`
+	}
+	resp := struct {
+		ID       string `json:"id"`
+		Status   string `json:"status"`
+		Currency string `json:"currency"`
+		Items    []item `json:"items"`
+	}{ID: "pay_0a7ab53df46edf9f61f57c2daf8c154e", Status: "success", Currency: "GHS"}
+	for i := 0; i < 250; i++ {
+		resp.Items = append(resp.Items, item{
+			SKU:         fmt.Sprintf("SKU-%06d", i*7919%1000000),
+			Description: fmt.Sprintf("Line item %d, standard delivery", i),
+			Quantity:    1 + i%5,
+			Amount:      fmt.Sprintf("%d.%02d", 10+i*37%500, i%100),
+		})
+	}
+	b, _ := json.Marshal(resp)
+	return b
+}
+
+func entryWithBody(body []byte) *models.CachedEntry {
+	return &models.CachedEntry{
+		State:        models.StateComplete,
+		BodyHash:     "abc123",
+		StatusCode:   201,
+		ResponseBody: body,
+		CreatedAt:    time.Now().Unix(),
+	}
+}
+
+func TestCompressedStore_RoundTrip(t *testing.T) {
+	for _, name := range []string{"gzip", "deflate"} {
+		codec, err := CodecByName(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		mem := newTestStore()
+		cs := NewCompressedStore(mem, codec, 1024)
+		body := largeBody()
+
+		cs.Set("key-001", entryWithBody(body))
+
+		raw := mem.Get("key-001")
+		if raw.Encoding != name || len(raw.ResponseBody) >= len(body)/4 {
+			t.Errorf("%s: expected the body stored compressed, got %d of %d bytes", name, len(raw.ResponseBody), len(body))
+		}
+		if got := cs.Get("key-001"); !bytes.Equal(got.ResponseBody, body) || got.Encoding != "" {
+			t.Errorf("%s: body didn't survive the round trip", name)
+		}
+		if page := cs.List(ListOptions{}); !bytes.Equal(page.Entries[0].Entry.ResponseBody, body) {
+			t.Errorf("%s: expected List to decompress entries", name)
+		}
+	}
+}
+
+func TestCompressedStore_Threshold(t *testing.T) {
+	mem := newTestStore()
+	cs := NewCompressedStore(mem, gzipCodec, 1024)
+
+	cs.Set("small", makeEntry(models.StateComplete))
+	cs.Set("processing", &models.CachedEntry{State: models.StateProcessing, BodyHash: "abc123"})
+	if mem.Get("small").Encoding != "" || mem.Get("processing").Encoding != "" {
+		t.Error("expected bodies under the threshold stored as they are")
+	}
+
+	cs.Set("large", entryWithBody(bytes.Repeat([]byte{'0'}, 2048)))
+	if mem.Get("large").Encoding != "gzip" {
+		t.Error("expected a body over the threshold stored compressed")
+	}
+
+	stats := cs.CompressionStats()
+	if stats.Compressed != 1 || stats.InputBytes != 2048 || stats.OutputBytes >= 100 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestCompressedStore_SkipsBodiesThatDontShrink(t *testing.T) {
+	mem := newTestStore()
+	cs := NewCompressedStore(mem, gzipCodec, 16)
+
+	// Already-compressed bytes only grow when compressed again.
+	packed, _ := gzipCodec.Compress(largeBody())
+	cs.Set("key-001", entryWithBody(packed))
+
+	if mem.Get("key-001").Encoding != "" {
+		t.Error("expected a body that doesn't shrink stored as it is")
+	}
+	if stats := cs.CompressionStats(); stats.Skipped != 1 || stats.Compressed != 0 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestCompressedStore_ReadsEntriesFromAnotherCodec(t *testing.T) {
+	mem := newTestStore()
+	NewCompressedStore(mem, gzipCodec, 0).Set("key-001", entryWithBody(largeBody()))
+
+	cs := NewCompressedStore(mem, deflateCodec, 0)
+	if got := cs.Get("key-001"); !bytes.Equal(got.ResponseBody, largeBody()) {
+		t.Error("expected a gzip entry to be readable after switching to deflate")
+	}
+
+	corrupt := entryWithBody([]byte("not gzip"))
+	corrupt.Encoding = "gzip"
+	mem.Set("key-002", corrupt)
+	if got := cs.Get("key-002"); got.StatusCode != 500 || got.Encoding != "" {
+		t.Errorf("expected a corrupt body replayed as a 500, got %+v", got)
+	}
+}
+
+func TestCompressedStore_OverEncryptedStore(t *testing.T) {
+	mem := newTestStore()
+	cs := NewCompressedStore(newEncrypted(t, mem, testKey("k1", 1)), gzipCodec, 1024)
+	body := largeBody()
+
+	cs.Set("key-001", entryWithBody(body))
+
+	raw := mem.Get("key-001")
+	if raw.Encoding != "gzip" || raw.KeyID != "k1" || len(raw.ResponseBody) >= len(body)/4 {
+		t.Errorf("expected compressed then encrypted, got %s/%s with %d bytes", raw.Encoding, raw.KeyID, len(raw.ResponseBody))
+	}
+	if got := cs.Get("key-001"); !bytes.Equal(got.ResponseBody, body) {
+		t.Error("body didn't survive the round trip")
+	}
+}
+
+func TestCompressedStore_SetIfAbsentOrOlderEncodesToo(t *testing.T) {
+	// Snapshot imports go through the conditional set, those bodies must
+	// end up compressed and encrypted like any other.
+	mem := newTestStore()
+	cs := NewCompressedStore(newEncrypted(t, mem, testKey("k1", 1)), gzipCodec, 1024)
+	body := largeBody()
+
+	if !cs.SetIfAbsentOrOlder("key-001", entryWithBody(body)) {
+		t.Fatal("expected a free key to be set")
+	}
+
+	raw := mem.Get("key-001")
+	if raw.Encoding != "gzip" || raw.KeyID != "k1" {
+		t.Errorf("expected compressed then encrypted, got %q/%q", raw.Encoding, raw.KeyID)
+	}
+	if got := cs.Get("key-001"); !bytes.Equal(got.ResponseBody, body) {
+		t.Error("body didn't survive the round trip")
+	}
+}
+
+func TestCodecByName_RejectsUnknown(t *testing.T) {
+	if _, err := CodecByName("zstd"); err == nil {
+		t.Error("expected an error for an unknown codec")
+	}
+}
+
+// BenchmarkStoreMemory stores large responses and reports the heap each
+// one holds on to, with and without compression. Run it with
+//
+//	go test ./store -run '^$' -bench StoreMemory
+func BenchmarkStoreMemory(b *testing.B) {
+	body := largeBody()
+	stores := []struct {
+		name string
+		new  func() Store
+	}{
+		{"plain", func() Store { return newTestStore() }},
+		{"gzip", func() Store { return NewCompressedStore(newTestStore(), gzipCodec, 1024) }},
+		{"deflate", func() Store { return NewCompressedStore(newTestStore(), deflateCodec, 1024) }},
+	}
+
+	for _, tc := range stores {
+		b.Run(tc.name, func(b *testing.B) {
+			s := tc.new()
+			var before, after runtime.MemStats
+			runtime.GC()
+			runtime.ReadMemStats(&before)
+
+			for i := 0; i < b.N; i++ {
+				// A copy, as the middleware's recorder hands over its own buffer.
+				s.Set(fmt.Sprintf("key-%d", i), entryWithBody(bytes.Clone(body)))
+			}
+
+			b.StopTimer()
+			runtime.GC()
+			runtime.ReadMemStats(&after)
+			b.ReportMetric(float64(after.HeapAlloc-before.HeapAlloc)/float64(b.N), "heap-bytes/entry")
+			b.ReportMetric(float64(len(body)), "body-bytes")
+			runtime.KeepAlive(s)
+		})
+	}
+}
+
+// BenchmarkCompressedStore_Get is what a replay pays to decompress.
+func BenchmarkCompressedStore_Get(b *testing.B) {
+	cs := NewCompressedStore(newTestStore(), gzipCodec, 1024)
+	cs.Set("key-001", entryWithBody(largeBody()))
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		cs.Get("key-001")
+	}
+}
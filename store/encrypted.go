@@ -0,0 +1,237 @@
+package store
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/GordenArcher/Idempotency-Gateway/models"
+)
+
+// EncryptionKey is a key-encryption key as written in the keys file.
+// Key is 32 random bytes, base64 in the JSON.
+type EncryptionKey struct {
+	ID  string `json:"id"`
+	Key []byte `json:"key"`
+}
+
+const dataKeySize = 32 // AES-256
+
+// EncryptedStore wraps another Store so response bodies are only ever held
+// encrypted. Every body gets its own random data key, which is itself
+// encrypted with the key ring's first key and stored alongside it, with
+// that key's ID in the entry's KeyID. The other keys in the ring are only
+// used to decrypt, that's how keys are rotated: put the new one first, and
+// drop the old one once everything it encrypted has expired.
+//
+// Only ResponseBody is encrypted. The body hash, status and headers stay
+// readable, the middleware needs them before it needs the body.
+type EncryptedStore struct {
+	Store
+
+	primary string
+	keys    map[string]cipher.AEAD
+}
+
+func NewEncryptedStore(s Store, keys []EncryptionKey) (*EncryptedStore, error) {
+	if err := validateKeys(keys); err != nil {
+		return nil, err
+	}
+
+	es := &EncryptedStore{Store: s, primary: keys[0].ID, keys: make(map[string]cipher.AEAD, len(keys))}
+	for _, k := range keys {
+		aead, err := newAEAD(k.Key)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %w", k.ID, err)
+		}
+		es.keys[k.ID] = aead
+	}
+	return es, nil
+}
+
+func (es *EncryptedStore) Get(key string) *models.CachedEntry {
+	return es.open(key, es.Store.Get(key))
+}
+
+func (es *EncryptedStore) WaitForComplete(key string) *models.CachedEntry {
+	return es.open(key, es.Store.WaitForComplete(key))
+}
+
+func (es *EncryptedStore) Set(key string, entry *models.CachedEntry) {
+	es.Store.Set(key, es.encrypt(key, entry))
+}
+
+func (es *EncryptedStore) SetIfAbsentOrOlder(key string, entry *models.CachedEntry) bool {
+	return es.Store.SetIfAbsentOrOlder(key, es.encrypt(key, entry))
+}
+
+// encrypt returns entry as it's held in the wrapped store, body encrypted.
+func (es *EncryptedStore) encrypt(key string, entry *models.CachedEntry) *models.CachedEntry {
+	if entry == nil || len(entry.ResponseBody) == 0 {
+		return entry
+	}
+
+	sealed, err := es.seal(key, entry.ResponseBody)
+	if err != nil {
+		// Only possible if the system's random source fails. Storing the
+		// plaintext instead would defeat the point, and storing nothing
+		// would let a retry charge again, so the body is dropped and a
+		// replay gets the 500 from open.
+		slog.Error("failed to encrypt response body", "error", err)
+		sealed = nil
+	}
+
+	stored := *entry
+	stored.ResponseBody = sealed
+	stored.KeyID = es.primary
+	return &stored
+}
+
+func (es *EncryptedStore) List(opts ListOptions) ListResult {
+	result := es.Store.List(opts)
+	for i, e := range result.Entries {
+		result.Entries[i].Entry = es.open(e.Key, e.Entry)
+	}
+	return result
+}
+
+// open returns entry with its body decrypted. An entry that can't be
+// decrypted, because its key has left the ring or it's been tampered with,
+// comes back as a 500 rather than nil: nil would mean "never seen", and
+// the request would run, and charge, a second time.
+func (es *EncryptedStore) open(key string, entry *models.CachedEntry) *models.CachedEntry {
+	if entry == nil || entry.KeyID == "" {
+		return entry
+	}
+
+	body, err := es.decrypt(key, entry.KeyID, entry.ResponseBody)
+	if err != nil {
+		slog.Error("failed to decrypt stored response body", "key_id", entry.KeyID, "error", err)
+		return unreadable(entry)
+	}
+
+	plain := *entry
+	plain.ResponseBody = body
+	plain.KeyID = ""
+	return &plain
+}
+
+// seal encrypts body under a fresh data key. The result is the wrapped
+// data key followed by the encrypted body, each as nonce then ciphertext.
+// The store key is bound in as additional data, so a body copied under
+// another key won't decrypt.
+func (es *EncryptedStore) seal(key string, body []byte) ([]byte, error) {
+	dataKey := make([]byte, dataKeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, err
+	}
+	data, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	kek := es.keys[es.primary]
+	out, err := sealWith(kek, nil, dataKey, []byte(es.primary))
+	if err != nil {
+		return nil, err
+	}
+	return sealWith(data, out, body, []byte(key))
+}
+
+func (es *EncryptedStore) decrypt(key, keyID string, sealed []byte) ([]byte, error) {
+	kek, ok := es.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("key %s is not in the key ring", keyID)
+	}
+
+	wrappedLen := kek.NonceSize() + dataKeySize + kek.Overhead()
+	if len(sealed) < wrappedLen {
+		return nil, errors.New("ciphertext too short")
+	}
+	dataKey, err := openWith(kek, sealed[:wrappedLen], []byte(keyID))
+	if err != nil {
+		return nil, fmt.Errorf("unwrapping data key: %w", err)
+	}
+	data, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	return openWith(data, sealed[wrappedLen:], []byte(key))
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// sealWith appends a random nonce and the sealed plaintext to dst.
+func sealWith(aead cipher.AEAD, dst, plaintext, additional []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	dst = append(dst, nonce...)
+	return aead.Seal(dst, nonce, plaintext, additional), nil
+}
+
+func openWith(aead cipher.AEAD, sealed, additional []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, additional)
+}
+
+func validateKeys(keys []EncryptionKey) error {
+	if len(keys) == 0 {
+		return errors.New("at least one encryption key is needed")
+	}
+	ids := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		if k.ID == "" {
+			return errors.New("encryption key with no id")
+		}
+		if ids[k.ID] {
+			return fmt.Errorf("encryption key %s listed twice", k.ID)
+		}
+		ids[k.ID] = true
+
+		if len(k.Key) != dataKeySize {
+			return fmt.Errorf("encryption key %s: must be %d bytes, got %d", k.ID, dataKeySize, len(k.Key))
+		}
+	}
+	return nil
+}
+
+// LoadEncryptionKeys reads a key ring from a JSON array, the key to encrypt
+// with first. An empty path means no keys, bodies are stored as they are.
+func LoadEncryptionKeys(path string) ([]EncryptionKey, error) {
+	if path == "" {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []EncryptionKey
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&keys); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := validateKeys(keys); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return keys, nil
+}
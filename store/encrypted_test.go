@@ -0,0 +1,169 @@
+package store
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/GordenArcher/Idempotency-Gateway/models"
+)
+
+func testKey(id string, fill byte) EncryptionKey {
+	return EncryptionKey{ID: id, Key: bytes.Repeat([]byte{fill}, dataKeySize)}
+}
+
+func newEncrypted(t *testing.T, s Store, keys ...EncryptionKey) *EncryptedStore {
+	t.Helper()
+	es, err := NewEncryptedStore(s, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return es
+}
+
+func TestEncryptedStore_RoundTrip(t *testing.T) {
+	mem := newTestStore()
+	es := newEncrypted(t, mem, testKey("k1", 1))
+	entry := makeEntry(models.StateComplete)
+
+	es.Set("key-001", entry)
+
+	raw := mem.Get("key-001")
+	if raw.KeyID != "k1" {
+		t.Errorf("expected the entry to record key k1, got %q", raw.KeyID)
+	}
+	if bytes.Contains(raw.ResponseBody, []byte("success")) {
+		t.Error("response body stored in plaintext")
+	}
+	if string(entry.ResponseBody) != `{"status":"success"}` || entry.KeyID != "" {
+		t.Error("Set modified the caller's entry")
+	}
+
+	got := es.Get("key-001")
+	if string(got.ResponseBody) != `{"status":"success"}` || got.KeyID != "" {
+		t.Errorf("unexpected decrypted entry %+v", got)
+	}
+	if got.BodyHash != entry.BodyHash || got.StatusCode != entry.StatusCode {
+		t.Error("expected everything but the body to pass through unchanged")
+	}
+
+	// Same body twice never gives the same ciphertext.
+	es.Set("key-002", entry)
+	if bytes.Equal(mem.Get("key-002").ResponseBody, raw.ResponseBody) {
+		t.Error("expected a fresh data key and nonce per entry")
+	}
+}
+
+func TestEncryptedStore_LeavesProcessingEntriesAlone(t *testing.T) {
+	mem := newTestStore()
+	es := newEncrypted(t, mem, testKey("k1", 1))
+
+	es.Set("key-001", &models.CachedEntry{State: models.StateProcessing, BodyHash: "abc123"})
+	if mem.Get("key-001").KeyID != "" {
+		t.Error("expected an entry without a body to be stored as-is")
+	}
+
+	var wg sync.WaitGroup
+	var got *models.CachedEntry
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		got = es.WaitForComplete("key-001")
+	}()
+	time.Sleep(20 * time.Millisecond)
+	es.Set("key-001", makeEntry(models.StateComplete))
+	wg.Wait()
+
+	if got == nil || string(got.ResponseBody) != `{"status":"success"}` {
+		t.Errorf("expected WaitForComplete to return the decrypted entry, got %+v", got)
+	}
+}
+
+func TestEncryptedStore_Rotation(t *testing.T) {
+	mem := newTestStore()
+	old := newEncrypted(t, mem, testKey("old", 1))
+	old.Set("key-001", makeEntry(models.StateComplete))
+
+	rotated := newEncrypted(t, mem, testKey("new", 2), testKey("old", 1))
+	if got := rotated.Get("key-001"); string(got.ResponseBody) != `{"status":"success"}` {
+		t.Errorf("expected an old entry to still decrypt, got %s", got.ResponseBody)
+	}
+	rotated.Set("key-002", makeEntry(models.StateComplete))
+	if mem.Get("key-002").KeyID != "new" {
+		t.Error("expected new entries under the first key")
+	}
+
+	// Once the old key is dropped its entries can't be read, but they
+	// mustn't look like they were never there either.
+	dropped := newEncrypted(t, mem, testKey("new", 2))
+	got := dropped.Get("key-001")
+	if got == nil || got.StatusCode != 500 || got.BodyHash != "abc123" {
+		t.Errorf("expected a 500 entry for an unreadable body, got %+v", got)
+	}
+}
+
+func TestEncryptedStore_RejectsMovedOrTamperedBodies(t *testing.T) {
+	mem := newTestStore()
+	es := newEncrypted(t, mem, testKey("k1", 1))
+	es.Set("key-001", makeEntry(models.StateComplete))
+
+	// Copied under another key.
+	moved := *mem.Get("key-001")
+	mem.Set("key-002", &moved)
+	if got := es.Get("key-002"); got.StatusCode != 500 {
+		t.Errorf("expected a body moved to another key not to decrypt, got %d", got.StatusCode)
+	}
+
+	tampered := *mem.Get("key-001")
+	tampered.ResponseBody = bytes.Clone(tampered.ResponseBody)
+	tampered.ResponseBody[len(tampered.ResponseBody)-1] ^= 1
+	mem.Set("key-003", &tampered)
+	if got := es.Get("key-003"); got.StatusCode != 500 {
+		t.Errorf("expected a tampered body not to decrypt, got %d", got.StatusCode)
+	}
+
+	page := es.List(ListOptions{Prefix: "key-001"})
+	if len(page.Entries) != 1 || string(page.Entries[0].Entry.ResponseBody) != `{"status":"success"}` {
+		t.Error("expected List to decrypt entries")
+	}
+}
+
+func TestNewEncryptedStore_ValidatesKeys(t *testing.T) {
+	cases := map[string][]EncryptionKey{
+		"no keys":   nil,
+		"no id":     {testKey("", 1)},
+		"duplicate": {testKey("k1", 1), testKey("k1", 2)},
+		"short":     {{ID: "k1", Key: make([]byte, 16)}},
+	}
+	for name, keys := range cases {
+		if _, err := NewEncryptedStore(newTestStore(), keys); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestLoadEncryptionKeys(t *testing.T) {
+	if keys, err := LoadEncryptionKeys(""); keys != nil || err != nil {
+		t.Errorf("expected no keys for an empty path, got %v, %v", keys, err)
+	}
+
+	path := filepath.Join(t.TempDir(), "keys.json")
+	key := strings.Repeat("A", 43) + "=" // 32 zero bytes
+	os.WriteFile(path, []byte(`[{"id": "2026-10", "key": "`+key+`"}]`), 0o600)
+	keys, err := LoadEncryptionKeys(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 || keys[0].ID != "2026-10" || len(keys[0].Key) != dataKeySize {
+		t.Errorf("unexpected keys %+v", keys)
+	}
+
+	os.WriteFile(path, []byte(`[{"id": "2026-10", "key": "c2hvcnQ="}]`), 0o600)
+	if _, err := LoadEncryptionKeys(path); err == nil {
+		t.Error("expected an error for a short key")
+	}
+}
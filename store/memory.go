@@ -1,8 +1,13 @@
 package store
 
 import (
-	"log"
+	"context"
+	"errors"
+	"log/slog"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/GordenArcher/Idempotency-Gateway/models"
@@ -13,12 +18,20 @@ type MemoryStore struct {
 	data map[string]*models.CachedEntry
 	cond *sync.Cond // used to wake up requests that are waiting on a PROCESSING key
 	ttl  time.Duration
+
+	stop      chan struct{} // closed by Close() to tell the sweeper to exit
+	closeOnce sync.Once
+	closed    atomic.Bool
+	sweeping  atomic.Bool // true while the sweeper goroutine is alive
+
+	evicted uint64 // running total of swept keys, guarded by mu
 }
 
 func NewMemoryStore(ttl time.Duration) *MemoryStore {
 	ms := &MemoryStore{
 		data: make(map[string]*models.CachedEntry),
 		ttl:  ttl,
+		stop: make(chan struct{}),
 	}
 	ms.cond = sync.NewCond(&ms.mu)
 	return ms
@@ -40,6 +53,85 @@ func (ms *MemoryStore) Set(key string, entry *models.CachedEntry) {
 	ms.cond.Broadcast()
 }
 
+// SetIfAbsentOrOlder stores entry unless what's under key is PROCESSING or
+// was created at the same time as entry or later.
+func (ms *MemoryStore) SetIfAbsentOrOlder(key string, entry *models.CachedEntry) bool {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	if existing, exists := ms.data[key]; exists &&
+		(existing.State == models.StateProcessing || existing.CreatedAt >= entry.CreatedAt) {
+		return false
+	}
+	ms.data[key] = entry
+	ms.cond.Broadcast()
+	return true
+}
+
+// Delete removes a key. Anyone parked in WaitForComplete on it is woken up
+// and gets nil back, so they don't sleep forever on a key that's gone.
+func (ms *MemoryStore) Delete(key string) bool {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	_, exists := ms.data[key]
+	delete(ms.data, key)
+	if exists {
+		ms.cond.Broadcast()
+	}
+	return exists
+}
+
+// DeleteIf is Delete for an entry that still matches cond. The check
+// happens under the same lock as the delete, so a key that has moved on
+// since the caller looked at it is left alone.
+func (ms *MemoryStore) DeleteIf(key string, cond DeleteCondition) bool {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	entry, exists := ms.data[key]
+	if !exists || !cond.Matches(entry) {
+		return false
+	}
+	delete(ms.data, key)
+	ms.cond.Broadcast()
+	return true
+}
+
+// List walks the map in key order. Sorting on every call is O(n log n),
+// that's fine for an admin endpoint, it's never on the payment path.
+func (ms *MemoryStore) List(opts ListOptions) ListResult {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	keys := make([]string, 0, len(ms.data))
+	for key, entry := range ms.data {
+		if !strings.HasPrefix(key, opts.Prefix) {
+			continue
+		}
+		if opts.After != "" && key <= opts.After {
+			continue
+		}
+		if opts.State != "" && entry.State != opts.State {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var result ListResult
+	if opts.Limit > 0 && len(keys) > opts.Limit {
+		keys = keys[:opts.Limit]
+		result.NextCursor = keys[len(keys)-1]
+	}
+
+	result.Entries = make([]KeyedEntry, len(keys))
+	for i, key := range keys {
+		result.Entries[i] = KeyedEntry{Key: key, Entry: ms.data[key]}
+	}
+	return result
+}
+
 // WaitForComplete blocks the calling goroutine until the entry for the given key
 // transitions out of PROCESSING state (i.e., becomes COMPLETE).
 // This is how we handle the bonus race condition scenario:
@@ -61,21 +153,68 @@ func (ms *MemoryStore) WaitForComplete(key string) *models.CachedEntry {
 	}
 }
 
-// StartSweeper launches a background goroutine that runs on a ticker
+// Stats counts the keys in the store. It walks the whole map under a read
+// lock, which is fine at scrape intervals but not something to call per request.
+func (ms *MemoryStore) Stats() Stats {
+	ms.mu.RLock()
+	defer ms.mu.RUnlock()
+
+	stats := Stats{Keys: len(ms.data), Evicted: ms.evicted}
+	for _, entry := range ms.data {
+		if entry.State == models.StateProcessing {
+			stats.Processing++
+		}
+	}
+	return stats
+}
+
+// StartSweeper launches a background goroutine that runs every interval
 // and evicts entries that have outlived their TTL.
 // This is the "Developer's Choice" feature —
 // without this, every key ever used would stay in memory forever.
-func (ms *MemoryStore) StartSweeper() {
+func (ms *MemoryStore) StartSweeper(interval time.Duration) {
+	ms.sweeping.Store(true)
 	go func() {
-		ticker := time.NewTicker(10 * time.Minute)
+		defer ms.sweeping.Store(false)
+
+		ticker := time.NewTicker(interval)
 		defer ticker.Stop()
 
-		for range ticker.C {
-			ms.sweep()
+		for {
+			select {
+			case <-ticker.C:
+				ms.sweep()
+			case <-ms.stop:
+				return
+			}
 		}
 	}()
 }
 
+// Close stops the sweeper goroutine. It's called during graceful shutdown,
+// after the HTTP server has finished draining, so nothing is still writing.
+// Safe to call more than once.
+func (ms *MemoryStore) Close() error {
+	ms.closeOnce.Do(func() {
+		ms.closed.Store(true)
+		close(ms.stop)
+	})
+	return nil
+}
+
+// Health has nothing to dial for an in-memory map, so "reachable" means
+// not closed. The sweeper is checked too: without it the map only grows,
+// and an instance in that state shouldn't be taking traffic.
+func (ms *MemoryStore) Health(ctx context.Context) error {
+	if ms.closed.Load() {
+		return errors.New("store is closed")
+	}
+	if !ms.sweeping.Load() {
+		return errors.New("sweeper is not running")
+	}
+	return ctx.Err()
+}
+
 // sweep does the actual eviction work.
 // Takes a write lock, iterates the map, and deletes anything older than TTL.
 func (ms *MemoryStore) sweep() {
@@ -93,7 +232,15 @@ func (ms *MemoryStore) sweep() {
 		}
 	}
 
+	// A PROCESSING key can only get this old if its request died,
+	// make sure nobody stays parked on it.
+	if evicted > 0 {
+		ms.cond.Broadcast()
+	}
+
+	ms.evicted += uint64(evicted)
+
 	if evicted > 0 {
-		log.Printf("sweeper evicted %d expired idempotency keys", evicted)
+		slog.Info("sweeper evicted expired idempotency keys", "evicted", evicted)
 	}
 }
@@ -1,6 +1,7 @@
 package store
 
 import (
+	"context"
 	"sync"
 	"testing"
 	"time"
@@ -248,3 +249,187 @@ func TestSweep_OnlyEvictsExpired_LeavesOthers(t *testing.T) {
 		t.Error("expected 'expired' key to be evicted")
 	}
 }
+
+func TestClose_IsIdempotent(t *testing.T) {
+	// main.go closes the store on shutdown, a second Close (e.g. from a defer)
+	// must not panic on the already-closed stop channel.
+	s := newTestStore()
+	s.StartSweeper(time.Minute)
+
+	if err := s.Close(); err != nil {
+		t.Fatalf("unexpected error on first Close: %v", err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("unexpected error on second Close: %v", err)
+	}
+}
+
+func TestStats_CountsKeysByState(t *testing.T) {
+	s := newTestStore()
+	s.Set("a", makeEntry(models.StateProcessing))
+	s.Set("b", makeEntry(models.StateComplete))
+	s.Set("c", makeEntry(models.StateComplete))
+
+	stats := s.Stats()
+
+	if stats.Keys != 3 {
+		t.Errorf("expected 3 keys, got %d", stats.Keys)
+	}
+	if stats.Processing != 1 {
+		t.Errorf("expected 1 processing key, got %d", stats.Processing)
+	}
+}
+
+func TestStats_TracksSweeperEvictions(t *testing.T) {
+	s := NewMemoryStore(1 * time.Nanosecond)
+	s.Set("old-1", &models.CachedEntry{State: models.StateComplete, CreatedAt: time.Now().Add(-time.Hour).Unix()})
+	s.Set("old-2", &models.CachedEntry{State: models.StateComplete, CreatedAt: time.Now().Add(-time.Hour).Unix()})
+
+	s.sweep()
+
+	if got := s.Stats().Evicted; got != 2 {
+		t.Errorf("expected 2 evictions, got %d", got)
+	}
+}
+
+func TestStartSweeper_UsesInterval(t *testing.T) {
+	// With the old hardcoded 10 minutes this would never evict in time.
+	s := NewMemoryStore(1 * time.Nanosecond)
+	s.Set("old", &models.CachedEntry{State: models.StateComplete, CreatedAt: time.Now().Add(-time.Hour).Unix()})
+
+	s.StartSweeper(10 * time.Millisecond)
+	defer s.Close()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for s.Get("old") != nil {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the sweeper to evict the key within a few intervals")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestDelete_RemovesKey(t *testing.T) {
+	s := newTestStore()
+	s.Set("gone", makeEntry(models.StateComplete))
+
+	if !s.Delete("gone") {
+		t.Error("expected Delete to report the key existed")
+	}
+	if s.Get("gone") != nil {
+		t.Error("expected key to be gone after Delete")
+	}
+	if s.Delete("gone") {
+		t.Error("expected second Delete to report nothing was removed")
+	}
+}
+
+func TestDeleteIf_OnlyDeletesMatchingEntries(t *testing.T) {
+	s := newTestStore()
+	now := time.Now().Unix()
+	s.Set("done", &models.CachedEntry{State: models.StateComplete, CreatedAt: now - 100})
+	s.Set("inflight", &models.CachedEntry{State: models.StateProcessing, CreatedAt: now - 100})
+	s.Set("fresh", &models.CachedEntry{State: models.StateComplete, CreatedAt: now})
+
+	complete := DeleteCondition{State: models.StateComplete, CreatedBefore: now - 10}
+	if s.DeleteIf("inflight", complete) || s.DeleteIf("fresh", complete) || s.DeleteIf("missing", complete) {
+		t.Error("deleted a key that doesn't match")
+	}
+	if !s.DeleteIf("done", complete) || s.Get("done") != nil {
+		t.Error("expected the matching key to be deleted")
+	}
+	if !s.DeleteIf("inflight", DeleteCondition{}) {
+		t.Error("expected an empty condition to match anything")
+	}
+}
+
+func TestDelete_WakesWaiters(t *testing.T) {
+	// If an admin purges a PROCESSING key, anyone waiting on it must
+	// wake up with nil instead of sleeping forever.
+	s := newTestStore()
+	s.Set("purged-inflight", makeEntry(models.StateProcessing))
+
+	done := make(chan *models.CachedEntry, 1)
+	go func() {
+		done <- s.WaitForComplete("purged-inflight")
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	s.Delete("purged-inflight")
+
+	select {
+	case result := <-done:
+		if result != nil {
+			t.Errorf("expected nil for a deleted key, got %+v", result)
+		}
+	case <-time.After(2 * time.Second):
+		t.Error("waiter never woke up after the key was deleted")
+	}
+}
+
+func TestList_SortsFiltersAndPaginates(t *testing.T) {
+	s := newTestStore()
+	s.Set("order-3", makeEntry(models.StateComplete))
+	s.Set("order-1", makeEntry(models.StateComplete))
+	s.Set("order-2", makeEntry(models.StateProcessing))
+	s.Set("refund-1", makeEntry(models.StateComplete))
+
+	page := s.List(ListOptions{Prefix: "order-", Limit: 2})
+	if len(page.Entries) != 2 || page.Entries[0].Key != "order-1" || page.Entries[1].Key != "order-2" {
+		t.Fatalf("unexpected first page: %+v", page.Entries)
+	}
+	if page.NextCursor != "order-2" {
+		t.Errorf("expected cursor order-2, got %q", page.NextCursor)
+	}
+
+	page = s.List(ListOptions{Prefix: "order-", Limit: 2, After: page.NextCursor})
+	if len(page.Entries) != 1 || page.Entries[0].Key != "order-3" {
+		t.Fatalf("unexpected second page: %+v", page.Entries)
+	}
+	if page.NextCursor != "" {
+		t.Errorf("expected no cursor on the last page, got %q", page.NextCursor)
+	}
+
+	complete := s.List(ListOptions{State: models.StateComplete})
+	if len(complete.Entries) != 3 {
+		t.Errorf("expected 3 COMPLETE entries, got %d", len(complete.Entries))
+	}
+}
+
+func TestHealth_ReportsSweeperAndClosedState(t *testing.T) {
+	s := newTestStore()
+	ctx := context.Background()
+
+	if err := s.Health(ctx); err == nil {
+		t.Error("expected unhealthy before the sweeper is started")
+	}
+
+	s.StartSweeper(time.Minute)
+	if err := s.Health(ctx); err != nil {
+		t.Errorf("expected healthy with the sweeper running, got %v", err)
+	}
+
+	s.Close()
+	if err := s.Health(ctx); err == nil {
+		t.Error("expected unhealthy after Close")
+	}
+}
+
+func TestSetIfAbsentOrOlder_KeepsProcessingAndNewerEntries(t *testing.T) {
+	s := NewMemoryStore(time.Hour)
+	now := time.Now().Unix()
+	s.Set("inflight", &models.CachedEntry{State: models.StateProcessing, CreatedAt: now - 60})
+	s.Set("newer", &models.CachedEntry{State: models.StateComplete, CreatedAt: now})
+	s.Set("older", &models.CachedEntry{State: models.StateComplete, CreatedAt: now - 60})
+
+	incoming := &models.CachedEntry{State: models.StateComplete, BodyHash: "incoming", CreatedAt: now - 30}
+	if s.SetIfAbsentOrOlder("inflight", incoming) || s.SetIfAbsentOrOlder("newer", incoming) {
+		t.Error("expected PROCESSING and newer entries to be kept")
+	}
+	if !s.SetIfAbsentOrOlder("older", incoming) || s.Get("older").BodyHash != "incoming" {
+		t.Error("expected an older entry to be replaced")
+	}
+	if !s.SetIfAbsentOrOlder("missing", incoming) || s.Get("missing") == nil {
+		t.Error("expected a free key to be set")
+	}
+}
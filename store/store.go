@@ -1,9 +1,101 @@
 package store
 
-import "github.com/GordenArcher/Idempotency-Gateway/models"
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/GordenArcher/Idempotency-Gateway/models"
+)
 
 type Store interface {
 	Get(key string) *models.CachedEntry
 	Set(key string, entry *models.CachedEntry)
-	StartSweeper()
+
+	// WaitForComplete blocks until key is no longer PROCESSING and returns
+	// its entry, or nil if the key is deleted in the meantime.
+	WaitForComplete(key string) *models.CachedEntry
+
+	StartSweeper(interval time.Duration)
+	Close() error
+	Stats() Stats
+
+	// List returns keys in ascending order, filtered and paginated by opts.
+	// DeleteIf removes a key only if its entry matches cond, checked and
+	// removed in one step, and reports whether it did.
+	// SetIfAbsentOrOlder stores entry only if the key is free or holds a
+	// COMPLETE entry created before it, checked and stored in one step, and
+	// reports whether it did.
+	// They exist for the admin API and snapshot imports, nothing on the
+	// request path uses them.
+	List(opts ListOptions) ListResult
+	DeleteIf(key string, cond DeleteCondition) bool
+	SetIfAbsentOrOlder(key string, entry *models.CachedEntry) bool
+
+	// Delete removes a key and reports whether it was there.
+	Delete(key string) bool
+
+	// Health reports whether the backend can serve requests right now.
+	// /readyz calls it, so it should be cheap and respect ctx.
+	Health(ctx context.Context) error
+}
+
+// ListOptions filters and paginates List.
+type ListOptions struct {
+	Prefix string          // only keys starting with this
+	State  models.KeyState // only entries in this state, "" for any
+	After  string          // cursor, only keys sorting after this one
+	Limit  int             // max entries returned, <= 0 means no limit
+}
+
+// DeleteCondition says which entry DeleteIf may remove. Zero fields
+// match anything.
+type DeleteCondition struct {
+	State         models.KeyState // only an entry in this state
+	CreatedBefore int64           // only an entry created before this unix time
+}
+
+// Matches reports whether entry meets the condition.
+func (c DeleteCondition) Matches(entry *models.CachedEntry) bool {
+	if c.State != "" && entry.State != c.State {
+		return false
+	}
+	if c.CreatedBefore != 0 && entry.CreatedAt >= c.CreatedBefore {
+		return false
+	}
+	return true
+}
+
+// KeyedEntry pairs an entry with the key it's stored under.
+type KeyedEntry struct {
+	Key   string
+	Entry *models.CachedEntry
+}
+
+// ListResult is one page of List. NextCursor is "" on the last page,
+// otherwise pass it back as ListOptions.After to get the next one.
+type ListResult struct {
+	Entries    []KeyedEntry
+	NextCursor string
+}
+
+// Stats is a point-in-time snapshot of what's in the store,
+// read by the /metrics endpoint on every scrape.
+type Stats struct {
+	Keys       int    // every key currently held, any state
+	Processing int    // keys still in PROCESSING
+	Evicted    uint64 // total keys the sweeper has removed since startup
+}
+
+// unreadable stands in for an entry whose body a wrapper couldn't decode.
+// It keeps the state and body hash, so the key still counts as used and
+// conflicts are still caught, but replays a 500 instead of the body.
+func unreadable(entry *models.CachedEntry) *models.CachedEntry {
+	e := *entry
+	e.StatusCode = http.StatusInternalServerError
+	e.Headers = nil
+	e.ResponseBody = []byte(`{"error": "the stored response for this idempotency key could not be read"}`)
+	e.KeyID = ""
+	e.Encoding = ""
+	return &e
 }
@@ -0,0 +1,218 @@
+// Package tlsutil builds the server's TLS configuration and keeps it
+// current. The certificate, key and client CA files are checked for changes
+// on an interval and re-read when they do, so a renewed certificate is
+// served without a restart.
+package tlsutil
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Config is what the server's TLS is built from.
+type Config struct {
+	CertFile string
+	KeyFile  string
+
+	// MinVersion is "1.2" or "1.3". Empty means 1.2.
+	MinVersion string
+
+	// CipherSuites are TLS 1.2 suite names as Go spells them,
+	// e.g. TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256. Empty uses Go's defaults.
+	// TLS 1.3 suites aren't configurable, they're all safe.
+	CipherSuites []string
+
+	// ClientCAFile turns on mutual TLS: every client must present a
+	// certificate signed by one of these CAs.
+	ClientCAFile string
+}
+
+// ParseVersion turns "1.2" or "1.3" into its tls constant. Anything older
+// isn't offered, there's no reason to serve payments over it.
+func ParseVersion(v string) (uint16, error) {
+	switch v {
+	case "", "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	}
+	return 0, fmt.Errorf("unsupported TLS version %q, use 1.2 or 1.3", v)
+}
+
+// ParseCipherSuites looks up suites by name. Only suites Go considers
+// secure are accepted, asking for a broken one is a configuration mistake.
+func ParseCipherSuites(names []string) ([]uint16, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	secure := make(map[string]uint16)
+	for _, s := range tls.CipherSuites() {
+		secure[s.Name] = s.ID
+	}
+	insecure := make(map[string]bool)
+	for _, s := range tls.InsecureCipherSuites() {
+		insecure[s.Name] = true
+	}
+
+	ids := make([]uint16, 0, len(names))
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		id, ok := secure[name]
+		switch {
+		case ok:
+			ids = append(ids, id)
+		case insecure[name]:
+			return nil, fmt.Errorf("cipher suite %s is insecure", name)
+		default:
+			return nil, fmt.Errorf("unknown cipher suite %q", name)
+		}
+	}
+	return ids, nil
+}
+
+// Reloader serves the certificate and client CAs from the files in its
+// Config, re-reading them whenever they change.
+type Reloader struct {
+	cfg          Config
+	minVersion   uint16
+	cipherSuites []uint16
+
+	current atomic.Pointer[tls.Config]
+
+	mu    sync.Mutex // serialises reloads
+	stamp string     // sizes and mod times of the files when last loaded
+	stop  chan struct{}
+	once  sync.Once
+}
+
+// NewReloader loads cfg's files. A missing or broken file is an error here,
+// the server shouldn't start without a certificate.
+func NewReloader(cfg Config) (*Reloader, error) {
+	if cfg.CertFile == "" || cfg.KeyFile == "" {
+		return nil, errors.New("both a certificate and a key file are needed")
+	}
+	minVersion, err := ParseVersion(cfg.MinVersion)
+	if err != nil {
+		return nil, err
+	}
+	suites, err := ParseCipherSuites(cfg.CipherSuites)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Reloader{cfg: cfg, minVersion: minVersion, cipherSuites: suites, stop: make(chan struct{})}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// TLSConfig is the config to give http.Server. Every handshake picks up
+// whatever was loaded last.
+func (r *Reloader) TLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion:   r.minVersion,
+		CipherSuites: r.cipherSuites,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			return r.current.Load(), nil
+		},
+	}
+}
+
+// Reload re-reads the files. If any of them doesn't load, the previous
+// certificate and CAs stay in use.
+func (r *Reloader) Reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stamp := r.fileStamp()
+	cert, err := tls.LoadX509KeyPair(r.cfg.CertFile, r.cfg.KeyFile)
+	if err != nil {
+		return fmt.Errorf("loading certificate: %w", err)
+	}
+
+	c := &tls.Config{
+		MinVersion:   r.minVersion,
+		CipherSuites: r.cipherSuites,
+		Certificates: []tls.Certificate{cert},
+		// The outer config's h2 isn't inherited by one returned from
+		// GetConfigForClient, so HTTP/2 has to be offered here.
+		NextProtos: []string{"h2", "http/1.1"},
+	}
+	if r.cfg.ClientCAFile != "" {
+		pem, err := os.ReadFile(r.cfg.ClientCAFile)
+		if err != nil {
+			return fmt.Errorf("loading client CAs: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("loading client CAs: no certificates in %s", r.cfg.ClientCAFile)
+		}
+		c.ClientCAs = pool
+		c.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	r.current.Store(c)
+	r.stamp = stamp
+	return nil
+}
+
+// Watch checks the files every interval and reloads when they've changed,
+// until Close. A failed reload is logged and tried again next time round.
+func (r *Reloader) Watch(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-r.stop:
+				return
+			case <-ticker.C:
+				if !r.changed() {
+					continue
+				}
+				if err := r.Reload(); err != nil {
+					slog.Error("failed to reload TLS certificates, still serving the old ones", "error", err)
+					continue
+				}
+				slog.Info("TLS certificates reloaded", "cert", r.cfg.CertFile)
+			}
+		}
+	}()
+}
+
+// Close stops Watch.
+func (r *Reloader) Close() {
+	r.once.Do(func() { close(r.stop) })
+}
+
+func (r *Reloader) changed() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.fileStamp() != r.stamp
+}
+
+// fileStamp summarises the files' sizes and mod times. A cert and key are
+// usually replaced one after the other, so a reload may catch them
+// mismatched, fail, and succeed on the next tick once both are in place.
+func (r *Reloader) fileStamp() string {
+	var b strings.Builder
+	for _, path := range []string{r.cfg.CertFile, r.cfg.KeyFile, r.cfg.ClientCAFile} {
+		if path == "" {
+			continue
+		}
+		if fi, err := os.Stat(path); err == nil {
+			fmt.Fprintf(&b, "%s:%d:%d;", path, fi.Size(), fi.ModTime().UnixNano())
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,246 @@
+package tlsutil
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// issued is a certificate and its key, generated on the spot.
+type issued struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	der  []byte
+}
+
+// issue makes a certificate for cn, signed by parent, or self-signed as a
+// CA when parent is nil.
+func issue(t *testing.T, cn string, serial int64, parent *issued) *issued {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: cn, Organization: []string{"Gateway Tests"}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	signer, signerKey := tmpl, key
+	if parent == nil {
+		tmpl.IsCA, tmpl.BasicConstraintsValid = true, true
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	return &issued{cert: cert, key: key, der: der}
+}
+
+func (i *issued) write(t *testing.T, certFile, keyFile string) {
+	t.Helper()
+	keyDER, _ := x509.MarshalECPrivateKey(i.key)
+	os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: i.der}), 0o600)
+	if keyFile != "" {
+		os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600)
+	}
+}
+
+func (i *issued) tlsCert() tls.Certificate {
+	return tls.Certificate{Certificate: [][]byte{i.der}, PrivateKey: i.key}
+}
+
+// serve starts an HTTPS server with r's config and returns its URL.
+func serve(t *testing.T, r *Reloader) string {
+	t.Helper()
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if len(req.TLS.PeerCertificates) > 0 {
+			w.Write([]byte(req.TLS.PeerCertificates[0].Subject.CommonName))
+		}
+	}))
+	srv.TLS = r.TLSConfig()
+	srv.Config.ErrorLog = log.New(io.Discard, "", 0) // refused handshakes are the point of some tests
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+// handshake connects to url and returns the serial of the certificate served.
+func handshake(url string, client *tls.Config) (int64, error) {
+	c := &http.Client{Transport: &http.Transport{TLSClientConfig: client}}
+	resp, err := c.Get(url)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return resp.TLS.PeerCertificates[0].SerialNumber.Int64(), nil
+}
+
+func files(t *testing.T) (string, string, string) {
+	dir := t.TempDir()
+	return filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem"), filepath.Join(dir, "ca.pem")
+}
+
+func TestReloader_PicksUpNewCertificate(t *testing.T) {
+	certFile, keyFile, _ := files(t)
+	ca := issue(t, "Test CA", 1, nil)
+	issue(t, "localhost", 10, ca).write(t, certFile, keyFile)
+
+	r, err := NewReloader(Config{CertFile: certFile, KeyFile: keyFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	r.Watch(5 * time.Millisecond)
+	url := serve(t, r)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	client := &tls.Config{RootCAs: roots}
+
+	if serial, err := handshake(url, client); err != nil || serial != 10 {
+		t.Fatalf("expected certificate 10, got %d, %v", serial, err)
+	}
+
+	// Renewed on disk, the mod time has to move for the watcher to notice.
+	issue(t, "localhost", 11, ca).write(t, certFile, keyFile)
+	later := time.Now().Add(time.Second)
+	os.Chtimes(certFile, later, later)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if serial, _ := handshake(url, client); serial == 11 {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Error("the renewed certificate was never served")
+}
+
+func TestReloader_BrokenFileKeepsOldCertificate(t *testing.T) {
+	certFile, keyFile, _ := files(t)
+	ca := issue(t, "Test CA", 1, nil)
+	issue(t, "localhost", 20, ca).write(t, certFile, keyFile)
+
+	r, err := NewReloader(Config{CertFile: certFile, KeyFile: keyFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(certFile, []byte("not a certificate"), 0o600)
+	if err := r.Reload(); err == nil {
+		t.Fatal("expected the broken certificate to fail to load")
+	}
+
+	if got := r.current.Load().Certificates[0].Leaf; got != nil && got.SerialNumber.Int64() != 20 {
+		t.Errorf("expected certificate 20 still in use, got %d", got.SerialNumber.Int64())
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	if serial, err := handshake(serve(t, r), &tls.Config{RootCAs: roots}); err != nil || serial != 20 {
+		t.Errorf("expected certificate 20 still served, got %d, %v", serial, err)
+	}
+}
+
+func TestReloader_MutualTLS(t *testing.T) {
+	certFile, keyFile, caFile := files(t)
+	ca := issue(t, "Test CA", 1, nil)
+	issue(t, "localhost", 30, ca).write(t, certFile, keyFile)
+	ca.write(t, caFile, "")
+
+	r, err := NewReloader(Config{CertFile: certFile, KeyFile: keyFile, ClientCAFile: caFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	url := serve(t, r)
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+
+	if _, err := handshake(url, &tls.Config{RootCAs: roots}); err == nil {
+		t.Error("expected a client without a certificate to be refused")
+	}
+
+	stranger := issue(t, "bank-b", 31, issue(t, "Other CA", 2, nil)).tlsCert()
+	if _, err := handshake(url, &tls.Config{RootCAs: roots, Certificates: []tls.Certificate{stranger}}); err == nil {
+		t.Error("expected a certificate from another CA to be refused")
+	}
+
+	client := issue(t, "bank-a", 32, ca).tlsCert()
+	c := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots, Certificates: []tls.Certificate{client}}}}
+	resp, err := c.Get(url)
+	if err != nil {
+		t.Fatalf("expected the CA's client certificate to be accepted, got %v", err)
+	}
+	defer resp.Body.Close()
+	buf := make([]byte, 16)
+	n, _ := resp.Body.Read(buf)
+	if string(buf[:n]) != "bank-a" {
+		t.Errorf("expected the handler to see bank-a's certificate, got %q", buf[:n])
+	}
+}
+
+func TestReloader_MinVersion(t *testing.T) {
+	certFile, keyFile, _ := files(t)
+	ca := issue(t, "Test CA", 1, nil)
+	issue(t, "localhost", 40, ca).write(t, certFile, keyFile)
+
+	r, err := NewReloader(Config{CertFile: certFile, KeyFile: keyFile, MinVersion: "1.3"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	url := serve(t, r)
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+
+	if _, err := handshake(url, &tls.Config{RootCAs: roots, MaxVersion: tls.VersionTLS12}); err == nil {
+		t.Error("expected a TLS 1.2 client to be refused")
+	}
+	if _, err := handshake(url, &tls.Config{RootCAs: roots}); err != nil {
+		t.Errorf("expected TLS 1.3 to work, got %v", err)
+	}
+}
+
+func TestParseCipherSuites(t *testing.T) {
+	ids, err := ParseCipherSuites([]string{"TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256", " TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256"})
+	if err != nil || len(ids) != 2 || ids[0] != tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256 {
+		t.Errorf("unexpected %v, %v", ids, err)
+	}
+	if _, err := ParseCipherSuites([]string{"TLS_RSA_WITH_RC4_128_SHA"}); err == nil {
+		t.Error("expected an insecure suite to be refused")
+	}
+	if _, err := ParseCipherSuites([]string{"TLS_MADE_UP"}); err == nil {
+		t.Error("expected an unknown suite to be refused")
+	}
+}
+
+func TestParseVersion(t *testing.T) {
+	for v, want := range map[string]uint16{"": tls.VersionTLS12, "1.2": tls.VersionTLS12, "1.3": tls.VersionTLS13} {
+		if got, err := ParseVersion(v); err != nil || got != want {
+			t.Errorf("%q: expected %x, got %x, %v", v, want, got, err)
+		}
+	}
+	if _, err := ParseVersion("1.0"); err == nil {
+		t.Error("expected TLS 1.0 to be refused")
+	}
+}
@@ -0,0 +1,85 @@
+package tracing
+
+import (
+	"net/http"
+)
+
+// Middleware continues the caller's trace from its traceparent header
+// (or starts a new one) and wraps the request in a server span.
+// The server span's traceparent is echoed on the response so a client
+// that didn't send one can still find the trace afterwards.
+func Middleware(t *Tracer, next http.Handler) http.Handler {
+	if t == nil {
+		return next
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		if sc, ok := ParseTraceparent(r.Header.Get(TraceparentHeader)); ok {
+			ctx = ContextWithRemoteParent(ctx, sc)
+		}
+
+		ctx, span := t.Start(ctx, r.Method+" "+r.URL.Path, KindServer)
+		defer span.Finish()
+
+		span.SetAttribute("http.request.method", r.Method)
+		span.SetAttribute("url.path", r.URL.Path)
+		w.Header().Set(TraceparentHeader, span.Context.Traceparent())
+
+		sw := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(sw, r.WithContext(ctx))
+
+		span.SetAttribute("http.response.status_code", sw.status)
+	})
+}
+
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (sw *statusWriter) WriteHeader(code int) {
+	sw.status = code
+	sw.ResponseWriter.WriteHeader(code)
+}
+
+// Inject sets the traceparent header on an outgoing request from the
+// span active in its context. Requests with no active span are left alone.
+func Inject(r *http.Request) {
+	if span := SpanFromContext(r.Context()); span != nil {
+		r.Header.Set(TraceparentHeader, span.Context.Traceparent())
+	}
+}
+
+// Transport is an http.RoundTripper that wraps each outgoing request in a
+// client span and forwards its traceparent downstream. Plug it into an
+// http.Client or an httputil.ReverseProxy and upstreams join the same trace.
+type Transport struct {
+	Tracer *Tracer
+	Base   http.RoundTripper
+}
+
+func (tr *Transport) RoundTrip(r *http.Request) (*http.Response, error) {
+	base := tr.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	ctx, span := tr.Tracer.Start(r.Context(), r.Method+" "+r.URL.Host, KindClient)
+	defer span.Finish()
+
+	// RoundTrippers must not modify the caller's request.
+	r = r.Clone(ctx)
+	Inject(r)
+
+	span.SetAttribute("http.request.method", r.Method)
+	span.SetAttribute("server.address", r.URL.Host)
+
+	resp, err := base.RoundTrip(r)
+	if err != nil {
+		span.SetAttribute("error", err.Error())
+		return nil, err
+	}
+	span.SetAttribute("http.response.status_code", resp.StatusCode)
+	return resp, nil
+}
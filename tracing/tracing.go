@@ -0,0 +1,255 @@
+// Package tracing implements just enough of W3C Trace Context and span
+// recording to answer "where did the time go?" for a slow payment:
+// waiting on a duplicate, inside the handler, or writing to the store.
+//
+// There's no SDK dependency. Spans are handed to an Exporter when they end,
+// and the bundled exporter writes OTLP-JSON lines that can be read offline
+// or replayed into any OpenTelemetry collector later.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TraceparentHeader is the W3C Trace Context header name.
+const TraceparentHeader = "traceparent"
+
+type (
+	TraceID [16]byte
+	SpanID  [8]byte
+)
+
+func (t TraceID) String() string { return hex.EncodeToString(t[:]) }
+func (s SpanID) String() string  { return hex.EncodeToString(s[:]) }
+
+func (t TraceID) IsZero() bool { return t == TraceID{} }
+func (s SpanID) IsZero() bool  { return s == SpanID{} }
+
+// SpanContext is the part of a span that crosses process boundaries.
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool
+}
+
+// IsValid reports whether both IDs are set, all-zero IDs are invalid per the spec.
+func (sc SpanContext) IsValid() bool {
+	return !sc.TraceID.IsZero() && !sc.SpanID.IsZero()
+}
+
+// Traceparent formats the context as a version 00 traceparent header value.
+func (sc SpanContext) Traceparent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return fmt.Sprintf("00-%s-%s-%s", sc.TraceID, sc.SpanID, flags)
+}
+
+// ParseTraceparent parses a traceparent header value.
+// Anything malformed returns false and the caller starts a fresh trace,
+// which is what the spec asks for.
+func ParseTraceparent(v string) (SpanContext, bool) {
+	parts := strings.Split(strings.TrimSpace(v), "-")
+	if len(parts) < 4 {
+		return SpanContext{}, false
+	}
+
+	version, traceID, spanID, flags := parts[0], parts[1], parts[2], parts[3]
+
+	// Version ff is forbidden. Version 00 has exactly four fields,
+	// future versions may append more and we ignore them.
+	if len(version) != 2 || version == "ff" || (version == "00" && len(parts) != 4) {
+		return SpanContext{}, false
+	}
+	if !isLowerHex(version) || !isLowerHex(traceID) || !isLowerHex(spanID) || !isLowerHex(flags) {
+		return SpanContext{}, false
+	}
+	if len(traceID) != 32 || len(spanID) != 16 || len(flags) != 2 {
+		return SpanContext{}, false
+	}
+
+	var sc SpanContext
+	hex.Decode(sc.TraceID[:], []byte(traceID))
+	hex.Decode(sc.SpanID[:], []byte(spanID))
+
+	var f [1]byte
+	hex.Decode(f[:], []byte(flags))
+	sc.Sampled = f[0]&0x01 == 0x01
+
+	if !sc.IsValid() {
+		return SpanContext{}, false
+	}
+	return sc, true
+}
+
+func isLowerHex(s string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// SpanKind mirrors the OTLP span kinds we actually use.
+type SpanKind int
+
+const (
+	KindInternal SpanKind = 1
+	KindServer   SpanKind = 2
+	KindClient   SpanKind = 3
+)
+
+// Span is a single timed operation. Start one with Tracer.Start
+// and always End it, usually with a defer.
+type Span struct {
+	Name         string
+	Kind         SpanKind
+	Context      SpanContext
+	ParentSpanID SpanID
+	Start        time.Time
+	End          time.Time
+
+	mu         sync.Mutex
+	attributes map[string]any
+	ended      bool
+	tracer     *Tracer
+}
+
+// SetAttribute attaches a key/value to the span. Values should be
+// strings, bools, ints or float64s, which is what OTLP can represent.
+// Safe to call on a nil span.
+func (s *Span) SetAttribute(key string, value any) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.attributes == nil {
+		s.attributes = make(map[string]any)
+	}
+	s.attributes[key] = value
+}
+
+// Attributes returns a copy of the span's attributes.
+func (s *Span) Attributes() map[string]any {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make(map[string]any, len(s.attributes))
+	for k, v := range s.attributes {
+		out[k] = v
+	}
+	return out
+}
+
+// Finish ends the span and hands it to the exporter. Calling it twice
+// only exports once. Safe to call on a nil span.
+func (s *Span) Finish() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.End = time.Now()
+	s.mu.Unlock()
+
+	if s.tracer != nil && s.tracer.exporter != nil {
+		s.tracer.exporter.ExportSpan(s)
+	}
+}
+
+// Exporter receives every span when it finishes.
+// Implementations must be safe for concurrent use.
+type Exporter interface {
+	ExportSpan(s *Span)
+}
+
+// Tracer creates spans and sends them to an exporter.
+// A nil *Tracer is valid and produces nil spans, whose methods are all no-ops,
+// so code can be instrumented unconditionally.
+type Tracer struct {
+	exporter Exporter
+}
+
+func NewTracer(exporter Exporter) *Tracer {
+	return &Tracer{exporter: exporter}
+}
+
+type (
+	activeSpanKey struct{}
+	remoteSpanKey struct{}
+)
+
+// Start begins a span as a child of whatever span is in ctx: a local
+// span if there is one, else a remote parent extracted from traceparent,
+// else it starts a new trace.
+func (t *Tracer) Start(ctx context.Context, name string, kind SpanKind) (context.Context, *Span) {
+	if t == nil {
+		return ctx, nil
+	}
+
+	span := &Span{
+		Name:   name,
+		Kind:   kind,
+		Start:  time.Now(),
+		tracer: t,
+	}
+
+	if parent, ok := parentContext(ctx); ok {
+		span.Context.TraceID = parent.TraceID
+		span.Context.Sampled = parent.Sampled
+		span.ParentSpanID = parent.SpanID
+	} else {
+		rand.Read(span.Context.TraceID[:])
+		span.Context.Sampled = true
+	}
+	rand.Read(span.Context.SpanID[:])
+
+	return context.WithValue(ctx, activeSpanKey{}, span), span
+}
+
+func parentContext(ctx context.Context) (SpanContext, bool) {
+	if span := SpanFromContext(ctx); span != nil {
+		return span.Context, true
+	}
+	if sc, ok := ctx.Value(remoteSpanKey{}).(SpanContext); ok {
+		return sc, true
+	}
+	return SpanContext{}, false
+}
+
+// SpanFromContext returns the active span, or nil.
+func SpanFromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(activeSpanKey{}).(*Span)
+	return span
+}
+
+// ContextWithParent makes the active span in ctx the parent of spans
+// started from the returned context without leaving it active, so
+// SpanFromContext returns nil there and nothing downstream annotates it.
+func ContextWithParent(ctx context.Context) context.Context {
+	span := SpanFromContext(ctx)
+	if span == nil {
+		return ctx
+	}
+	ctx = context.WithValue(ctx, activeSpanKey{}, (*Span)(nil))
+	return ContextWithRemoteParent(ctx, span.Context)
+}
+
+// ContextWithRemoteParent records an incoming span context
+// so the next Start continues that trace.
+func ContextWithRemoteParent(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, remoteSpanKey{}, sc)
+}
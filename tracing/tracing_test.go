@@ -0,0 +1,225 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// recorder is an in-memory exporter for tests.
+type recorder struct {
+	mu    sync.Mutex
+	spans []*Span
+}
+
+func (r *recorder) ExportSpan(s *Span) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.spans = append(r.spans, s)
+}
+
+const validTraceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func TestParseTraceparent_Valid(t *testing.T) {
+	sc, ok := ParseTraceparent(validTraceparent)
+	if !ok {
+		t.Fatal("expected valid traceparent to parse")
+	}
+	if sc.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("unexpected trace ID %s", sc.TraceID)
+	}
+	if sc.SpanID.String() != "00f067aa0ba902b7" {
+		t.Errorf("unexpected span ID %s", sc.SpanID)
+	}
+	if !sc.Sampled {
+		t.Error("expected sampled flag to be set")
+	}
+	if sc.Traceparent() != validTraceparent {
+		t.Errorf("round trip mismatch: %s", sc.Traceparent())
+	}
+}
+
+func TestParseTraceparent_RejectsMalformed(t *testing.T) {
+	for _, v := range []string{
+		"",
+		"garbage",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",          // missing flags
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",       // zero trace ID
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",       // zero span ID
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",       // forbidden version
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",       // uppercase
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", // v00 has 4 fields
+	} {
+		if _, ok := ParseTraceparent(v); ok {
+			t.Errorf("expected %q to be rejected", v)
+		}
+	}
+}
+
+func TestParseTraceparent_FutureVersionIgnoresExtraFields(t *testing.T) {
+	if _, ok := ParseTraceparent("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-whatever"); !ok {
+		t.Error("expected future version with extra fields to parse")
+	}
+}
+
+func TestTracer_ChildSpansShareTraceAndLinkParent(t *testing.T) {
+	rec := &recorder{}
+	tr := NewTracer(rec)
+
+	ctx, parent := tr.Start(context.Background(), "parent", KindServer)
+	_, child := tr.Start(ctx, "child", KindInternal)
+	child.Finish()
+	parent.Finish()
+
+	if child.Context.TraceID != parent.Context.TraceID {
+		t.Error("child should share the parent's trace ID")
+	}
+	if child.ParentSpanID != parent.Context.SpanID {
+		t.Error("child's parent span ID should be the parent's span ID")
+	}
+	if len(rec.spans) != 2 {
+		t.Errorf("expected 2 exported spans, got %d", len(rec.spans))
+	}
+}
+
+func TestContextWithParent_ChildrenLinkButParentIsNotActive(t *testing.T) {
+	tr := NewTracer(&recorder{})
+	ctx, parent := tr.Start(context.Background(), "parent", KindServer)
+
+	detached := ContextWithParent(ctx)
+	if SpanFromContext(detached) != nil {
+		t.Error("expected no active span in the detached context")
+	}
+	_, child := tr.Start(detached, "child", KindInternal)
+	if child.Context.TraceID != parent.Context.TraceID || child.ParentSpanID != parent.Context.SpanID {
+		t.Error("expected the child to continue the parent's trace under the parent span")
+	}
+}
+
+func TestSpan_FinishTwiceExportsOnce(t *testing.T) {
+	rec := &recorder{}
+	_, span := NewTracer(rec).Start(context.Background(), "once", KindInternal)
+
+	span.Finish()
+	span.Finish()
+
+	if len(rec.spans) != 1 {
+		t.Errorf("expected 1 exported span, got %d", len(rec.spans))
+	}
+}
+
+func TestNilTracer_IsNoOp(t *testing.T) {
+	var tr *Tracer
+	ctx, span := tr.Start(context.Background(), "nothing", KindInternal)
+
+	span.SetAttribute("k", "v")
+	span.Finish()
+
+	if SpanFromContext(ctx) != nil {
+		t.Error("nil tracer should not put a span in the context")
+	}
+}
+
+func TestMiddleware_ContinuesIncomingTrace(t *testing.T) {
+	rec := &recorder{}
+	var inner *Span
+	h := Middleware(NewTracer(rec), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		inner = SpanFromContext(r.Context())
+		w.WriteHeader(http.StatusCreated)
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/process-payment", nil)
+	req.Header.Set(TraceparentHeader, validTraceparent)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+
+	if inner == nil {
+		t.Fatal("expected a server span in the handler's context")
+	}
+	if inner.Context.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("expected incoming trace ID to be continued, got %s", inner.Context.TraceID)
+	}
+	if inner.ParentSpanID.String() != "00f067aa0ba902b7" {
+		t.Errorf("expected remote span as parent, got %s", inner.ParentSpanID)
+	}
+	if got := w.Header().Get(TraceparentHeader); got != inner.Context.Traceparent() {
+		t.Errorf("expected server span traceparent on response, got %q", got)
+	}
+	if got := inner.Attributes()["http.response.status_code"]; got != http.StatusCreated {
+		t.Errorf("expected status attribute 201, got %v", got)
+	}
+}
+
+func TestTransport_PropagatesTraceparentUpstream(t *testing.T) {
+	var received string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Get(TraceparentHeader)
+	}))
+	defer upstream.Close()
+
+	rec := &recorder{}
+	tr := NewTracer(rec)
+	ctx, parent := tr.Start(context.Background(), "outer", KindServer)
+
+	client := &http.Client{Transport: &Transport{Tracer: tr}}
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, upstream.URL, nil)
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("request failed: %v", err)
+	}
+	resp.Body.Close()
+	parent.Finish()
+
+	sc, ok := ParseTraceparent(received)
+	if !ok {
+		t.Fatalf("upstream got no valid traceparent: %q", received)
+	}
+	if sc.TraceID != parent.Context.TraceID {
+		t.Error("upstream should be in the same trace")
+	}
+	if req.Header.Get(TraceparentHeader) != "" {
+		t.Error("transport must not modify the caller's request")
+	}
+}
+
+func TestJSONExporter_WritesOTLPLine(t *testing.T) {
+	var buf bytes.Buffer
+	tr := NewTracer(NewJSONExporter(&buf))
+
+	_, span := tr.Start(context.Background(), "idempotency.lookup", KindInternal)
+	span.SetAttribute("idempotency.key_hash", "abc")
+	span.Finish()
+
+	var decoded struct {
+		ResourceSpans []struct {
+			ScopeSpans []struct {
+				Spans []struct {
+					TraceID    string `json:"traceId"`
+					Name       string `json:"name"`
+					Attributes []struct {
+						Key   string            `json:"key"`
+						Value map[string]string `json:"value"`
+					} `json:"attributes"`
+				} `json:"spans"`
+			} `json:"scopeSpans"`
+		} `json:"resourceSpans"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("exported line is not valid JSON: %v", err)
+	}
+
+	got := decoded.ResourceSpans[0].ScopeSpans[0].Spans[0]
+	if got.Name != "idempotency.lookup" {
+		t.Errorf("unexpected span name %s", got.Name)
+	}
+	if got.TraceID != span.Context.TraceID.String() {
+		t.Errorf("unexpected trace ID %s", got.TraceID)
+	}
+	if len(got.Attributes) != 1 || got.Attributes[0].Value["stringValue"] != "abc" {
+		t.Errorf("unexpected attributes %+v", got.Attributes)
+	}
+}
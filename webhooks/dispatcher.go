@@ -0,0 +1,353 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Delivery states.
+const (
+	StatePending   = "pending"   // waiting for its next attempt
+	StateDelivered = "delivered" // the endpoint answered 2xx
+	StateFailed    = "failed"    // gave up after MaxAttempts
+)
+
+// Attempt is one try at delivering an event.
+type Attempt struct {
+	At         time.Time
+	StatusCode int
+	Error      string
+	Duration   time.Duration
+}
+
+// Delivery is one event on its way to one endpoint.
+type Delivery struct {
+	ID            string
+	EventID       string
+	EventType     string
+	EndpointID    string
+	Merchant      string // the event's merchant
+	URL           string
+	State         string
+	Attempts      []Attempt
+	NextAttemptAt time.Time
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+// Config tunes delivery.
+type Config struct {
+	Workers        int           // deliveries in flight at once
+	MaxAttempts    int           // attempts before a delivery is marked failed
+	InitialBackoff time.Duration // wait before the first retry, doubled each time after
+	MaxBackoff     time.Duration // the doubling stops here
+	Timeout        time.Duration // per attempt
+	Retention      time.Duration // how long finished deliveries stay inspectable
+}
+
+type delivery struct {
+	Delivery
+	endpoint Endpoint
+	body     []byte
+}
+
+// Dispatcher delivers events to endpoints in the background, retrying with
+// exponential backoff. Everything is in memory: deliveries still pending
+// at shutdown are logged and dropped.
+type Dispatcher struct {
+	cfg       Config
+	endpoints []Endpoint
+	client    *http.Client
+
+	queue chan *delivery
+	stop  chan struct{}
+	wg    sync.WaitGroup
+
+	mu         sync.Mutex
+	deliveries map[string]*delivery
+	order      []string       // delivery IDs, oldest first
+	published  map[string]int // event IDs already fanned out -> their deliveries still kept
+	timers     map[string]*time.Timer
+	closed     bool
+}
+
+// NewDispatcher starts delivering to endpoints. A nil client uses one with
+// cfg.Timeout, pass your own to add tracing or a proxy.
+func NewDispatcher(endpoints []Endpoint, cfg Config, client *http.Client) *Dispatcher {
+	if cfg.Workers < 1 {
+		cfg.Workers = 1
+	}
+	if cfg.MaxAttempts < 1 {
+		cfg.MaxAttempts = 1
+	}
+	if client == nil {
+		client = &http.Client{}
+	}
+
+	d := &Dispatcher{
+		cfg:        cfg,
+		endpoints:  endpoints,
+		client:     client,
+		queue:      make(chan *delivery),
+		stop:       make(chan struct{}),
+		deliveries: make(map[string]*delivery),
+		published:  make(map[string]int),
+		timers:     make(map[string]*time.Timer),
+	}
+	for i := 0; i < cfg.Workers; i++ {
+		d.wg.Add(1)
+		go d.worker()
+	}
+	return d
+}
+
+// Publish queues e for every endpoint subscribed to its type and merchant. An event ID
+// that's already been published is ignored, so the same event never goes
+// out twice however many times the handler that caused it ran.
+func (d *Dispatcher) Publish(e Event) {
+	body, err := json.Marshal(e)
+	if err != nil {
+		slog.Error("failed to encode webhook event", "error", err, "event_id", e.ID)
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.closed || d.published[e.ID] > 0 {
+		return
+	}
+	d.prune()
+
+	now := time.Now().UTC()
+	for _, endpoint := range d.endpoints {
+		if !endpoint.Receives(e) {
+			continue
+		}
+		dl := &delivery{
+			Delivery: Delivery{
+				// One per event and endpoint, so it's derived rather than random.
+				ID:         "whd_" + EventID(e.ID, endpoint.ID)[len("evt_"):],
+				EventID:    e.ID,
+				EventType:  e.Type,
+				EndpointID: endpoint.ID,
+				Merchant:   e.Merchant,
+				URL:        endpoint.URL,
+				State:      StatePending,
+				CreatedAt:  now,
+				UpdatedAt:  now,
+			},
+			endpoint: endpoint,
+			body:     body,
+		}
+		d.deliveries[dl.ID] = dl
+		d.order = append(d.order, dl.ID)
+		d.schedule(dl, 0)
+		// Counted per delivery: prune forgets an event along with the last
+		// of its deliveries, one with none would be remembered forever.
+		d.published[e.ID]++
+	}
+}
+
+// Get returns a delivery with its attempts so far.
+func (d *Dispatcher) Get(id string) (Delivery, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	dl, ok := d.deliveries[id]
+	if !ok {
+		return Delivery{}, false
+	}
+	return dl.snapshot(), true
+}
+
+// Filter narrows List. Empty fields match everything.
+type Filter struct {
+	EventID    string
+	EndpointID string
+	Merchant   string
+	State      string
+}
+
+// List returns the deliveries matching f, newest first.
+func (d *Dispatcher) List(f Filter) []Delivery {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var out []Delivery
+	for i := len(d.order) - 1; i >= 0; i-- {
+		dl := d.deliveries[d.order[i]]
+		if (f.EventID != "" && dl.EventID != f.EventID) ||
+			(f.EndpointID != "" && dl.EndpointID != f.EndpointID) ||
+			(f.Merchant != "" && dl.Merchant != f.Merchant) ||
+			(f.State != "" && dl.State != f.State) {
+			continue
+		}
+		out = append(out, dl.snapshot())
+	}
+	return out
+}
+
+// Close stops retrying and waits for attempts already in flight, or for
+// ctx to end. Anything still pending is logged so it can be resent by hand.
+func (d *Dispatcher) Close(ctx context.Context) error {
+	d.mu.Lock()
+	if !d.closed {
+		d.closed = true
+		close(d.stop)
+		for id, t := range d.timers {
+			t.Stop()
+			slog.Warn("webhook delivery dropped at shutdown",
+				"delivery_id", id, "event_id", d.deliveries[id].EventID, "endpoint_id", d.deliveries[id].EndpointID)
+		}
+		clear(d.timers)
+	}
+	d.mu.Unlock()
+
+	finished := make(chan struct{})
+	go func() {
+		d.wg.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// schedule hands dl to a worker after delay. Must be called with d.mu held.
+func (d *Dispatcher) schedule(dl *delivery, delay time.Duration) {
+	dl.NextAttemptAt = time.Now().Add(delay).UTC()
+	d.timers[dl.ID] = time.AfterFunc(delay, func() {
+		select {
+		case d.queue <- dl:
+		case <-d.stop:
+		}
+	})
+}
+
+func (d *Dispatcher) worker() {
+	defer d.wg.Done()
+
+	for {
+		select {
+		case dl := <-d.queue:
+			d.attempt(dl)
+		case <-d.stop:
+			return
+		}
+	}
+}
+
+// attempt makes one delivery attempt and decides what happens next.
+func (d *Dispatcher) attempt(dl *delivery) {
+	d.mu.Lock()
+	delete(d.timers, dl.ID)
+	d.mu.Unlock()
+
+	start := time.Now()
+	status, err := d.send(dl, start)
+	a := Attempt{At: start.UTC(), StatusCode: status, Duration: time.Since(start)}
+	if err != nil {
+		a.Error = err.Error()
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	dl.Attempts = append(dl.Attempts, a)
+	dl.UpdatedAt = time.Now().UTC()
+	dl.NextAttemptAt = time.Time{}
+
+	switch {
+	case err == nil && status >= 200 && status < 300:
+		dl.State = StateDelivered
+	case len(dl.Attempts) >= d.cfg.MaxAttempts:
+		dl.State = StateFailed
+		slog.Warn("webhook delivery failed, giving up",
+			"delivery_id", dl.ID, "event_id", dl.EventID, "endpoint_id", dl.EndpointID,
+			"attempts", len(dl.Attempts), "status", status, "error", a.Error)
+	case !d.closed:
+		d.schedule(dl, d.backoff(len(dl.Attempts)))
+	}
+}
+
+// send POSTs the event once. Any response is a result, only transport
+// failures come back as errors.
+func (d *Dispatcher) send(dl *delivery, now time.Time) (int, error) {
+	ctx := context.Background()
+	if d.cfg.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, d.cfg.Timeout)
+		defer cancel()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, dl.URL, bytes.NewReader(dl.body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Idempotency-Key", dl.EventID)
+	req.Header.Set(HeaderID, dl.EventID)
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(now.Unix(), 10))
+	req.Header.Set(HeaderSignature, Sign(dl.endpoint.Secret, dl.EventID, now, dl.body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	// Drain a little so the connection can be reused, the body itself is ignored.
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	return resp.StatusCode, nil
+}
+
+// backoff is the wait after the nth failed attempt: InitialBackoff,
+// doubled each time, capped at MaxBackoff.
+func (d *Dispatcher) backoff(n int) time.Duration {
+	wait := d.cfg.InitialBackoff
+	for i := 1; i < n; i++ {
+		wait *= 2
+		if d.cfg.MaxBackoff > 0 && wait >= d.cfg.MaxBackoff {
+			return d.cfg.MaxBackoff
+		}
+	}
+	return wait
+}
+
+// prune forgets finished deliveries older than Retention, and the events
+// whose deliveries are all gone. Must be called with d.mu held.
+func (d *Dispatcher) prune() {
+	if d.cfg.Retention <= 0 {
+		return
+	}
+	cutoff := time.Now().Add(-d.cfg.Retention)
+	d.order = slices.DeleteFunc(d.order, func(id string) bool {
+		dl := d.deliveries[id]
+		if dl.State == StatePending || dl.UpdatedAt.After(cutoff) {
+			return false
+		}
+		delete(d.deliveries, id)
+		if d.published[dl.EventID]--; d.published[dl.EventID] <= 0 {
+			delete(d.published, dl.EventID)
+		}
+		return true
+	})
+}
+
+func (dl *delivery) snapshot() Delivery {
+	s := dl.Delivery
+	s.Attempts = slices.Clone(dl.Attempts)
+	return s
+}
@@ -0,0 +1,293 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// receiver is an httptest.Server that records what it's sent and answers
+// with whatever status respond returns for the nth call.
+type receiver struct {
+	*httptest.Server
+	mu       sync.Mutex
+	requests []*http.Request
+	bodies   [][]byte
+	calls    atomic.Int32
+}
+
+func newReceiver(t *testing.T, respond func(n int) int) *receiver {
+	t.Helper()
+	rc := &receiver{}
+	rc.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		rc.mu.Lock()
+		rc.requests = append(rc.requests, r)
+		rc.bodies = append(rc.bodies, body)
+		rc.mu.Unlock()
+		w.WriteHeader(respond(int(rc.calls.Add(1))))
+	}))
+	t.Cleanup(rc.Close)
+	return rc
+}
+
+func testDispatcher(t *testing.T, endpoints []Endpoint, maxAttempts int) *Dispatcher {
+	t.Helper()
+	d := NewDispatcher(endpoints, Config{
+		MaxAttempts:    maxAttempts,
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     10 * time.Millisecond,
+		Timeout:        time.Second,
+	}, nil)
+	t.Cleanup(func() { d.Close(context.Background()) })
+	return d
+}
+
+func waitForState(t *testing.T, d *Dispatcher, eventID, state string) Delivery {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if list := d.List(Filter{EventID: eventID}); len(list) == 1 && list[0].State == state {
+			return list[0]
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("delivery of %s never reached %s: %+v", eventID, state, d.List(Filter{EventID: eventID}))
+	return Delivery{}
+}
+
+func testEvent(t *testing.T, key string) Event {
+	t.Helper()
+	e, err := NewEvent(PaymentCaptured, key, map[string]string{"id": "pay_123"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+func TestDispatcher_DeliversSignedEvent(t *testing.T) {
+	rc := newReceiver(t, func(int) int { return http.StatusOK })
+	d := testDispatcher(t, []Endpoint{{ID: "shop", URL: rc.URL, Secret: "whsec_test"}}, 3)
+
+	e := testEvent(t, "key-1")
+	d.Publish(e)
+	delivery := waitForState(t, d, e.ID, StateDelivered)
+
+	if len(delivery.Attempts) != 1 || delivery.Attempts[0].StatusCode != http.StatusOK {
+		t.Errorf("expected one successful attempt, got %+v", delivery.Attempts)
+	}
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	req, body := rc.requests[0], rc.bodies[0]
+	if req.Header.Get("Idempotency-Key") != e.ID || req.Header.Get(HeaderID) != e.ID {
+		t.Errorf("expected the event ID in Idempotency-Key and %s", HeaderID)
+	}
+	err := Verify("whsec_test", req.Header.Get(HeaderID), req.Header.Get(HeaderTimestamp),
+		req.Header.Get(HeaderSignature), body, time.Minute, time.Now())
+	if err != nil {
+		t.Errorf("receiver couldn't verify the delivery: %v", err)
+	}
+
+	var got Event
+	json.Unmarshal(body, &got)
+	if got.ID != e.ID || got.Type != PaymentCaptured || string(got.Data) != `{"id":"pay_123"}` {
+		t.Errorf("unexpected event body: %s", body)
+	}
+}
+
+func TestDispatcher_RetriesUntilSuccess(t *testing.T) {
+	rc := newReceiver(t, func(n int) int {
+		if n < 3 {
+			return http.StatusServiceUnavailable
+		}
+		return http.StatusNoContent
+	})
+	d := testDispatcher(t, []Endpoint{{ID: "shop", URL: rc.URL, Secret: "s"}}, 5)
+
+	e := testEvent(t, "key-2")
+	d.Publish(e)
+	delivery := waitForState(t, d, e.ID, StateDelivered)
+
+	if len(delivery.Attempts) != 3 {
+		t.Fatalf("expected 3 attempts, got %d", len(delivery.Attempts))
+	}
+	if delivery.Attempts[0].StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("expected the first attempt's 503 to be recorded, got %d", delivery.Attempts[0].StatusCode)
+	}
+
+	// Every retry carries the same event ID so the receiver can dedupe.
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	for _, req := range rc.requests {
+		if req.Header.Get("Idempotency-Key") != e.ID {
+			t.Errorf("expected every attempt to carry %s, got %s", e.ID, req.Header.Get("Idempotency-Key"))
+		}
+	}
+}
+
+func TestDispatcher_GivesUpAfterMaxAttempts(t *testing.T) {
+	rc := newReceiver(t, func(int) int { return http.StatusInternalServerError })
+	d := testDispatcher(t, []Endpoint{{ID: "shop", URL: rc.URL, Secret: "s"}}, 3)
+
+	e := testEvent(t, "key-3")
+	d.Publish(e)
+	delivery := waitForState(t, d, e.ID, StateFailed)
+
+	if len(delivery.Attempts) != 3 {
+		t.Errorf("expected 3 attempts, got %d", len(delivery.Attempts))
+	}
+	time.Sleep(20 * time.Millisecond)
+	if n := rc.calls.Load(); n != 3 {
+		t.Errorf("expected no attempts after giving up, receiver saw %d", n)
+	}
+}
+
+func TestDispatcher_RecordsTransportErrors(t *testing.T) {
+	rc := newReceiver(t, func(int) int { return http.StatusOK })
+	url := rc.URL
+	rc.Close()
+	d := testDispatcher(t, []Endpoint{{ID: "gone", URL: url, Secret: "s"}}, 2)
+
+	e := testEvent(t, "key-4")
+	d.Publish(e)
+	delivery := waitForState(t, d, e.ID, StateFailed)
+
+	if delivery.Attempts[0].Error == "" || delivery.Attempts[0].StatusCode != 0 {
+		t.Errorf("expected a connection error recorded, got %+v", delivery.Attempts[0])
+	}
+}
+
+func TestDispatcher_SameEventPublishedTwiceDeliversOnce(t *testing.T) {
+	rc := newReceiver(t, func(int) int { return http.StatusOK })
+	d := testDispatcher(t, []Endpoint{{ID: "shop", URL: rc.URL, Secret: "s"}}, 1)
+
+	e := testEvent(t, "key-5")
+	d.Publish(e)
+	d.Publish(testEvent(t, "key-5"))
+	waitForState(t, d, e.ID, StateDelivered)
+
+	time.Sleep(20 * time.Millisecond)
+	if n := rc.calls.Load(); n != 1 {
+		t.Errorf("expected one delivery, receiver saw %d", n)
+	}
+}
+
+func TestDispatcher_OnlySubscribedEndpoints(t *testing.T) {
+	payments := newReceiver(t, func(int) int { return http.StatusOK })
+	refunds := newReceiver(t, func(int) int { return http.StatusOK })
+	d := testDispatcher(t, []Endpoint{
+		{ID: "payments", URL: payments.URL, Secret: "s", Events: []string{PaymentCaptured}},
+		{ID: "refunds", URL: refunds.URL, Secret: "s", Events: []string{RefundCreated}},
+	}, 1)
+
+	e := testEvent(t, "key-6")
+	d.Publish(e)
+	delivery := waitForState(t, d, e.ID, StateDelivered)
+
+	if delivery.EndpointID != "payments" {
+		t.Errorf("expected delivery to the payments endpoint, got %s", delivery.EndpointID)
+	}
+	if refunds.calls.Load() != 0 {
+		t.Error("expected the refunds endpoint not to be called")
+	}
+}
+
+func TestDispatcher_EventsNoOneReceivesAreNotRemembered(t *testing.T) {
+	refunds := newReceiver(t, func(int) int { return http.StatusOK })
+	d := testDispatcher(t, []Endpoint{
+		{ID: "refunds", URL: refunds.URL, Secret: "s", Events: []string{RefundCreated}},
+	}, 1)
+
+	for i := 0; i < 10; i++ {
+		d.Publish(testEvent(t, fmt.Sprintf("unsubscribed-%d", i)))
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if len(d.published) != 0 || len(d.deliveries) != 0 {
+		t.Errorf("expected nothing kept for events with no subscribers, got %d events and %d deliveries", len(d.published), len(d.deliveries))
+	}
+}
+
+func TestDispatcher_RemembersAnEventUntilAllItsDeliveriesArePruned(t *testing.T) {
+	up := newReceiver(t, func(int) int { return http.StatusOK })
+	down := newReceiver(t, func(int) int { return http.StatusInternalServerError })
+	d := NewDispatcher([]Endpoint{
+		{ID: "up", URL: up.URL, Secret: "s", Events: []string{PaymentCaptured}},
+		{ID: "down", URL: down.URL, Secret: "s", Events: []string{PaymentCaptured}},
+	}, Config{MaxAttempts: 5, InitialBackoff: time.Hour, Timeout: time.Second, Retention: time.Millisecond}, nil)
+	t.Cleanup(func() { d.Close(context.Background()) })
+
+	e := testEvent(t, "key-prune")
+	d.Publish(e)
+	deadline := time.Now().Add(2 * time.Second)
+	for (up.calls.Load() == 0 || down.calls.Load() == 0) && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	// Any publish prunes the delivered one, even one nobody receives. The
+	// other is still pending its retry, so the event mustn't go out again.
+	other, err := NewEvent(RefundCreated, "key-prune-2", map[string]string{"id": "ref_1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.Publish(other)
+	if got := d.List(Filter{EventID: e.ID}); len(got) != 1 || got[0].EndpointID != "down" {
+		t.Fatalf("expected only the pending delivery left, got %v", got)
+	}
+	d.Publish(e)
+	time.Sleep(20 * time.Millisecond)
+	if up.calls.Load() != 1 {
+		t.Errorf("expected the event delivered to up once, got %d", up.calls.Load())
+	}
+}
+
+func TestDispatcher_OnlyTheMerchantsEndpoints(t *testing.T) {
+	acme := newReceiver(t, func(int) int { return http.StatusOK })
+	globex := newReceiver(t, func(int) int { return http.StatusOK })
+	ops := newReceiver(t, func(int) int { return http.StatusOK })
+	d := testDispatcher(t, []Endpoint{
+		{ID: "acme", URL: acme.URL, Secret: "s", Merchant: "acme"},
+		{ID: "globex", URL: globex.URL, Secret: "s", Merchant: "globex"},
+		{ID: "ops", URL: ops.URL, Secret: "s"},
+	}, 1)
+
+	e := testEvent(t, "key-7")
+	e.Merchant = "acme"
+	d.Publish(e)
+	deadline := time.Now().Add(2 * time.Second)
+	for (acme.calls.Load() == 0 || ops.calls.Load() == 0) && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+
+	var endpoints []string
+	for _, dl := range d.List(Filter{EventID: e.ID, Merchant: "acme"}) {
+		endpoints = append(endpoints, dl.EndpointID)
+	}
+	if len(endpoints) != 2 || globex.calls.Load() != 0 {
+		t.Errorf("expected acme's endpoint and the merchant-less one only, got %v", endpoints)
+	}
+	if got := d.List(Filter{Merchant: "globex"}); len(got) != 0 {
+		t.Errorf("expected no deliveries listed for globex, got %d", len(got))
+	}
+}
+
+func TestDispatcher_Backoff(t *testing.T) {
+	d := &Dispatcher{cfg: Config{InitialBackoff: time.Second, MaxBackoff: 5 * time.Second}}
+
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	for i, w := range want {
+		if got := d.backoff(i + 1); got != w {
+			t.Errorf("after attempt %d: expected %s, got %s", i+1, w, got)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package webhooks
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSignAndVerify(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	body := []byte(`{"id":"evt_1"}`)
+	sig := Sign("whsec_test", "evt_1", now, body)
+
+	if err := Verify("whsec_test", "evt_1", "1700000000", sig, body, 5*time.Minute, now); err != nil {
+		t.Fatalf("expected a valid signature, got %v", err)
+	}
+	if err := Verify("whsec_other", "evt_1", "1700000000", sig, body, 5*time.Minute, now); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("wrong secret: expected ErrInvalidSignature, got %v", err)
+	}
+	if err := Verify("whsec_test", "evt_1", "1700000000", sig, []byte(`{"id":"evt_2"}`), 5*time.Minute, now); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("tampered body: expected ErrInvalidSignature, got %v", err)
+	}
+	if err := Verify("whsec_test", "evt_1", "1700000000", sig, body, 5*time.Minute, now.Add(time.Hour)); !errors.Is(err, ErrStaleTimestamp) {
+		t.Errorf("old delivery: expected ErrStaleTimestamp, got %v", err)
+	}
+
+	// During a secret rotation the header carries both signatures.
+	both := Sign("whsec_old", "evt_1", now, body) + " " + sig
+	if err := Verify("whsec_test", "evt_1", "1700000000", both, body, 5*time.Minute, now); err != nil {
+		t.Errorf("expected one of several signatures to match, got %v", err)
+	}
+}
+
+func TestEventID_StablePerTypeAndKey(t *testing.T) {
+	if EventID(PaymentCaptured, "key-1") != EventID(PaymentCaptured, "key-1") {
+		t.Error("expected the same ID for the same type and key")
+	}
+	if EventID(PaymentCaptured, "key-1") == EventID(RefundCreated, "key-1") {
+		t.Error("expected different types to get different IDs")
+	}
+}
+
+func TestEndpoint_Wants(t *testing.T) {
+	all := Endpoint{}
+	refunds := Endpoint{Events: []string{RefundCreated}}
+
+	if !all.Wants(PaymentCaptured) {
+		t.Error("expected an endpoint with no events listed to want everything")
+	}
+	if refunds.Wants(PaymentCaptured) || !refunds.Wants(RefundCreated) {
+		t.Error("expected the endpoint to want only what it listed")
+	}
+}
+
+func TestLoad(t *testing.T) {
+	write := func(content string) string {
+		path := filepath.Join(t.TempDir(), "webhooks.json")
+		os.WriteFile(path, []byte(content), 0o600)
+		return path
+	}
+
+	endpoints, err := Load(write(`[{"id": "shop", "url": "https://shop.example/hooks", "secret": "whsec_1", "events": ["payment.captured"]}]`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(endpoints) != 1 || endpoints[0].ID != "shop" {
+		t.Errorf("unexpected endpoints: %+v", endpoints)
+	}
+
+	if endpoints, err := Load(""); err != nil || endpoints != nil {
+		t.Errorf("expected no endpoints and no error for an empty path, got %v, %v", endpoints, err)
+	}
+
+	for name, content := range map[string]string{
+		"missing secret": `[{"id": "shop", "url": "https://shop.example/hooks"}]`,
+		"relative url":   `[{"id": "shop", "url": "/hooks", "secret": "s"}]`,
+		"duplicate id":   `[{"id": "a", "url": "https://a.example", "secret": "s"}, {"id": "a", "url": "https://b.example", "secret": "s"}]`,
+		"unknown field":  `[{"id": "a", "url": "https://a.example", "secret": "s", "retries": 3}]`,
+	} {
+		if _, err := Load(write(content)); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}